@@ -221,12 +221,16 @@ def _get_whatsapp_cli_path() -> Path:
     )
 
 
-def _run_whatsapp_cli(*args: str, capture: bool = True) -> dict | list | None:
+def _run_whatsapp_cli(
+    *args: str, capture: bool = True, keep_exit_code: bool = False
+) -> dict | list | None:
     """Run the whatsapp-cli binary and return parsed JSON output.
 
     Args:
         *args: Command line arguments to pass to whatsapp-cli
         capture: If True, capture and parse JSON output. If False, let output flow to terminal.
+        keep_exit_code: With capture=False, exit with the binary's exit code when
+            it fails, for commands whose codes mean something
 
     Returns:
         Parsed JSON output, or None if capture=False
@@ -243,6 +247,8 @@ def _run_whatsapp_cli(*args: str, capture: bool = True) -> dict | list | None:
     if not capture:
         # Let output flow directly (for auth command with QR code)
         result = subprocess.run(cmd)
+        if result.returncode != 0 and keep_exit_code:
+            sys.exit(result.returncode)
         if result.returncode != 0:
             raise JeanClaudeError(
                 f"whatsapp-cli failed with exit code {result.returncode}"
@@ -326,13 +332,53 @@ def cli():
 
 
 @cli.command()
-def auth():
+@click.option("--no-open", is_flag=True, help="Don't open the QR code image")
+@click.option(
+    "--qr",
+    metavar="stdout|FILE.png|none",
+    help="Where the QR image goes: base64 PNG on stdout, a file, or nowhere",
+)
+@click.option("--timeout", type=int, help="Give up after this many seconds")
+@click.option("--json", "json_events", is_flag=True, help="Stream events as JSON lines")
+@click.option("--wait", is_flag=True, help="Wait for history sync and report counts")
+@click.option("--phone", help="Link with a pairing code for this number, not a QR code")
+def auth(
+    no_open: bool,
+    qr: str | None,
+    timeout: int | None,
+    json_events: bool,
+    wait: bool,
+    phone: str | None,
+):
     """Authenticate with WhatsApp by scanning QR code.
 
     Opens a QR code image and displays it in the terminal. Scan with
     WhatsApp on your phone: Settings > Linked Devices > Link a Device.
+
+    Exits 2 on timeout, 3 if pairing is cancelled, and 4 if --wait saw no
+    history sync.
+
+    \b
+    Examples:
+        jean-claude whatsapp auth
+        jean-claude whatsapp auth --no-open --qr=none
+        jean-claude whatsapp auth --timeout 300 --json
+        jean-claude whatsapp auth --phone "+12025551234"
     """
-    _run_whatsapp_cli("auth", capture=False)
+    args = ["auth"]
+    if no_open:
+        args.append("--no-open")
+    if qr:
+        args.append(f"--qr={qr}")
+    if timeout:
+        args.append(f"--timeout={timeout}")
+    if json_events:
+        args.append("--json")
+    if wait:
+        args.append("--wait")
+    if phone:
+        args.append(f"--phone={phone}")
+    _run_whatsapp_cli(*args, capture=False, keep_exit_code=True)
 
 
 @cli.command()
@@ -360,12 +406,40 @@ def sync():
 
 
 @cli.command()
-@click.argument("recipient")
+@click.argument("recipient", required=False)
+@click.option(
+    "--to",
+    "more_recipients",
+    multiple=True,
+    help="Another recipient, sent to over the same connection (repeatable)",
+)
 @click.option("--reply-to", help="Message ID to reply to")
-def send(recipient: str, reply_to: str | None):
+@click.option(
+    "--mention",
+    "mentions",
+    multiple=True,
+    help="Phone, ID, or contact name to @mention (repeatable)",
+)
+@click.option("--at", "send_at", help="Queue it for the daemon to send at this time")
+@click.option(
+    "--typing",
+    is_flag=False,
+    flag_value="",
+    metavar="[DURATION]",
+    help="Show 'typing...' first, for DURATION or a time scaled to the length",
+)
+def send(
+    recipient: str | None,
+    more_recipients: tuple[str, ...],
+    reply_to: str | None,
+    mentions: tuple[str, ...],
+    send_at: str | None,
+    typing: str | None,
+):
     """Send a WhatsApp message.
 
-    RECIPIENT: Phone number, ID, or chat name.
+    RECIPIENT: Phone number, ID, or chat name. Give several with --to to send
+    the same message to each, with a result per recipient.
 
     Message body is read from stdin.
 
@@ -378,13 +452,29 @@ def send(recipient: str, reply_to: str | None):
         cat << 'EOF' | jean-claude whatsapp send "+12025551234"
         It's great to hear from you!
         EOF
+
+        echo "@Alice can you check?" | jean-claude whatsapp send "Team" --mention Alice
+        echo "Running late" | jean-claude whatsapp send --to "Alice" --to "+12025551234"
     """
+    recipients = ([recipient] if recipient else []) + list(more_recipients)
+    if not recipients:
+        raise click.UsageError("Give a RECIPIENT or --to")
     body = read_body_stdin()
-    resolved = resolve_recipient(recipient)
+    resolved = [resolve_recipient(r) for r in recipients]
 
-    args = ["send", resolved, body]
+    args = ["send"]
     if reply_to:
-        args.insert(1, f"--reply-to={reply_to}")
+        args.append(f"--reply-to={reply_to}")
+    args.extend(f"--mention={mention}" for mention in mentions)
+    if send_at:
+        args.append(f"--at={send_at}")
+    if typing is not None:
+        args.append(f"--typing={typing}" if typing else "--typing")
+    if len(resolved) > 1:
+        args.extend(f"--to={r}" for r in resolved)
+        args.append(body)
+    else:
+        args += [resolved[0], body]
 
     result = _run_whatsapp_cli(*args)
     if result:
@@ -393,12 +483,25 @@ def send(recipient: str, reply_to: str | None):
 
 @cli.command("send-file")
 @click.argument("recipient")
-@click.argument("file_path", type=click.Path(exists=True))
-def send_file(recipient: str, file_path: str):
+@click.argument("file_path")
+@click.option("--caption", help="Caption for an image, video or document")
+@click.option("--voice", is_flag=True, help="Send audio as a voice note")
+@click.option("--gif", is_flag=True, help="Send a video or .gif as a looping GIF")
+@click.option("--filename", help="File name to send, e.g. for stdin")
+@click.option("--mime", help="MIME type to send, instead of guessing it")
+def send_file(
+    recipient: str,
+    file_path: str,
+    caption: str | None,
+    voice: bool,
+    gif: bool,
+    filename: str | None,
+    mime: str | None,
+):
     """Send a file attachment via WhatsApp.
 
     RECIPIENT: Phone number, ID, or chat name.
-    FILE_PATH: Path to the file to send
+    FILE_PATH: Path to the file to send, - for stdin, or an http(s) URL to fetch
 
     Supports images, videos, audio, and documents.
 
@@ -406,9 +509,26 @@ def send_file(recipient: str, file_path: str):
     Examples:
         jean-claude whatsapp send-file "+12025551234" ./photo.jpg
         jean-claude whatsapp send-file "Dialog Brain Trust" ./document.pdf
+        jean-claude whatsapp send-file "+12025551234" ./memo.m4a --voice
+        jean-claude whatsapp send-file "+12025551234" ./photo.jpg --caption "Us!"
+        curl -s "$URL" | jean-claude whatsapp send-file "Alice" - --filename a.png
     """
+    is_url = file_path.startswith(("http://", "https://"))
+    if file_path != "-" and not is_url and not Path(file_path).exists():
+        raise click.BadParameter(f"{file_path} does not exist", param_hint="FILE_PATH")
     resolved = resolve_recipient(recipient)
-    result = _run_whatsapp_cli("send-file", resolved, file_path)
+    args = ["send-file", resolved, file_path]
+    if caption:
+        args.append(f"--caption={caption}")
+    if voice:
+        args.append("--voice")
+    if gif:
+        args.append("--gif")
+    if filename:
+        args.append(f"--filename={filename}")
+    if mime:
+        args.append(f"--mime={mime}")
+    result = _run_whatsapp_cli(*args)
     if result:
         click.echo(json.dumps(result, indent=2))
 
@@ -416,15 +536,46 @@ def send_file(recipient: str, file_path: str):
 @cli.command()
 @click.option("-n", "--max-results", default=50, help="Maximum chats to return")
 @click.option("--unread", is_flag=True, help="Show only chats with unread messages")
-def chats(max_results: int, unread: bool):
+@click.option("--muted", is_flag=True, help="Show only muted chats")
+@click.option("--unmuted", is_flag=True, help="Show only chats that aren't muted")
+@click.option("--all", "include_left", is_flag=True, help="Include groups you left")
+@click.option("--group-only", is_flag=True, help="Show only group chats")
+@click.option("--dm-only", is_flag=True, help="Show only direct chats")
+@click.option(
+    "--sort",
+    type=click.Choice(["last_message", "unread", "name"]),
+    default="last_message",
+    help="Order of the chats",
+)
+def chats(
+    max_results: int,
+    unread: bool,
+    muted: bool,
+    unmuted: bool,
+    include_left: bool,
+    group_only: bool,
+    dm_only: bool,
+    sort: str,
+):
     """List WhatsApp chats.
 
     Shows recent chats with names (for groups and contacts) and last
     message timestamps. Use --unread to show only chats with unread messages.
+    Use --sort to order by unread count or name instead of the last message.
     """
-    args = ["chats"]
+    args = ["chats", f"--sort={sort}", f"--limit={max_results}"]
     if unread:
         args.append("--unread")
+    if muted:
+        args.append("--muted")
+    if unmuted:
+        args.append("--unmuted")
+    if include_left:
+        args.append("--all")
+    if group_only:
+        args.append("--group-only")
+    if dm_only:
+        args.append("--dm-only")
     result = _run_whatsapp_cli(*args)
     if result and isinstance(result, list):
         # Transform output: rename 'jid' to 'id' for consistency with iMessage
@@ -435,6 +586,8 @@ def chats(max_results: int, unread: bool):
                 "is_group": chat["is_group"],
                 "last_message_time": chat["last_message_time"],
                 "unread_count": chat.get("unread_count", 0),
+                "muted": chat.get("muted", False),
+                "disappearing_timer": chat.get("disappearing_timer"),
             }
             for chat in result[:max_results]
         ]
@@ -446,7 +599,32 @@ def chats(max_results: int, unread: bool):
 @click.option("-n", "--max-results", default=50, help="Maximum messages to return")
 @click.option("--unread", is_flag=True, help="Show only unread messages")
 @click.option("--with-media", is_flag=True, help="Auto-download media files")
-def messages(chat_id: str | None, max_results: int, unread: bool, with_media: bool):
+@click.option("--threads", is_flag=True, help="Tag messages in reply threads")
+@click.option("--mentions-me", is_flag=True, help="Only messages that @mention you")
+@click.option("--starred", is_flag=True, help="Only starred messages")
+@click.option("--since", help="Only messages at or after TIME (RFC 3339, or 24h, 7d)")
+@click.option("--until", help="Only messages before TIME (RFC 3339, or 24h, 7d)")
+@click.option("--media-only", is_flag=True, help="Only messages with media")
+@click.option(
+    "--media-type",
+    type=click.Choice(["image", "video", "audio", "sticker", "document"]),
+    help="Only messages with this type of media",
+)
+@click.option("--output", help="Write to FILE instead (.csv, .md, otherwise JSON)")
+def messages(
+    chat_id: str | None,
+    max_results: int,
+    unread: bool,
+    with_media: bool,
+    threads: bool,
+    mentions_me: bool,
+    starred: bool,
+    since: str | None,
+    until: str | None,
+    media_only: bool,
+    media_type: str | None,
+    output: str | None,
+):
     """List messages from local database.
 
     Shows messages with sender, timestamp, and text content.
@@ -458,13 +636,16 @@ def messages(chat_id: str | None, max_results: int, unread: bool, with_media: bo
     - reply_to: Context when message is a reply (id, sender, text preview)
     - reactions: List of emoji reactions with sender info
     - file: Path to downloaded media (automatic with --unread, or use --with-media)
+    - thread_id, thread_size: The thread a message is in (with --threads)
 
     \b
     Examples:
         jean-claude whatsapp messages -n 20
         jean-claude whatsapp messages --chat "120363277025153496@g.us"
         jean-claude whatsapp messages --unread
+        jean-claude whatsapp messages --since 24h
         jean-claude whatsapp messages --chat "..." --with-media
+        jean-claude whatsapp messages --chat "..." --output chat.csv
     """
     args = ["messages", f"--max-results={max_results}"]
     if chat_id:
@@ -473,16 +654,72 @@ def messages(chat_id: str | None, max_results: int, unread: bool, with_media: bo
         args.append("--unread")
     if with_media:
         args.append("--with-media")
+    if threads:
+        args.append("--threads")
+    if mentions_me:
+        args.append("--mentions-me")
+    if starred:
+        args.append("--starred")
+    if since:
+        args.append(f"--since={since}")
+    if until:
+        args.append(f"--until={until}")
+    if media_only:
+        args.append("--media-only")
+    if media_type:
+        args.append(f"--media-type={media_type}")
+    if output:
+        args.append(f"--output={output}")
+        _run_whatsapp_cli(*args, capture=False)
+        return
 
     result = _run_whatsapp_cli(*args)
     if result:
         click.echo(json.dumps(result, indent=2))
 
 
-@cli.command()
-def contacts():
+@cli.group(invoke_without_command=True)
+@click.pass_context
+def contacts(ctx: click.Context):
     """List WhatsApp contacts from local database."""
-    result = _run_whatsapp_cli("contacts")
+    if ctx.invoked_subcommand is None:
+        result = _run_whatsapp_cli("contacts")
+        if result:
+            click.echo(json.dumps(result, indent=2))
+
+
+@contacts.command("merge")
+@click.argument("canonical_jid", required=False)
+@click.argument("alias_jid", required=False)
+@click.option("--suggest", is_flag=True, help="List likely duplicates, merging none")
+def contacts_merge(canonical_jid: str | None, alias_jid: str | None, suggest: bool):
+    """Merge one person's identities into a canonical JID.
+
+    Rewrites messages, chats and reactions from ALIAS_JID (an old number, or a
+    lid identity) to CANONICAL_JID, and saves later messages from the alias
+    there too.
+
+    \b
+    Examples:
+        jean-claude whatsapp contacts merge --suggest
+        jean-claude whatsapp contacts merge "12025551234@s.whatsapp.net" "123456789@lid"
+    """
+    if suggest:
+        args = ["contacts", "merge", "--suggest"]
+    elif canonical_jid and alias_jid:
+        args = ["contacts", "merge", canonical_jid, alias_jid]
+    else:
+        raise click.UsageError("Give CANONICAL_JID and ALIAS_JID, or --suggest")
+    result = _run_whatsapp_cli(*args)
+    if result:
+        click.echo(json.dumps(result, indent=2))
+
+
+@contacts.command("unmerge")
+@click.argument("alias_jid")
+def contacts_unmerge(alias_jid: str):
+    """Undo a merge, moving ALIAS_JID's rows back."""
+    result = _run_whatsapp_cli("contacts", "unmerge", alias_jid)
     if result:
         click.echo(json.dumps(result, indent=2))
 
@@ -490,7 +727,8 @@ def contacts():
 @cli.command()
 @click.argument("query")
 @click.option("-n", "--max-results", default=50, help="Maximum results to return")
-def search(query: str, max_results: int):
+@click.option("--output", help="Write to FILE instead (.csv, .md, otherwise JSON)")
+def search(query: str, max_results: int, output: str | None):
     """Search message history.
 
     QUERY: Search term (searches message text)
@@ -500,45 +738,67 @@ def search(query: str, max_results: int):
         jean-claude whatsapp search "dinner plans"
         jean-claude whatsapp search "meeting" -n 20
     """
-    result = _run_whatsapp_cli("search", query, f"--max-results={max_results}")
+    args = ["search", query, f"--max-results={max_results}"]
+    if output:
+        args.append(f"--output={output}")
+        _run_whatsapp_cli(*args, capture=False)
+        return
+    result = _run_whatsapp_cli(*args)
     if result:
         click.echo(json.dumps(result, indent=2))
 
 
 @cli.command()
 @click.argument("chat_id")
-def participants(chat_id: str):
+@click.option("--refresh", is_flag=True, help="Ask WhatsApp instead of the local cache")
+def participants(chat_id: str, refresh: bool):
     """List participants of a group chat.
 
     CHAT_ID: The group chat ID (e.g., "120363277025153496@g.us")
 
+    Reads the group cache that sync keeps, so it works offline.
+
     \b
     Examples:
         jean-claude whatsapp participants "120363277025153496@g.us"
     """
-    result = _run_whatsapp_cli("participants", chat_id)
+    args = ["participants", chat_id]
+    if refresh:
+        args.append("--refresh")
+    result = _run_whatsapp_cli(*args)
     if result:
         click.echo(json.dumps(result, indent=2))
 
 
 @cli.command("mark-read")
 @click.argument("chat_ids", nargs=-1, required=True)
-def mark_read(chat_ids: tuple[str, ...]):
+@click.option("--before", help="Only messages before this time")
+@click.option("--up-to", help="Only this message and older ones")
+def mark_read(chat_ids: tuple[str, ...], before: str | None, up_to: str | None):
     """Mark all messages in chats as read.
 
     CHAT_IDS: One or more chat IDs (e.g., "120363277025153496@g.us")
 
+    --before takes Unix seconds, RFC 3339 or 2006-01-02T15:04; with either
+    bound, read receipts go only for the messages it covers.
+
     \b
     Examples:
         jean-claude whatsapp mark-read "120363277025153496@g.us"
         jean-claude whatsapp mark-read "chat1@g.us" "chat2@s.whatsapp.net"
+        jean-claude whatsapp mark-read "120363277025153496@g.us" --up-to MSG_ID
     """
+    bounds = []
+    if before is not None:
+        bounds.append(f"--before={before}")
+    if up_to:
+        bounds.append(f"--up-to={up_to}")
     results = []
     total_messages = 0
     total_receipts = 0
 
     for chat_id in chat_ids:
-        result = _run_whatsapp_cli("mark-read", chat_id)
+        result = _run_whatsapp_cli("mark-read", chat_id, *bounds)
         if result and isinstance(result, dict):
             results.append(result)
             total_messages += result.get("messages_marked", 0)
@@ -555,10 +815,11 @@ def mark_read(chat_ids: tuple[str, ...]):
 
 @cli.command()
 @click.argument("message_id")
+@click.option("--chat", "chat_id", help="Chat of the message, if its ID is in several")
 @click.option(
     "--output", type=click.Path(), help="Output file path (defaults to XDG data dir)"
 )
-def download(message_id: str, output: str | None):
+def download(message_id: str, chat_id: str | None, output: str | None):
     """Download media from a message.
 
     MESSAGE_ID: The message ID
@@ -572,9 +833,291 @@ def download(message_id: str, output: str | None):
         jean-claude whatsapp download "3EB0ABC123..." --output ./photo.jpg
     """
     args = ["download", message_id]
+    if chat_id:
+        args.append(f"--chat={chat_id}")
     if output:
         args.append(f"--output={output}")
 
     result = _run_whatsapp_cli(*args)
     if result:
         click.echo(json.dumps(result, indent=2))
+
+
+
+def _add_passthrough(name: str, summary: str, usage: str) -> None:
+    """Register a command that runs whatsapp-cli NAME with its arguments as given.
+
+    For commands the wrapper has nothing to add to: the binary parses the
+    arguments and prints the JSON (or JSON lines, for streaming commands) itself.
+    """
+
+    @cli.command(
+        name,
+        help=f"{summary}\n\n\b\n{usage}",
+        context_settings={
+            "ignore_unknown_options": True,
+            "allow_interspersed_args": False,
+        },
+    )
+    @click.argument("args", nargs=-1, type=click.UNPROCESSED)
+    def passthrough(args: tuple[str, ...]):
+        _run_whatsapp_cli(name, *args, capture=False)
+
+
+_add_passthrough(
+    "presence",
+    "Set own presence, or follow contacts'.",
+    (
+        "presence set available|unavailable\n"
+        "presence watch JID...\n"
+        "presence log [JID] [--max-results=N]"
+    ),
+)
+_add_passthrough(
+    "config",
+    "Show or change WhatsApp settings.",
+    "config [show | set KEY VALUE | unset KEY]",
+)
+_add_passthrough(
+    "daemon",
+    "Stay connected and save messages as they arrive.",
+    "daemon [--interval=5m]",
+)
+_add_passthrough(
+    "chat-settings",
+    "Show or change per-chat settings.",
+    "chat-settings [CHAT_JID [--read-receipts=on|off]]",
+)
+_add_passthrough(
+    "purge",
+    "Delete old messages and media.",
+    "purge [--messages-older-than=AGE] [--media-older-than=AGE] [--disappeared]",
+)
+_add_passthrough(
+    "du",
+    "Show disk usage by database, media, and chat.",
+    "du [--max-results=N]",
+)
+_add_passthrough(
+    "export-media",
+    "Copy a chat's media into dated folders.",
+    "export-media --chat JID --output DIR [--copy]",
+)
+_add_passthrough(
+    "receipts",
+    "Show delivery and read receipts for a message.",
+    "receipts MESSAGE_ID [--chat=JID]",
+)
+_add_passthrough(
+    "names",
+    "Refresh stored sender names from contacts.",
+    "names backfill [--dry-run]",
+)
+_add_passthrough(
+    "rules",
+    "Show or edit the daemon's notification rules.",
+    (
+        "rules [list]\n"
+        "rules add [--chat=JID] [--sender=JID] --action=notify|silent-log|drop\n"
+        "rules remove N\n"
+        "rules default ACTION\n"
+        "rules watch JID [--last-seen] | rules unwatch JID"
+    ),
+)
+_add_passthrough(
+    "context",
+    "Print a chat as a compact transcript for LLM prompts.",
+    "context --chat JID [--since 7d] [--max-tokens 4000]",
+)
+_add_passthrough(
+    "export",
+    "Export a chat's history.",
+    (
+        "export [--chat] JID [--format json|csv|txt|whatsapp-txt] [--since=TIME]\n"
+        "       [--until=TIME] [--redact] [--output FILE]\n"
+        "export --contact JID [--output FILE.zip]"
+    ),
+)
+_add_passthrough(
+    "undo",
+    "Delete the last message sent for everyone.",
+    "undo [--dry-run]",
+)
+_add_passthrough(
+    "activity",
+    "Show who is typing or recording.",
+    "activity [--chat JID]",
+)
+_add_passthrough(
+    "thread",
+    "Show the whole reply thread around a message.",
+    "thread MESSAGE_ID [--chat=JID]",
+)
+_add_passthrough(
+    "rpc",
+    "Call the running daemon over its JSON-RPC socket.",
+    "rpc METHOD [PARAMS_JSON]",
+)
+_add_passthrough(
+    "watch",
+    "Stream incoming messages as JSON lines.",
+    "watch [--chat JID] [--from JID]",
+)
+_add_passthrough(
+    "backfill",
+    "Fetch older history from the phone.",
+    "backfill [--chat JID] [--count 50]",
+)
+_add_passthrough(
+    "send-contact",
+    "Share a contact card.",
+    "send-contact RECIPIENT --vcf FILE | --name NAME --phone NUMBER",
+)
+_add_passthrough(
+    "send-poll",
+    "Send a poll.",
+    'send-poll RECIPIENT "Question" --option A --option B [--multi]',
+)
+_add_passthrough(
+    "poll-results",
+    "Tally the votes on a poll.",
+    "poll-results MESSAGE_ID [--chat=JID]",
+)
+_add_passthrough(
+    "set-disappearing",
+    "Set a chat's disappearing-message timer.",
+    "set-disappearing CHAT_JID off|24h|7d|90d",
+)
+_add_passthrough(
+    "send-batch",
+    "Send one message per row of a CSV or JSONL file.",
+    "send-batch --input FILE [--template TEXT] [--delay 3s]",
+)
+_add_passthrough(
+    "scheduled",
+    "List or cancel messages queued with send --at.",
+    "scheduled list [--all] | scheduled cancel ID",
+)
+_add_passthrough(
+    "group",
+    "Manage a group.",
+    (
+        "group set-name GROUP_JID NAME\n"
+        "group set-description GROUP_JID TEXT\n"
+        "group set-picture GROUP_JID IMAGE | --remove\n"
+        "group leave GROUP_JID [--yes]\n"
+        "group join|invite-info INVITE_URL\n"
+        "group history GROUP_JID [--max-results=N]\n"
+        "group requests GROUP_JID\n"
+        "group approve|reject GROUP_JID PHONE..."
+    ),
+)
+_add_passthrough(
+    "groups",
+    "List the groups you're in.",
+    "groups",
+)
+_add_passthrough(
+    "mute",
+    "Mute a chat on all devices.",
+    "mute CHAT [--duration=8h|1w|forever]",
+)
+_add_passthrough(
+    "unmute",
+    "Unmute a chat.",
+    "unmute CHAT",
+)
+_add_passthrough(
+    "star",
+    "Star a message on all devices.",
+    "star MESSAGE_ID [--chat=JID]",
+)
+_add_passthrough(
+    "unstar",
+    "Unstar a message.",
+    "unstar MESSAGE_ID [--chat=JID]",
+)
+_add_passthrough(
+    "mark-unread",
+    "Mark a chat as unread on all devices.",
+    "mark-unread CHAT_JID",
+)
+_add_passthrough(
+    "profile",
+    "Change your own profile.",
+    (
+        "profile set-name NAME | profile set-about TEXT\n"
+        "profile set-picture IMAGE | profile remove-picture"
+    ),
+)
+_add_passthrough(
+    "user-info",
+    "Show a contact's about text, devices and business name.",
+    "user-info PHONE [--refresh]",
+)
+_add_passthrough(
+    "check",
+    "Check which numbers are on WhatsApp.",
+    "check PHONE...",
+)
+_add_passthrough(
+    "calls",
+    "List incoming calls seen while connected.",
+    "calls [--missed] [--from=JID] [--max-results=N]",
+)
+_add_passthrough(
+    "alerts",
+    "Show or edit the daemon's keyword alerts.",
+    (
+        "alerts [list]\n"
+        "alerts add REGEX [--chat=JID] [--notify=CMD]\n"
+        "alerts remove N"
+    ),
+)
+_add_passthrough(
+    "message-context",
+    "Show the messages around one message.",
+    "message-context MESSAGE_ID [--chat=JID] [--before=5] [--after=5]",
+)
+_add_passthrough(
+    "links",
+    "List URLs shared in messages, newest first.",
+    "links [--chat=JID] [--since=TIME] [--max-results=N]",
+)
+_add_passthrough(
+    "stats",
+    "Count messages by chat, sender, hour and media type.",
+    "stats [--chat=JID] [--since=TIME] [--max-results=N]",
+)
+_add_passthrough(
+    "digest",
+    "Show unread chats with counts and previews.",
+    "digest [--previews=3] [--unmuted]",
+)
+_add_passthrough(
+    "db",
+    "Maintain the local databases.",
+    "db stats|vacuum|integrity-check",
+)
+_add_passthrough(
+    "download-all",
+    "Download a chat's media not yet on disk.",
+    (
+        "download-all --chat JID [--media-type image|video|audio|sticker|document]\n"
+        "             [--since TIME]"
+    ),
+)
+_add_passthrough(
+    "media",
+    "Inspect and prune downloaded media.",
+    (
+        "media list [--chat=JID] [--max-results=N] [--orphaned]\n"
+        "media stats\n"
+        "media gc [--older-than=AGE] [--max-size=SIZE] [--dry-run]"
+    ),
+)
+_add_passthrough(
+    "mark-all-read",
+    "Mark every chat as read.",
+    "mark-all-read",
+)
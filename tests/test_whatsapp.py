@@ -2,6 +2,7 @@
 
 from __future__ import annotations
 
+import csv
 import json
 import os
 import platform
@@ -9,11 +10,14 @@ import shutil
 import subprocess
 import sys
 import tempfile
+from datetime import datetime
 from pathlib import Path
 
 import pytest
+from click.testing import CliRunner
 
 from jean_claude.logging import JeanClaudeError
+from jean_claude.whatsapp import cli as whatsapp_cli_group
 from jean_claude.whatsapp import find_chat_by_name, resolve_recipient
 from tests.fixtures.whatsapp_cli import SAMPLE_CHATS
 
@@ -248,10 +252,38 @@ class TestPhoneNumberDetection:
             resolve_recipient("123")
 
 
+class TestPassthroughCommands:
+    """Tests for commands handed to whatsapp-cli unchanged."""
+
+    def _invoke(self, monkeypatch, *args: str) -> list[tuple]:
+        calls = []
+        monkeypatch.setattr(
+            "jean_claude.whatsapp._run_whatsapp_cli",
+            lambda *a, **kw: calls.append((a, kw)),
+        )
+        result = CliRunner().invoke(whatsapp_cli_group, list(args))
+        assert result.exit_code == 0, result.output
+        return calls
+
+    def test_arguments_forwarded(self, monkeypatch):
+        """Test that subcommands and arguments reach the binary as given."""
+        calls = self._invoke(monkeypatch, "presence", "set", "unavailable")
+        assert calls == [(("presence", "set", "unavailable"), {"capture": False})]
+
+    def test_unknown_options_forwarded(self, monkeypatch):
+        """Test that options the wrapper doesn't know aren't rejected."""
+        calls = self._invoke(monkeypatch, "daemon", "--interval=1m")
+        assert calls == [(("daemon", "--interval=1m"), {"capture": False})]
+
+
 # =============================================================================
 # Integration Tests - Go CLI with SQLite Database
 # =============================================================================
 
+# Sample chats from tests/fixtures/whatsapp_db.py
+TEAM_JID = "120363277025153496@g.us"
+ALICE_JID = "12025551234@s.whatsapp.net"
+
 
 @pytest.fixture
 def whatsapp_cli(tmp_path):
@@ -336,6 +368,21 @@ class TestWhatsAppCLIChats:
         all_chats = _extract_data(all_output, "chats")
         assert len(chats) < len(all_chats), "Unread filter should return fewer chats"
 
+    def test_chats_sort_limit_and_kind(self, whatsapp_cli, whatsapp_data_dir):
+        """Test --sort=name, --limit and the --group-only/--dm-only filters."""
+        result = whatsapp_cli(
+            "chats", "--sort=name", "--dm-only", data_dir=whatsapp_data_dir
+        )
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+        chats = _extract_data(json.loads(result.stdout), "chats")
+        assert [c["name"] for c in chats] == ["Alice Smith", "Bob Johnson"]
+
+        result = whatsapp_cli(
+            "chats", "--group-only", "--limit=1", data_dir=whatsapp_data_dir
+        )
+        chats = _extract_data(json.loads(result.stdout), "chats")
+        assert [c["jid"] for c in chats] == [TEAM_JID]
+
 
 class TestWhatsAppCLIMessages:
     """Integration tests for 'whatsapp-cli messages' command."""
@@ -407,6 +454,19 @@ class TestWhatsAppCLIMessages:
         assert "emoji" in reaction
         assert "sender_jid" in reaction
 
+    def test_messages_filter_by_media_type(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that --media-only and --media-type keep only media messages."""
+        for flag in ["--media-only", "--media-type=image"]:
+            result = whatsapp_cli("messages", flag, data_dir=whatsapp_data_dir)
+            assert result.returncode == 0, f"CLI failed: {result.stderr}"
+            messages = _extract_data(json.loads(result.stdout), "messages")
+            assert [m["id"] for m in messages] == ["3EB0GHI001"]
+
+        result = whatsapp_cli(
+            "messages", "--media-type=video", data_dir=whatsapp_data_dir
+        )
+        assert _extract_data(json.loads(result.stdout), "messages") == []
+
 
 class TestWhatsAppCLISearch:
     """Integration tests for 'whatsapp-cli search' command."""
@@ -453,3 +513,188 @@ class TestWhatsAppCLIContacts:
         for contact in contacts:
             assert "jid" in contact
             # name and push_name may be null
+
+
+class TestWhatsAppCLISearchSnippets:
+    """Integration tests for search snippets and literal matching."""
+
+    def test_search_returns_snippet_and_offsets(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that matches come with a snippet and rune offsets into it."""
+        result = whatsapp_cli("search", "LUNCH", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        messages = _extract_data(json.loads(result.stdout), "messages")
+        assert [m["id"] for m in messages] == ["3EB0ABC001"]
+        msg = messages[0]
+        assert msg["snippet"] == "Hey, are you free for lunch?"
+        [[start, end]] = msg["match_offsets"]
+        assert msg["snippet"][start:end] == "lunch"
+
+    def test_search_wildcards_match_literally(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that % and _ in a query aren't LIKE wildcards."""
+        for query in ["%", "sound_ good"]:
+            result = whatsapp_cli("search", query, data_dir=whatsapp_data_dir)
+            assert result.returncode == 0, f"CLI failed: {result.stderr}"
+            assert _extract_data(json.loads(result.stdout), "messages") == []
+
+
+class TestWhatsAppCLIThreads:
+    """Integration tests for 'whatsapp-cli thread' and 'message-context'."""
+
+    def test_thread_walks_up_to_root(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that a reply's thread starts at the message it replied to."""
+        result = whatsapp_cli("thread", "3EB0DEF002", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        output = json.loads(result.stdout)
+        assert output["root_id"] == "3EB0DEF001"
+        assert [(m["id"], m["depth"]) for m in output["messages"]] == [
+            ("3EB0DEF001", 0),
+            ("3EB0DEF002", 1),
+        ]
+
+    def test_message_context_marks_target(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that message-context shows the chat around a message."""
+        result = whatsapp_cli(
+            "message-context", "3EB0ABC002", data_dir=whatsapp_data_dir
+        )
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        output = json.loads(result.stdout)
+        assert output["chat_jid"] == ALICE_JID
+        ids = [m["id"] for m in output["messages"]]
+        assert ids == ["3EB0ABC001", "3EB0ABC002", "3EB0ABC003"]
+        targets = [m["id"] for m in output["messages"] if m.get("is_target")]
+        assert targets == ["3EB0ABC002"]
+
+
+class TestWhatsAppCLIMarkRead:
+    """Integration tests for 'whatsapp-cli mark-read' bounds (local only)."""
+
+    def _unread_ids(self, whatsapp_cli, data_dir) -> list[str]:
+        result = whatsapp_cli("messages", f"--chat={TEAM_JID}", data_dir=data_dir)
+        messages = _extract_data(json.loads(result.stdout), "messages")
+        return sorted(m["id"] for m in messages if not m["is_read"])
+
+    def test_mark_read_up_to(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that --up-to leaves later messages unread."""
+        result = whatsapp_cli(
+            "mark-read", TEAM_JID, "--up-to=3EB0DEF001", data_dir=whatsapp_data_dir
+        )
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+        assert json.loads(result.stdout)["messages_marked"] == 1
+        assert self._unread_ids(whatsapp_cli, whatsapp_data_dir) == ["3EB0DEF002"]
+
+    def test_mark_read_before_zero_marks_nothing(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that --before=0 is a bound, not an unset flag."""
+        result = whatsapp_cli(
+            "mark-read", TEAM_JID, "--before=0", data_dir=whatsapp_data_dir
+        )
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+        assert json.loads(result.stdout)["messages_marked"] == 0
+        assert self._unread_ids(whatsapp_cli, whatsapp_data_dir) == [
+            "3EB0DEF001",
+            "3EB0DEF002",
+        ]
+
+    def test_mark_read_up_to_other_chat_fails(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that --up-to rejects a message from another chat."""
+        result = whatsapp_cli(
+            "mark-read", TEAM_JID, "--up-to=3EB0ABC001", data_dir=whatsapp_data_dir
+        )
+        assert result.returncode != 0
+        assert len(self._unread_ids(whatsapp_cli, whatsapp_data_dir)) == 2
+
+
+class TestWhatsAppCLIReports:
+    """Integration tests for reports on the local database."""
+
+    def test_scheduled_list_empty(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that scheduled list is empty with nothing scheduled."""
+        result = whatsapp_cli("scheduled", "list", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+        assert json.loads(result.stdout)["scheduled"] == []
+
+    def test_links_without_urls(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that links returns an empty list when no message has a URL."""
+        result = whatsapp_cli("links", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+        assert _extract_data(json.loads(result.stdout), "links") == []
+
+    def test_stats_counts_messages(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that stats counts messages by chat, sender and type."""
+        result = whatsapp_cli("stats", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        output = json.loads(result.stdout)
+        assert output["messages"] == 6
+        assert output["by_media_type"] == {"image": 1, "text": 5}
+        by_chat = {c["chat_jid"]: c["messages"] for c in output["by_chat"]}
+        assert by_chat[ALICE_JID] == 3
+        assert by_chat[TEAM_JID] == 2
+        assert len(output["by_hour"]) == 24
+
+    def test_digest_lists_unread_chats(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that digest previews unread messages per chat."""
+        result = whatsapp_cli("digest", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        chats = _extract_data(json.loads(result.stdout), "chats")
+        by_jid = {c["jid"]: c for c in chats}
+        assert by_jid[TEAM_JID]["unread_count"] == 2
+        assert [p["id"] for p in by_jid[TEAM_JID]["previews"]] == [
+            "3EB0DEF001",
+            "3EB0DEF002",
+        ]
+
+    def test_db_stats_counts(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that db stats reports row counts and file size."""
+        result = whatsapp_cli("db", "stats", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        output = json.loads(result.stdout)
+        assert output["counts"]["messages"] == 6
+        assert output["counts"]["chats"] == 4
+        assert output["messages"]["bytes"] > 0
+
+    def test_media_stats_without_downloads(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that media stats works before anything is downloaded."""
+        result = whatsapp_cli("media", "stats", data_dir=whatsapp_data_dir)
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+        assert json.loads(result.stdout)["downloaded"]["files"] == 0
+
+
+class TestWhatsAppCLIExport:
+    """Integration tests for 'whatsapp-cli export'."""
+
+    def test_export_csv(self, whatsapp_cli, whatsapp_data_dir, tmp_path):
+        """Test that a CSV export has the fixed columns and one row per message."""
+        out = tmp_path / "alice.csv"
+        result = whatsapp_cli(
+            "export",
+            ALICE_JID,
+            "--format",
+            "csv",
+            "--output",
+            str(out),
+            data_dir=whatsapp_data_dir,
+        )
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        with out.open(newline="") as f:
+            rows = list(csv.DictReader(f))
+        assert list(rows[0])[:3] == ["id", "timestamp", "time"]
+        assert [r["id"] for r in rows] == ["3EB0ABC001", "3EB0ABC002", "3EB0ABC003"]
+        assert json.loads(rows[0]["reactions"]) == [{"emoji": "👍", "sender_jid": "me"}]
+        assert rows[1]["is_from_me"] == "true"
+
+    def test_export_txt(self, whatsapp_cli, whatsapp_data_dir):
+        """Test that a txt export uses WhatsApp's [dd/mm/yyyy, hh:mm] layout."""
+        result = whatsapp_cli(
+            "export", ALICE_JID, "--format", "txt", data_dir=whatsapp_data_dir
+        )
+        assert result.returncode == 0, f"CLI failed: {result.stderr}"
+
+        stamp, line = result.stdout.splitlines()[1].removeprefix("[").split("] ", 1)
+        datetime.strptime(stamp, "%d/%m/%Y, %H:%M")
+        assert line == "Alice Smith: Hey, are you free for lunch?"
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"strings"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// profilePictureSize is the side of the square JPEG WhatsApp stores as a
+// profile picture; larger images are scaled down to it.
+const profilePictureSize = 640
+
+// cmdProfile changes our own WhatsApp profile.
+// Usage: profile set-name <name...> | profile set-about <text...> |
+// profile set-picture <image> | profile remove-picture
+func cmdProfile(args []string) error {
+	usage := fmt.Errorf("usage: profile set-name <name> | set-about <text> | set-picture <image> | remove-picture")
+	if len(args) < 1 {
+		return usage
+	}
+
+	switch args[0] {
+	case "set-name":
+		return cmdProfileSetName(args[1:])
+	case "set-about":
+		return cmdProfileSetAbout(args[1:])
+	case "set-picture":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: profile set-picture <image>")
+		}
+		return setProfilePicture(args[1])
+	case "remove-picture":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: profile remove-picture")
+		}
+		return setProfilePicture("")
+	default:
+		return fmt.Errorf("unknown profile subcommand: %s", args[0])
+	}
+}
+
+// cmdProfileSetName sets our push name, the name contacts without us in their
+// address book see.
+func cmdProfileSetName(args []string) error {
+	name := strings.TrimSpace(strings.Join(args, " "))
+	if name == "" {
+		return fmt.Errorf("usage: profile set-name <name>")
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SendAppState(ctx, appstate.BuildSettingPushName(name)); err != nil {
+		return fmt.Errorf("failed to set name: %w", err)
+	}
+	// The app state resync that would store this runs in the background, and
+	// may not finish before we disconnect
+	client.Store.PushName = name
+	if err := client.Store.Save(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save name locally: %v\n", err)
+	}
+
+	return printJSON(map[string]any{
+		"success": true,
+		"name":    name,
+	})
+}
+
+// cmdProfileSetAbout sets our about text; an empty one clears it.
+func cmdProfileSetAbout(args []string) error {
+	about := strings.Join(args, " ")
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SetStatusMessage(ctx, about); err != nil {
+		return fmt.Errorf("failed to set about: %w", err)
+	}
+
+	return printJSON(map[string]any{
+		"success": true,
+		"about":   about,
+	})
+}
+
+// setProfilePicture sets our profile picture from an image file, or removes
+// it if path is empty.
+func setProfilePicture(path string) error {
+	var avatar []byte
+	if path != "" {
+		var err error
+		if avatar, err = profilePicture(path); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// Without a target JID the picture request applies to our own account
+	pictureID, err := client.SetGroupPhoto(ctx, types.EmptyJID, avatar)
+	if err != nil {
+		return fmt.Errorf("failed to set profile picture: %w", err)
+	}
+
+	output := map[string]any{"success": true}
+	if avatar == nil {
+		output["removed"] = true
+	} else {
+		output["picture_id"] = pictureID
+	}
+	return printJSON(output)
+}
+
+// profilePicture reads a JPEG or PNG and turns it into what WhatsApp expects: a
+// square JPEG (cropped to the center) no larger than profilePictureSize.
+func profilePicture(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a JPEG or PNG image: %w", path, err)
+	}
+
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+	out := scaleSquare(img, crop, min(side, profilePictureSize))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleSquare scales the square src region of img to size x size, averaging
+// the source pixels that fall in each output pixel.
+func scaleSquare(img image.Image, src image.Rectangle, size int) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, size, size))
+	side := src.Dx()
+	for y := 0; y < size; y++ {
+		y0, y1 := src.Min.Y+y*side/size, src.Min.Y+(y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := src.Min.X+x*side/size, src.Min.X+(x+1)*side/size
+			var r, g, b, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			i := out.PixOffset(x, y)
+			out.Pix[i] = uint8(r / n >> 8)
+			out.Pix[i+1] = uint8(g / n >> 8)
+			out.Pix[i+2] = uint8(b / n >> 8)
+			out.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// activityTTL is how long a typing or recording state counts as current.
+// WhatsApp repeats composing while the user types and usually sends paused
+// when they stop, but the paused can be lost, so old states expire.
+const activityTTL = 30 * time.Second
+
+// activityHandler records ChatPresence (typing/recording) events. Groups only
+// send these while we're online, so pair the daemon with announce_presence.
+func activityHandler(evt interface{}) {
+	v, ok := evt.(*events.ChatPresence)
+	if !ok || v.IsFromMe {
+		return
+	}
+	chatJID := canonicalJID(normalizeJID(v.Chat.String()))
+	if !chatSynced(chatJID) {
+		return
+	}
+	senderJID := canonicalJID(normalizeJID(v.Sender.String()))
+
+	state := "paused"
+	if v.State == types.ChatPresenceComposing {
+		state = "typing"
+		if v.Media == types.ChatPresenceMediaAudio {
+			state = "recording"
+		}
+	}
+	if _, err := messageDB.Exec(`
+		INSERT INTO chat_activity (chat_jid, sender_jid, state, timestamp) VALUES (?, ?, ?, ?)
+		ON CONFLICT(chat_jid, sender_jid) DO UPDATE SET state = excluded.state, timestamp = excluded.timestamp
+	`, chatJID, senderJID, state, time.Now().Unix()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save chat activity: %v\n", err)
+	}
+}
+
+// cmdActivity shows the latest typing/recording state of each participant,
+// newest first; active marks who is typing or recording right now.
+// Usage: activity [--chat <jid>]
+func cmdActivity(args []string) error {
+	var chatJID string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--chat="):
+			chatJID = strings.TrimPrefix(args[i], "--chat=")
+		case args[i] == "--chat" && i+1 < len(args):
+			chatJID = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT a.chat_jid, a.sender_jid, COALESCE(NULLIF(ct.name, ''), ct.push_name), a.state, a.timestamp
+		FROM chat_activity a
+		LEFT JOIN contacts ct ON ct.jid = a.sender_jid`
+	var queryArgs []any
+	if chatJID != "" {
+		chatJID = canonicalJID(normalizeJID(chatJID))
+		query += ` WHERE a.chat_jid = ?`
+		queryArgs = append(queryArgs, chatJID)
+	}
+	query += ` ORDER BY a.timestamp DESC`
+
+	rows, err := messageDB.Query(query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to query activity: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	cutoff := time.Now().Add(-activityTTL).Unix()
+	activity := []map[string]any{}
+	active := 0
+	for rows.Next() {
+		var chat, sender, state string
+		var name sql.NullString
+		var timestamp int64
+		if err := rows.Scan(&chat, &sender, &name, &state, &timestamp); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry := map[string]any{
+			"chat_jid":   chat,
+			"sender_jid": sender,
+			"state":      state,
+			"timestamp":  timestamp,
+			"active":     state != "paused" && timestamp >= cutoff,
+		}
+		if entry["active"] == true {
+			active++
+		}
+		if name.Valid && name.String != "" {
+			entry["sender_name"] = name.String
+		}
+		activity = append(activity, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	output := map[string]any{
+		"active":   active,
+		"activity": activity,
+	}
+	if chatJID != "" {
+		output["chat_jid"] = chatJID
+	}
+	return printJSON(output)
+}
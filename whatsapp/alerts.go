@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AlertRule fires when an incoming message's text matches Pattern, optionally
+// only in Chat. Alerts apply whatever the notification rules say about the
+// chat, so a silenced group can still alert on a keyword. Notify, if set, is
+// a shell command run with the alert's JSON on stdin.
+type AlertRule struct {
+	Pattern string `json:"pattern"`
+	Chat    string `json:"chat,omitempty"`
+	Notify  string `json:"notify,omitempty"`
+}
+
+// compiledAlert is an AlertRule with its pattern compiled.
+type compiledAlert struct {
+	AlertRule
+	re *regexp.Regexp
+}
+
+// compileAlerts compiles the alert patterns. loadRules has already checked
+// that they compile.
+func compileAlerts(alerts []AlertRule) []compiledAlert {
+	compiled := make([]compiledAlert, 0, len(alerts))
+	for _, a := range alerts {
+		re, err := regexp.Compile(a.Pattern)
+		if err != nil {
+			continue
+		}
+		compiled = append(compiled, compiledAlert{AlertRule: a, re: re})
+	}
+	return compiled
+}
+
+// matchAlerts returns the alerts a message notification triggers.
+func matchAlerts(alerts []compiledAlert, n Notification) []compiledAlert {
+	var matched []compiledAlert
+	for _, a := range alerts {
+		if a.Chat != "" && !chatListed([]string{a.Chat}, n.ChatJID) {
+			continue
+		}
+		if n.Text != "" && a.re.MatchString(n.Text) {
+			matched = append(matched, a)
+		}
+	}
+	return matched
+}
+
+// fireAlert sends a matched message to the notifiers as an alert event and
+// runs the alert's own command, if any.
+func fireAlert(a compiledAlert, n Notification) {
+	n.Event = eventAlert
+	n.Alert = a.Pattern
+	fmt.Fprintf(os.Stderr, "[%s %s] %s\n", eventAlert, a.Pattern, notificationSummary(n))
+	fireNotifiers(n)
+	if a.Notify != "" {
+		runHook(a.Notify, n)
+	}
+}
+
+// cmdAlerts lists or edits keyword alerts, stored in rules.json.
+// Usage: alerts [list | add <regex> [--chat=JID] [--notify=CMD] | remove <n>]
+func cmdAlerts(args []string) error {
+	rules, err := loadRules()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		alerts := rules.Alerts
+		if alerts == nil {
+			alerts = []AlertRule{}
+		}
+		return printJSON(alerts)
+	}
+
+	switch args[0] {
+	case "add":
+		usage := fmt.Errorf("usage: alerts add <regex> [--chat=JID] [--notify=CMD]")
+		var alert AlertRule
+		rest := args[1:]
+		for i := 0; i < len(rest); i++ {
+			name, value, hasValue := strings.Cut(rest[i], "=")
+			switch {
+			case name == "--chat" || name == "--notify":
+				if !hasValue {
+					if i+1 >= len(rest) {
+						return usage
+					}
+					value = rest[i+1]
+					i++
+				}
+				if name == "--chat" {
+					alert.Chat = value
+				} else {
+					alert.Notify = value
+				}
+			case alert.Pattern == "" && !strings.HasPrefix(rest[i], "--"):
+				alert.Pattern = rest[i]
+			default:
+				return usage
+			}
+		}
+		if alert.Pattern == "" {
+			return usage
+		}
+		if _, err := regexp.Compile(alert.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		if alert.Chat != "" {
+			if _, err := parseJID(alert.Chat); err != nil {
+				return fmt.Errorf("invalid chat %q: %w", alert.Chat, err)
+			}
+		}
+		rules.Alerts = append(rules.Alerts, alert)
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: alerts remove <n> (1-based, as listed)")
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > len(rules.Alerts) {
+			return fmt.Errorf("no alert %s (have %d)", args[1], len(rules.Alerts))
+		}
+		rules.Alerts = append(rules.Alerts[:n-1], rules.Alerts[n:]...)
+	default:
+		return fmt.Errorf("unknown alerts subcommand: %s", args[0])
+	}
+
+	if err := saveRules(rules); err != nil {
+		return err
+	}
+	return printJSON(rules.Alerts)
+}
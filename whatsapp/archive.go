@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// zipArchive writes a zip next to its final path and renames it into place on
+// commit, so an interrupted export never leaves a truncated archive.
+type zipArchive struct {
+	path string
+	tmp  *os.File
+	zw   *zip.Writer
+	now  time.Time
+}
+
+func createZipArchive(path string) (*zipArchive, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	return &zipArchive{path: path, tmp: tmp, zw: zip.NewWriter(tmp), now: time.Now()}, nil
+}
+
+func (a *zipArchive) create(name string, modified time.Time) (io.Writer, error) {
+	return a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+}
+
+// addJSON writes v as indented JSON.
+func (a *zipArchive) addJSON(name string, v any) error {
+	w, err := a.create(name, a.now)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// addBytes writes data as is.
+func (a *zipArchive) addBytes(name string, data []byte) error {
+	w, err := a.create(name, a.now)
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// addFile copies the file at src, keeping its modification time. It reports
+// false, without error, if src doesn't exist.
+func (a *zipArchive) addFile(name, src string) (bool, error) {
+	f, err := os.Open(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to archive %s: %w", src, err)
+	}
+	defer func() { _ = f.Close() }()
+	modified := a.now
+	if info, err := f.Stat(); err == nil {
+		modified = info.ModTime()
+	}
+	w, err := a.create(name, modified)
+	if err == nil {
+		_, err = io.Copy(w, f)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to archive %s: %w", src, err)
+	}
+	return true, nil
+}
+
+// commit finishes the archive and moves it into place. Archives hold private
+// data, so unlike other output files they're only readable by the owner.
+func (a *zipArchive) commit() error {
+	defer func() { _ = os.Remove(a.tmp.Name()) }() // No-op after a successful rename
+	if err := a.zw.Close(); err != nil {
+		_ = a.tmp.Close()
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := a.tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Rename(a.tmp.Name(), a.path); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// abort discards the archive.
+func (a *zipArchive) abort() {
+	_ = a.tmp.Close()
+	_ = os.Remove(a.tmp.Name())
+}
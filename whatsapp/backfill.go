@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	// defaultBackfillCount is how many messages are requested per chat; it's
+	// what whatsmeow recommends per request.
+	defaultBackfillCount = 50
+	// backfillTimeout is how long to wait for the phone to answer a request.
+	backfillTimeout = 30 * time.Second
+)
+
+// cmdBackfill asks the phone for messages older than the oldest one stored for
+// a chat (or every chat), and saves them through the history sync handler.
+// Running it again reaches further back. The phone must be online.
+// Usage: backfill [--chat JID] [--count N]
+func cmdBackfill(args []string) error {
+	var chatFilter string
+	count := defaultBackfillCount
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("usage: backfill [--chat JID] [--count N]")
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--chat":
+			chatFilter = value
+		case "--count":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--count must be a positive number")
+			}
+			count = n
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	var chats []string
+	if chatFilter != "" {
+		chats = []string{canonicalJID(normalizeJID(chatFilter))}
+	} else {
+		var err error
+		if chats, err = backfillChats(); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	if err := initClient(ctx); err != nil {
+		return err
+	}
+	if client.Store.ID == nil {
+		return fmt.Errorf("not authenticated. Run 'auth' first")
+	}
+
+	var messageCount atomic.Int64
+	answered := make(chan string, 16)
+	client.AddEventHandler(syncEventHandler(ctx, &messageCount))
+	client.AddEventHandler(func(evt interface{}) {
+		v, ok := evt.(*events.HistorySync)
+		if !ok || v.Data.GetSyncType() != waHistorySync.HistorySync_ON_DEMAND {
+			return
+		}
+		for _, conv := range v.Data.Conversations {
+			select {
+			case answered <- canonicalJID(normalizeJID(conv.GetID())):
+			default:
+			}
+		}
+	})
+
+	if err := connectInitialized(); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	results := []map[string]any{}
+	for _, chatJID := range chats {
+		result := map[string]any{"chat_jid": chatJID}
+		results = append(results, result)
+
+		anchor, err := oldestMessage(chatJID)
+		if errors.Is(err, sql.ErrNoRows) {
+			result["status"] = "no_messages"
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		before := messageCount.Load()
+		req := client.BuildHistorySyncRequest(anchor, count)
+		if _, err := client.SendMessage(ctx, client.Store.ID.ToNonAD(), req, whatsmeow.SendRequestExtra{Peer: true}); err != nil {
+			return fmt.Errorf("failed to request history for %s: %w", chatJID, err)
+		}
+		fmt.Fprintf(os.Stderr, "Requested %d messages before %s in %s...\n",
+			count, anchor.Timestamp.Format("2006-01-02"), chatJID)
+
+		result["status"] = waitForBackfill(answered, chatJID)
+		result["messages_saved"] = messageCount.Load() - before
+	}
+
+	return printJSON(map[string]any{
+		"success":        true,
+		"chats":          results,
+		"messages_saved": messageCount.Load(),
+	})
+}
+
+// waitForBackfill waits for the phone's answer for chatJID and returns the
+// status to report: "ok" or "timeout".
+func waitForBackfill(answered <-chan string, chatJID string) string {
+	timeout := time.After(backfillTimeout)
+	for {
+		select {
+		case jid := <-answered:
+			if jid == chatJID {
+				return "ok"
+			}
+		case <-timeout:
+			fmt.Fprintf(os.Stderr, "Warning: no history for %s after %s (is the phone online?)\n", chatJID, backfillTimeout)
+			return "timeout"
+		}
+	}
+}
+
+// backfillChats lists the chats sync saves, most recent first.
+func backfillChats() ([]string, error) {
+	rows, err := messageDB.Query(`SELECT jid FROM chats ORDER BY last_message_time DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chats: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var chats []string
+	for rows.Next() {
+		var jid string
+		if err := rows.Scan(&jid); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if chatSynced(jid) {
+			chats = append(chats, jid)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return chats, nil
+}
+
+// oldestMessage returns the oldest stored message in a chat, the anchor for a
+// history request. Returns sql.ErrNoRows if the chat has none.
+func oldestMessage(chatJID string) (*types.MessageInfo, error) {
+	var id string
+	var isFromMe int
+	var timestamp int64
+	err := messageDB.QueryRow(`
+		SELECT id, is_from_me, timestamp FROM messages
+		WHERE chat_jid = ?
+		ORDER BY timestamp ASC, rowid ASC
+		LIMIT 1
+	`, chatJID).Scan(&id, &isFromMe, &timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find oldest message: %w", err)
+	}
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chat JID %s: %w", chatJID, err)
+	}
+	return &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, IsFromMe: isFromMe == 1},
+		ID:            id,
+		Timestamp:     time.Unix(timestamp, 0),
+	}, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dailyBackupInterval is how old the newest backup gets before the daemon
+// makes another.
+const dailyBackupInterval = 24 * time.Hour
+
+// backupDir returns where backups of messages.db go: backup_dir, or
+// dataDir/backups.
+func backupDir() string {
+	if cfg.BackupDir != "" {
+		return expandHome(cfg.BackupDir)
+	}
+	return filepath.Join(dataDir, "backups")
+}
+
+// backupBeforeMigration backs up messages.db before migrateMessageDB changes
+// it, whatever backups is set to, since a failed migration is what backups are
+// most needed for. A new, empty database isn't backed up.
+func backupBeforeMigration() error {
+	var tables int
+	if err := messageDB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages'`).Scan(&tables); err != nil {
+		return fmt.Errorf("failed to inspect message database: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+	path, err := backupMessageDB("pre-migration")
+	if err != nil {
+		// Not migrating without the backup is the point of taking it
+		return fmt.Errorf("failed to back up before migrating: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Backed up messages database to %s before migrating\n", path)
+	return nil
+}
+
+// dailyBackup backs up messages.db if backups are on and the newest backup is
+// more than a day old. The daemon calls it every tick.
+func dailyBackup() {
+	if cfg.Backups <= 0 {
+		return
+	}
+	backups, err := listBackups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	if len(backups) > 0 {
+		if info, err := os.Stat(backups[len(backups)-1]); err == nil && time.Since(info.ModTime()) < dailyBackupInterval {
+			return
+		}
+	}
+	path, err := backupMessageDB("daily")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: daily backup failed: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Backed up messages database to %s\n", path)
+}
+
+// backupMessageDB writes a consistent copy of messages.db to the backup
+// directory with VACUUM INTO, then deletes all but the newest cfg.Backups
+// copies (at least one). reason becomes part of the file name.
+func backupMessageDB(reason string) (string, error) {
+	dir := backupDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("messages-%s-%s.db", time.Now().Format("20060102-150405"), reason))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil // Already taken this second
+	}
+	if _, err := messageDB.Exec(`VACUUM INTO ?`, path); err != nil {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	_ = os.Chmod(path, 0600)
+
+	backups, err := listBackups()
+	if err != nil {
+		return path, err
+	}
+	for len(backups) > max(cfg.Backups, 1) {
+		if err := os.Remove(backups[0]); err != nil {
+			return path, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+// listBackups returns the backups in the backup directory, oldest first. Their
+// names start with the time they were taken, so they sort by age.
+func listBackups() ([]string, error) {
+	entries, err := os.ReadDir(backupDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var backups []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasPrefix(name, "messages-") && strings.HasSuffix(name, ".db") {
+			backups = append(backups, filepath.Join(backupDir(), name))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
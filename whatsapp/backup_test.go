@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBackupMessageDBRotates(t *testing.T) {
+	openTestDB(t)
+	oldCfg := cfg
+	t.Cleanup(func() { cfg = oldCfg })
+	cfg.Backups = 2
+
+	// Older backups, and a file that isn't one
+	dir := backupDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"messages-20200101-000000-daily.db", "messages-20200102-000000-daily.db", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, err := backupMessageDB("daily")
+	if err != nil {
+		t.Fatalf("backupMessageDB: %v", err)
+	}
+	backups, err := listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "messages-20200102-000000-daily.db"), path}
+	if !slices.Equal(backups, want) {
+		t.Errorf("backups = %q, want %q", backups, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("rotation removed a file that isn't a backup: %v", err)
+	}
+
+	// Whatever backups is set to, the newest is kept
+	cfg.Backups = 0
+	if _, err := backupMessageDB("pre-migration"); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := listBackups(); len(backups) != 1 {
+		t.Errorf("with backups = 0, kept %q, want one", backups)
+	}
+}
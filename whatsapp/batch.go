@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// defaultBatchDelay spaces out batch sends so they don't look like a burst.
+const defaultBatchDelay = 3 * time.Second
+
+// templateField matches a {{column}} placeholder in a batch message.
+var templateField = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// cmdSendBatch sends one message per row of a CSV (with a header row) or JSONL
+// file over a single connection. Rows need a recipient column and a message
+// column, or --template; {{column}} in either is replaced by the row's value.
+// Usage: send-batch --input FILE [--template TEXT] [--delay 3s]
+func cmdSendBatch(args []string) error {
+	usage := fmt.Errorf("usage: send-batch --input FILE [--template TEXT] [--delay 3s]")
+	var inputPath, template string
+	delay := defaultBatchDelay
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return usage
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--input":
+			inputPath = value
+		case "--template":
+			template = value
+		case "--delay":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return fmt.Errorf("--delay must be a duration like 3s")
+			}
+			delay = d
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+	}
+	if inputPath == "" {
+		return usage
+	}
+
+	rows, err := readBatchRows(inputPath)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no rows in %s", inputPath)
+	}
+
+	ctx := context.Background()
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	results := make([]map[string]any, 0, len(rows))
+	sent, failed := 0, 0
+	for i, row := range rows {
+		if i > 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		result := map[string]any{"row": i + 1, "recipient": row["recipient"]}
+		results = append(results, result)
+		id, err := sendBatchRow(ctx, row, template)
+		if err != nil {
+			failed++
+			result["success"] = false
+			result["error"] = err.Error()
+			fmt.Fprintf(os.Stderr, "Row %d: %v\n", i+1, err)
+			continue
+		}
+		sent++
+		result["success"] = true
+		result["id"] = id
+	}
+
+	return printJSON(map[string]any{
+		"success": failed == 0,
+		"sent":    sent,
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+// sendBatchRow sends one row's message, returning the sent message's ID.
+func sendBatchRow(ctx context.Context, row map[string]string, template string) (string, error) {
+	recipient := row["recipient"]
+	if recipient == "" {
+		return "", fmt.Errorf("no recipient")
+	}
+	text, ok := row["message"]
+	if !ok || text == "" {
+		text = template
+	}
+	if text == "" {
+		return "", fmt.Errorf("no message (add a message column or --template)")
+	}
+	text, err := fillTemplate(text, row)
+	if err != nil {
+		return "", err
+	}
+
+	jid, err := parseJID(recipient)
+	if err != nil {
+		return "", err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return "", err
+	}
+	msg, _, err := buildTextMessage(jid, text, "", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.SendMessage(ctx, jid, withDisappearingTimer(ctx, jid, msg))
+	if err != nil {
+		return "", fmt.Errorf("failed to send message: %w", err)
+	}
+	recordSent("send-batch", jid.String(), resp)
+	return resp.ID, nil
+}
+
+// fillTemplate replaces each {{column}} in text with the row's value.
+func fillTemplate(text string, row map[string]string) (string, error) {
+	var missing string
+	filled := templateField.ReplaceAllStringFunc(text, func(m string) string {
+		field := templateField.FindStringSubmatch(m)[1]
+		value, ok := row[field]
+		if !ok && missing == "" {
+			missing = field
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("template field {{%s}} isn't a column", missing)
+	}
+	return filled, nil
+}
+
+// readBatchRows reads send-batch input: JSON lines for .jsonl/.ndjson files,
+// CSV with a header row otherwise. "to" and "phone" columns count as the
+// recipient.
+func readBatchRows(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var rows []map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			// Numbers keep their digits: a phone number as a float64 would
+			// print as 4.47700900123e+11
+			dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			dec.UseNumber()
+			var obj map[string]any
+			if err := dec.Decode(&obj); err != nil {
+				return nil, fmt.Errorf("invalid JSON on line %d: %w", line, err)
+			}
+			row := make(map[string]string, len(obj))
+			for k, v := range obj {
+				switch v := v.(type) {
+				case string:
+					row[k] = v
+				case json.Number:
+					row[k] = v.String()
+				case nil:
+					// Left unset, like a missing column
+				default:
+					row[k] = fmt.Sprint(v)
+				}
+			}
+			rows = append(rows, row)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+	default:
+		r := csv.NewReader(f)
+		r.TrimLeadingSpace = true
+		header, err := r.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		for i := range header {
+			header[i] = strings.TrimSpace(header[i])
+		}
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CSV: %w", err)
+			}
+			row := make(map[string]string, len(header))
+			for i, column := range header {
+				if i < len(record) {
+					row[column] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	for _, row := range rows {
+		if row["recipient"] == "" {
+			for _, alias := range []string{"to", "phone"} {
+				if row[alias] != "" {
+					row["recipient"] = row[alias]
+					break
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// sendToMany sends one message to each recipient over a single connection,
+// printing a result per recipient like send-batch. The first numbers
+// recipients are phone numbers or JIDs; the rest are contact names. A
+// recipient that can't be resolved or sent to fails alone.
+func sendToMany(recipients []string, numbers int, message string, mentions []string, typing bool, typingFor time.Duration) error {
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	var mentioned []string
+	if len(mentions) > 0 {
+		var err error
+		if message, mentioned, err = resolveMentions(message, mentions); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if typing && typingFor == 0 {
+		typingFor = typingDelay(message)
+	}
+	results := make([]map[string]any, 0, len(recipients))
+	sent, failed := 0, 0
+	for i, recipient := range recipients {
+		result := map[string]any{"recipient": recipient}
+		results = append(results, result)
+		jid, id, err := sendToOne(ctx, recipient, i >= numbers, message, mentioned, typing, typingFor)
+		if !jid.IsEmpty() {
+			result["recipient"] = jid.String()
+		}
+		if err != nil {
+			failed++
+			result["success"] = false
+			result["error"] = err.Error()
+			fmt.Fprintf(os.Stderr, "%s: %v\n", recipient, err)
+			continue
+		}
+		sent++
+		result["success"] = true
+		result["id"] = id
+	}
+
+	output := map[string]any{
+		"success": failed == 0,
+		"sent":    sent,
+		"failed":  failed,
+		"results": results,
+	}
+	if len(mentioned) > 0 {
+		output["mentions"] = mentioned
+	}
+	return printJSON(output)
+}
+
+// sendToOne resolves one of sendToMany's recipients and sends it the message.
+func sendToOne(ctx context.Context, recipient string, byName bool, message string, mentioned []string, typing bool, typingFor time.Duration) (types.JID, string, error) {
+	phone := recipient
+	if byName {
+		var err error
+		if phone, err = lookupContactByName(recipient); err != nil {
+			return types.JID{}, "", err
+		}
+	}
+	jid, err := parseJID(phone)
+	if err != nil {
+		return types.JID{}, "", err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return jid, "", err
+	}
+	msg, _, err := buildTextMessage(jid, message, "", mentioned)
+	if err != nil {
+		return jid, "", err
+	}
+	if typing {
+		showTyping(ctx, jid, typingFor)
+	}
+	resp, err := client.SendMessage(ctx, jid, withDisappearingTimer(ctx, jid, msg))
+	if err != nil {
+		return jid, "", fmt.Errorf("failed to send message: %w", err)
+	}
+	recordSent("send", jid.String(), resp)
+	return jid, resp.ID, nil
+}
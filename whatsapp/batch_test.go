@@ -0,0 +1,63 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBatchRows(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		want                []map[string]string
+	}{
+		{
+			"csv", "batch.csv",
+			"recipient, name\n447700900123,Ann\n",
+			[]map[string]string{{"recipient": "447700900123", "name": "Ann"}},
+		},
+		{
+			"csv aliases", "batch.csv",
+			"phone,name\n447700900123,Ann\n",
+			[]map[string]string{{"phone": "447700900123", "recipient": "447700900123", "name": "Ann"}},
+		},
+		{
+			// Numbers keep their digits rather than printing as floats
+			"jsonl", "batch.jsonl",
+			"{\"to\": 447700900123, \"name\": \"Ann\", \"count\": 2.5, \"vip\": true, \"note\": null}\n\n{\"recipient\": \"Bob\"}\n",
+			[]map[string]string{
+				{"to": "447700900123", "recipient": "447700900123", "name": "Ann", "count": "2.5", "vip": "true"},
+				{"recipient": "Bob"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readBatchRows(path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d rows, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if !maps.Equal(got[i], tt.want[i]) {
+				t.Errorf("%s: row %d = %v, want %v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.jsonl")
+	if err := os.WriteFile(path, []byte("{\"to\": \"Ann\"}\nnot json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBatchRows(path); err == nil {
+		t.Error("readBatchRows accepted invalid JSON")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Call statuses stored in calls.status. A call is ringing until it's accepted
+// or ends; one that ends without being accepted was missed.
+const (
+	callRinging  = "ringing"
+	callAccepted = "accepted"
+	callRejected = "rejected"
+	callMissed   = "missed"
+	callEnded    = "ended"
+)
+
+// saveCallEvent records an incoming call and follows it through being
+// accepted, rejected, or terminated. WhatsApp only delivers call events to
+// connected clients, so calls are logged while sync, watch or the daemon runs.
+func saveCallEvent(evt interface{}) error {
+	switch v := evt.(type) {
+	case *events.CallOffer:
+		return insertCall(v.BasicCallMeta, offerMedia(v))
+	case *events.CallOfferNotice:
+		return insertCall(v.BasicCallMeta, v.Media)
+	case *events.CallAccept:
+		return updateCall(v.BasicCallMeta, `status = ?, accepted_at = ?`, callAccepted, v.Timestamp.Unix())
+	case *events.CallReject:
+		return updateCall(v.BasicCallMeta, `status = CASE WHEN status = 'ringing' THEN ? ELSE status END, ended_at = ?`,
+			callRejected, v.Timestamp.Unix())
+	case *events.CallTerminate:
+		return updateCall(v.BasicCallMeta, `
+			status = CASE status WHEN 'ringing' THEN ? WHEN 'accepted' THEN ? ELSE status END,
+			ended_at = COALESCE(ended_at, ?), reason = ?`,
+			callMissed, callEnded, v.Timestamp.Unix(), v.Reason)
+	}
+	return nil
+}
+
+// offerMedia is "video" for a video call offer, otherwise "audio".
+func offerMedia(offer *events.CallOffer) string {
+	if offer.Data != nil && offer.Data.GetChildByTag("video").Tag == "video" {
+		return "video"
+	}
+	return "audio"
+}
+
+// callPayload describes a call event for hooks: its type (offer, accept,
+// reject or terminate) and the call it belongs to. It returns false for chats
+// sync doesn't save.
+func callPayload(evt interface{}) (map[string]any, bool) {
+	var meta types.BasicCallMeta
+	payload := map[string]any{"event": "call"}
+	switch v := evt.(type) {
+	case *events.CallOffer:
+		meta = v.BasicCallMeta
+		payload["type"] = "offer"
+		payload["media"] = offerMedia(v)
+	case *events.CallOfferNotice:
+		meta = v.BasicCallMeta
+		payload["type"] = "offer"
+		payload["media"] = v.Media
+	case *events.CallAccept:
+		meta = v.BasicCallMeta
+		payload["type"] = "accept"
+	case *events.CallReject:
+		meta = v.BasicCallMeta
+		payload["type"] = "reject"
+	case *events.CallTerminate:
+		meta = v.BasicCallMeta
+		payload["type"] = "terminate"
+		payload["reason"] = v.Reason
+	default:
+		return nil, false
+	}
+	caller := callCaller(meta)
+	groupJID := normalizeJID(jidString(meta.GroupJID))
+	if !chatSynced(caller) || (groupJID != "" && !chatSynced(groupJID)) {
+		return nil, false
+	}
+	payload["call_id"] = meta.CallID
+	payload["caller_jid"] = caller
+	if groupJID != "" {
+		payload["group_jid"] = groupJID
+	}
+	payload["timestamp"] = meta.Timestamp.Unix()
+	return payload, true
+}
+
+// callCaller is who started a call, preferring their phone-number JID when the
+// call identifies them by hidden-number identity.
+func callCaller(meta types.BasicCallMeta) string {
+	caller := meta.CallCreator
+	if caller.Server == types.HiddenUserServer && meta.CallCreatorAlt.Server == types.DefaultUserServer {
+		caller = meta.CallCreatorAlt
+	}
+	if caller.IsEmpty() {
+		caller = meta.From
+	}
+	return canonicalJID(normalizeJID(caller.String()))
+}
+
+func insertCall(meta types.BasicCallMeta, media string) error {
+	caller := callCaller(meta)
+	groupJID := normalizeJID(jidString(meta.GroupJID))
+	if !chatSynced(caller) || (groupJID != "" && !chatSynced(groupJID)) {
+		return nil
+	}
+	_, err := messageDB.Exec(`
+		INSERT INTO calls (call_id, caller_jid, group_jid, media, status, started_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(call_id) DO UPDATE SET media = COALESCE(NULLIF(excluded.media, ''), calls.media)
+	`, meta.CallID, caller, groupJID, media, callRinging, meta.Timestamp.Unix())
+	return err
+}
+
+// updateCall applies set to a call, adding it first if its offer was missed
+// (e.g. it started before we connected).
+func updateCall(meta types.BasicCallMeta, set string, args ...any) error {
+	if err := insertCall(meta, ""); err != nil {
+		return err
+	}
+	_, err := messageDB.Exec(`UPDATE calls SET `+set+` WHERE call_id = ?`, append(args, meta.CallID)...)
+	return err
+}
+
+// cmdCalls lists logged calls, newest first.
+// Usage: calls [--missed] [--from=JID] [--max-results=N]
+func cmdCalls(args []string) error {
+	var missedOnly bool
+	var fromArg string
+	limit := 50
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--missed":
+			missedOnly = true
+		case strings.HasPrefix(args[i], "--from="):
+			fromArg = strings.TrimPrefix(args[i], "--from=")
+		case args[i] == "--from" && i+1 < len(args):
+			fromArg = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--max-results="):
+			n, err := strconv.Atoi(strings.TrimPrefix(args[i], "--max-results="))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--max-results must be a positive number")
+			}
+			limit = n
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT c.call_id, c.caller_jid, COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''), ''),
+			c.group_jid, COALESCE(g.name, ''), c.media, c.status, c.reason, c.started_at,
+			COALESCE(c.accepted_at, 0), COALESCE(c.ended_at, 0)
+		FROM calls c
+		LEFT JOIN contacts ct ON ct.jid = c.caller_jid
+		LEFT JOIN chats g ON g.jid = c.group_jid AND c.group_jid != ''
+		WHERE 1 = 1`
+	var queryArgs []any
+	if missedOnly {
+		query += ` AND c.status = ?`
+		queryArgs = append(queryArgs, callMissed)
+	}
+	if fromArg != "" {
+		jid, err := parseJID(fromArg)
+		if err != nil {
+			return err
+		}
+		query += ` AND c.caller_jid = ?`
+		queryArgs = append(queryArgs, canonicalJID(normalizeJID(jid.String())))
+	}
+	query += ` ORDER BY c.started_at DESC LIMIT ?`
+	queryArgs = append(queryArgs, limit)
+
+	rows, err := messageDB.Query(query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to query calls: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	calls := []map[string]any{}
+	for rows.Next() {
+		var id, caller, callerName, groupJID, groupName, media, status, reason string
+		var started, accepted, ended int64
+		if err := rows.Scan(&id, &caller, &callerName, &groupJID, &groupName, &media, &status, &reason,
+			&started, &accepted, &ended); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		call := map[string]any{
+			"id":         id,
+			"caller_jid": caller,
+			"status":     status,
+			"timestamp":  started,
+		}
+		if callerName != "" {
+			call["caller_name"] = callerName
+		}
+		if groupJID != "" {
+			call["group_jid"] = groupJID
+		}
+		if groupName != "" {
+			call["group_name"] = groupName
+		}
+		if media != "" {
+			call["media"] = media
+		}
+		if reason != "" {
+			call["reason"] = reason
+		}
+		if accepted > 0 && ended >= accepted {
+			call["duration"] = ended - accepted
+		}
+		if ended > 0 {
+			call["ended_at"] = ended
+		}
+		calls = append(calls, call)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return printJSON(calls)
+}
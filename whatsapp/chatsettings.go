@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// receiptsSuppressed reports whether read receipts must not be sent for a chat,
+// either because the chat opted out via chat-settings or because it's a group
+// and suppress_group_receipts is enabled. Local read status is unaffected.
+func receiptsSuppressed(chatJID string) bool {
+	if cfg.SuppressGroupReceipts && strings.HasSuffix(chatJID, "@g.us") {
+		return true
+	}
+	var suppress int
+	err := messageDB.QueryRow(`SELECT suppress_read_receipts FROM chat_settings WHERE chat_jid = ?`, chatJID).Scan(&suppress)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		// Fail closed: a DB error shouldn't leak a receipt the user opted out of
+		fmt.Fprintf(os.Stderr, "Warning: failed to read chat settings: %v\n", err)
+		return true
+	}
+	return suppress == 1
+}
+
+// chatListed reports whether chatJID matches an entry of a chat list. Entries
+// are JIDs, or bare numbers matching the user part of a DM JID.
+func chatListed(list []string, chatJID string) bool {
+	user := strings.Split(chatJID, "@")[0]
+	for _, entry := range list {
+		if normalizeJID(entry) == chatJID || (!strings.Contains(entry, "@") && entry == user) {
+			return true
+		}
+	}
+	return false
+}
+
+// chatSynced reports whether messages for chatJID should be saved,
+// per the ignore_chats and only_chats settings.
+func chatSynced(chatJID string) bool {
+	if len(cfg.OnlyChats) > 0 && !chatListed(cfg.OnlyChats, chatJID) {
+		return false
+	}
+	return !chatListed(cfg.IgnoreChats, chatJID)
+}
+
+// cmdChatSettings lists or updates per-chat settings.
+// Usage: chat-settings [<chat-jid> [--read-receipts=on|off]]
+func cmdChatSettings(args []string) error {
+	var chatJID, readReceipts string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--read-receipts="):
+			readReceipts = strings.TrimPrefix(args[i], "--read-receipts=")
+		case args[i] == "--read-receipts" && i+1 < len(args):
+			readReceipts = args[i+1]
+			i++
+		case !strings.HasPrefix(args[i], "--"):
+			chatJID = args[i]
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if chatJID != "" {
+		chatJID = canonicalJID(normalizeJID(chatJID))
+	}
+
+	if readReceipts != "" {
+		if chatJID == "" {
+			return fmt.Errorf("usage: chat-settings <chat-jid> --read-receipts=on|off")
+		}
+		var suppress bool
+		switch readReceipts {
+		case "on":
+			suppress = false
+		case "off":
+			suppress = true
+		default:
+			return fmt.Errorf("invalid --read-receipts value %q (expected on or off)", readReceipts)
+		}
+		if _, err := messageDB.Exec(`
+			INSERT INTO chat_settings (chat_jid, suppress_read_receipts, updated_at)
+			VALUES (?, ?, ?)
+			ON CONFLICT(chat_jid) DO UPDATE SET
+				suppress_read_receipts = excluded.suppress_read_receipts,
+				updated_at = excluded.updated_at
+		`, chatJID, boolToInt(suppress), time.Now().Unix()); err != nil {
+			return fmt.Errorf("failed to save chat settings: %w", err)
+		}
+	}
+
+	query := `SELECT chat_jid FROM chat_settings`
+	var queryArgs []any
+	if chatJID != "" {
+		query += ` WHERE chat_jid = ?`
+		queryArgs = append(queryArgs, chatJID)
+	}
+	query += ` ORDER BY chat_jid`
+
+	rows, err := messageDB.Query(query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to query chat settings: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	settings := []map[string]any{}
+	for rows.Next() {
+		var jid string
+		if err := rows.Scan(&jid); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		settings = append(settings, map[string]any{"chat_jid": jid})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	_ = rows.Close()
+
+	// A chat with no stored row still has effective settings worth showing
+	if chatJID != "" && len(settings) == 0 {
+		settings = append(settings, map[string]any{"chat_jid": chatJID})
+	}
+
+	// Report effective values, which also account for config-wide rules
+	for _, s := range settings {
+		s["read_receipts"] = !receiptsSuppressed(s["chat_jid"].(string))
+	}
+
+	if chatJID != "" {
+		return printJSON(settings[0])
+	}
+	return printJSON(settings)
+}
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types/events"
 )
 
 // initClient initializes the WhatsApp client.
@@ -38,6 +41,10 @@ func initClient(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
+	secrets, err := syncSessionKeyring(dbPath)
+	if err != nil {
+		return err
+	}
 
 	device, err := container.GetFirstDevice(ctx)
 	if err != nil {
@@ -47,6 +54,11 @@ func initClient(ctx context.Context) error {
 			return fmt.Errorf("failed to get device: %w", err)
 		}
 	}
+	if secrets != nil {
+		if err := applySessionSecrets(device, secrets); err != nil {
+			return err
+		}
+	}
 
 	client = whatsmeow.NewClient(device, logger)
 	// Enable app state events during full sync so we receive MarkChatAsRead events
@@ -55,6 +67,80 @@ func initClient(ctx context.Context) error {
 	return nil
 }
 
+// connectClient initializes the client, requires an existing session, and
+// connects to WhatsApp. Callers are responsible for calling client.Disconnect.
+func connectClient(ctx context.Context) error {
+	if err := initClient(ctx); err != nil {
+		return err
+	}
+	return connectInitialized()
+}
+
+// connectInitialized connects a client set up by initClient, for callers that
+// register event handlers in between, and waits for the connection to settle.
+func connectInitialized() error {
+	if client.Store.ID == nil {
+		return fmt.Errorf("not authenticated. Run 'auth' first")
+	}
+
+	if err := connectSession(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	// Wait for connection
+	time.Sleep(2 * time.Second)
+	return nil
+}
+
+// connectSession connects the client once it holds the session lock (see
+// lockSession).
+func connectSession() error {
+	if err := lockSession(); err != nil {
+		return err
+	}
+	return client.Connect()
+}
+
+// watchSessionEnd reports when WhatsApp ends the connection for good: another
+// client took over the session, or the phone logged this device out.
+// whatsmeow doesn't reconnect after either, so commands that stay connected
+// exit with the error rather than idle disconnected.
+func watchSessionEnd() <-chan error {
+	ended := make(chan error, 1)
+	client.AddEventHandler(func(evt interface{}) {
+		var err error
+		switch evt.(type) {
+		case *events.StreamReplaced:
+			err = fmt.Errorf("disconnected: another client connected with this session")
+		case *events.LoggedOut:
+			err = fmt.Errorf("disconnected: logged out from the phone")
+		default:
+			return
+		}
+		select {
+		case ended <- err:
+		default:
+		}
+	})
+	return ended
+}
+
+// messageDBBusyTimeout is how long a write waits for another process's write
+// to finish before failing with SQLITE_BUSY.
+const messageDBBusyTimeout = 10 * time.Second
+
+// messageDBDSN opens messages.db in WAL mode, so readers don't block the
+// writer or each other, with the busy timeout applied to every pooled
+// connection. WAL mode is stored in the file, so a read-only connection,
+// which can't set it, still gets it.
+func messageDBDSN(path string, readOnly bool) string {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)", path, messageDBBusyTimeout.Milliseconds())
+	if readOnly {
+		return dsn + "&mode=ro"
+	}
+	return dsn + "&_pragma=journal_mode(WAL)"
+}
+
 // initMessageDB initializes the message database.
 func initMessageDB() error {
 	// Messages are user data, stored in XDG data directory
@@ -76,167 +162,218 @@ func initMessageDB() error {
 	}
 
 	var err error
-	messageDB, err = sql.Open("sqlite", newMsgPath)
+	messageDB, err = sql.Open("sqlite", messageDBDSN(newMsgPath, false))
 	if err != nil {
 		return fmt.Errorf("failed to open message database: %w", err)
 	}
+	if err := migrateMessageDB(); err != nil {
+		return err
+	}
 
-	// Create tables
-	_, err = messageDB.Exec(`
-		CREATE TABLE IF NOT EXISTS messages (
-			id TEXT PRIMARY KEY,
-			chat_jid TEXT NOT NULL,
-			sender_jid TEXT NOT NULL,
-			sender_name TEXT,
-			timestamp INTEGER NOT NULL,
-			text TEXT,
-			media_type TEXT,
-			is_from_me INTEGER NOT NULL,
-			created_at INTEGER NOT NULL
-		);
-		CREATE INDEX IF NOT EXISTS idx_messages_chat ON messages(chat_jid);
-		CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
-
-		CREATE TABLE IF NOT EXISTS contacts (
-			jid TEXT PRIMARY KEY,
-			name TEXT,
-			push_name TEXT,
-			updated_at INTEGER NOT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS chats (
-			jid TEXT PRIMARY KEY,
-			name TEXT,
-			is_group INTEGER NOT NULL,
-			last_message_time INTEGER,
-			marked_as_unread INTEGER NOT NULL DEFAULT 0,
-			updated_at INTEGER NOT NULL
-		);
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
-	}
-
-	// Migration: populate chats from existing messages if chats table is empty
-	var chatCount int
-	if err := messageDB.QueryRow("SELECT COUNT(*) FROM chats").Scan(&chatCount); err != nil {
-		return fmt.Errorf("failed to count chats: %w", err)
-	}
-	if chatCount == 0 {
-		if _, err = messageDB.Exec(`
-			INSERT OR IGNORE INTO chats (jid, name, is_group, last_message_time, updated_at)
-			SELECT
-				chat_jid,
-				'',
-				CASE WHEN chat_jid LIKE '%@g.us' THEN 1 ELSE 0 END,
-				MAX(timestamp),
-				strftime('%s', 'now')
-			FROM messages
-			GROUP BY chat_jid
-		`); err != nil {
-			return fmt.Errorf("failed to migrate chats: %w", err)
-		}
+	// Migration: move media files if the configured media directory changed
+	if err := migrateMediaDir(); err != nil {
+		return err
 	}
 
-	// Migration: populate contacts from existing messages if contacts table is empty
-	var contactCount int
-	if err := messageDB.QueryRow("SELECT COUNT(*) FROM contacts").Scan(&contactCount); err != nil {
-		return fmt.Errorf("failed to count contacts: %w", err)
-	}
-	if contactCount == 0 {
-		if _, err = messageDB.Exec(`
-			INSERT OR IGNORE INTO contacts (jid, name, push_name, updated_at)
-			SELECT
-				sender_jid,
-				'',
-				sender_name,
-				strftime('%s', 'now')
-			FROM messages
-			WHERE sender_name IS NOT NULL AND sender_name != ''
-			GROUP BY sender_jid
-		`); err != nil {
-			return fmt.Errorf("failed to migrate contacts: %w", err)
+	// Migration: decrypt votes kept encrypted in poll_updates, which needs the
+	// session's poll secrets, so it waits for a command that loaded the session
+	if client != nil && client.Store.ID != nil {
+		if err := migratePollUpdates(); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Migration: add is_read column to messages if it doesn't exist
-	if !hasColumn(messageDB, "messages", "is_read") {
-		if _, err = messageDB.Exec(`ALTER TABLE messages ADD COLUMN is_read INTEGER NOT NULL DEFAULT 0`); err != nil {
-			return fmt.Errorf("failed to add is_read column: %w", err)
+// jidColumns lists every stored JID column. keyed marks columns in a primary
+// key, where normalizing can collide with a row already in normal form.
+var jidColumns = []struct {
+	table, column string
+	keyed         bool
+}{
+	{"messages", "chat_jid", true},
+	{"messages", "sender_jid", false},
+	{"messages", "reply_to_sender", false},
+	{"chats", "jid", true},
+	{"contacts", "jid", true},
+	{"reactions", "chat_jid", true},
+	{"reactions", "sender_jid", true},
+	{"receipts", "chat_jid", true},
+	{"receipts", "participant_jid", true},
+	{"chat_settings", "chat_jid", true},
+	{"contact_aliases", "alias_jid", true},
+	{"contact_aliases", "canonical_jid", false},
+}
+
+// normalizeStoredJIDs rewrites JIDs saved before normalizeJID was applied on
+// save. Where a normalized row already exists, the legacy duplicate is dropped
+// in favour of it. Databases from before schema_version record having done it
+// in meta.
+func normalizeStoredJIDs(tx *sql.Tx) error {
+	var done int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM meta WHERE key = 'jids_normalized'`).Scan(&done); err != nil {
+		return fmt.Errorf("failed to read migration state: %w", err)
+	}
+	if done > 0 {
+		return nil
+	}
+
+	rewritten := 0
+	for _, jc := range jidColumns {
+		// SAFETY: table and column names come from jidColumns, not user input
+		rows, err := tx.Query(`SELECT DISTINCT ` + jc.column + ` FROM ` + jc.table + ` WHERE ` + jc.column + ` IS NOT NULL`)
+		if err != nil {
+			return fmt.Errorf("failed to query %s.%s: %w", jc.table, jc.column, err)
 		}
-		if _, err = messageDB.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(is_read, chat_jid)`); err != nil {
-			return fmt.Errorf("failed to create unread index: %w", err)
+		var legacy []string
+		for rows.Next() {
+			var jid string
+			if err := rows.Scan(&jid); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			if normalizeJID(jid) != jid {
+				legacy = append(legacy, jid)
+			}
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to iterate rows: %w", err)
+		}
+
+		for _, jid := range legacy {
+			result, err := tx.Exec(`UPDATE OR IGNORE `+jc.table+` SET `+jc.column+` = ? WHERE `+jc.column+` = ?`, normalizeJID(jid), jid)
+			if err != nil {
+				return fmt.Errorf("failed to normalize %s.%s: %w", jc.table, jc.column, err)
+			}
+			n, _ := result.RowsAffected()
+			rewritten += int(n)
+			if jc.keyed {
+				if _, err := tx.Exec(`DELETE FROM `+jc.table+` WHERE `+jc.column+` = ?`, jid); err != nil {
+					return fmt.Errorf("failed to drop duplicate %s: %w", jc.table, err)
+				}
+			}
 		}
 	}
 
-	// Migration: add marked_as_unread column to chats if it doesn't exist
-	if !hasColumn(messageDB, "chats", "marked_as_unread") {
-		if _, err = messageDB.Exec(`ALTER TABLE chats ADD COLUMN marked_as_unread INTEGER NOT NULL DEFAULT 0`); err != nil {
-			return fmt.Errorf("failed to add marked_as_unread column: %w", err)
+	if rewritten > 0 {
+		fmt.Fprintf(os.Stderr, "Normalized %d stored JIDs\n", rewritten)
+	}
+	return nil
+}
+
+// rebuildUnreadCounters recomputes chat_unread from scratch. Used to seed the
+// table; the triggers keep it current afterwards.
+func rebuildUnreadCounters(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		DELETE FROM chat_unread;
+		INSERT INTO chat_unread (chat_jid, unread)
+		SELECT chat_jid, COUNT(*) FROM messages
+		WHERE is_read = 0 AND is_from_me = 0
+		GROUP BY chat_jid;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild unread counters: %w", err)
+	}
+	return nil
+}
+
+// rebuildWithPrimaryKey recreates table with the given primary key if it has a
+// different one, keeping all columns, rows, rowids, and indexes. Rowids matter:
+// the contact merge journal refers to rows by rowid.
+// SAFETY: table and column parameters must be trusted literals, not user input.
+func rebuildWithPrimaryKey(tx *sql.Tx, table string, pk ...string) error {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	type column struct {
+		name, ctype string
+		notNull     bool
+		dflt        sql.NullString
+		pkPos       int
+	}
+	var columns []column
+	for rows.Next() {
+		var c column
+		var cid, notNull int
+		if err := rows.Scan(&cid, &c.name, &c.ctype, &notNull, &c.dflt, &c.pkPos); err != nil {
+			_ = rows.Close()
+			return err
 		}
+		c.notNull = notNull == 1
+		columns = append(columns, c)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	// Migration: add media metadata columns to messages if they don't exist
-	mediaColumns := []string{
-		"mime_type_full TEXT",  // Full MIME type (e.g., image/jpeg)
-		"media_key BLOB",       // Decryption key
-		"file_sha256 BLOB",     // SHA256 hash of decrypted file
-		"file_enc_sha256 BLOB", // SHA256 hash of encrypted file
-		"file_length INTEGER",  // File size in bytes
-		"direct_path TEXT",     // WhatsApp CDN path
-		"media_url TEXT",       // Full download URL
-		"media_file_path TEXT", // Local file path after download
-	}
-	for _, colDef := range mediaColumns {
-		colName := strings.Split(colDef, " ")[0]
-		if !hasColumn(messageDB, "messages", colName) {
-			if _, err = messageDB.Exec("ALTER TABLE messages ADD COLUMN " + colDef); err != nil {
-				return fmt.Errorf("failed to add %s column: %w", colName, err)
-			}
+	// Compare the current primary key (ordered by pkPos) with the wanted one
+	current := make([]string, len(columns))
+	n := 0
+	for _, c := range columns {
+		if c.pkPos > 0 && c.pkPos <= len(current) {
+			current[c.pkPos-1] = c.name
+			n++
 		}
 	}
+	if strings.Join(current[:n], ",") == strings.Join(pk, ",") {
+		return nil
+	}
 
-	// Migration: add reply context columns to messages if they don't exist
-	replyColumns := []string{
-		"reply_to_id TEXT",     // ID of message being replied to
-		"reply_to_sender TEXT", // Sender of the quoted message
-		"reply_to_text TEXT",   // Preview of quoted message text
+	// Indexes are dropped with the table; keep their definitions to recreate
+	var indexSQL []string
+	idxRows, err := tx.Query(`SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL`, table)
+	if err != nil {
+		return err
 	}
-	for _, colDef := range replyColumns {
-		colName := strings.Split(colDef, " ")[0]
-		if !hasColumn(messageDB, "messages", colName) {
-			if _, err = messageDB.Exec("ALTER TABLE messages ADD COLUMN " + colDef); err != nil {
-				return fmt.Errorf("failed to add %s column: %w", colName, err)
-			}
+	for idxRows.Next() {
+		var stmt string
+		if err := idxRows.Scan(&stmt); err != nil {
+			_ = idxRows.Close()
+			return err
 		}
+		indexSQL = append(indexSQL, stmt)
 	}
+	_ = idxRows.Close()
 
-	// Create reactions table if it doesn't exist
-	_, err = messageDB.Exec(`
-		CREATE TABLE IF NOT EXISTS reactions (
-			message_id TEXT NOT NULL,
-			chat_jid TEXT NOT NULL,
-			sender_jid TEXT NOT NULL,
-			sender_name TEXT,
-			emoji TEXT NOT NULL,
-			timestamp INTEGER NOT NULL,
-			PRIMARY KEY (message_id, sender_jid)
-		);
-		CREATE INDEX IF NOT EXISTS idx_reactions_message ON reactions(message_id);
-		CREATE INDEX IF NOT EXISTS idx_reactions_chat ON reactions(chat_jid);
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create reactions table: %w", err)
+	var defs, names []string
+	for _, c := range columns {
+		def := c.name + " " + c.ctype
+		if c.notNull || slices.Contains(pk, c.name) {
+			def += " NOT NULL"
+		}
+		if c.dflt.Valid {
+			def += " DEFAULT " + c.dflt.String
+		}
+		defs = append(defs, def)
+		names = append(names, c.name)
 	}
+	defs = append(defs, "PRIMARY KEY ("+strings.Join(pk, ", ")+")")
+	cols := strings.Join(names, ", ")
 
+	stmts := []string{
+		"CREATE TABLE " + table + "_new (" + strings.Join(defs, ", ") + ")",
+		// OR IGNORE: rows that collide under the new key were already one row
+		"INSERT OR IGNORE INTO " + table + "_new (rowid, " + cols + ") SELECT rowid, " + cols + " FROM " + table,
+		"DROP TABLE " + table,
+		"ALTER TABLE " + table + "_new RENAME TO " + table,
+	}
+	for _, stmt := range append(stmts, indexSQL...) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Migrated %s to primary key (%s)\n", table, strings.Join(pk, ", "))
 	return nil
 }
 
 // hasColumn checks if a column exists in a table.
 // SAFETY: table parameter must be a trusted literal, not user input.
 // SQLite PRAGMA doesn't support parameterized queries.
-func hasColumn(db *sql.DB, table, column string) bool {
-	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+func hasColumn(tx *sql.Tx, table, column string) bool {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
 	if err != nil {
 		return false
 	}
@@ -3,15 +3,19 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/hex"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"mime"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"sort"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -20,14 +24,115 @@ import (
 	"github.com/skip2/go-qrcode"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waCommon"
 	"go.mau.fi/whatsmeow/proto/waE2E"
-	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
 )
 
-// cmdAuth handles QR code authentication
-func cmdAuth() error {
+// Exit codes for auth, so provisioning scripts can tell outcomes apart.
+// Other failures exit 1 like every command.
+const (
+	exitAuthTimeout   = 2
+	exitAuthCancelled = 3
+	exitAuthNoHistory = 4 // Paired, but --wait saw no history sync
+)
+
+// emitAuthEvent writes one JSON line to stdout for auth --json.
+func emitAuthEvent(event string, fields map[string]any) {
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	fields["event"] = event
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// authSyncReport is auth --wait's summary of what's usable in the local
+// database. An account that was already authenticated has nothing new, so
+// its history counts as started if earlier syncs stored any.
+func authSyncReport(connected, historyStarted bool) map[string]any {
+	var chatTotal, messageTotal int64
+	_ = messageDB.QueryRow(`SELECT COUNT(*) FROM chats`).Scan(&chatTotal)
+	_ = messageDB.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&messageTotal)
+	if !connected {
+		historyStarted = chatTotal > 0 || messageTotal > 0
+	}
+	result := map[string]any{
+		"connected":            connected,
+		"history_sync_started": historyStarted,
+		"chats":                chatTotal,
+		"messages":             messageTotal,
+	}
+	if client.Store.ID != nil {
+		result["jid"] = client.Store.ID.String()
+	}
+	return result
+}
+
+// cmdAuth handles QR code authentication, or pairing-code authentication with --phone
+// Usage: auth [--no-open] [--qr=stdout|<file.png>|none] [--timeout=SECONDS] [--json] [--wait]
+//
+// With --wait, auth only succeeds once history sync has started, and reports
+// how many chats and messages were prefetched so scripts know the account is usable.
+// An account that's already authenticated reports the same from earlier syncs.
+//
+// With --json, progress is streamed to stdout as one JSON object per line
+// (qr, paired, connected, success, timeout, cancelled, error) and the QR code
+// isn't drawn on the terminal. Exits 0 on success, 2 on timeout, 3 on Ctrl+C.
+func cmdAuth(args []string) error {
+	noOpen := false
+	jsonEvents := false
+	waitForHistory := false
+	var timeout time.Duration
+	var phone string
+	qrFile := filepath.Join(configDir, "qr.png")
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--phone="):
+			phone = strings.TrimPrefix(args[i], "--phone=")
+		case args[i] == "--phone" && i+1 < len(args):
+			phone = args[i+1]
+			i++
+		case args[i] == "--no-open":
+			noOpen = true
+		case args[i] == "--wait":
+			waitForHistory = true
+		case args[i] == "--json":
+			jsonEvents = true
+			noOpen = true // Nobody is watching a desktop
+		case strings.HasPrefix(args[i], "--timeout="), args[i] == "--timeout" && i+1 < len(args):
+			value := strings.TrimPrefix(args[i], "--timeout=")
+			if args[i] == "--timeout" {
+				value = args[i+1]
+				i++
+			}
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return fmt.Errorf("--timeout must be a positive number of seconds: %s", value)
+			}
+			timeout = time.Duration(seconds) * time.Second
+		case strings.HasPrefix(args[i], "--qr="):
+			qrFile = strings.TrimPrefix(args[i], "--qr=")
+		case args[i] == "--qr" && i+1 < len(args):
+			qrFile = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	if qrFile == "" {
+		return fmt.Errorf("--qr requires stdout, a file path, or none")
+	}
+	if phone != "" && strings.Trim(phone, "+0123456789 -()") != "" {
+		return fmt.Errorf("--phone must be a phone number in international format: %s", phone)
+	}
+
 	ctx := context.Background()
 	if err := initClient(ctx); err != nil {
 		return err
@@ -35,6 +140,23 @@ func cmdAuth() error {
 
 	if client.Store.ID != nil {
 		fmt.Fprintln(os.Stderr, "Already authenticated. Use 'logout' to clear credentials.")
+		if waitForHistory {
+			// Scripts get the counts a fresh pairing reports, from earlier syncs
+			if err := initMessageDB(); err != nil {
+				return err
+			}
+			result := authSyncReport(false, false)
+			result["already_authenticated"] = true
+			if jsonEvents {
+				emitAuthEvent("success", result)
+				return nil
+			}
+			result["success"] = true
+			return printJSON(result)
+		}
+		if jsonEvents {
+			emitAuthEvent("success", map[string]any{"already_authenticated": true, "jid": client.Store.ID.String()})
+		}
 		return nil
 	}
 
@@ -63,65 +185,23 @@ func cmdAuth() error {
 		switch v := evt.(type) {
 		case *events.PairSuccess:
 			fmt.Fprintln(os.Stderr, "Device paired successfully!")
+			if jsonEvents {
+				emitAuthEvent("paired", map[string]any{"jid": v.ID.String()})
+			}
 		case *events.Connected:
 			fmt.Fprintln(os.Stderr, "Connected to WhatsApp!")
+			if jsonEvents {
+				emitAuthEvent("connected", nil)
+			}
 			close(pairComplete)
 		case *events.HistorySync:
 			historyReceived.Store(true)
 			for _, conv := range v.Data.Conversations {
-				chatJID := conv.GetID()
-				isGroup := strings.HasSuffix(chatJID, "@g.us")
-				unreadCount := int(conv.GetUnreadCount())
-
-				if unreadCount == 0 && !conv.GetMarkedAsUnread() {
-					if _, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE chat_jid = ? AND is_read = 0`, chatJID); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: failed to mark chat messages read during history sync: %v\n", err)
-					}
-				}
-
-				var latestTimestamp int64
-				type msgInfo struct {
-					msg       *waWeb.WebMessageInfo
-					timestamp int64
-					isFromMe  bool
-				}
-				var messages []msgInfo
-
-				for _, msg := range conv.Messages {
-					if m := msg.Message; m != nil {
-						ts := int64(m.GetMessageTimestamp())
-						isFromMe := m.GetKey().GetFromMe()
-						messages = append(messages, msgInfo{m, ts, isFromMe})
-						if ts > latestTimestamp {
-							latestTimestamp = ts
-						}
-					}
-				}
-
-				sort.Slice(messages, func(i, j int) bool {
-					return messages[i].timestamp > messages[j].timestamp
-				})
-
-				incomingCount := 0
-				for _, m := range messages {
-					isRead := m.isFromMe || incomingCount >= unreadCount
-					saved, err := saveHistoryMessageWithReadStatus(chatJID, m.msg, isRead)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Failed to save history message: %v\n", err)
-					} else if saved {
-						messageCount.Add(1)
-						if !m.isFromMe {
-							incomingCount++
-						}
-					}
-				}
-
-				chatName := getChatName(ctx, chatJID, isGroup)
-				if latestTimestamp > 0 || chatName != "" {
-					if err := saveChat(chatJID, chatName, isGroup, latestTimestamp, conv.GetMarkedAsUnread()); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: failed to save chat %s: %v\n", chatJID, err)
-					}
+				saved, err := saveHistoryConversation(ctx, conv, false)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 				}
+				messageCount.Add(saved)
 			}
 			fmt.Fprintf(os.Stderr, "  History sync: %d messages saved\n", messageCount.Load())
 		case *events.Message:
@@ -131,38 +211,134 @@ func cmdAuth() error {
 				messageCount.Add(1)
 			}
 		case *events.PushName:
-			if err := saveContact(v.JID.String(), "", v.NewPushName); err != nil {
+			if err := saveContact(messageDB, v.JID.String(), "", v.NewPushName); err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: failed to save contact: %v\n", err)
 			}
 		}
 	})
 
+	// A pairing code is requested once the QR channel delivers its first code
+	var pairCode string
+
 	qrChan, _ := client.GetQRChannel(ctx)
-	if err := client.Connect(); err != nil {
+	if err := connectSession(); err != nil {
+		if jsonEvents {
+			emitAuthEvent("error", map[string]any{"error": err.Error()})
+		}
 		return fmt.Errorf("failed to connect: %w", err)
 	}
 
-	qrFile := filepath.Join(configDir, "qr.png")
+	// Pairing deadline; a nil channel never fires when there's no --timeout
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	for {
+		var evt whatsmeow.QRChannelItem
+		select {
+		case <-deadline:
+			client.Disconnect()
+			if jsonEvents {
+				emitAuthEvent("timeout", nil)
+			}
+			waitingFor := "QR scan"
+			if phone != "" {
+				waitingFor = "pairing code"
+			}
+			return &exitCodeError{code: exitAuthTimeout, err: fmt.Errorf("timed out after %s waiting for %s", timeout, waitingFor)}
+		case <-sigChan:
+			client.Disconnect()
+			if jsonEvents {
+				emitAuthEvent("cancelled", nil)
+			}
+			return &exitCodeError{code: exitAuthCancelled, err: fmt.Errorf("authentication cancelled")}
+		case item, ok := <-qrChan:
+			if !ok {
+				return nil
+			}
+			evt = item
+		}
 
-	for evt := range qrChan {
 		switch evt.Event {
 		case "code":
-			// Save QR code to PNG file
-			if err := qrcode.WriteFile(evt.Code, qrcode.Medium, 256, qrFile); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to save QR code image: %v\n", err)
-			} else {
-				fmt.Fprintf(os.Stderr, "QR code saved to: %s\n", qrFile)
-				// Open the file with system viewer
-				openFile(qrFile)
+			// With --phone, the first QR code only signals the websocket is ready
+			// for a pairing code; later refreshes are ignored
+			if phone != "" {
+				if pairCode != "" {
+					continue
+				}
+				code, err := client.PairPhone(ctx, phone, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+				if err != nil {
+					client.Disconnect()
+					if jsonEvents {
+						emitAuthEvent("error", map[string]any{"error": err.Error()})
+					}
+					return fmt.Errorf("failed to request pairing code: %w", err)
+				}
+				pairCode = code
+				if jsonEvents {
+					emitAuthEvent("pairing_code", map[string]any{"code": code, "phone": phone})
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "\nPairing code: %s\n", code)
+				fmt.Fprintln(os.Stderr, "Enter it on your phone: WhatsApp > Settings > Linked Devices > Link a Device")
+				fmt.Fprintln(os.Stderr, "> Link with phone number instead")
+				continue
+			}
+			var pngBase64 string
+			switch qrFile {
+			case "none":
+				// Terminal QR only
+			case "stdout":
+				// Base64 PNG for display on another machine
+				png, err := qrcode.Encode(evt.Code, qrcode.Medium, 256)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to encode QR code image: %v\n", err)
+				} else if jsonEvents {
+					pngBase64 = base64.StdEncoding.EncodeToString(png)
+				} else {
+					fmt.Println(base64.StdEncoding.EncodeToString(png))
+				}
+			default:
+				// Save QR code to PNG file
+				if err := qrcode.WriteFile(evt.Code, qrcode.Medium, 256, qrFile); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to save QR code image: %v\n", err)
+				} else {
+					fmt.Fprintf(os.Stderr, "QR code saved to: %s\n", qrFile)
+					// Open the file with system viewer
+					if !noOpen {
+						openFile(qrFile)
+					}
+				}
+			}
+			if jsonEvents {
+				event := map[string]any{"code": evt.Code, "expires_in": int(evt.Timeout.Seconds())}
+				if pngBase64 != "" {
+					event["png_base64"] = pngBase64
+				} else if qrFile != "none" {
+					event["file"] = qrFile
+				}
+				emitAuthEvent("qr", event)
+				continue
 			}
 			// Also print to terminal as fallback
 			fmt.Fprintln(os.Stderr, "\nScan this QR code with WhatsApp:")
 			fmt.Fprintln(os.Stderr, "(WhatsApp > Settings > Linked Devices > Link a Device)")
 			qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stderr)
 		case "success":
-			fmt.Fprintln(os.Stderr, "\nQR code scanned! Completing device registration...")
+			if phone != "" {
+				fmt.Fprintln(os.Stderr, "\nPairing code accepted! Completing device registration...")
+			} else {
+				fmt.Fprintln(os.Stderr, "\nQR code scanned! Completing device registration...")
+			}
 			// Clean up QR file
-			_ = os.Remove(qrFile)
+			if phone == "" && qrFile != "stdout" && qrFile != "none" {
+				_ = os.Remove(qrFile)
+			}
 			// Wait for the Connected event or timeout
 			fmt.Fprintln(os.Stderr, "Waiting for device sync to complete...")
 			select {
@@ -173,6 +349,15 @@ func cmdAuth() error {
 				stopProcessing.Store(true)
 				time.Sleep(500 * time.Millisecond)
 				client.Disconnect()
+				if waitForHistory {
+					if jsonEvents {
+						emitAuthEvent("error", map[string]any{"error": "paired but never connected"})
+					}
+					return &exitCodeError{code: exitAuthNoHistory, err: fmt.Errorf("paired but never connected; history sync not verified")}
+				}
+				if jsonEvents {
+					emitAuthEvent("success", map[string]any{"connected": false, "messages_synced": messageCount.Load()})
+				}
 				return nil
 			}
 
@@ -195,6 +380,10 @@ func cmdAuth() error {
 				case <-maxWait:
 					fmt.Fprintln(os.Stderr, "History sync timeout reached")
 					break SyncLoop
+				case <-sigChan:
+					// Already paired, so stopping early still counts as success
+					fmt.Fprintln(os.Stderr, "Stopping history sync early")
+					break SyncLoop
 				case <-minWait:
 					minWaitDone = true
 				case <-ticker.C:
@@ -214,37 +403,116 @@ func cmdAuth() error {
 
 			fmt.Fprintf(os.Stderr, "Device registration complete! %d messages synced.\n", messageCount.Load())
 			client.Disconnect()
-			return nil
+
+			if !waitForHistory {
+				if jsonEvents {
+					emitAuthEvent("success", map[string]any{"connected": true, "messages_synced": messageCount.Load()})
+				}
+				return nil
+			}
+
+			// Report what's actually usable in the local database
+			result := authSyncReport(true, historyReceived.Load())
+			if !historyReceived.Load() {
+				if jsonEvents {
+					emitAuthEvent("error", map[string]any{"error": "history sync did not start"})
+				}
+				return &exitCodeError{code: exitAuthNoHistory, err: fmt.Errorf("paired but history sync did not start within %s", maxSyncTime)}
+			}
+			if jsonEvents {
+				emitAuthEvent("success", result)
+				return nil
+			}
+			result["success"] = true
+			return printJSON(result)
 		case "timeout":
 			client.Disconnect()
-			return fmt.Errorf("QR code timed out")
+			if jsonEvents {
+				emitAuthEvent("timeout", nil)
+			}
+			if phone != "" {
+				return &exitCodeError{code: exitAuthTimeout, err: fmt.Errorf("pairing code expired")}
+			}
+			return &exitCodeError{code: exitAuthTimeout, err: fmt.Errorf("QR code timed out")}
+		default:
+			// Pairing errors (client outdated, unexpected state, ...) end the channel
+			client.Disconnect()
+			msg := evt.Event
+			if evt.Error != nil {
+				msg = evt.Error.Error()
+			}
+			if jsonEvents {
+				emitAuthEvent("error", map[string]any{"error": msg})
+			}
+			return fmt.Errorf("pairing failed: %s", msg)
 		}
 	}
-
-	return nil
 }
 
 // cmdSend sends a message
 func cmdSend(args []string) error {
-	// Parse args: send [--name] [--reply-to=ID] <recipient> <message...>
+	// Parse args: send [--name] [--reply-to=ID] [--mention=WHO...] [--at=TIME] [--typing[=DURATION]]
+	// <recipient> <message...>, or send --to=A --to=B... [--name=NAME...] <message...>
 	var name string
+	var names, to []string
 	var replyTo string
+	var sendAt string
+	var typing bool
+	var typingFor time.Duration
+	var mentions []string
 	var positionalArgs []string
 
 	for i := 0; i < len(args); i++ {
 		switch {
 		case args[i] == "--name" && i+1 < len(args):
-			name = args[i+1]
+			names = append(names, args[i+1])
 			i++ // skip next arg
 		case strings.HasPrefix(args[i], "--name="):
-			name = strings.TrimPrefix(args[i], "--name=")
+			names = append(names, strings.TrimPrefix(args[i], "--name="))
+		case args[i] == "--to" && i+1 < len(args):
+			to = append(to, args[i+1])
+			i++
+		case strings.HasPrefix(args[i], "--to="):
+			to = append(to, strings.TrimPrefix(args[i], "--to="))
 		case strings.HasPrefix(args[i], "--reply-to="):
 			replyTo = strings.TrimPrefix(args[i], "--reply-to=")
+		case args[i] == "--mention" && i+1 < len(args):
+			mentions = append(mentions, args[i+1])
+			i++
+		case strings.HasPrefix(args[i], "--mention="):
+			mentions = append(mentions, strings.TrimPrefix(args[i], "--mention="))
+		case args[i] == "--at" && i+1 < len(args):
+			sendAt = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--at="):
+			sendAt = strings.TrimPrefix(args[i], "--at=")
+		case args[i] == "--typing":
+			typing = true
+		case strings.HasPrefix(args[i], "--typing="):
+			d, err := time.ParseDuration(strings.TrimPrefix(args[i], "--typing="))
+			if err != nil || d <= 0 {
+				return fmt.Errorf("--typing must be a duration like 3s")
+			}
+			typing, typingFor = true, d
 		default:
 			positionalArgs = append(positionalArgs, args[i])
 		}
 	}
 
+	// Several recipients get the same message over one connection
+	if len(to) > 0 || len(names) > 1 {
+		if len(positionalArgs) < 1 {
+			return fmt.Errorf("usage: send --to=A --to=B... [--name=NAME...] <message>")
+		}
+		if replyTo != "" || sendAt != "" {
+			return fmt.Errorf("--reply-to and --at can't be combined with several recipients")
+		}
+		return sendToMany(append(to, names...), len(to), strings.Join(positionalArgs, " "), mentions, typing, typingFor)
+	}
+	if len(names) == 1 {
+		name = names[0]
+	}
+
 	if len(positionalArgs) < 1 && name == "" {
 		return fmt.Errorf("usage: send [--name=NAME | <phone>] [--reply-to=MSG_ID] <message>")
 	}
@@ -281,21 +549,41 @@ func cmdSend(args []string) error {
 		}
 	}
 
-	if err := initClient(ctx); err != nil {
-		return err
+	if recipient, err := parseJID(phone); err == nil {
+		if err := checkProfileSend(recipient); err != nil {
+			return err
+		}
 	}
 
-	if client.Store.ID == nil {
-		return fmt.Errorf("not authenticated. Run 'auth' first")
+	// Mentions may be contact names, so resolve them before connecting too
+	var mentioned []string
+	if len(mentions) > 0 {
+		var err error
+		if message, mentioned, err = resolveMentions(message, mentions); err != nil {
+			return err
+		}
 	}
 
-	if err := client.Connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	// Scheduled messages are queued for the daemon instead of sent now
+	if sendAt != "" {
+		if typing {
+			return fmt.Errorf("--typing can't be combined with --at")
+		}
+		at, err := parseSendAt(sendAt)
+		if err != nil {
+			return err
+		}
+		jid, err := parseJID(phone)
+		if err != nil {
+			return err
+		}
+		return scheduleMessage(jid, message, replyTo, mentioned, at)
 	}
-	defer client.Disconnect()
 
-	// Wait for connection
-	time.Sleep(2 * time.Second)
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
 
 	// Parse recipient JID
 	jid, err := parseJID(phone)
@@ -303,31 +591,24 @@ func cmdSend(args []string) error {
 		return err
 	}
 
-	// Build message
-	msg := &waE2E.Message{
-		Conversation: &message,
+	msg, replyTo, err := buildTextMessage(jid, message, replyTo, mentioned)
+	if err != nil {
+		return err
 	}
 
-	// If replying to a message, add context info
-	if replyTo != "" {
-		contextInfo, err := getQuotedContext(replyTo, jid.String())
-		if err != nil {
-			return fmt.Errorf("failed to get quoted message: %w", err)
-		}
-		// Use ExtendedTextMessage for replies (Conversation doesn't support ContextInfo)
-		msg = &waE2E.Message{
-			ExtendedTextMessage: &waE2E.ExtendedTextMessage{
-				Text:        &message,
-				ContextInfo: contextInfo,
-			},
+	if typing {
+		if typingFor == 0 {
+			typingFor = typingDelay(message)
 		}
+		showTyping(ctx, jid, typingFor)
 	}
 
 	// Send message
-	resp, err := client.SendMessage(ctx, jid, msg)
+	resp, err := client.SendMessage(ctx, jid, withDisappearingTimer(ctx, jid, msg))
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
+	recordSent("send", jid.String(), resp)
 
 	output := map[string]any{
 		"success":   true,
@@ -338,27 +619,141 @@ func cmdSend(args []string) error {
 	if replyTo != "" {
 		output["reply_to"] = replyTo
 	}
+	if len(mentioned) > 0 {
+		output["mentions"] = mentioned
+	}
 	return printJSON(output)
 }
 
+// buildTextMessage builds a text message to jid, quoting replyTo if set and
+// mentioning the mentioned JIDs. replyTo may be a ^N ref; the resolved message
+// ID is returned.
+func buildTextMessage(jid types.JID, text, replyTo string, mentioned []string) (*waE2E.Message, string, error) {
+	if replyTo == "" {
+		if len(mentioned) > 0 {
+			return &waE2E.Message{
+				ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+					Text:        &text,
+					ContextInfo: &waE2E.ContextInfo{MentionedJID: mentioned},
+				},
+			}, "", nil
+		}
+		return &waE2E.Message{Conversation: &text}, "", nil
+	}
+	if messageDB == nil {
+		if err := initMessageDB(); err != nil {
+			return nil, "", err
+		}
+	}
+	if isRef(replyTo) {
+		key, err := lookupRef(replyTo)
+		if err != nil {
+			return nil, "", err
+		}
+		if key.ChatJID != normalizeJID(jid.String()) {
+			return nil, "", fmt.Errorf("%s is a message in %s, not in the chat with %s", replyTo, key.ChatJID, jid)
+		}
+		replyTo = key.ID
+	}
+	contextInfo, err := getQuotedContext(replyTo, jid.String())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get quoted message: %w", err)
+	}
+	contextInfo.MentionedJID = mentioned
+	// Use ExtendedTextMessage for replies (Conversation doesn't support ContextInfo)
+	return &waE2E.Message{
+		ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        &text,
+			ContextInfo: contextInfo,
+		},
+	}, replyTo, nil
+}
+
+// resolveMentions resolves --mention values (phone numbers, JIDs or contact
+// names) to JIDs. WhatsApp renders a mention where the text has an @number
+// token, so an @Name for the mention in the text becomes @number; mentions
+// the text doesn't name are prepended.
+func resolveMentions(text string, mentions []string) (string, []string, error) {
+	if messageDB == nil {
+		if err := initMessageDB(); err != nil {
+			return "", nil, err
+		}
+	}
+	var jids, missing []string
+	for _, who := range mentions {
+		target := who
+		if !strings.Contains(who, "@") && strings.Trim(who, "+0123456789 -()") != "" {
+			phone, err := lookupContactByName(strings.TrimPrefix(who, "@"))
+			if err != nil {
+				return "", nil, fmt.Errorf("can't mention %s: %w", who, err)
+			}
+			target = phone
+		}
+		jid, err := parseJID(target)
+		if err != nil {
+			return "", nil, fmt.Errorf("can't mention %s: %w", who, err)
+		}
+		token := "@" + jid.User
+		jids = append(jids, jid.ToNonAD().String())
+
+		named := regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(strings.TrimPrefix(who, "@")) + `\b`)
+		switch {
+		case strings.Contains(text, token):
+		case target != who && named.MatchString(text):
+			text = named.ReplaceAllLiteralString(text, token)
+		default:
+			missing = append(missing, token)
+		}
+	}
+	if len(missing) > 0 {
+		text = strings.Join(missing, " ") + " " + text
+	}
+	return text, jids, nil
+}
+
 // cmdSendFile sends a file attachment
 func cmdSendFile(args []string) error {
-	// Parse args: send-file [--name=NAME] <recipient> <file-path>
-	var name string
+	// Parse args: send-file [--name=NAME] [--voice | --gif] [--caption=TEXT]
+	// [--filename=NAME] [--mime=TYPE] <recipient> <file-path | - | URL>
+	var name, caption, fileNameOverride, mimeOverride string
+	var voice, gif bool
 	var positionalArgs []string
 
 	for i := 0; i < len(args); i++ {
 		switch {
+		case args[i] == "--voice":
+			voice = true
+		case args[i] == "--gif":
+			gif = true
 		case args[i] == "--name" && i+1 < len(args):
 			name = args[i+1]
 			i++ // skip next arg
 		case strings.HasPrefix(args[i], "--name="):
 			name = strings.TrimPrefix(args[i], "--name=")
+		case args[i] == "--caption" && i+1 < len(args):
+			caption = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--caption="):
+			caption = strings.TrimPrefix(args[i], "--caption=")
+		case args[i] == "--filename" && i+1 < len(args):
+			fileNameOverride = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--filename="):
+			fileNameOverride = strings.TrimPrefix(args[i], "--filename=")
+		case args[i] == "--mime" && i+1 < len(args):
+			mimeOverride = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--mime="):
+			mimeOverride = strings.TrimPrefix(args[i], "--mime=")
 		default:
 			positionalArgs = append(positionalArgs, args[i])
 		}
 	}
 
+	if voice && gif {
+		return fmt.Errorf("--voice and --gif can't be combined")
+	}
+
 	var phone string
 	var filePath string
 
@@ -389,17 +784,41 @@ func cmdSendFile(args []string) error {
 		}
 	}
 
-	// Read file
-	data, err := os.ReadFile(filePath)
+	if recipient, err := parseJID(phone); err == nil {
+		if err := checkProfileSend(recipient); err != nil {
+			return err
+		}
+	}
+
+	// Read the file, stdin ("-") or URL
+	data, fileName, declaredMime, err := readFileSource(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
+	}
+	if fileNameOverride != "" {
+		fileName = fileNameOverride
 	}
 
 	// Detect MIME type from extension
-	ext := filepath.Ext(filePath)
-	mimeType := mime.TypeByExtension(ext)
+	mimeType := mimeOverride
 	if mimeType == "" {
-		mimeType = "application/octet-stream"
+		mimeType = fileSourceMimeType(fileName, declaredMime, data)
+	}
+	if fileName == "" {
+		fileName = "file"
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			fileName += exts[0]
+		}
+	}
+
+	// ffmpeg conversions need the input on disk
+	if voice || gif {
+		localPath, cleanup, err := localFileFor(filePath, fileName, data)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		filePath = localPath
 	}
 
 	// Determine media type for upload
@@ -415,23 +834,40 @@ func cmdSendFile(args []string) error {
 		mediaType = whatsmeow.MediaDocument
 	}
 
-	ctx := context.Background()
-	if err := initClient(ctx); err != nil {
-		return err
+	// Voice notes are ogg/opus audio flagged as push-to-talk
+	var note *voiceNote
+	if voice {
+		if note, err = prepareVoiceNote(filePath, data); err != nil {
+			return err
+		}
+		data = note.Data
+		mimeType = voiceNoteMimeType
+		mediaType = whatsmeow.MediaAudio
 	}
 
-	if client.Store.ID == nil {
-		return fmt.Errorf("not authenticated. Run 'auth' first")
+	// WhatsApp plays GIFs as muted MP4s flagged for looping playback
+	if gif {
+		switch {
+		case mimeType == "image/gif":
+			if data, err = gifToMP4(filePath); err != nil {
+				return err
+			}
+			mimeType = "video/mp4"
+		case !strings.HasPrefix(mimeType, "video/"):
+			return fmt.Errorf("--gif needs a .gif or video file")
+		}
+		mediaType = whatsmeow.MediaVideo
+	}
+	if caption != "" && mediaType == whatsmeow.MediaAudio {
+		return fmt.Errorf("audio can't have a caption")
 	}
 
-	if err := client.Connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
 	}
 	defer client.Disconnect()
 
-	// Wait for connection
-	time.Sleep(2 * time.Second)
-
 	// Upload file to WhatsApp servers
 	uploadResp, err := client.Upload(ctx, data, mediaType)
 	if err != nil {
@@ -445,7 +881,6 @@ func cmdSendFile(args []string) error {
 	}
 
 	// Build message based on media type
-	fileName := filepath.Base(filePath)
 	fileLen := uint64(len(data))
 	var msg *waE2E.Message
 
@@ -474,6 +909,9 @@ func cmdSendFile(args []string) error {
 				FileLength:    &fileLen,
 			},
 		}
+		if gif {
+			msg.VideoMessage.GifPlayback = &gif
+		}
 	case whatsmeow.MediaAudio:
 		msg = &waE2E.Message{
 			AudioMessage: &waE2E.AudioMessage{
@@ -486,6 +924,12 @@ func cmdSendFile(args []string) error {
 				FileLength:    &fileLen,
 			},
 		}
+		if note != nil {
+			ptt := true
+			msg.AudioMessage.PTT = &ptt
+			msg.AudioMessage.Seconds = &note.Seconds
+			msg.AudioMessage.Waveform = note.Waveform
+		}
 	default:
 		msg = &waE2E.Message{
 			DocumentMessage: &waE2E.DocumentMessage{
@@ -501,11 +945,23 @@ func cmdSendFile(args []string) error {
 		}
 	}
 
+	if caption != "" {
+		switch {
+		case msg.ImageMessage != nil:
+			msg.ImageMessage.Caption = &caption
+		case msg.VideoMessage != nil:
+			msg.VideoMessage.Caption = &caption
+		case msg.DocumentMessage != nil:
+			msg.DocumentMessage.Caption = &caption
+		}
+	}
+
 	// Send message
-	resp, err := client.SendMessage(ctx, jid, msg)
+	resp, err := client.SendMessage(ctx, jid, withDisappearingTimer(ctx, jid, msg))
 	if err != nil {
 		return fmt.Errorf("failed to send file: %w", err)
 	}
+	recordSent("send-file", jid.String(), resp)
 
 	output := map[string]any{
 		"success":   true,
@@ -516,6 +972,16 @@ func cmdSendFile(args []string) error {
 		"size":      fileLen,
 		"mime_type": mimeType,
 	}
+	if caption != "" {
+		output["caption"] = caption
+	}
+	if gif {
+		output["gif"] = true
+	}
+	if note != nil {
+		output["voice"] = true
+		output["seconds"] = note.Seconds
+	}
 	return printJSON(output)
 }
 
@@ -527,140 +993,49 @@ func doSync(ctx context.Context) (messagesSaved int64, namesUpdated int, err err
 		return 0, 0, fmt.Errorf("not authenticated. Run 'auth' first")
 	}
 
-	// Idle detection for sync completion.
+	// Sync completion.
 	//
 	// WhatsApp's protocol is push-based: we can't request "messages since X".
-	// On connect, WhatsApp pushes events (messages, receipts, history) and we
-	// save whatever arrives. The challenge is knowing when sync is "done".
-	//
-	// We use idle detection: track when events last arrived, exit after silence.
-	// Events arrive in bursts (typically <100ms gaps), so 500ms of silence
-	// reliably indicates completion. This gives ~1-2s total sync time vs 30s
-	// with a fixed timeout.
+	// On connect, WhatsApp pushes the events we missed while offline (messages,
+	// receipts, history) and then tells us the offline queue is drained with
+	// OfflineSyncCompleted. Nodes are handled in order, so by the time that
+	// event arrives everything before it has been saved.
 	var messageCount atomic.Int64
-	var lastActivity atomic.Int64
-	lastActivity.Store(time.Now().UnixNano())
+	offlineDone := make(chan struct{})
+	var offlineOnce sync.Once
 
+	handleEvent := syncEventHandler(ctx, &messageCount)
 	client.AddEventHandler(func(evt interface{}) {
-		lastActivity.Store(time.Now().UnixNano()) // Update on ANY event for idle detection
 		switch v := evt.(type) {
-		case *events.Message:
-			if err := saveMessage(v); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to save message: %v\n", err)
-			} else {
-				messageCount.Add(1)
+		case *events.OfflineSyncPreview:
+			if v.Total > 0 {
+				fmt.Fprintf(os.Stderr, "Receiving %d missed events (%d messages, %d receipts)...\n",
+					v.Total, v.Messages, v.Receipts)
 			}
-		case *events.HistorySync:
-			for _, conv := range v.Data.Conversations {
-				chatJID := conv.GetID()
-				isGroup := strings.HasSuffix(chatJID, "@g.us")
-
-				// Get unread count from WhatsApp - this is the authoritative source
-				unreadCount := int(conv.GetUnreadCount())
-
-				// If unreadCount is 0, mark ALL existing messages in this chat as read.
-				// This handles the case where messages were marked read on the phone before sync.
-				// The MAX(is_read, excluded.is_read) in saveHistoryMessage prevents us from
-				// downgrading read status, so we need to explicitly update here.
-				if unreadCount == 0 && !conv.GetMarkedAsUnread() {
-					if _, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE chat_jid = ? AND is_read = 0`, chatJID); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: failed to mark chat messages read during history sync: %v\n", err)
-					}
-				}
-
-				// Track most recent message timestamp for this conversation
-				var latestTimestamp int64
-
-				// Collect messages sorted by timestamp (newest first) to mark unread correctly
-				type msgInfo struct {
-					msg       *waWeb.WebMessageInfo
-					timestamp int64
-					isFromMe  bool
-				}
-				var messages []msgInfo
-
-				for _, msg := range conv.Messages {
-					if m := msg.Message; m != nil {
-						ts := int64(m.GetMessageTimestamp())
-						isFromMe := m.GetKey().GetFromMe()
-						messages = append(messages, msgInfo{m, ts, isFromMe})
-						if ts > latestTimestamp {
-							latestTimestamp = ts
-						}
-					}
-				}
-
-				// Sort by timestamp descending (newest first) - required for unread tracking below
-				sort.Slice(messages, func(i, j int) bool {
-					return messages[i].timestamp > messages[j].timestamp
-				})
-
-				// Mark the N most recent incoming messages as unread based on WhatsApp's unreadCount.
-				// Messages from self are always read. For incoming messages, we count through
-				// the sorted list: the first unreadCount incoming messages are unread.
-				// Only count messages that are actually saved (not reactions or protocol messages).
-				incomingCount := 0
-				for _, m := range messages {
-					// Determine read status:
-					// - Messages from self are always read
-					// - For incoming messages: unread if within unreadCount, else read
-					isRead := m.isFromMe || incomingCount >= unreadCount
-
-					saved, err := saveHistoryMessageWithReadStatus(chatJID, m.msg, isRead)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Failed to save history message: %v\n", err)
-					} else if saved {
-						messageCount.Add(1)
-						// Only count saved incoming messages toward unread budget
-						if !m.isFromMe {
-							incomingCount++
-						}
-					}
-				}
-
-				// Get chat name (from DB cache or fetch from WhatsApp)
-				chatName := getChatName(ctx, chatJID, isGroup)
-
-				// Save chat with name (unread_count computed from messages table)
-				if latestTimestamp > 0 || chatName != "" {
-					if err := saveChat(chatJID, chatName, isGroup, latestTimestamp, conv.GetMarkedAsUnread()); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: failed to save chat %s: %v\n", chatJID, err)
-					}
-				}
-			}
-		case *events.PushName:
-			if err := saveContact(v.JID.String(), "", v.NewPushName); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to save contact: %v\n", err)
-			}
-		case *events.Receipt:
-			// Mark messages as read when we receive read receipts
-			if v.Type == types.ReceiptTypeRead || v.Type == types.ReceiptTypeReadSelf {
-				for _, msgID := range v.MessageIDs {
-					if err := markMessageRead(msgID); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: failed to mark message read: %v\n", err)
-					}
-				}
-			}
-		case *events.MarkChatAsRead:
-			// Fired when we read messages on another device (e.g., phone) or from app state sync.
-			// v.Action.GetRead() returns true if the chat was marked as read, false if marked as unread.
-			chatJID := v.JID.String()
-			if v.Action != nil && v.Action.GetRead() {
-				// Mark all messages in this chat as read
-				if _, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE chat_jid = ? AND is_read = 0`, chatJID); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to mark chat messages read: %v\n", err)
-				}
-				// Clear the "marked as unread" flag
-				_, _ = messageDB.Exec(`UPDATE chats SET marked_as_unread = 0 WHERE jid = ?`, chatJID)
-			}
-			// Note: read:false means "mark as unread" - we don't need to do anything since
-			// messages are already unread by default when they arrive.
+		case *events.OfflineSyncCompleted:
+			offlineOnce.Do(func() { close(offlineDone) })
 		}
+		handleEvent(evt)
 	})
 
-	if err := client.Connect(); err != nil {
+	// Webhooks and hooks fire for messages delivered while we were offline, too
+	hooked := installHooks()
+	defer flushHooks()
+	if webhooked := installWebhook(); webhooked || hooked {
+		rules, err := loadRules()
+		if err != nil {
+			return 0, 0, err
+		}
+		client.AddEventHandler(notificationHandler(rules))
+		if webhooked {
+			defer flushWebhooks()
+		}
+	}
+
+	if err := connectSession(); err != nil {
 		return 0, 0, fmt.Errorf("failed to connect: %w", err)
 	}
+	announcePresence(ctx)
 
 	// Fetch read status from app state. WAPatchRegularLow contains MarkChatAsRead
 	// mutations that tell us which chats have been explicitly marked as read/unread.
@@ -672,46 +1047,29 @@ func doSync(ctx context.Context) (messagesSaved int64, namesUpdated int, err err
 	if err := client.FetchAppState(ctx, appstate.WAPatchRegularLow, true, false); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to fetch app state: %v\n", err)
 	}
+	// WAPatchRegularHigh carries mutes and stars made on other devices
+	if err := client.FetchAppState(ctx, appstate.WAPatchRegularHigh, false, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to fetch app state: %v\n", err)
+	}
 
-	// Idle-based sync completion.
-	//
-	// Timing rationale:
-	// - 500ms idle timeout: Events arrive in tight bursts. 500ms of silence means
-	//   WhatsApp is done sending. Tested values: 100ms works but aggressive,
-	//   500ms is safe with margin for network jitter.
-	// - 100ms poll interval: Frequent enough to exit promptly after idle threshold.
-	// - 60s max wait: Safety cap for first sync after pairing (can have large
-	//   history). Normal syncs complete in 1-2s via idle detection.
-	//
-	// Why not request-based sync? WhatsApp multidevice protocol doesn't support
-	// "fetch messages since timestamp X". We must connect, receive whatever
-	// WhatsApp pushes, and infer completion from silence.
+	// The 60s cap is a safety net in case OfflineSyncCompleted never arrives
+	// (e.g. the connection drops mid-sync).
 	fmt.Fprintln(os.Stderr, "Syncing messages...")
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	const (
-		idleTimeout  = 500 * time.Millisecond // Exit after this much silence
-		pollInterval = 100 * time.Millisecond // How often to check for idle
-		maxSyncTime  = 60 * time.Second       // Safety cap (first sync can be slow)
-	)
-	maxWait := time.After(maxSyncTime)
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
+	const maxSyncTime = 60 * time.Second
+	select {
+	case <-offlineDone:
+	case <-sigChan:
+	case <-time.After(maxSyncTime):
+		fmt.Fprintln(os.Stderr, "Warning: WhatsApp didn't report the end of offline sync; stopping anyway")
+	}
 
-SyncLoop:
-	for {
-		select {
-		case <-sigChan:
-			break SyncLoop
-		case <-maxWait:
-			break SyncLoop
-		case <-ticker.C:
-			if time.Since(time.Unix(0, lastActivity.Load())) > idleTimeout {
-				break SyncLoop
-			}
-		}
+	// Cache group metadata and members; this also names every group chat
+	if _, err := refreshGroupCache(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	}
 
 	// Fetch names for chats that don't have them
@@ -733,6 +1091,97 @@ SyncLoop:
 	return messageCount.Load(), namesUpdated, nil
 }
 
+// syncEventHandler returns the event handler shared by sync and daemon. It saves
+// messages, history, contacts, and read status to the local database as events
+// arrive, incrementing messageCount for every message saved.
+func syncEventHandler(ctx context.Context, messageCount *atomic.Int64) func(evt interface{}) {
+	return func(evt interface{}) {
+		switch v := evt.(type) {
+		case *events.Message:
+			if err := saveMessage(v); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to save message: %v\n", err)
+			} else {
+				messageCount.Add(1)
+			}
+		case *events.HistorySync:
+			onDemand := v.Data.GetSyncType() == waHistorySync.HistorySync_ON_DEMAND
+			for _, conv := range v.Data.Conversations {
+				saved, err := saveHistoryConversation(ctx, conv, onDemand)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+				messageCount.Add(saved)
+			}
+		case *events.PushName:
+			if err := saveContact(messageDB, v.JID.String(), "", v.NewPushName); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save contact: %v\n", err)
+			}
+		case *events.GroupInfo:
+			if err := applyGroupChange(v); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to update group %s: %v\n", v.JID, err)
+			}
+			if err := saveGroupEvents(v); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		case *events.Picture:
+			if v.JID.Server == types.GroupServer {
+				if err := saveGroupPictureEvent(v); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+		case *events.JoinedGroup:
+			if err := saveGroupInfo(&v.GroupInfo); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to cache group %s: %v\n", v.JID, err)
+			}
+			if err := saveChat(messageDB, v.JID.String(), v.Name, true, 0, false); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save chat %s: %v\n", v.JID, err)
+			} else if err := markChatLeft(v.JID.String(), 0); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to update chat %s: %v\n", v.JID, err)
+			}
+		case *events.CallOffer, *events.CallOfferNotice, *events.CallAccept, *events.CallReject, *events.CallTerminate:
+			if err := saveCallEvent(v); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save call: %v\n", err)
+			}
+		case *events.Mute:
+			if err := saveMuteEvent(v); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save mute: %v\n", err)
+			}
+		case *events.Star:
+			if err := saveStarEvent(v); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save star: %v\n", err)
+			}
+		case *events.Receipt:
+			if err := saveReceipt(v); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save receipt: %v\n", err)
+			}
+			// Mark messages as read when we receive read receipts
+			if v.Type == types.ReceiptTypeRead || v.Type == types.ReceiptTypeReadSelf {
+				for _, msgID := range v.MessageIDs {
+					if err := markMessageRead(msgID, v.Chat.String()); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: failed to mark message read: %v\n", err)
+					}
+				}
+			}
+		case *events.MarkChatAsRead:
+			// Fired when we read messages on another device (e.g., phone) or from app state sync.
+			// v.Action.GetRead() returns true if the chat was marked as read, false if marked as unread.
+			chatJID := v.JID.String()
+			if v.Action != nil && v.Action.GetRead() {
+				// Mark all messages in this chat as read
+				if _, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE chat_jid = ? AND is_read = 0`, chatJID); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to mark chat messages read: %v\n", err)
+				}
+				// Clear the "marked as unread" flag
+				_, _ = messageDB.Exec(`UPDATE chats SET marked_as_unread = 0 WHERE jid = ?`, chatJID)
+			}
+			// read:false is "mark as unread" (e.g. mark-unread, or from the phone)
+			if v.Action != nil && !v.Action.GetRead() {
+				_, _ = messageDB.Exec(`UPDATE chats SET marked_as_unread = 1 WHERE jid = ?`, chatJID)
+			}
+		}
+	}
+}
+
 func cmdSync() error {
 	ctx := context.Background()
 	if err := initClient(ctx); err != nil {
@@ -752,6 +1201,14 @@ func cmdSync() error {
 		"messages_saved": messagesSaved,
 		"names_updated":  namesUpdated,
 	}
+
+	// Enforce the retention policy now that new messages are in
+	report, err := runRetention()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: retention failed: %v\n", err)
+	} else if report != nil {
+		output["pruned"] = report
+	}
 	return printJSON(output)
 }
 
@@ -763,17 +1220,47 @@ func cmdMessages(args []string) error {
 	var chatJID string
 	var unreadOnly bool
 	var withMedia bool
+	var withThreads bool
+	var mentionsMe bool
+	var starredOnly bool
+	var since, until time.Time
+	var mediaOnly bool
+	var mediaType string
 	limit := 50
 	for i := 0; i < len(args); i++ {
 		switch {
 		case strings.HasPrefix(args[i], "--chat="):
 			chatJID = strings.TrimPrefix(args[i], "--chat=")
+		case strings.HasPrefix(args[i], "--since="), strings.HasPrefix(args[i], "--until="):
+			name, value, _ := strings.Cut(args[i], "=")
+			t, err := parseTimeBound(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if name == "--since" {
+				since = t
+			} else {
+				until = t
+			}
+		case args[i] == "--mentions-me":
+			mentionsMe = true
+		case args[i] == "--starred":
+			starredOnly = true
+		case args[i] == "--media-only":
+			mediaOnly = true
+		case strings.HasPrefix(args[i], "--media-type="):
+			mediaType = strings.TrimPrefix(args[i], "--media-type=")
+			if !isDownloadableMedia(mediaType) || strings.HasPrefix(mediaType, "viewonce_") {
+				return fmt.Errorf("--media-type must be one of image, video, audio, sticker, document")
+			}
 		case strings.HasPrefix(args[i], "--max-results="):
 			_, _ = fmt.Sscanf(strings.TrimPrefix(args[i], "--max-results="), "%d", &limit)
 		case args[i] == "--unread":
 			unreadOnly = true
 		case args[i] == "--with-media":
 			withMedia = true
+		case args[i] == "--threads":
+			withThreads = true
 		}
 	}
 
@@ -805,14 +1292,23 @@ func cmdMessages(args []string) error {
 	}
 
 	// Build query with LEFT JOIN to get chat name, including reply context
-	query := `SELECT m.id, m.chat_jid, m.sender_jid, m.sender_name, m.timestamp, m.text, m.media_type, m.is_from_me, m.is_read,
+	// Group senders without a stored name are looked up via the cached
+	// participants, whose phone JID finds the contact when the sender is a lid
+	query := `SELECT m.id, m.chat_jid, m.sender_jid,
+		COALESCE(NULLIF(m.sender_name, ''), (
+			SELECT COALESCE(NULLIF(pc.name, ''), NULLIF(pc.push_name, ''), NULLIF(p.display_name, ''))
+			FROM participants p LEFT JOIN contacts pc ON pc.jid = p.phone_jid
+			WHERE p.group_jid = m.chat_jid AND (p.jid = m.sender_jid OR p.lid = m.sender_jid)
+			LIMIT 1
+		), m.sender_name) as sender_name,
+		m.timestamp, m.text, m.media_type, m.is_from_me, m.is_read,
 		CASE
 			WHEN c.is_group = 1 THEN COALESCE(NULLIF(c.name, ''), '')
 			ELSE COALESCE(NULLIF(c.name, ''), ct.name, ct.push_name, '')
 		END as chat_name,
 		m.mime_type_full, m.file_length, m.media_file_path,
 		m.reply_to_id, m.reply_to_sender, m.reply_to_text,
-		m.media_key, m.file_sha256, m.file_enc_sha256, m.direct_path
+		m.media_key, m.file_sha256, m.file_enc_sha256, m.direct_path, m.is_starred, m.thumbnail_path
 		FROM messages m
 		LEFT JOIN chats c ON m.chat_jid = c.jid
 		LEFT JOIN contacts ct ON m.chat_jid = ct.jid`
@@ -826,6 +1322,42 @@ func cmdMessages(args []string) error {
 	if unreadOnly {
 		conditions = append(conditions, "m.is_read = 0 AND m.is_from_me = 0")
 	}
+	if starredOnly {
+		conditions = append(conditions, "m.is_starred = 1")
+	}
+	if mediaType != "" {
+		// View-once media counts as its underlying type
+		conditions = append(conditions, "m.media_type IN (?, ?)")
+		queryArgs = append(queryArgs, mediaType, "viewonce_"+mediaType)
+	} else if mediaOnly {
+		var placeholders []string
+		for _, mt := range downloadableMediaTypes {
+			placeholders = append(placeholders, "?", "?")
+			queryArgs = append(queryArgs, mt, "viewonce_"+mt)
+		}
+		conditions = append(conditions, "m.media_type IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !since.IsZero() {
+		conditions = append(conditions, "m.timestamp >= ?")
+		queryArgs = append(queryArgs, since.Unix())
+	}
+	if !until.IsZero() {
+		conditions = append(conditions, "m.timestamp < ?")
+		queryArgs = append(queryArgs, until.Unix())
+	}
+	if mentionsMe {
+		own, err := ownJIDs(ctx)
+		if err != nil {
+			return err
+		}
+		placeholders := make([]string, len(own))
+		for i, jid := range own {
+			placeholders[i] = "?"
+			queryArgs = append(queryArgs, jid)
+		}
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM mentions mn
+			WHERE mn.message_id = m.id AND mn.chat_jid = m.chat_jid AND mn.mentioned_jid IN (`+strings.Join(placeholders, ",")+`))`)
+	}
 
 	if len(conditions) > 0 {
 		query += " WHERE " + strings.Join(conditions, " AND ")
@@ -833,30 +1365,52 @@ func cmdMessages(args []string) error {
 	query += " ORDER BY m.timestamp DESC LIMIT ?"
 	queryArgs = append(queryArgs, limit)
 
+	var fields map[string]any
+	if dataStatus.Warning != "" {
+		// Include data status warning in output if there are issues
+		fields = map[string]any{"_status": dataStatus}
+	}
+	stream, err := newListStream("messages", fields)
+	if err != nil {
+		return err
+	}
+	defer stream.abort()
+
 	rows, err := messageDB.Query(query, queryArgs...)
 	if err != nil {
 		return fmt.Errorf("failed to query messages: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
-	// Collect message IDs to query reactions
-	var messageIDs []string
-	var messages []map[string]any
+	// Messages are enriched and printed a page at a time, so a long listing
+	// is never held in memory; only the keys are kept, for the refs
+	var messageKeys []messageKey
+	var page []map[string]any
+	flush := func() error {
+		enrichListedMessages(page, messageKeys[len(messageKeys)-len(page):], withThreads)
+		for _, msg := range page {
+			if err := stream.add(msg); err != nil {
+				return err
+			}
+		}
+		page = page[:0]
+		return nil
+	}
 
 	for rows.Next() {
 		var id, chatJIDVal, senderJID string
 		var senderName, text, mediaType, chatName, mimeType, mediaFilePath sql.NullString
 		var replyToID, replyToSender, replyToText sql.NullString
-		var directPath sql.NullString
+		var directPath, thumbnailPath sql.NullString
 		var timestamp int64
-		var isFromMe, isRead int
+		var isFromMe, isRead, isStarred int
 		var fileLength sql.NullInt64
 		var mediaKey, fileSHA256, fileEncSHA256 []byte
 
 		if err := rows.Scan(&id, &chatJIDVal, &senderJID, &senderName, &timestamp, &text, &mediaType, &isFromMe, &isRead, &chatName,
 			&mimeType, &fileLength, &mediaFilePath,
 			&replyToID, &replyToSender, &replyToText,
-			&mediaKey, &fileSHA256, &fileEncSHA256, &directPath); err != nil {
+			&mediaKey, &fileSHA256, &fileEncSHA256, &directPath, &isStarred, &thumbnailPath); err != nil {
 			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -868,6 +1422,9 @@ func cmdMessages(args []string) error {
 			"is_from_me": isFromMe == 1,
 			"is_read":    isRead == 1,
 		}
+		if isStarred == 1 {
+			msg["starred"] = true
+		}
 		if chatName.Valid && chatName.String != "" {
 			msg["chat_name"] = chatName.String
 		}
@@ -895,15 +1452,22 @@ func cmdMessages(args []string) error {
 
 		// Auto-download media if --with-media and not already downloaded
 		if withMedia && mediaType.Valid && isDownloadableMedia(mediaType.String) && filePath == "" && len(mediaKey) > 0 {
-			downloaded := downloadMediaForMessage(ctx, id, mediaType.String, mimeType.String, mediaKey, fileSHA256, fileEncSHA256, fileLength.Int64, directPath.String)
+			downloaded := downloadMediaForMessage(ctx, id, chatJIDVal, mediaType.String, mimeType.String, mediaKey, fileSHA256, fileEncSHA256, fileLength.Int64, directPath.String)
 			if downloaded != "" {
 				filePath = downloaded
+			} else if reason := mediaSkipReason(chatJIDVal, mediaType.String, fileLength.Int64); reason != "" {
+				msg["media_skipped"] = reason
 			}
 		}
 
 		if filePath != "" {
 			msg["file"] = filePath
 		}
+		if thumbnailPath.Valid && thumbnailPath.String != "" {
+			if _, err := os.Stat(thumbnailPath.String); err == nil {
+				msg["thumbnail_path"] = thumbnailPath.String
+			}
+		}
 
 		// Add reply context if present
 		if replyToID.Valid && replyToID.String != "" {
@@ -919,48 +1483,99 @@ func cmdMessages(args []string) error {
 			msg["reply_to"] = replyTo
 		}
 
-		messages = append(messages, msg)
-		messageIDs = append(messageIDs, id)
+		msg["ref"] = refName(len(messageKeys))
+		page = append(page, msg)
+		messageKeys = append(messageKeys, messageKey{ID: id, ChatJID: chatJIDVal})
+		if len(page) == listPageSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	if err := flush(); err != nil {
+		return err
 	}
+	saveRefs(messageKeys)
+	return stream.close()
+}
+
+// listPageSize is how many messages the messages command enriches at once.
+const listPageSize = 500
 
+// enrichListedMessages adds to listed messages their reactions, poll tallies
+// and, with withThreads, thread membership. keys[i] identifies messages[i].
+func enrichListedMessages(messages []map[string]any, keys []messageKey, withThreads bool) {
 	// Query reactions for all messages
-	if len(messageIDs) > 0 {
-		reactionsByMsg := getReactionsForMessages(messageIDs)
-		for _, msg := range messages {
-			msgID := msg["id"].(string)
-			if reactions, ok := reactionsByMsg[msgID]; ok {
+	if len(keys) > 0 {
+		reactionsByMsg := getReactionsForMessages(keys)
+		for i, msg := range messages {
+			if reactions, ok := reactionsByMsg[keys[i]]; ok {
 				msg["reactions"] = reactions
 			}
 		}
 	}
 
-	// Include data status warning in output if there are issues
-	if dataStatus.Warning != "" {
-		output := map[string]any{
-			"messages": messages,
-			"_status":  dataStatus,
+	// Polls carry their vote counts instead of separate vote messages
+	for i, msg := range messages {
+		if msg["media_type"] != "poll" {
+			continue
+		}
+		if poll, err := tallyPoll(keys[i].ID, keys[i].ChatJID, false); err == nil {
+			msg["poll"] = poll
+		}
+	}
+
+	// Tag messages that are part of a reply thread with the thread's root
+	if withThreads {
+		threads, err := listedThreads(keys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		for i, msg := range messages {
+			if thread, ok := threads[keys[i]]; ok {
+				msg["thread_id"] = thread.root
+				msg["thread_size"] = thread.size
+			}
 		}
-		return printJSON(output)
 	}
+}
 
-	return printJSON(messages)
+// ownJIDs returns the JIDs others can mention us by: our phone number JID and,
+// in groups using hidden identities, our LID.
+func ownJIDs(ctx context.Context) ([]string, error) {
+	if client == nil {
+		if err := initClient(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if client.Store.ID == nil {
+		return nil, fmt.Errorf("not authenticated. Run 'auth' first")
+	}
+	jids := []string{canonicalJID(normalizeJID(client.Store.ID.String()))}
+	if !client.Store.LID.IsEmpty() {
+		jids = append(jids, canonicalJID(normalizeJID(client.Store.LID.String())))
+	}
+	return jids, nil
 }
 
-// getReactionsForMessages queries reactions for a list of message IDs.
-func getReactionsForMessages(messageIDs []string) map[string][]map[string]any {
-	if len(messageIDs) == 0 {
+// getReactionsForMessages queries reactions for a list of messages.
+func getReactionsForMessages(keys []messageKey) map[messageKey][]map[string]any {
+	if len(keys) == 0 {
 		return nil
 	}
 
 	// Build IN clause
-	placeholders := make([]string, len(messageIDs))
-	args := make([]interface{}, len(messageIDs))
-	for i, id := range messageIDs {
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
 		placeholders[i] = "?"
-		args[i] = id
+		args[i] = key.ID
 	}
 
-	query := `SELECT message_id, sender_jid, sender_name, emoji FROM reactions WHERE message_id IN (` + strings.Join(placeholders, ",") + `)`
+	query := `SELECT message_id, chat_jid, sender_jid, sender_name, emoji FROM reactions WHERE message_id IN (` + strings.Join(placeholders, ",") + `)`
 	rows, err := messageDB.Query(query, args...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to query reactions: %v\n", err)
@@ -968,12 +1583,12 @@ func getReactionsForMessages(messageIDs []string) map[string][]map[string]any {
 	}
 	defer func() { _ = rows.Close() }()
 
-	result := make(map[string][]map[string]any)
+	result := make(map[messageKey][]map[string]any)
 	for rows.Next() {
-		var msgID, senderJID string
+		var msgID, chatJID, senderJID string
 		var senderName sql.NullString
 		var emoji string
-		if err := rows.Scan(&msgID, &senderJID, &senderName, &emoji); err != nil {
+		if err := rows.Scan(&msgID, &chatJID, &senderJID, &senderName, &emoji); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to scan reaction: %v\n", err)
 			continue
 		}
@@ -984,54 +1599,47 @@ func getReactionsForMessages(messageIDs []string) map[string][]map[string]any {
 		if senderName.Valid && senderName.String != "" {
 			reaction["sender_name"] = senderName.String
 		}
-		result[msgID] = append(result[msgID], reaction)
+		key := messageKey{ID: msgID, ChatJID: chatJID}
+		result[key] = append(result[key], reaction)
 	}
 	return result
 }
 
+// downloadableMediaTypes are the media types with a file to download.
+var downloadableMediaTypes = []string{"image", "video", "audio", "sticker", "document"}
+
 // isDownloadableMedia returns true if the media type can be auto-downloaded.
 // Handles both regular types (image, video) and viewonce variants (viewonce_image).
 func isDownloadableMedia(mediaType string) bool {
 	// Strip viewonce_ prefix if present
-	mt := strings.TrimPrefix(mediaType, "viewonce_")
-	switch mt {
-	case "image", "video", "audio", "sticker", "document":
-		return true
-	default:
-		return false
-	}
+	return slices.Contains(downloadableMediaTypes, strings.TrimPrefix(mediaType, "viewonce_"))
 }
 
 // downloadMediaForMessage downloads media for a message and returns the file path.
 // On failure, logs to stderr and returns empty string.
-func downloadMediaForMessage(ctx context.Context, messageID, mediaType, mimeType string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength int64, directPath string) string {
+func downloadMediaForMessage(ctx context.Context, messageID, chatJID, mediaType, mimeType string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength int64, directPath string) string {
 	if len(mediaKey) == 0 || directPath == "" {
 		return ""
 	}
 
-	// Determine output path
-	home, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to get home directory: %v\n", err)
-		return ""
-	}
-	mediaDir := filepath.Join(home, ".local", "share", "jean-claude", "whatsapp", "media")
-	if err := os.MkdirAll(mediaDir, 0755); err != nil {
+	// Determine output path from media_filename_template
+	outputPath := mediaPathForMessage(messageID, chatJID, mediaType, mimeType, fileSHA256)
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to create media directory: %v\n", err)
 		return ""
 	}
 
-	ext := getExtensionFromMime(mimeType)
-	filename := hex.EncodeToString(fileSHA256) + ext
-	outputPath := filepath.Join(mediaDir, filename)
-
-	// Check if already exists
-	if _, err := os.Stat(outputPath); err == nil {
-		// Update message with file path
-		_, _ = messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = ?`, outputPath, messageID)
+	// Reuse the file if it exists, or link identical content saved under another name
+	if placeCachedMedia(messageID, chatJID, outputPath, fileSHA256) {
+		ensureThumbnail(messageID, chatJID, mediaType, outputPath, fileSHA256)
 		return outputPath
 	}
 
+	// Automatic downloads honor the media skip rules; callers report the reason
+	if mediaSkipReason(chatJID, mediaType, fileLength) != "" {
+		return ""
+	}
+
 	// Need client to download
 	if client == nil || !client.IsConnected() {
 		// Try to initialize and connect
@@ -1043,7 +1651,7 @@ func downloadMediaForMessage(ctx context.Context, messageID, mediaType, mimeType
 			fmt.Fprintf(os.Stderr, "Warning: not authenticated, cannot download media\n")
 			return ""
 		}
-		if err := client.Connect(); err != nil {
+		if err := connectSession(); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to connect for download: %v\n", err)
 			return ""
 		}
@@ -1065,17 +1673,35 @@ func downloadMediaForMessage(ctx context.Context, messageID, mediaType, mimeType
 	}
 
 	// Update message with file path
-	_, _ = messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = ?`, outputPath, messageID)
+	_, _ = messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = ? AND chat_jid = ?`, outputPath, messageID, chatJID)
+	ensureThumbnail(messageID, chatJID, mediaType, outputPath, fileSHA256)
 	return outputPath
 }
 
 // cmdContacts lists contacts from local database
-func cmdContacts() error {
+// Usage: contacts [merge ... | unmerge <alias-jid>]
+func cmdContacts(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "merge":
+			return cmdContactsMerge(args[1:])
+		case "unmerge":
+			return cmdContactsUnmerge(args[1:])
+		default:
+			return fmt.Errorf("unknown contacts subcommand: %s", args[0])
+		}
+	}
+
 	if err := initMessageDB(); err != nil {
 		return err
 	}
 
-	rows, err := messageDB.Query(`SELECT jid, name, push_name FROM contacts ORDER BY name, push_name`)
+	rows, err := messageDB.Query(`
+		SELECT ct.jid, ct.name, ct.push_name, a.canonical_jid
+		FROM contacts ct
+		LEFT JOIN contact_aliases a ON a.alias_jid = ct.jid
+		ORDER BY ct.name, ct.push_name
+	`)
 	if err != nil {
 		return fmt.Errorf("failed to query contacts: %w", err)
 	}
@@ -1084,9 +1710,9 @@ func cmdContacts() error {
 	var contacts []map[string]any
 	for rows.Next() {
 		var jid string
-		var name, pushName sql.NullString
+		var name, pushName, mergedInto sql.NullString
 
-		if err := rows.Scan(&jid, &name, &pushName); err != nil {
+		if err := rows.Scan(&jid, &name, &pushName, &mergedInto); err != nil {
 			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -1097,6 +1723,9 @@ func cmdContacts() error {
 		if pushName.Valid {
 			contact["push_name"] = pushName.String
 		}
+		if mergedInto.Valid {
+			contact["merged_into"] = mergedInto.String
+		}
 		contacts = append(contacts, contact)
 	}
 
@@ -1113,25 +1742,53 @@ func cmdChats(args []string) error {
 	dataStatus := getDataStatus()
 
 	// Parse args
-	var unreadOnly bool
+	var unreadOnly, all, mutedOnly, unmutedOnly, groupOnly, dmOnly bool
+	sortBy := "last_message"
+	limit := 0
 	for i := 0; i < len(args); i++ {
-		if args[i] == "--unread" {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if (name == "--limit" || name == "--sort") && !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s needs a value", name)
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--unread":
 			unreadOnly = true
+		case "--all":
+			all = true
+		case "--muted":
+			mutedOnly = true
+		case "--unmuted":
+			unmutedOnly = true
+		case "--group-only":
+			groupOnly = true
+		case "--dm-only":
+			dmOnly = true
+		case "--limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--limit must be a positive number")
+			}
+			limit = n
+		case "--sort":
+			if value != "last_message" && value != "unread" && value != "name" {
+				return fmt.Errorf("--sort must be last_message, unread, or name")
+			}
+			sortBy = value
 		}
 	}
+	if groupOnly && dmOnly {
+		return fmt.Errorf("--group-only and --dm-only can't be combined")
+	}
 
 	// Join with contacts to get names for DM chats
 	// For groups: use chat name only (don't fall back to sender name)
 	// For DMs: try contact name, then sender name from messages
-	// Compute unread_count from messages table (single source of truth)
-	// Use CTE to calculate unread count once, then use it in both SELECT and WHERE
+	// unread_count comes from chat_unread, which triggers on messages keep current
 	query := `
-		WITH chat_unread AS (
-			SELECT chat_jid, COUNT(*) as cnt
-			FROM messages
-			WHERE is_read = 0 AND is_from_me = 0
-			GROUP BY chat_jid
-		)
 		SELECT c.jid,
 			CASE
 				WHEN c.is_group = 1 THEN COALESCE(NULLIF(c.name, ''), '')
@@ -1144,20 +1801,56 @@ func cmdChats(args []string) error {
 					 ORDER BY m.timestamp DESC LIMIT 1),
 					''
 				)
-			END,
+			END AS chat_name,
 			c.is_group,
 			c.last_message_time,
-			COALESCE(cu.cnt, 0) as unread_count,
-			c.marked_as_unread
+			COALESCE(cu.unread, 0) as unread_count,
+			c.marked_as_unread,
+			c.left_at,
+			c.muted_until,
+			c.disappearing_timer
 		FROM chats c
 		LEFT JOIN contacts ct ON c.jid = ct.jid
 		LEFT JOIN chat_unread cu ON c.jid = cu.chat_jid`
+	var conditions []string
 	if unreadOnly {
+		conditions = append(conditions, "(COALESCE(cu.unread, 0) > 0 OR c.marked_as_unread = 1)")
+	}
+	if mutedOnly {
+		conditions = append(conditions, mutedSQL)
+	}
+	if unmutedOnly {
+		conditions = append(conditions, "NOT "+mutedSQL)
+	}
+	if groupOnly {
+		conditions = append(conditions, "c.is_group = 1")
+	}
+	if dmOnly {
+		conditions = append(conditions, "c.is_group = 0")
+	}
+	// Groups we left are hidden unless asked for
+	if !all {
+		conditions = append(conditions, "c.left_at IS NULL")
+	}
+	if len(conditions) > 0 {
 		query += `
-		WHERE COALESCE(cu.cnt, 0) > 0 OR c.marked_as_unread = 1`
+		WHERE ` + strings.Join(conditions, " AND ")
 	}
-	query += `
+	switch sortBy {
+	case "unread":
+		query += `
+		ORDER BY unread_count DESC, c.marked_as_unread DESC, c.last_message_time DESC`
+	case "name":
+		// Unnamed chats last
+		query += `
+		ORDER BY chat_name = '', chat_name COLLATE NOCASE, c.jid`
+	default:
+		query += `
 		ORDER BY c.last_message_time DESC`
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
 
 	rows, err := messageDB.Query(query)
 	if err != nil {
@@ -1172,8 +1865,10 @@ func cmdChats(args []string) error {
 		var isGroup int
 		var lastMessageTime sql.NullInt64
 		var unreadCount, markedAsUnread int
+		var leftAt sql.NullInt64
+		var mutedUntil, disappearingTimer int64
 
-		if err := rows.Scan(&jid, &name, &isGroup, &lastMessageTime, &unreadCount, &markedAsUnread); err != nil {
+		if err := rows.Scan(&jid, &name, &isGroup, &lastMessageTime, &unreadCount, &markedAsUnread, &leftAt, &mutedUntil, &disappearingTimer); err != nil {
 			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -1188,6 +1883,18 @@ func cmdChats(args []string) error {
 		if unreadCount > 0 || markedAsUnread == 1 {
 			chat["unread_count"] = unreadCount
 		}
+		if leftAt.Valid {
+			chat["left_at"] = leftAt.Int64
+		}
+		if disappearingTimer > 0 {
+			chat["disappearing_timer"] = disappearingTimer
+		}
+		if mutedUntil == mutedForever || mutedUntil > time.Now().Unix() {
+			chat["muted"] = true
+			if mutedUntil > 0 {
+				chat["muted_until"] = mutedUntil
+			}
+		}
 		chats = append(chats, chat)
 	}
 
@@ -1234,7 +1941,8 @@ func cmdSearch(args []string) error {
 		return fmt.Errorf("usage: search <query> [--max-results=N]")
 	}
 
-	// Search messages with LIKE query
+	// Search messages with LIKE query on the folded text, so accents and case don't matter.
+	// The query is literal: % and _ match themselves
 	sqlQuery := `SELECT m.id, m.chat_jid, m.sender_jid, m.sender_name, m.timestamp, m.text, m.media_type, m.is_from_me, m.is_read,
 		CASE
 			WHEN c.is_group = 1 THEN COALESCE(NULLIF(c.name, ''), '')
@@ -1243,17 +1951,28 @@ func cmdSearch(args []string) error {
 		FROM messages m
 		LEFT JOIN chats c ON m.chat_jid = c.jid
 		LEFT JOIN contacts ct ON m.chat_jid = ct.jid
-		WHERE m.text LIKE ?
+		WHERE m.search_text LIKE ? ESCAPE '\'
 		ORDER BY m.timestamp DESC
 		LIMIT ?`
 
-	rows, err := messageDB.Query(sqlQuery, "%"+query+"%", limit)
+	var fields map[string]any
+	if dataStatus.Warning != "" {
+		// Include data status warning in output if there are issues
+		fields = map[string]any{"_status": dataStatus}
+	}
+	stream, err := newListStream("messages", fields)
+	if err != nil {
+		return err
+	}
+	defer stream.abort()
+
+	rows, err := messageDB.Query(sqlQuery, "%"+escapeLike(searchText(query))+"%", limit)
 	if err != nil {
 		return fmt.Errorf("failed to search messages: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
-	var messages []map[string]any
+	var keys []messageKey
 	for rows.Next() {
 		var id, chatJID, senderJID string
 		var senderName, text, mediaType, chatName sql.NullString
@@ -1280,50 +1999,66 @@ func cmdSearch(args []string) error {
 		}
 		if text.Valid {
 			msg["text"] = text.String
+			if snippet, offsets := searchSnippet(text.String, query); snippet != "" {
+				msg["snippet"] = snippet
+				msg["match_offsets"] = offsets
+			}
 		}
 		if mediaType.Valid && mediaType.String != "" {
 			msg["media_type"] = mediaType.String
 		}
-		messages = append(messages, msg)
-	}
-
-	// Include data status warning in output if there are issues
-	if dataStatus.Warning != "" {
-		output := map[string]any{
-			"messages": messages,
-			"_status":  dataStatus,
+		msg["ref"] = refName(len(keys))
+		keys = append(keys, messageKey{ID: id, ChatJID: chatJID})
+		if err := stream.add(msg); err != nil {
+			return err
 		}
-		return printJSON(output)
 	}
-
-	return printJSON(messages)
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	saveRefs(keys)
+	return stream.close()
 }
 
-// cmdParticipants lists group participants
+// cmdParticipants lists group participants, from the group cache if the group
+// is in it and otherwise (or with --refresh) from WhatsApp
 func cmdParticipants(args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("usage: participants <group-jid>")
+	var groupJID string
+	refresh := false
+	for _, arg := range args {
+		if arg == "--refresh" {
+			refresh = true
+		} else if groupJID == "" {
+			groupJID = arg
+		}
+	}
+	if groupJID == "" {
+		return fmt.Errorf("usage: participants <group-jid> [--refresh]")
 	}
 
-	groupJID := args[0]
-
-	ctx := context.Background()
-	if err := initClient(ctx); err != nil {
+	if err := initMessageDB(); err != nil {
 		return err
 	}
-
-	if client.Store.ID == nil {
-		return fmt.Errorf("not authenticated. Run 'auth' first")
+	if !refresh {
+		name, participants, ok, err := cachedParticipants(groupJID)
+		if err != nil {
+			return err
+		}
+		if ok && len(participants) > 0 {
+			return printJSON(map[string]any{
+				"group_jid":    groupJID,
+				"group_name":   name,
+				"participants": participants,
+			})
+		}
 	}
 
-	if err := client.Connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
 	}
 	defer client.Disconnect()
 
-	// Wait for connection
-	time.Sleep(2 * time.Second)
-
 	// Parse group JID
 	jid, err := types.ParseJID(groupJID)
 	if err != nil {
@@ -1339,6 +2074,9 @@ func cmdParticipants(args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get group info: %w", err)
 	}
+	if err := saveGroupInfo(groupInfo); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache group: %v\n", err)
+	}
 
 	var participants []map[string]any
 	for _, p := range groupInfo.Participants {
@@ -1374,25 +2112,14 @@ func cmdParticipants(args []string) error {
 // cmdRefresh fetches chat names from WhatsApp
 func cmdRefresh() error {
 	ctx := context.Background()
-	if err := initClient(ctx); err != nil {
-		return err
-	}
 	if err := initMessageDB(); err != nil {
 		return err
 	}
-
-	if client.Store.ID == nil {
-		return fmt.Errorf("not authenticated. Run 'auth' first")
-	}
-
-	if err := client.Connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	if err := connectClient(ctx); err != nil {
+		return err
 	}
 	defer client.Disconnect()
 
-	// Wait for connection
-	time.Sleep(2 * time.Second)
-
 	// Get chats without names
 	chatsToRefresh, err := getChatsNeedingNames(100)
 	if err != nil {
@@ -1469,119 +2196,308 @@ func cmdMarkAllRead() error {
 	return printJSON(output)
 }
 
-// cmdMarkRead marks all messages in a chat as read (local + sends read receipts to WhatsApp)
+// cmdMarkRead marks messages in a chat as read (local + sends read receipts to WhatsApp):
+// all of them, or with --before/--up-to only the older ones.
+// Receipts are skipped for chats where receiptsSuppressed is true.
 func cmdMarkRead(args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("usage: mark-read <chat-jid>")
+	usage := fmt.Errorf("usage: mark-read <chat-jid> [--before=TIME | --up-to=MESSAGE_ID]")
+	var chatJID, beforeArg, upTo string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch name {
+		case "--before", "--up-to":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return usage
+				}
+				value = args[i+1]
+				i++
+			}
+			if name == "--before" {
+				beforeArg = value
+			} else {
+				upTo = value
+			}
+		default:
+			if strings.HasPrefix(args[i], "--") || chatJID != "" {
+				return usage
+			}
+			chatJID = args[i]
+		}
+	}
+	if chatJID == "" {
+		return usage
+	}
+	if beforeArg != "" && upTo != "" {
+		return fmt.Errorf("--before and --up-to can't be combined")
 	}
-
-	chatJID := args[0]
 
 	if err := initMessageDB(); err != nil {
 		return err
 	}
-	// Get unread message IDs and sender JIDs for sending read receipts
+	chatJID = canonicalJID(normalizeJID(chatJID))
+	bound, err := markReadBound(chatJID, beforeArg, upTo)
+	if err != nil {
+		return err
+	}
+	messageIDs, senderJID, err := unreadMessages(chatJID, bound)
+	if err != nil {
+		return err
+	}
+
+	// Send read receipts to WhatsApp if there are unread messages,
+	// unless the chat is configured to stay silent
+	receiptsSent := 0
+	suppressed := receiptsSuppressed(chatJID)
+	if len(messageIDs) > 0 && !suppressed {
+		ctx := context.Background()
+		if err := initClient(ctx); err != nil {
+			return err
+		}
+
+		if client.Store.ID != nil {
+			// Refused rather than skipped, so the receipts aren't silently lost
+			if err := lockSession(); err != nil {
+				return err
+			}
+			if err := connectSession(); err == nil {
+				defer client.Disconnect()
+				// Wait for connection to stabilize before sending read receipts
+				time.Sleep(2 * time.Second)
+
+				receiptsSent = sendReadReceipts(ctx, chatJID, messageIDs, senderJID)
+			}
+		}
+	}
+
+	affected, err := markChatReadLocally(chatJID, bound)
+	if err != nil {
+		return err
+	}
+
+	output := map[string]any{
+		"success":         true,
+		"chat_jid":        chatJID,
+		"messages_marked": affected,
+		"receipts_sent":   receiptsSent,
+	}
+	if bound.upToID != "" {
+		output["up_to"] = bound.upToID
+	} else if bound.set {
+		output["before"] = bound.before
+	}
+	if suppressed {
+		output["receipts_suppressed"] = true
+	}
+	return printJSON(output)
+}
+
+// readBound limits mark-read to older messages: those before a time, or with
+// --up-to those up to and including a message, ordered by (timestamp, rowid)
+// so messages sent in the same second after it stay unread. The zero value
+// marks everything.
+type readBound struct {
+	set    bool
+	before int64 // Unix time messages must be older than, for --before
+	upToID string
+	// The --up-to message's position
+	upToTime, upToRowID int64
+}
+
+// where returns the SQL condition selecting messages within the bound.
+func (b readBound) where() (string, []any) {
+	switch {
+	case !b.set:
+		return "1 = 1", nil
+	case b.upToID != "":
+		return "(timestamp < ? OR (timestamp = ? AND rowid <= ?))", []any{b.upToTime, b.upToTime, b.upToRowID}
+	default:
+		return "timestamp < ?", []any{b.before}
+	}
+}
+
+// markReadBound turns mark-read's --before time or --up-to message into a
+// readBound. The --up-to message must be in the chat.
+func markReadBound(chatJID, before, upTo string) (readBound, error) {
+	switch {
+	case before != "":
+		t, err := parseTimestamp(before)
+		if err != nil {
+			return readBound{}, err
+		}
+		return readBound{set: true, before: t.Unix()}, nil
+	case upTo != "":
+		messageID, resolvedChat, err := resolveMessage(upTo, chatJID)
+		if err != nil {
+			return readBound{}, err
+		}
+		if resolvedChat != chatJID {
+			return readBound{}, fmt.Errorf("message %s is in %s, not %s", upTo, resolvedChat, chatJID)
+		}
+		b := readBound{set: true, upToID: messageID}
+		err = messageDB.QueryRow(`SELECT timestamp, rowid FROM messages WHERE id = ? AND chat_jid = ?`,
+			messageID, resolvedChat).Scan(&b.upToTime, &b.upToRowID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return readBound{}, fmt.Errorf("message %s not found in %s", upTo, chatJID)
+		}
+		if err != nil {
+			return readBound{}, fmt.Errorf("failed to look up message: %w", err)
+		}
+		return b, nil
+	}
+	return readBound{}, nil
+}
+
+// unreadMessages returns the IDs of unread incoming messages in a chat within
+// bound, newest first, and the sender of the newest one.
+func unreadMessages(chatJID string, bound readBound) ([]string, string, error) {
+	cond, condArgs := bound.where()
 	rows, err := messageDB.Query(`
 		SELECT id, sender_jid FROM messages
-		WHERE chat_jid = ? AND is_read = 0 AND is_from_me = 0
-		ORDER BY timestamp DESC
-	`, chatJID)
+		WHERE chat_jid = ? AND is_read = 0 AND is_from_me = 0 AND `+cond+`
+		ORDER BY timestamp DESC, rowid DESC
+	`, append([]any{chatJID}, condArgs...)...)
 	if err != nil {
-		return fmt.Errorf("failed to query unread messages: %w", err)
+		return nil, "", fmt.Errorf("failed to query unread messages: %w", err)
 	}
+	defer func() { _ = rows.Close() }()
 
 	var messageIDs []string
 	var senderJID string
 	for rows.Next() {
 		var id, sender string
 		if err := rows.Scan(&id, &sender); err != nil {
-			_ = rows.Close()
-			return fmt.Errorf("failed to scan row: %w", err)
+			return nil, "", fmt.Errorf("failed to scan row: %w", err)
 		}
 		messageIDs = append(messageIDs, id)
 		if senderJID == "" {
 			senderJID = sender
 		}
 	}
-	_ = rows.Close()
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("failed to iterate rows: %w", err)
+		return nil, "", fmt.Errorf("failed to iterate rows: %w", err)
 	}
+	return messageIDs, senderJID, nil
+}
 
-	// Send read receipts to WhatsApp if there are unread messages
-	receiptsSent := 0
-	if len(messageIDs) > 0 {
-		ctx := context.Background()
-		if err := initClient(ctx); err != nil {
-			return err
-		}
+// sendReadReceipts sends read receipts for messageIDs over the connected
+// client and returns how many were sent. Failures are warnings.
+func sendReadReceipts(ctx context.Context, chatJID string, messageIDs []string, senderJID string) int {
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return 0
+	}
+	// For groups, we need the sender JID; for DMs, sender is the chat JID
+	var sender types.JID
+	if strings.HasSuffix(chatJID, "@g.us") && senderJID != "" {
+		sender, _ = types.ParseJID(senderJID)
+	} else {
+		sender = jid
+	}
 
-		if client.Store.ID != nil {
-			if err := client.Connect(); err == nil {
-				defer client.Disconnect()
-				// Wait for connection to stabilize before sending read receipts
-				time.Sleep(2 * time.Second)
+	// Convert string IDs to MessageID type
+	msgIDs := make([]types.MessageID, len(messageIDs))
+	copy(msgIDs, messageIDs)
 
-				// Parse chat JID
-				jid, err := types.ParseJID(chatJID)
-				if err == nil {
-					// For groups, we need the sender JID; for DMs, sender is the chat JID
-					var sender types.JID
-					if strings.HasSuffix(chatJID, "@g.us") && senderJID != "" {
-						sender, _ = types.ParseJID(senderJID)
-					} else {
-						sender = jid
-					}
+	if err := client.MarkRead(ctx, msgIDs, time.Now(), jid, sender); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send read receipts: %v\n", err)
+		return 0
+	}
+	return len(messageIDs)
+}
 
-					// Convert string IDs to MessageID type
-					msgIDs := make([]types.MessageID, len(messageIDs))
-					copy(msgIDs, messageIDs)
+// markChatReadLocally marks messages in a chat as read in the local DB: all of
+// them, clearing its "marked as unread" flag, or only those older than before.
+func markChatReadLocally(chatJID string, bound readBound) (int64, error) {
+	cond, condArgs := bound.where()
+	result, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE chat_jid = ? AND is_read = 0 AND `+cond,
+		append([]any{chatJID}, condArgs...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
+	affected, _ := result.RowsAffected()
 
-					// Send read receipt
-					if err := client.MarkRead(ctx, msgIDs, time.Now(), jid, sender); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: failed to send read receipts: %v\n", err)
-					} else {
-						receiptsSent = len(messageIDs)
-					}
-				}
-			}
-		}
+	// Clear the "marked as unread" flag if set; a partial read leaves it
+	if !bound.set {
+		_, _ = messageDB.Exec(`UPDATE chats SET marked_as_unread = 0 WHERE jid = ?`, chatJID)
 	}
+	return affected, nil
+}
 
-	// Mark all messages in the chat as read in local DB
-	result, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE chat_jid = ? AND is_read = 0`, chatJID)
+// cmdMarkUnread marks a chat as unread on every device, the inverse of
+// mark-read. WhatsApp keys the mutation to the chat's latest message.
+func cmdMarkUnread(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: mark-unread <chat-jid>")
+	}
+	jid, err := types.ParseJID(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to mark messages as read: %w", err)
+		return fmt.Errorf("invalid chat JID: %w", err)
 	}
+	chatJID := normalizeJID(jid.String())
 
-	affected, _ := result.RowsAffected()
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	var lastTime time.Time
+	var lastKey *waCommon.MessageKey
+	var id, senderJID string
+	var timestamp int64
+	var isFromMe int
+	err = messageDB.QueryRow(`
+		SELECT id, sender_jid, timestamp, is_from_me FROM messages
+		WHERE chat_jid = ? ORDER BY timestamp DESC LIMIT 1
+	`, chatJID).Scan(&id, &senderJID, &timestamp, &isFromMe)
+	if err == nil {
+		lastTime = time.Unix(timestamp, 0)
+		lastKey = &waCommon.MessageKey{
+			RemoteJID: proto.String(jid.String()),
+			FromMe:    proto.Bool(isFromMe == 1),
+			ID:        proto.String(id),
+		}
+		if jid.Server == types.GroupServer && isFromMe == 0 {
+			lastKey.Participant = proto.String(senderJID)
+		}
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
 
-	// Clear the "marked as unread" flag if set
-	_, _ = messageDB.Exec(`UPDATE chats SET marked_as_unread = 0 WHERE jid = ?`, chatJID)
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
 
-	output := map[string]any{
-		"success":         true,
-		"chat_jid":        chatJID,
-		"messages_marked": affected,
-		"receipts_sent":   receiptsSent,
+	if err := client.SendAppState(ctx, appstate.BuildMarkChatAsRead(jid, false, lastTime, lastKey)); err != nil {
+		return fmt.Errorf("failed to mark chat as unread: %w", err)
 	}
-	return printJSON(output)
+	if _, err := messageDB.Exec(`UPDATE chats SET marked_as_unread = 1 WHERE jid = ?`, chatJID); err != nil {
+		return fmt.Errorf("failed to mark chat as unread: %w", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":          true,
+		"chat_jid":         chatJID,
+		"marked_as_unread": true,
+	})
 }
 
 // cmdDownload downloads media from a message
 func cmdDownload(args []string) error {
 	if len(args) < 1 {
-		return fmt.Errorf("usage: download <message-id> [--output path]")
+		return fmt.Errorf("usage: download <message-id> [--chat=JID] [--output path]")
 	}
 
 	messageID := args[0]
-	var outputPath string
+	var outputPath, chatJID string
 	for i := 1; i < len(args); i++ {
 		if strings.HasPrefix(args[i], "--output=") {
 			outputPath = strings.TrimPrefix(args[i], "--output=")
 		} else if args[i] == "--output" && i+1 < len(args) {
 			outputPath = args[i+1]
 			i++
+		} else if strings.HasPrefix(args[i], "--chat=") {
+			chatJID = strings.TrimPrefix(args[i], "--chat=")
 		}
 	}
 
@@ -1589,6 +2505,21 @@ func cmdDownload(args []string) error {
 		return err
 	}
 
+	messageID, chatJID, err := resolveMessage(messageID, chatJID)
+	if err != nil {
+		return err
+	}
+	output, err := downloadMessage(context.Background(), messageID, chatJID, outputPath)
+	if err != nil {
+		return err
+	}
+	return printJSON(output)
+}
+
+// downloadMessage saves a message's media to outputPath (default: per
+// media_filename_template) and records where. It reuses the connected client
+// if there is one, otherwise connects for the download.
+func downloadMessage(ctx context.Context, messageID, chatJID, outputPath string) (map[string]any, error) {
 	// Look up message to get media metadata
 	var mediaType, mimeType, directPath sql.NullString
 	var mediaKey, fileSHA256, fileEncSHA256 []byte
@@ -1597,82 +2528,66 @@ func cmdDownload(args []string) error {
 
 	err := messageDB.QueryRow(`
 		SELECT media_type, mime_type_full, media_key, file_sha256, file_enc_sha256, file_length, direct_path, media_file_path
-		FROM messages WHERE id = ?
-	`, messageID).Scan(&mediaType, &mimeType, &mediaKey, &fileSHA256, &fileEncSHA256, &fileLength, &directPath, &existingPath)
+		FROM messages WHERE id = ? AND chat_jid = ?
+	`, messageID, chatJID).Scan(&mediaType, &mimeType, &mediaKey, &fileSHA256, &fileEncSHA256, &fileLength, &directPath, &existingPath)
 	if errors.Is(err, sql.ErrNoRows) {
-		return fmt.Errorf("message not found: %s", messageID)
+		return nil, fmt.Errorf("message not found: %s", messageID)
 	}
 	if err != nil {
-		return fmt.Errorf("failed to query message: %w", err)
+		return nil, fmt.Errorf("failed to query message: %w", err)
 	}
 
 	// Check if this is a media message
 	if !mediaType.Valid || mediaType.String == "" {
-		return fmt.Errorf("message has no media")
+		return nil, fmt.Errorf("message has no media")
 	}
 	if len(mediaKey) == 0 {
-		return fmt.Errorf("message has no download metadata (media_key missing)")
+		return nil, fmt.Errorf("message has no download metadata (media_key missing)")
 	}
 
 	// Check if already downloaded
 	if existingPath.Valid && existingPath.String != "" {
 		// Verify file still exists
 		if _, err := os.Stat(existingPath.String); err == nil {
+			ensureThumbnail(messageID, chatJID, mediaType.String, existingPath.String, fileSHA256)
 			output := map[string]any{
 				"success":    true,
 				"message_id": messageID,
 				"file":       existingPath.String,
 				"cached":     true,
 			}
-			return printJSON(output)
+			return output, nil
 		}
 	}
 
 	// Determine output path if not specified
 	if outputPath == "" {
-		// Use XDG data dir: ~/.local/share/jean-claude/whatsapp/media/
-		home, _ := os.UserHomeDir()
-		mediaDir := filepath.Join(home, ".local", "share", "jean-claude", "whatsapp", "media")
-		if err := os.MkdirAll(mediaDir, 0755); err != nil {
-			return fmt.Errorf("failed to create media directory: %w", err)
+		// Default: media_filename_template inside the media directory
+		outputPath = mediaPathForMessage(messageID, chatJID, mediaType.String, mimeType.String, fileSHA256)
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create media directory: %w", err)
 		}
 
-		// Use file hash as filename to deduplicate
-		ext := getExtensionFromMime(mimeType.String)
-		filename := hex.EncodeToString(fileSHA256) + ext
-		outputPath = filepath.Join(mediaDir, filename)
-
 		// Check if file already exists (downloaded via another message with same content)
-		if _, err := os.Stat(outputPath); err == nil {
-			// Update message with existing file path
-			_, _ = messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = ?`, outputPath, messageID)
+		if placeCachedMedia(messageID, chatJID, outputPath, fileSHA256) {
+			ensureThumbnail(messageID, chatJID, mediaType.String, outputPath, fileSHA256)
 			output := map[string]any{
 				"success":    true,
 				"message_id": messageID,
 				"file":       outputPath,
 				"cached":     true,
 			}
-			return printJSON(output)
+			return output, nil
 		}
 	}
 
-	// Need to connect to WhatsApp to download
-	ctx := context.Background()
-	if err := initClient(ctx); err != nil {
-		return err
-	}
-
-	if client.Store.ID == nil {
-		return fmt.Errorf("not authenticated. Run 'auth' first")
-	}
-
-	if err := client.Connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	// Need to connect to WhatsApp to download, unless the daemon already is
+	if client == nil || !client.IsConnected() {
+		if err := connectClient(ctx); err != nil {
+			return nil, err
+		}
+		defer client.Disconnect()
 	}
-	defer client.Disconnect()
-
-	// Wait for connection
-	time.Sleep(2 * time.Second)
 
 	// Download using whatsmeow
 	waMediaType, mmsType := mediaTypeToWA(mediaType.String)
@@ -1687,16 +2602,17 @@ func cmdDownload(args []string) error {
 		mmsType,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to download media: %w", err)
+		return nil, fmt.Errorf("failed to download media: %w", err)
 	}
 
 	// Write to file
 	if err := os.WriteFile(outputPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return nil, fmt.Errorf("failed to write file: %w", err)
 	}
 
 	// Update message with file path
-	_, _ = messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = ?`, outputPath, messageID)
+	_, _ = messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = ? AND chat_jid = ?`, outputPath, messageID, chatJID)
+	ensureThumbnail(messageID, chatJID, mediaType.String, outputPath, fileSHA256)
 
 	output := map[string]any{
 		"success":    true,
@@ -1705,7 +2621,7 @@ func cmdDownload(args []string) error {
 		"size":       len(data),
 		"cached":     false,
 	}
-	return printJSON(output)
+	return output, nil
 }
 
 // cmdStatus shows connection status
@@ -1719,6 +2635,7 @@ func cmdStatus() error {
 		"authenticated": client.Store.ID != nil,
 		"config_dir":    configDir,
 		"data_dir":      dataDir,
+		"media_dir":     mediaDir(),
 	}
 
 	if client.Store.ID != nil {
@@ -1743,6 +2660,8 @@ func cmdLogout() error {
 	if err := client.Logout(context.Background()); err != nil {
 		// Even if logout fails, clear local data
 		fmt.Fprintf(os.Stderr, "Warning: logout request failed: %v\n", err)
+	} else {
+		removeSessionSecrets()
 	}
 
 	fmt.Fprintln(os.Stderr, "Logged out successfully.")
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMarkReadBound(t *testing.T) {
+	openTestDB(t)
+	const chat, other = "12025551234@s.whatsapp.net", "12025555678@s.whatsapp.net"
+	insertTestMessage(t, "A1", chat, 100, "")
+	insertTestMessage(t, "A2", chat, 200, "")
+	insertTestMessage(t, "A3", chat, 200, "") // Same second as A2, but after it
+	insertTestMessage(t, "A4", chat, 300, "")
+	insertTestMessage(t, "B1", other, 150, "")
+
+	unread := func(bound readBound) []string {
+		t.Helper()
+		ids, _, err := unreadMessages(chat, bound)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name, before, upTo string
+		want               []string // Newest first
+	}{
+		{"no bound", "", "", []string{"A4", "A3", "A2", "A1"}},
+		{"before", "200", "", []string{"A1"}},
+		{"before the first message", "0", "", nil},
+		{"up to a message", "", "A2", []string{"A2", "A1"}},
+		{"up to the newest", "", "A4", []string{"A4", "A3", "A2", "A1"}},
+	}
+	for _, tt := range tests {
+		bound, err := markReadBound(chat, tt.before, tt.upTo)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := unread(bound); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: unread = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := markReadBound(chat, "", "B1"); err == nil {
+		t.Error("--up-to accepted a message from another chat")
+	}
+	if _, err := markReadBound(chat, "", "MISSING"); err == nil {
+		t.Error("--up-to accepted a message that isn't stored")
+	}
+
+	bound, err := markReadBound(chat, "", "A2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	marked, err := markChatReadLocally(chat, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked != 2 {
+		t.Errorf("marked %d messages read, want 2", marked)
+	}
+	if got := unread(readBound{}); !slices.Equal(got, []string{"A4", "A3"}) {
+		t.Errorf("after marking up to A2, unread = %q", got)
+	}
+}
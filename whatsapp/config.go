@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Config holds user settings stored in config.json in the config directory.
+// Keys missing from the file keep their zero values, so every setting must
+// default to the behavior the CLI had before the setting existed.
+type Config struct {
+	// AnnouncePresence sends "available" presence after sync connects. The
+	// daemon also repeats it on reconnects and every few minutes. After
+	// presence set unavailable, it repeats "unavailable" instead.
+	// Off by default so the account never appears online to contacts.
+	AnnouncePresence bool `json:"announce_presence"`
+
+	// ReadOnly makes every run behave as with --read-only. config set can't
+	// turn it off while it's on; edit config.json instead.
+	ReadOnly bool `json:"read_only"`
+
+	// SuppressGroupReceipts stops read receipts for every group chat, in
+	// addition to chats configured individually via chat-settings.
+	SuppressGroupReceipts bool `json:"suppress_group_receipts"`
+
+	// RetainMessages is how long to keep messages (e.g. "2y"). Older messages
+	// are pruned after each sync and daemon tick, except starred ones. Empty
+	// keeps everything.
+	RetainMessages string `json:"retain_messages"`
+
+	// PurgeDisappearing deletes local copies of messages sent with a
+	// disappearing timer once their timer has run out, like the phone does.
+	// Messages from before a chat's timer was turned on are kept. Off by
+	// default so the local archive keeps them.
+	PurgeDisappearing bool `json:"purge_disappearing"`
+
+	// RetainMedia is how long to keep downloaded media files (e.g. "90d").
+	// Message rows keep their download metadata, so files can be re-fetched.
+	RetainMedia string `json:"retain_media"`
+
+	// MediaCacheMaxSize caps downloaded media (e.g. "5GB"). Past it, the
+	// oldest files are deleted after each sync and daemon tick, those that can
+	// be downloaded again first. Empty doesn't cap it.
+	MediaCacheMaxSize string `json:"media_cache_max_size"`
+
+	// MediaDir is where downloaded media is stored (default: data dir/media).
+	// Changing it moves existing files on the next run. WHATSAPP_MEDIA_DIR
+	// takes precedence.
+	MediaDir string `json:"media_dir"`
+
+	// MediaFilenameTemplate names downloaded files relative to the media
+	// directory, e.g. "{chat_name}/{date}_{sender}_{id}{ext}". Identical
+	// content is hardlinked rather than downloaded twice. Default: "{sha256}{ext}".
+	MediaFilenameTemplate string `json:"media_filename_template"`
+
+	// IgnoreChats lists chats (JIDs, or bare numbers for DMs) whose messages
+	// sync and the daemon don't save, e.g. noisy large groups.
+	IgnoreChats []string `json:"ignore_chats"`
+
+	// OnlyChats, if non-empty, restricts saving to just these chats.
+	// IgnoreChats still applies on top.
+	OnlyChats []string `json:"only_chats"`
+
+	// MediaSkipGroups stops automatic media downloads (--with-media, bulk
+	// export) from group chats. Explicit download <id> still works.
+	MediaSkipGroups bool `json:"media_skip_groups"`
+
+	// MediaMaxSize skips automatic downloads of files larger than this (e.g. "20MB").
+	MediaMaxSize string `json:"media_max_size"`
+
+	// MediaSkipTypes lists media types never downloaded automatically,
+	// e.g. ["video", "document"].
+	MediaSkipTypes []string `json:"media_skip_types"`
+
+	// DesktopNotifications shows a native notification (notify-send,
+	// terminal-notifier or osascript) for each message the notification rules
+	// let through while watch or the daemon runs.
+	DesktopNotifications bool `json:"desktop_notifications"`
+
+	// QuietHours silences desktop notifications during a local-time range,
+	// e.g. "22:00-07:00". Empty never silences them.
+	QuietHours string `json:"quiet_hours"`
+
+	// OnMessage, OnReceipt, OnCall and OnGroupChange are shell commands run
+	// for each such event while sync or the daemon is connected, with the
+	// event as JSON on stdin. on_message follows the notification rules.
+	OnMessage     string `json:"on_message"`
+	OnReceipt     string `json:"on_receipt"`
+	OnCall        string `json:"on_call"`
+	OnGroupChange string `json:"on_group_change"`
+
+	// Script is a Starlark file whose on_message(msg) the daemon calls for
+	// each message the notification rules let through. It can call send,
+	// mark_read and download.
+	Script string `json:"script"`
+
+	// Plugins are shell commands the daemon keeps running, speaking JSON-RPC
+	// 2.0 over stdio: events arrive on stdin as "event" notifications, and
+	// requests on stdout get responses on stdin (see plugins.go).
+	Plugins []string `json:"plugins"`
+
+	// Backups is how many backups of messages.db to keep. When set, the
+	// database is also backed up daily while the daemon runs. It is always
+	// backed up before a new version migrates it; 0 (the default) keeps just
+	// the latest of those.
+	Backups int `json:"backups"`
+
+	// BackupDir is where backups go (default: data dir/backups). Another disk
+	// protects against that one failing.
+	BackupDir string `json:"backup_dir"`
+
+	// SessionKeyring keeps the session's private keys in the OS keyring
+	// (macOS Keychain, or the Secret Service via secret-tool) rather than in
+	// session.db. Turning it on or off moves them on the next run.
+	SessionKeyring bool `json:"session_keyring"`
+
+	// WebhookURL receives a JSON POST for each new incoming message while sync
+	// or the daemon is connected, subject to the notification rules.
+	WebhookURL string `json:"webhook_url"`
+
+	// WebhookSecret signs webhook bodies (HMAC-SHA256, X-Signature-256 header).
+	WebhookSecret string `json:"webhook_secret"`
+
+	// WebhookEvents selects what is posted: "message", "receipt", "reaction",
+	// "alert". Default: ["message", "alert"].
+	WebhookEvents []string `json:"webhook_events"`
+}
+
+// validate checks settings that JSON decoding alone can't.
+func (c *Config) validate() error {
+	for key, value := range map[string]string{
+		"retain_messages": c.RetainMessages,
+		"retain_media":    c.RetainMedia,
+	} {
+		if value == "" {
+			continue
+		}
+		if _, err := parseAge(value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	for key, list := range map[string][]string{
+		"ignore_chats": c.IgnoreChats,
+		"only_chats":   c.OnlyChats,
+		"plugins":      c.Plugins,
+	} {
+		for _, entry := range list {
+			if entry == "" {
+				return fmt.Errorf("%s: entries must not be empty", key)
+			}
+		}
+	}
+	for key, value := range map[string]string{
+		"media_max_size":       c.MediaMaxSize,
+		"media_cache_max_size": c.MediaCacheMaxSize,
+	} {
+		if value == "" {
+			continue
+		}
+		if _, err := parseSize(value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if c.Backups < 0 {
+		return fmt.Errorf("backups: must not be negative")
+	}
+	if c.QuietHours != "" {
+		if _, _, err := parseQuietHours(c.QuietHours); err != nil {
+			return fmt.Errorf("quiet_hours: %w", err)
+		}
+	}
+	if c.WebhookURL != "" {
+		if u, err := url.Parse(c.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook_url: expected an http(s) URL, got %q", c.WebhookURL)
+		}
+	}
+	for _, event := range c.WebhookEvents {
+		if event != webhookMessage && event != webhookReceipt && event != webhookReaction && event != webhookAlert {
+			return fmt.Errorf("webhook_events: unknown event %q (expected message, receipt, reaction, or alert)", event)
+		}
+	}
+	if c.MediaFilenameTemplate != "" {
+		if err := validateMediaTemplate(c.MediaFilenameTemplate); err != nil {
+			return fmt.Errorf("media_filename_template: %w", err)
+		}
+	}
+	return nil
+}
+
+// cfg is the loaded configuration, populated by loadConfig in main.
+var cfg Config
+
+func configPath() string {
+	return filepath.Join(configDir, "config.json")
+}
+
+// loadConfig reads config.json into cfg. A missing file leaves the defaults.
+func loadConfig() error {
+	data, err := os.ReadFile(configPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", configPath(), err)
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("invalid config %s: %w", configPath(), err)
+	}
+	return nil
+}
+
+// cmdConfig shows or edits config.json: config [show | set <key> <value> | unset <key>]
+func cmdConfig(args []string) error {
+	if len(args) == 0 || args[0] == "show" {
+		return printJSON(cfg)
+	}
+
+	switch args[0] {
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: config set <key> <value>")
+		}
+		// Values are parsed as JSON so booleans, numbers, and lists keep their
+		// types; anything that isn't valid JSON is stored as a plain string.
+		var value any
+		if err := json.Unmarshal([]byte(args[2]), &value); err != nil {
+			value = args[2]
+		}
+		return updateConfigFile(func(raw map[string]any) { raw[args[1]] = value })
+	case "unset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: config unset <key>")
+		}
+		return updateConfigFile(func(raw map[string]any) { delete(raw, args[1]) })
+	default:
+		return fmt.Errorf("unknown config subcommand: %s (expected show, set, or unset)", args[0])
+	}
+}
+
+// updateConfigFile applies edit to the raw contents of config.json, validates the
+// result against Config, and writes it back. Editing the raw map rather than cfg
+// preserves keys exactly as the user wrote them.
+func updateConfigFile(edit func(raw map[string]any)) error {
+	raw := map[string]any{}
+	data, err := os.ReadFile(configPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", configPath(), err)
+		}
+	}
+
+	edit(raw)
+
+	out, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	// Reject unknown keys and mistyped values before touching the file
+	var updated Config
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&updated); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if err := updated.validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(configPath(), append(out, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	cfg = updated
+	return printJSON(cfg)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// mergeColumns lists every column holding a person's JID. A merge rewrites
+// each of them from the alias to the canonical JID, journaling the row IDs.
+var mergeColumns = []struct{ table, column string }{
+	{"messages", "chat_jid"},
+	{"messages", "sender_jid"},
+	{"messages", "reply_to_sender"},
+	{"reactions", "chat_jid"},
+	{"reactions", "sender_jid"},
+	{"receipts", "chat_jid"},
+	{"receipts", "participant_jid"},
+	{"chat_settings", "chat_jid"},
+	{"polls", "chat_jid"},
+	{"poll_votes", "chat_jid"},
+	{"poll_votes", "voter_jid"},
+	{"mentions", "chat_jid"},
+	{"mentions", "mentioned_jid"},
+	{"link_previews", "chat_jid"},
+	{"participants", "jid"},
+	{"group_events", "actor_jid"},
+	{"group_events", "target_jid"},
+	{"presence_log", "jid"},
+	{"calls", "caller_jid"},
+}
+
+// canonicalJID maps a merged alias to its canonical JID so new messages from an
+// old identity land in the merged chat. Unmerged JIDs are returned unchanged.
+func canonicalJID(jid string) string {
+	if jid == "" {
+		return jid
+	}
+	var canonical string
+	if err := messageDB.QueryRow(`SELECT canonical_jid FROM contact_aliases WHERE alias_jid = ?`, jid).Scan(&canonical); err != nil {
+		return jid
+	}
+	return canonical
+}
+
+// cmdContactsMerge rewrites an alias JID to a canonical one across messages,
+// chats, and reactions, e.g. for a person's old number or their lid identity.
+// Usage: contacts merge <canonical-jid> <alias-jid> | contacts merge --suggest
+func cmdContactsMerge(args []string) error {
+	if len(args) == 1 && args[0] == "--suggest" {
+		return cmdContactsSuggest()
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: contacts merge <canonical-jid> <alias-jid> | contacts merge --suggest")
+	}
+	canonical, alias := args[0], args[1]
+	if canonical == alias {
+		return fmt.Errorf("cannot merge a JID into itself")
+	}
+	if strings.HasSuffix(canonical, "@g.us") || strings.HasSuffix(alias, "@g.us") {
+		return fmt.Errorf("only contacts can be merged, not groups")
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	var existing string
+	err := messageDB.QueryRow(`SELECT canonical_jid FROM contact_aliases WHERE alias_jid = ?`, canonical).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("%s is already merged into %s; merge into that instead", canonical, existing)
+	}
+	err = messageDB.QueryRow(`SELECT canonical_jid FROM contact_aliases WHERE alias_jid = ?`, alias).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("%s is already merged into %s; unmerge it first", alias, existing)
+	}
+
+	tx, err := messageDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rewritten := map[string]int64{}
+	for _, mc := range mergeColumns {
+		// SAFETY: table and column names come from mergeColumns, not user input
+		if _, err := tx.Exec(`
+			INSERT INTO contact_merge_log (alias_jid, table_name, column_name, row_id)
+			SELECT ?, ?, ?, rowid FROM `+mc.table+` WHERE `+mc.column+` = ?
+		`, alias, mc.table, mc.column, alias); err != nil {
+			return fmt.Errorf("failed to journal %s.%s: %w", mc.table, mc.column, err)
+		}
+		// OR IGNORE: a row that would collide (e.g. both identities reacted to
+		// the same message) stays under the alias rather than replacing the other
+		result, err := tx.Exec(`UPDATE OR IGNORE `+mc.table+` SET `+mc.column+` = ? WHERE `+mc.column+` = ?`, canonical, alias)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite %s.%s: %w", mc.table, mc.column, err)
+		}
+		n, _ := result.RowsAffected()
+		rewritten[mc.table] += n
+	}
+
+	// Fold the alias chat into the canonical one, remembering its name for unmerge
+	var aliasChatName sql.NullString
+	_ = tx.QueryRow(`SELECT name FROM chats WHERE jid = ?`, alias).Scan(&aliasChatName)
+	if _, err := tx.Exec(`
+		INSERT INTO chats (jid, name, is_group, last_message_time, marked_as_unread, updated_at)
+		SELECT ?, name, 0, last_message_time, marked_as_unread, ? FROM chats WHERE jid = ?
+		ON CONFLICT(jid) DO UPDATE SET
+			name = CASE WHEN chats.name IS NULL OR chats.name = '' THEN excluded.name ELSE chats.name END,
+			last_message_time = MAX(COALESCE(chats.last_message_time, 0), COALESCE(excluded.last_message_time, 0)),
+			marked_as_unread = MAX(chats.marked_as_unread, excluded.marked_as_unread),
+			updated_at = excluded.updated_at
+	`, canonical, time.Now().Unix(), alias); err != nil {
+		return fmt.Errorf("failed to merge chats: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM chats WHERE jid = ?`, alias); err != nil {
+		return fmt.Errorf("failed to remove alias chat: %w", err)
+	}
+
+	// Give the canonical contact the alias's names if it has none. The alias
+	// contact row is kept so names survive an unmerge.
+	if _, err := tx.Exec(`
+		INSERT INTO contacts (jid, name, push_name, updated_at)
+		SELECT ?, name, push_name, updated_at FROM contacts WHERE jid = ?
+		ON CONFLICT(jid) DO UPDATE SET
+			name = COALESCE(NULLIF(contacts.name, ''), excluded.name),
+			push_name = COALESCE(NULLIF(contacts.push_name, ''), excluded.push_name)
+	`, canonical, alias); err != nil {
+		return fmt.Errorf("failed to merge contacts: %w", err)
+	}
+
+	// Anything previously merged into the alias now points at the canonical JID
+	if _, err := tx.Exec(`UPDATE contact_aliases SET canonical_jid = ? WHERE canonical_jid = ?`, canonical, alias); err != nil {
+		return fmt.Errorf("failed to update aliases: %w", err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO contact_aliases (alias_jid, canonical_jid, alias_chat_name, merged_at)
+		VALUES (?, ?, ?, ?)
+	`, alias, canonical, aliasChatName, time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to record alias: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	output := map[string]any{
+		"success":       true,
+		"canonical_jid": canonical,
+		"alias_jid":     alias,
+		"rewritten":     rewritten,
+	}
+	return printJSON(output)
+}
+
+// cmdContactsUnmerge reverses a merge using the journal of rewritten rows.
+// Usage: contacts unmerge <alias-jid>
+func cmdContactsUnmerge(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: contacts unmerge <alias-jid>")
+	}
+	alias := args[0]
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	var canonical string
+	var aliasChatName sql.NullString
+	err := messageDB.QueryRow(`SELECT canonical_jid, alias_chat_name FROM contact_aliases WHERE alias_jid = ?`, alias).
+		Scan(&canonical, &aliasChatName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s is not merged into another contact", alias)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up alias: %w", err)
+	}
+
+	tx, err := messageDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	restored := map[string]int64{}
+	for _, mc := range mergeColumns {
+		// Only restore rows that still hold the canonical JID; later edits win
+		result, err := tx.Exec(`
+			UPDATE OR IGNORE `+mc.table+` SET `+mc.column+` = ?
+			WHERE `+mc.column+` = ? AND rowid IN (
+				SELECT row_id FROM contact_merge_log
+				WHERE alias_jid = ? AND table_name = ? AND column_name = ?
+			)
+		`, alias, canonical, alias, mc.table, mc.column)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s.%s: %w", mc.table, mc.column, err)
+		}
+		n, _ := result.RowsAffected()
+		restored[mc.table] += n
+	}
+
+	// Recreate the alias chat from its restored messages
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO chats (jid, name, is_group, last_message_time, updated_at)
+		SELECT ?, ?, 0, MAX(timestamp), ? FROM messages WHERE chat_jid = ?
+		HAVING COUNT(*) > 0
+	`, alias, aliasChatName.String, time.Now().Unix(), alias); err != nil {
+		return fmt.Errorf("failed to restore alias chat: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM contact_merge_log WHERE alias_jid = ?`, alias); err != nil {
+		return fmt.Errorf("failed to clear merge journal: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM contact_aliases WHERE alias_jid = ?`, alias); err != nil {
+		return fmt.Errorf("failed to remove alias: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit unmerge: %w", err)
+	}
+
+	output := map[string]any{
+		"success":       true,
+		"canonical_jid": canonical,
+		"alias_jid":     alias,
+		"restored":      restored,
+	}
+	return printJSON(output)
+}
+
+// cmdContactsSuggest lists likely duplicate identities without changing anything:
+// lid JIDs whose phone number is known to the session store, and separate
+// contacts sharing the same saved name.
+func cmdContactsSuggest() error {
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	// Every individual JID we hold data for, excluding existing aliases
+	rows, err := messageDB.Query(`
+		SELECT jid FROM (
+			SELECT jid FROM contacts
+			UNION SELECT jid FROM chats WHERE is_group = 0
+			UNION SELECT DISTINCT sender_jid FROM messages
+		)
+		WHERE jid != '' AND jid NOT LIKE '%@g.us'
+			AND jid NOT IN (SELECT alias_jid FROM contact_aliases)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query contacts: %w", err)
+	}
+	known := map[string]bool{}
+	var jids []string
+	for rows.Next() {
+		var jid string
+		if err := rows.Scan(&jid); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		known[jid] = true
+		jids = append(jids, jid)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	sort.Strings(jids)
+
+	suggestions := []map[string]any{}
+	seen := map[string]bool{}
+
+	// lid -> phone number mappings come from the session store
+	ctx := context.Background()
+	if err := initClient(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: skipping lid suggestions: %v\n", err)
+	} else {
+		for _, jid := range jids {
+			parsed, err := types.ParseJID(jid)
+			if err != nil || parsed.Server != types.HiddenUserServer {
+				continue
+			}
+			pn, err := client.Store.LIDs.GetPNForLID(ctx, parsed.ToNonAD())
+			if err != nil || pn.IsEmpty() {
+				continue
+			}
+			pnJID := pn.ToNonAD().String()
+			if !known[pnJID] {
+				continue
+			}
+			seen[pnJID+" "+jid] = true
+			suggestions = append(suggestions, map[string]any{
+				"canonical_jid": pnJID,
+				"alias_jid":     jid,
+				"reason":        "lid",
+			})
+		}
+	}
+
+	// Same saved name on different JIDs (often an old and a new number)
+	rows, err = messageDB.Query(`
+		SELECT a.jid, b.jid, a.name FROM contacts a
+		JOIN contacts b ON LOWER(a.name) = LOWER(b.name) AND a.jid < b.jid
+		WHERE a.name IS NOT NULL AND a.name != ''
+			AND a.jid NOT LIKE '%@g.us' AND b.jid NOT LIKE '%@g.us'
+			AND a.jid NOT IN (SELECT alias_jid FROM contact_aliases)
+			AND b.jid NOT IN (SELECT alias_jid FROM contact_aliases)
+		ORDER BY a.name, a.jid, b.jid
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query contacts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var canonical, alias, name string
+		if err := rows.Scan(&canonical, &alias, &name); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if seen[canonical+" "+alias] || seen[alias+" "+canonical] {
+			continue
+		}
+		suggestions = append(suggestions, map[string]any{
+			"canonical_jid": canonical,
+			"alias_jid":     alias,
+			"reason":        "same_name",
+			"name":          name,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return printJSON(suggestions)
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestContactsMergeAndUnmerge(t *testing.T) {
+	openTestDB(t)
+	canonical, alias := "12025551234@s.whatsapp.net", "123456789@lid"
+	insertTestMessage(t, "old", canonical, 100, "")
+	insertTestMessage(t, "new", alias, 200, "")
+
+	chatOf := func(id string) string {
+		t.Helper()
+		var chat string
+		if err := messageDB.QueryRow(`SELECT chat_jid FROM messages WHERE id = ?`, id).Scan(&chat); err != nil {
+			t.Fatalf("message %s: %v", id, err)
+		}
+		return chat
+	}
+
+	if err := cmdContactsMerge([]string{canonical, alias}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if got := chatOf("new"); got != canonical {
+		t.Errorf("after merge, message is in %s, want %s", got, canonical)
+	}
+	if got := canonicalJID(alias); got != canonical {
+		t.Errorf("canonicalJID(alias) = %s, want %s", got, canonical)
+	}
+	if err := cmdContactsMerge([]string{canonical, alias}); err == nil {
+		t.Error("merging an alias twice succeeded")
+	}
+
+	if err := cmdContactsUnmerge([]string{alias}); err != nil {
+		t.Fatalf("unmerge: %v", err)
+	}
+	if got := chatOf("new"); got != alias {
+		t.Errorf("after unmerge, message is in %s, want %s", got, alias)
+	}
+	if got := chatOf("old"); got != canonical {
+		t.Errorf("unmerge moved the canonical chat's own message to %s", got)
+	}
+	if got := canonicalJID(alias); got != alias {
+		t.Errorf("canonicalJID(alias) after unmerge = %s, want %s", got, alias)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultContextTokens   = 4000 // Budget for context when --max-tokens isn't given
+	defaultContextMessages = 5    // Messages either side for message-context
+)
+
+// contextLine is one transcript line, with the fields used to collapse repeats.
+type contextLine struct {
+	timestamp int64
+	sender    string
+	body      string
+	repeats   int
+}
+
+// cmdContext prints a chat as a compact plain-text transcript for pasting into
+// an LLM prompt: names resolved, media as placeholders, replies inlined, and
+// consecutive repeats collapsed. The newest messages that fit in --max-tokens
+// are kept.
+// Usage: context --chat <jid> [--since 7d] [--max-tokens 4000]
+func cmdContext(args []string) error {
+	usage := fmt.Errorf("usage: context --chat <jid> [--since AGE] [--max-tokens N]")
+	var chatJID string
+	var since time.Duration
+	maxTokens := defaultContextTokens
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return usage
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--chat":
+			chatJID = value
+		case "--since":
+			d, err := parseAge(value)
+			if err != nil {
+				return err
+			}
+			since = d
+		case "--max-tokens":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--max-tokens must be a positive number")
+			}
+			maxTokens = n
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+	}
+	if chatJID == "" {
+		return usage
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	chatJID = canonicalJID(normalizeJID(chatJID))
+
+	var cutoff int64
+	if since > 0 {
+		cutoff = time.Now().Add(-since).Unix()
+	}
+
+	// Our own JID, to name replies to our messages
+	var ownJID sql.NullString
+	_ = messageDB.QueryRow(`SELECT sender_jid FROM messages WHERE is_from_me = 1 LIMIT 1`).Scan(&ownJID)
+
+	rows, err := messageDB.Query(`
+		SELECT m.timestamp, m.is_from_me, m.sender_jid, m.text, m.media_type,
+			COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''), NULLIF(m.sender_name, '')),
+			m.reply_to_sender, m.reply_to_text,
+			COALESCE(NULLIF(rct.name, ''), NULLIF(rct.push_name, ''))
+		FROM messages m
+		LEFT JOIN contacts ct ON ct.jid = m.sender_jid
+		LEFT JOIN contacts rct ON rct.jid = m.reply_to_sender
+		WHERE m.chat_jid = ? AND m.timestamp >= ?
+		ORDER BY m.timestamp DESC, m.rowid DESC
+	`, chatJID, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	// Walk newest first until the budget runs out, then print in order
+	var lines []contextLine
+	tokens := 0
+	truncated := false
+	for rows.Next() {
+		var timestamp int64
+		var isFromMe int
+		var senderJID string
+		var text, mediaType, senderName, replySender, replyText, replyName sql.NullString
+		if err := rows.Scan(&timestamp, &isFromMe, &senderJID, &text, &mediaType, &senderName,
+			&replySender, &replyText, &replyName); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		sender := contextName(senderJID, senderName.String)
+		if isFromMe == 1 {
+			sender = "Me"
+		}
+		body := strings.TrimSpace(text.String)
+		if mediaType.String != "" {
+			body = strings.TrimSpace("[" + mediaType.String + "] " + body)
+		}
+		if body == "" {
+			continue
+		}
+		if replyText.Valid && replyText.String != "" {
+			to := contextName(replySender.String, replyName.String)
+			if ownJID.Valid && replySender.String == ownJID.String {
+				to = "Me"
+			}
+			body = fmt.Sprintf("(re %s: %q) %s", to, truncateRunes(oneLine(replyText.String), 80), body)
+		}
+
+		if n := len(lines); n > 0 && lines[n-1].sender == sender && lines[n-1].body == body {
+			lines[n-1].repeats++
+			lines[n-1].timestamp = timestamp
+			continue
+		}
+		cost := estimateTokens(sender + body)
+		if tokens+cost > maxTokens {
+			truncated = true
+			break
+		}
+		tokens += cost
+		lines = append(lines, contextLine{timestamp: timestamp, sender: sender, body: body, repeats: 1})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	var b strings.Builder
+	name := chatDisplayName(chatJID)
+	if name == "" {
+		name = strings.Split(chatJID, "@")[0]
+	}
+	fmt.Fprintf(&b, "Chat: %s\n", name)
+	if truncated {
+		b.WriteString("(earlier messages omitted)\n")
+	} else if len(lines) == 0 {
+		b.WriteString("(no messages)\n")
+	}
+
+	day := ""
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := lines[i]
+		t := time.Unix(l.timestamp, 0)
+		if d := t.Format("2006-01-02 Mon"); d != day {
+			day = d
+			fmt.Fprintf(&b, "\n## %s\n", day)
+		}
+		fmt.Fprintf(&b, "%s %s: %s", t.Format("15:04"), l.sender, strings.ReplaceAll(l.body, "\n", "\n  "))
+		if l.repeats > 1 {
+			fmt.Fprintf(&b, " (x%d)", l.repeats)
+		}
+		b.WriteString("\n")
+	}
+	return printText(b.String())
+}
+
+// cmdMessageContext lists the messages around one message in its chat, oldest
+// first, since a search result alone lacks the conversation it was part of.
+// Usage: message-context <message-id> [--chat=JID] [--before N] [--after N]
+func cmdMessageContext(args []string) error {
+	usage := fmt.Errorf("usage: message-context <message-id> [--chat=JID] [--before N] [--after N]")
+	if len(args) == 0 || strings.HasPrefix(args[0], "--") {
+		return usage
+	}
+	messageID := args[0]
+	var chatJID string
+	before, after := defaultContextMessages, defaultContextMessages
+	for i := 1; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return usage
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--chat":
+			chatJID = value
+		case "--before", "--after":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s must be a non-negative number", name)
+			}
+			if name == "--before" {
+				before = n
+			} else {
+				after = n
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	messageID, chatJID, err := resolveMessage(messageID, chatJID)
+	if err != nil {
+		return err
+	}
+	var timestamp, rowid int64
+	if err := messageDB.QueryRow(`SELECT timestamp, rowid FROM messages WHERE id = ? AND chat_jid = ?`,
+		messageID, chatJID).Scan(&timestamp, &rowid); err != nil {
+		return fmt.Errorf("message %s not found in %s", messageID, chatJID)
+	}
+
+	// Ordered by (timestamp, rowid), as listings are, so messages sharing a
+	// second keep the order they were saved in
+	const columns = `id, sender_jid, sender_name, timestamp, text, media_type, is_from_me, reply_to_id, rowid`
+	rows, err := messageDB.Query(`
+		SELECT * FROM (
+			SELECT `+columns+` FROM messages
+			WHERE chat_jid = ? AND (timestamp < ? OR (timestamp = ? AND rowid < ?))
+			ORDER BY timestamp DESC, rowid DESC LIMIT ?
+		)
+		UNION ALL
+		SELECT `+columns+` FROM messages WHERE rowid = ?
+		UNION ALL
+		SELECT * FROM (
+			SELECT `+columns+` FROM messages
+			WHERE chat_jid = ? AND (timestamp > ? OR (timestamp = ? AND rowid > ?))
+			ORDER BY timestamp, rowid LIMIT ?
+		)
+		ORDER BY timestamp, rowid
+	`, chatJID, timestamp, timestamp, rowid, before, rowid, chatJID, timestamp, timestamp, rowid, after)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	messages := []map[string]any{}
+	var keys []messageKey
+	for rows.Next() {
+		var id, senderJID string
+		var senderName, text, mediaType, replyToID sql.NullString
+		var ts, rid int64
+		var isFromMe int
+		if err := rows.Scan(&id, &senderJID, &senderName, &ts, &text, &mediaType, &isFromMe, &replyToID, &rid); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		msg := map[string]any{
+			"id":         id,
+			"sender_jid": senderJID,
+			"timestamp":  ts,
+			"is_from_me": isFromMe == 1,
+		}
+		if rid == rowid {
+			msg["is_target"] = true
+		}
+		if senderName.Valid && senderName.String != "" {
+			msg["sender_name"] = senderName.String
+		}
+		if text.Valid {
+			msg["text"] = text.String
+		}
+		if mediaType.Valid && mediaType.String != "" {
+			msg["media_type"] = mediaType.String
+		}
+		if replyToID.Valid && replyToID.String != "" {
+			msg["reply_to_id"] = replyToID.String
+		}
+		messages = append(messages, msg)
+		keys = append(keys, messageKey{ID: id, ChatJID: chatJID})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	assignRefs(messages, keys)
+
+	return printJSON(map[string]any{
+		"chat_jid":   chatJID,
+		"chat_name":  chatDisplayName(chatJID),
+		"message_id": messageID,
+		"count":      len(messages),
+		"messages":   messages,
+	})
+}
+
+// contextName is a display name for a sender, falling back to the phone number.
+func contextName(jid, name string) string {
+	if name != "" {
+		return name
+	}
+	return strings.Split(jid, "@")[0]
+}
+
+// estimateTokens approximates LLM tokens at four characters each, plus a few for
+// the line's timestamp and separators.
+func estimateTokens(s string) int {
+	return (len([]rune(s))+3)/4 + 4
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
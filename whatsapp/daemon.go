@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// defaultDaemonInterval is how often the daemon runs periodic maintenance.
+const defaultDaemonInterval = 5 * time.Minute
+
+// cmdDaemon stays connected to WhatsApp and saves events as they arrive, like a
+// sync that never finishes. Every --interval it runs daemonTick for periodic work.
+// Scripts can reach it through the JSON-RPC control socket (see rpc.go).
+// Usage: daemon [--interval=DURATION]
+func cmdDaemon(args []string) error {
+	interval := defaultDaemonInterval
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--interval="):
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, "--interval="))
+			if err != nil {
+				return err
+			}
+			if d <= 0 {
+				return fmt.Errorf("--interval must be positive")
+			}
+			interval = d
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	ctx := context.Background()
+	if err := initClient(ctx); err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if client.Store.ID == nil {
+		return fmt.Errorf("not authenticated. Run 'auth' first")
+	}
+
+	rules, err := loadRules()
+	if err != nil {
+		return err
+	}
+
+	var messageCount atomic.Int64
+	server, closeSocket, err := listenControlSocket(ctx, &messageCount)
+	if err != nil {
+		return err
+	}
+	defer closeSocket()
+
+	client.AddEventHandler(syncEventHandler(ctx, &messageCount))
+	client.AddEventHandler(notificationHandler(rules))
+	client.AddEventHandler(activityHandler)
+	client.AddEventHandler(presenceLogHandler)
+	// A reconnect starts out unavailable, so announce again on every connect
+	client.AddEventHandler(func(evt interface{}) {
+		if _, ok := evt.(*events.Connected); ok {
+			go announcePresence(ctx)
+		}
+	})
+	client.AddEventHandler(presenceWatchHandler(ctx, rules))
+	ended := watchSessionEnd()
+	installDesktopNotifier()
+	installHooks()
+	defer flushHooks()
+	if err := installScript(server); err != nil {
+		return err
+	}
+	defer startPlugins(server)()
+	if installWebhook() {
+		defer flushWebhooks()
+	}
+
+	if err := connectSession(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Disconnect()
+
+	// Same app state fetch as sync, so read status is current from the start
+	if err := client.FetchAppState(ctx, appstate.WAPatchRegularLow, true, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to fetch app state: %v\n", err)
+	}
+	if err := client.FetchAppState(ctx, appstate.WAPatchRegularHigh, false, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to fetch app state: %v\n", err)
+	}
+	if _, err := refreshGroupCache(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Daemon running (maintenance every %s, control socket %s). Press Ctrl+C to stop.\n",
+		interval, socketPath())
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Messages queued with send --at, including any that fell due while stopped
+	deliverScheduled(ctx)
+	scheduledTicker := time.NewTicker(scheduledCheckInterval)
+	defer scheduledTicker.Stop()
+	presenceTicker := time.NewTicker(presenceRefreshInterval)
+	defer presenceTicker.Stop()
+
+	for {
+		select {
+		case <-sigChan:
+			fmt.Fprintf(os.Stderr, "Daemon stopping. %d messages saved.\n", messageCount.Load())
+			return nil
+		case err := <-ended:
+			fmt.Fprintf(os.Stderr, "Daemon stopping. %d messages saved.\n", messageCount.Load())
+			return err
+		case <-ticker.C:
+			daemonTick()
+		case <-scheduledTicker.C:
+			deliverScheduled(ctx)
+		case <-presenceTicker.C:
+			announcePresence(ctx)
+		}
+	}
+}
+
+// daemonTick runs periodic maintenance. Failures are logged rather than
+// returned so one bad tick doesn't bring the daemon down.
+func daemonTick() {
+	dailyBackup()
+	report, err := runRetention()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: retention failed: %v\n", err)
+	} else if report != nil && (report.MessagesDeleted > 0 || report.MediaFilesDeleted > 0) {
+		fmt.Fprintf(os.Stderr, "Retention: pruned %d messages, %d media files (%d bytes)\n",
+			report.MessagesDeleted, report.MediaFilesDeleted, report.MediaBytesFreed)
+	}
+
+	// Sync fetches names once at the end; chats seen since then have none yet
+	chats, _ := getChatsNeedingNames(50)
+	for _, chat := range chats {
+		if name := getChatName(context.Background(), chat.jid, chat.isGroup); name != "" {
+			if _, err := messageDB.Exec(`UPDATE chats SET name = ?, updated_at = ? WHERE jid = ?`,
+				name, time.Now().Unix(), chat.jid); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save chat name: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+)
+
+// cmdDB maintains the SQLite files without a sqlite3 shell.
+// Usage: db vacuum | db integrity-check | db stats
+func cmdDB(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: db vacuum | db integrity-check | db stats")
+	}
+	switch args[0] {
+	case "vacuum":
+		return cmdDBVacuum()
+	case "integrity-check":
+		return cmdDBIntegrityCheck()
+	case "stats":
+		return cmdDBStats()
+	default:
+		return fmt.Errorf("unknown db subcommand: %s (expected vacuum, integrity-check, or stats)", args[0])
+	}
+}
+
+// maintainedDatabase is a database the db command works on.
+type maintainedDatabase struct {
+	name string // "messages" or "session"
+	path string
+	db   *sql.DB
+}
+
+// openMaintainedDatabases opens messages.db and session.db. closeSession
+// releases session.db; messageDB stays open for main to close.
+func openMaintainedDatabases() (dbs []maintainedDatabase, closeSession func(), err error) {
+	if err := initMessageDB(); err != nil {
+		return nil, nil, err
+	}
+	dbs = []maintainedDatabase{{"messages", filepath.Join(dataDir, "messages.db"), messageDB}}
+	closeSession = func() {}
+
+	// session.db belongs to whatsmeow, so only open one that already exists
+	sessionPath := filepath.Join(configDir, "session.db")
+	if sqliteFileSize(sessionPath) > 0 {
+		session, err := sql.Open("sqlite", "file:"+sessionPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open session database: %w", err)
+		}
+		dbs = append(dbs, maintainedDatabase{"session", sessionPath, session})
+		closeSession = func() { _ = session.Close() }
+	}
+	return dbs, closeSession, nil
+}
+
+// cmdDBVacuum rebuilds each database to reclaim the space of deleted rows,
+// reporting the size before and after. It needs free disk space about the
+// size of the database, and waits for other processes to finish writing.
+func cmdDBVacuum() error {
+	dbs, closeDBs, err := openMaintainedDatabases()
+	if err != nil {
+		return err
+	}
+	defer closeDBs()
+
+	results := map[string]any{}
+	for _, d := range dbs {
+		before := sqliteFileSize(d.path)
+		if _, err := d.db.Exec(`VACUUM`); err != nil {
+			return fmt.Errorf("failed to vacuum %s database: %w", d.name, err)
+		}
+		// In WAL mode the rebuilt pages sit in the WAL until checkpointed
+		if _, err := d.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+			return fmt.Errorf("failed to checkpoint %s database: %w", d.name, err)
+		}
+		after := sqliteFileSize(d.path)
+		results[d.name] = map[string]any{
+			"path":            d.path,
+			"bytes_before":    before,
+			"bytes_after":     after,
+			"bytes_reclaimed": before - after,
+		}
+	}
+	return printJSON(results)
+}
+
+// cmdDBIntegrityCheck runs SQLite's integrity check on each database, which
+// also verifies every index against its table. It fails if any problem is
+// found, after listing the problems.
+func cmdDBIntegrityCheck() error {
+	dbs, closeDBs, err := openMaintainedDatabases()
+	if err != nil {
+		return err
+	}
+	defer closeDBs()
+
+	results := map[string]any{}
+	healthy := true
+	for _, d := range dbs {
+		rows, err := d.db.Query(`PRAGMA integrity_check`)
+		if err != nil {
+			return fmt.Errorf("failed to check %s database: %w", d.name, err)
+		}
+		problems := []string{}
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			if line != "ok" {
+				problems = append(problems, line)
+			}
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to check %s database: %w", d.name, err)
+		}
+		result := map[string]any{"path": d.path, "ok": len(problems) == 0}
+		if len(problems) > 0 {
+			result["problems"] = problems
+			healthy = false
+		}
+		results[d.name] = result
+	}
+	if err := printJSON(results); err != nil {
+		return err
+	}
+	if !healthy {
+		return fmt.Errorf("integrity check found problems; restore a backup or re-sync")
+	}
+	return nil
+}
+
+// cmdDBStats reports each database's size, the free space VACUUM would
+// reclaim, each table's rows and bytes, and each index's bytes. Indexes are
+// listed under their table; an index bigger than its table is usually worth a
+// look.
+func cmdDBStats() error {
+	dbs, closeDBs, err := openMaintainedDatabases()
+	if err != nil {
+		return err
+	}
+	defer closeDBs()
+
+	results := map[string]any{}
+	for _, d := range dbs {
+		stats, err := databaseStats(d.db)
+		if err != nil {
+			return fmt.Errorf("failed to read %s database stats: %w", d.name, err)
+		}
+		stats["path"] = d.path
+		stats["bytes"] = sqliteFileSize(d.path)
+		results[d.name] = stats
+	}
+
+	var messages, chats, contacts, media, downloaded int64
+	if err := messageDB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM messages), (SELECT COUNT(*) FROM chats), (SELECT COUNT(*) FROM contacts),
+			(SELECT COUNT(*) FROM messages WHERE media_type IS NOT NULL AND media_type != ''),
+			(SELECT COUNT(*) FROM messages WHERE media_file_path IS NOT NULL AND media_file_path != '')
+	`).Scan(&messages, &chats, &contacts, &media, &downloaded); err != nil {
+		return fmt.Errorf("failed to count messages: %w", err)
+	}
+	results["counts"] = map[string]any{
+		"messages":         messages,
+		"chats":            chats,
+		"contacts":         contacts,
+		"media_messages":   media,
+		"media_downloaded": downloaded,
+	}
+	return printJSON(results)
+}
+
+// databaseStats sizes a database's tables and indexes from the dbstat
+// virtual table.
+func databaseStats(db *sql.DB) (map[string]any, error) {
+	var pageSize, pageCount, freePages int64
+	if err := db.QueryRow(`SELECT page_size, page_count, freelist_count FROM pragma_page_size, pragma_page_count, pragma_freelist_count`).
+		Scan(&pageSize, &pageCount, &freePages); err != nil {
+		return nil, err
+	}
+
+	sizes := map[string]int64{}
+	rows, err := db.Query(`SELECT name, SUM(pgsize) FROM dbstat GROUP BY name`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		sizes[name] = size
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT type, name, tbl_name FROM sqlite_master
+		WHERE type IN ('table', 'index') AND NOT (type = 'table' AND name LIKE 'sqlite\_%' ESCAPE '\')
+		ORDER BY type DESC, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	type object struct{ kind, name, table string }
+	var objects []object
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name, &o.table); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Tables sort before indexes, so each index finds its table
+	tables := []map[string]any{}
+	byName := map[string]map[string]any{}
+	for _, o := range objects {
+		if o.kind == "table" {
+			var count int64
+			if err := db.QueryRow(`SELECT COUNT(*) FROM "` + o.name + `"`).Scan(&count); err != nil {
+				return nil, err
+			}
+			table := map[string]any{"name": o.name, "rows": count, "bytes": sizes[o.name], "indexes": []map[string]any{}}
+			tables = append(tables, table)
+			byName[o.name] = table
+			continue
+		}
+		if table := byName[o.table]; table != nil {
+			table["indexes"] = append(table["indexes"].([]map[string]any), map[string]any{"name": o.name, "bytes": sizes[o.name]})
+		}
+	}
+
+	return map[string]any{
+		"page_size":         pageSize,
+		"pages":             pageCount,
+		"free_pages":        freePages,
+		"reclaimable_bytes": freePages * pageSize,
+		"tables":            tables,
+	}, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	desktopPreviewLength = 200              // Characters of message text shown
+	desktopNotifyTimeout = 10 * time.Second // Per notifier command
+)
+
+// desktopCommand builds the command that shows one notification. group lets
+// notifiers that support it replace an earlier notification from the same chat.
+type desktopCommand func(ctx context.Context, title, body, group string) *exec.Cmd
+
+// installDesktopNotifier registers native desktop notifications when
+// desktop_notifications is set, and reports whether it did. They go through
+// the notification rules like webhooks, so rules decide which chats notify;
+// quiet_hours silences them for part of the day.
+func installDesktopNotifier() bool {
+	if !cfg.DesktopNotifications {
+		return false
+	}
+	command, err := findDesktopNotifier()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: desktop_notifications is set but %v\n", err)
+		return false
+	}
+	notifiers = append(notifiers, func(n Notification) {
+		if inQuietHours(cfg.QuietHours, time.Now()) {
+			return
+		}
+		title, body := desktopNotificationText(n)
+		group := n.ChatJID
+		if group == "" {
+			group = n.SenderJID
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), desktopNotifyTimeout)
+			defer cancel()
+			if out, err := command(ctx, title, body, group).CombinedOutput(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: desktop notification failed: %v %s\n", err, strings.TrimSpace(string(out)))
+			}
+		}()
+	})
+	return true
+}
+
+// findDesktopNotifier picks the platform's notifier: terminal-notifier or
+// osascript on macOS, notify-send elsewhere.
+func findDesktopNotifier() (desktopCommand, error) {
+	if runtime.GOOS == "darwin" {
+		if path, err := exec.LookPath("terminal-notifier"); err == nil {
+			return func(ctx context.Context, title, body, group string) *exec.Cmd {
+				return exec.CommandContext(ctx, path, "-title", title, "-message", body, "-group", group)
+			}, nil
+		}
+		if path, err := exec.LookPath("osascript"); err == nil {
+			// Passing the text as arguments avoids quoting it into the script
+			return func(ctx context.Context, title, body, group string) *exec.Cmd {
+				return exec.CommandContext(ctx, path,
+					"-e", "on run argv",
+					"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+					"-e", "end run",
+					title, body)
+			}, nil
+		}
+		return nil, fmt.Errorf("neither terminal-notifier nor osascript was found")
+	}
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		return nil, fmt.Errorf("notify-send was not found (install libnotify)")
+	}
+	return func(ctx context.Context, title, body, group string) *exec.Cmd {
+		return exec.CommandContext(ctx, path, "--app-name=WhatsApp", "--", title, body)
+	}, nil
+}
+
+// desktopNotificationText titles a notification with the chat (or sender) and
+// previews the message, prefixed with the sender in groups. Alerts say so in
+// the title.
+func desktopNotificationText(n Notification) (title, body string) {
+	sender := n.SenderName
+	if sender == "" {
+		sender = strings.Split(n.SenderJID, "@")[0]
+	}
+	if n.Event != eventMessage && n.Event != eventAlert {
+		return "WhatsApp", notificationSummary(n)
+	}
+
+	body = n.Text
+	if body == "" {
+		body = "[" + n.MediaType + "]"
+	}
+	if runes := []rune(body); len(runes) > desktopPreviewLength {
+		body = string(runes[:desktopPreviewLength]) + "…"
+	}
+	title = sender
+	if n.ChatName != "" && n.ChatJID != n.SenderJID {
+		title = n.ChatName
+		body = sender + ": " + body
+	}
+	if n.Event == eventAlert {
+		title = "Alert: " + title
+	}
+	return title, body
+}
+
+// parseQuietHours parses a local-time range like "22:00-07:00", which may wrap
+// past midnight, into minutes since midnight.
+func parseQuietHours(s string) (start, end int, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", s)
+	}
+	for i, part := range []string{from, to} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", s)
+		}
+		minutes := t.Hour()*60 + t.Minute()
+		if i == 0 {
+			start = minutes
+		} else {
+			end = minutes
+		}
+	}
+	return start, end, nil
+}
+
+// inQuietHours reports whether now falls in the quiet_hours range. An empty or
+// invalid range is never quiet; config validation rejects invalid ones.
+func inQuietHours(quietHours string, now time.Time) bool {
+	if quietHours == "" {
+		return false
+	}
+	start, end, err := parseQuietHours(quietHours)
+	if err != nil {
+		return false
+	}
+	minutes := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return minutes >= start && minutes < end
+	}
+	return minutes >= start || minutes < end
+}
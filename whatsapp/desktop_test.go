@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int
+		wantErr    bool
+	}{
+		{"22:00-07:00", 22 * 60, 7 * 60, false},
+		{"09:30 - 17:45", 9*60 + 30, 17*60 + 45, false},
+		{"00:00-00:00", 0, 0, false},
+		{"22:00", 0, 0, true},
+		{"10pm-7am", 0, 0, true},
+		{"24:00-07:00", 0, 0, true},
+		{"", 0, 0, true},
+	}
+	for _, tt := range tests {
+		start, end, err := parseQuietHours(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseQuietHours(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if start != tt.start || end != tt.end {
+			t.Errorf("parseQuietHours(%q) = %d, %d, want %d, %d", tt.in, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 1, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		quietHours string
+		now        time.Time
+		want       bool
+	}{
+		// Within a day
+		{"09:00-17:00", at(8, 59), false},
+		{"09:00-17:00", at(9, 0), true},
+		{"09:00-17:00", at(16, 59), true},
+		{"09:00-17:00", at(17, 0), false},
+		// Across midnight
+		{"22:00-07:00", at(21, 59), false},
+		{"22:00-07:00", at(23, 30), true},
+		{"22:00-07:00", at(0, 0), true},
+		{"22:00-07:00", at(6, 59), true},
+		{"22:00-07:00", at(7, 0), false},
+		// Unset or invalid is never quiet
+		{"", at(3, 0), false},
+		{"night", at(3, 0), false},
+	}
+	for _, tt := range tests {
+		if got := inQuietHours(tt.quietHours, tt.now); got != tt.want {
+			t.Errorf("inQuietHours(%q, %s) = %v, want %v", tt.quietHours, tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultDigestPreviews = 3   // Newest unread messages previewed per chat
+	digestPreviewLength   = 100 // Characters of each preview
+)
+
+// cmdDigest summarizes the inbox in one document: each chat with unread
+// messages, newest first, with its unread count, newest unread timestamp, and
+// previews of the newest unread messages. Like chats --unread it reads the
+// local database; run sync first for fresh data.
+// Usage: digest [--previews=N] [--unmuted]
+func cmdDigest(args []string) error {
+	previews := defaultDigestPreviews
+	var unmutedOnly bool
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--previews="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--previews="))
+			if err != nil || n < 0 {
+				return fmt.Errorf("--previews must be a non-negative number")
+			}
+			previews = n
+		case arg == "--unmuted":
+			unmutedOnly = true
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	dataStatus := getDataStatus()
+
+	query := `
+		SELECT c.jid, c.is_group, COALESCE(cu.unread, 0), c.marked_as_unread, ` + mutedSQL + `,
+			COALESCE((SELECT MAX(m.timestamp) FROM messages m
+				WHERE m.chat_jid = c.jid AND m.is_read = 0 AND m.is_from_me = 0), c.last_message_time, 0) AS newest
+		FROM chats c
+		LEFT JOIN chat_unread cu ON cu.chat_jid = c.jid
+		WHERE (COALESCE(cu.unread, 0) > 0 OR c.marked_as_unread = 1) AND c.left_at IS NULL`
+	if unmutedOnly {
+		query += ` AND NOT ` + mutedSQL
+	}
+	query += ` ORDER BY newest DESC`
+
+	rows, err := messageDB.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query chats: %w", err)
+	}
+	type digestChat struct {
+		jid            string
+		isGroup        bool
+		unread         int
+		markedAsUnread bool
+		muted          bool
+		newest         int64
+	}
+	var unread []digestChat
+	for rows.Next() {
+		var c digestChat
+		var isGroup, markedAsUnread, muted int
+		if err := rows.Scan(&c.jid, &isGroup, &c.unread, &markedAsUnread, &muted, &c.newest); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		c.isGroup, c.markedAsUnread, c.muted = isGroup == 1, markedAsUnread == 1, muted == 1
+		unread = append(unread, c)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	chats := []map[string]any{}
+	totalUnread := 0
+	for _, c := range unread {
+		totalUnread += c.unread
+		chat := map[string]any{
+			"jid":          c.jid,
+			"name":         chatDisplayName(c.jid),
+			"is_group":     c.isGroup,
+			"unread_count": c.unread,
+		}
+		if c.newest > 0 {
+			chat["newest_timestamp"] = c.newest
+		}
+		if c.markedAsUnread {
+			chat["marked_as_unread"] = true
+		}
+		if c.muted {
+			chat["muted"] = true
+		}
+		if previews > 0 && c.unread > 0 {
+			list, err := digestPreviews(c.jid, previews)
+			if err != nil {
+				return err
+			}
+			chat["previews"] = list
+		}
+		chats = append(chats, chat)
+	}
+
+	output := map[string]any{
+		"unread_chats":    len(chats),
+		"unread_messages": totalUnread,
+		"chats":           chats,
+	}
+	if dataStatus.Warning != "" {
+		output["_status"] = dataStatus
+	}
+	return printJSON(output)
+}
+
+// digestPreviews returns the newest unread messages in a chat, oldest first,
+// each as a sender and a one-line preview.
+func digestPreviews(chatJID string, limit int) ([]map[string]any, error) {
+	rows, err := messageDB.Query(`
+		SELECT m.id, m.sender_jid, COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''), NULLIF(m.sender_name, ''), ''),
+			m.timestamp, COALESCE(m.text, ''), COALESCE(m.media_type, '')
+		FROM messages m
+		LEFT JOIN contacts ct ON ct.jid = m.sender_jid
+		WHERE m.chat_jid = ? AND m.is_read = 0 AND m.is_from_me = 0
+		ORDER BY m.timestamp DESC, m.rowid DESC LIMIT ?
+	`, chatJID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var previews []map[string]any
+	for rows.Next() {
+		var id, senderJID, senderName, text, mediaType string
+		var timestamp int64
+		if err := rows.Scan(&id, &senderJID, &senderName, &timestamp, &text, &mediaType); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		body := truncateRunes(oneLine(text), digestPreviewLength)
+		if mediaType != "" {
+			body = strings.TrimSpace("[" + mediaType + "] " + body)
+		}
+		previews = append(previews, map[string]any{
+			"id":        id,
+			"sender":    contextName(senderJID, senderName),
+			"timestamp": timestamp,
+			"text":      body,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	// Oldest first, so previews read in order
+	slices.Reverse(previews)
+	return previews, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// saveDisappearingTimer records a chat's disappearing-message timer in seconds
+// (0 when off).
+func saveDisappearingTimer(db dbWriter, chatJID string, seconds uint32) error {
+	chatJID = canonicalJID(normalizeJID(chatJID))
+	if !chatSynced(chatJID) {
+		return nil
+	}
+	_, err := db.Exec(`
+		INSERT INTO chats (jid, name, is_group, disappearing_timer, updated_at)
+		VALUES (?, '', ?, ?, ?)
+		ON CONFLICT(jid) DO UPDATE SET disappearing_timer = excluded.disappearing_timer
+	`, chatJID, boolToInt(strings.HasSuffix(chatJID, "@g.us")), seconds, time.Now().Unix())
+	return err
+}
+
+// noteDisappearingTimer learns a chat's timer from a live message: timer
+// changes arrive as protocol messages, and every message sent while a timer is
+// on carries its expiration.
+func noteDisappearingTimer(evt *events.Message) {
+	var seconds uint32
+	if pm := evt.Message.GetProtocolMessage(); pm.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING {
+		seconds = pm.GetEphemeralExpiration()
+	} else if evt.IsEphemeral {
+		if seconds = messageContextInfo(evt.Message).GetExpiration(); seconds == 0 {
+			return
+		}
+	} else {
+		return
+	}
+	if err := saveDisappearingTimer(messageDB, evt.Info.Chat.String(), seconds); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save disappearing timer: %v\n", err)
+	}
+}
+
+// chatDisappearingTimer returns the timer outgoing messages to jid must carry.
+// Groups are asked directly since any admin can change it; for other chats
+// it's the last timer seen.
+func chatDisappearingTimer(ctx context.Context, jid types.JID) uint32 {
+	if jid.Server == types.GroupServer {
+		if info, err := client.GetGroupInfo(ctx, jid); err == nil {
+			if err := saveDisappearingTimer(messageDB, jid.String(), info.DisappearingTimer); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save disappearing timer: %v\n", err)
+			}
+			return info.DisappearingTimer
+		}
+	}
+	var seconds uint32
+	_ = messageDB.QueryRow(`SELECT disappearing_timer FROM chats WHERE jid = ?`,
+		canonicalJID(normalizeJID(jid.String()))).Scan(&seconds)
+	return seconds
+}
+
+// withDisappearingTimer wraps msg in an EphemeralMessage with the chat's
+// expiration when the chat has a timer on, so the message disappears for the
+// recipient like ones sent from the phone. msg is returned as is otherwise.
+func withDisappearingTimer(ctx context.Context, jid types.JID, msg *waE2E.Message) *waE2E.Message {
+	if messageDB == nil {
+		if err := initMessageDB(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open message database: %v\n", err)
+			return msg
+		}
+	}
+	seconds := chatDisappearingTimer(ctx, jid)
+	if seconds == 0 {
+		return msg
+	}
+	// Plain text has no ContextInfo to carry the expiration
+	if text := msg.GetConversation(); text != "" {
+		msg = &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: &text}}
+	}
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return true
+		}
+		inner := v.Message()
+		if f := inner.Descriptor().Fields().ByName("contextInfo"); f != nil {
+			ci := inner.Mutable(f).Message().Interface().(*waE2E.ContextInfo)
+			ci.Expiration = &seconds
+			return false
+		}
+		return true
+	})
+	return &waE2E.Message{EphemeralMessage: &waE2E.FutureProofMessage{Message: msg}}
+}
+
+// cmdSetDisappearing changes a chat's disappearing-message timer.
+// Usage: set-disappearing <chat> <off|24h|7d|90d>
+func cmdSetDisappearing(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: set-disappearing <chat> <off|24h|7d|90d>")
+	}
+	timer, ok := whatsmeow.ParseDisappearingTimerString(args[1])
+	if !ok {
+		return fmt.Errorf("invalid timer %q: use off, 24h, 7d or 90d", args[1])
+	}
+	jid, err := parseJID(args[0])
+	if err != nil {
+		return err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SetDisappearingTimer(ctx, jid, timer, time.Now()); err != nil {
+		return fmt.Errorf("failed to set disappearing timer: %w", err)
+	}
+	seconds := uint32(timer.Seconds())
+	if err := saveDisappearingTimer(messageDB, jid.String(), seconds); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save disappearing timer: %v\n", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":       true,
+		"chat_jid":      jid.String(),
+		"timer_seconds": seconds,
+	})
+}
+
+// saveMessageExpiry records when a message sent with a disappearing timer
+// runs out, from the expiration it carries.
+func saveMessageExpiry(db dbWriter, msg *NormalizedMessage) error {
+	seconds := messageContextInfo(msg.Message).GetExpiration()
+	if seconds == 0 {
+		return nil
+	}
+	_, err := db.Exec(`UPDATE messages SET expires_at = ? WHERE id = ? AND chat_jid = ?`,
+		msg.Timestamp+int64(seconds), msg.ID, msg.ChatJID)
+	return err
+}
+
+// pruneDisappeared deletes messages whose own disappearing timer has run out,
+// with their reactions, receipts, and any media files no other message uses.
+// Only messages saved with an expiration qualify: ones sent before a chat's
+// timer was turned on stay, as they do on the phone.
+func pruneDisappeared(now int64, report *PruneReport) error {
+	for _, table := range []string{"reactions", "receipts"} {
+		// SAFETY: table names are constants above
+		result, err := messageDB.Exec(`
+			DELETE FROM `+table+` WHERE EXISTS (SELECT 1 FROM messages m
+				WHERE m.id = `+table+`.message_id AND m.chat_jid = `+table+`.chat_jid AND m.expires_at < ?)
+		`, now)
+		if err != nil {
+			return fmt.Errorf("failed to prune %s: %w", table, err)
+		}
+		if table == "reactions" {
+			n, _ := result.RowsAffected()
+			report.ReactionsDeleted += n
+		}
+	}
+
+	result, err := messageDB.Exec(`DELETE FROM messages WHERE expires_at < ?`, now)
+	if err != nil {
+		return fmt.Errorf("failed to prune disappeared messages: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	report.MessagesDeleted += deleted
+	if deleted == 0 {
+		return nil
+	}
+
+	if err := releaseMedia(report); err != nil {
+		return err
+	}
+	return releaseThumbnails()
+}
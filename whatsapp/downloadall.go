@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cmdDownloadAll downloads a chat's stored media that isn't on disk yet into
+// the media directory, and reports what it did. Like automatic downloads, it
+// honors the media_skip_* / media_max_size settings. It only connects to
+// WhatsApp if something needs downloading.
+// Usage: download-all --chat <jid> [--media-type TYPE] [--since TIME]
+func cmdDownloadAll(args []string) error {
+	usage := fmt.Errorf("usage: download-all --chat <jid> [--media-type image|video|audio|sticker|document] [--since TIME]")
+	var chatJID, mediaType string
+	var since time.Time
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--chat="):
+			chatJID = strings.TrimPrefix(args[i], "--chat=")
+		case args[i] == "--chat" && i+1 < len(args):
+			chatJID = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--media-type="):
+			mediaType = strings.TrimPrefix(args[i], "--media-type=")
+		case args[i] == "--media-type" && i+1 < len(args):
+			mediaType = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--since="), args[i] == "--since" && i+1 < len(args):
+			_, value, hasValue := strings.Cut(args[i], "=")
+			if !hasValue {
+				value = args[i+1]
+				i++
+			}
+			t, err := parseTimeBound(value)
+			if err != nil {
+				return fmt.Errorf("--since: %w", err)
+			}
+			since = t
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	if chatJID == "" {
+		return usage
+	}
+	types := downloadableMediaTypes
+	if mediaType != "" {
+		if !isDownloadableMedia(mediaType) || strings.HasPrefix(mediaType, "viewonce_") {
+			return fmt.Errorf("--media-type must be one of image, video, audio, sticker, document")
+		}
+		types = []string{mediaType}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	chatJID = canonicalJID(normalizeJID(chatJID))
+
+	// View-once media counts as its underlying type
+	var placeholders []string
+	queryArgs := []any{chatJID}
+	for _, t := range types {
+		placeholders = append(placeholders, "?", "?")
+		queryArgs = append(queryArgs, t, "viewonce_"+t)
+	}
+	query := `SELECT id, media_type, mime_type_full, media_key, file_sha256, file_length, media_file_path
+		FROM messages
+		WHERE chat_jid = ? AND media_type IN (` + strings.Join(placeholders, ", ") + `)`
+	if !since.IsZero() {
+		query += " AND timestamp >= ?"
+		queryArgs = append(queryArgs, since.Unix())
+	}
+	rows, err := messageDB.Query(query+" ORDER BY timestamp, id", queryArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+
+	type mediaItem struct {
+		id, mediaType          string
+		mimeType, existingPath sql.NullString
+		mediaKey, fileSHA256   []byte
+		fileLength             sql.NullInt64
+	}
+	var items []mediaItem
+	for rows.Next() {
+		var it mediaItem
+		if err := rows.Scan(&it.id, &it.mediaType, &it.mimeType, &it.mediaKey, &it.fileSHA256, &it.fileLength, &it.existingPath); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		items = append(items, it)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	ctx := context.Background()
+	defer func() {
+		if client != nil && client.IsConnected() {
+			client.Disconnect()
+		}
+	}()
+
+	present, downloaded, reused, unavailable := 0, 0, 0, 0
+	skippedByRule := map[string]int{}
+	var downloadedBytes int64
+	failed := []map[string]any{}
+	for i, it := range items {
+		if it.existingPath.Valid && it.existingPath.String != "" {
+			if _, err := os.Stat(it.existingPath.String); err == nil {
+				present++
+				continue
+			}
+		}
+		if len(it.mediaKey) == 0 {
+			unavailable++
+			continue
+		}
+
+		// Content already downloaded for another message needs no connection
+		outputPath := mediaPathForMessage(it.id, chatJID, it.mediaType, it.mimeType.String, it.fileSHA256)
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return fmt.Errorf("failed to create media directory: %w", err)
+		}
+		if placeCachedMedia(it.id, chatJID, outputPath, it.fileSHA256) {
+			ensureThumbnail(it.id, chatJID, it.mediaType, outputPath, it.fileSHA256)
+			reused++
+			continue
+		}
+		if reason := mediaSkipReason(chatJID, it.mediaType, it.fileLength.Int64); reason != "" {
+			skippedByRule[reason]++
+			continue
+		}
+
+		// downloadMessage reuses the connection once there is one
+		if client == nil || !client.IsConnected() {
+			if err := connectClient(ctx); err != nil {
+				return err
+			}
+		}
+		result, err := downloadMessage(ctx, it.id, chatJID, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to download %s: %v\n", it.id, err)
+			failed = append(failed, map[string]any{"message_id": it.id, "error": err.Error()})
+			continue
+		}
+		if result["cached"] == true {
+			reused++
+			continue
+		}
+		downloaded++
+		size, _ := result["size"].(int)
+		downloadedBytes += int64(size)
+		fmt.Fprintf(os.Stderr, "Downloaded %s (%d/%d)\n", it.id, i+1, len(items))
+	}
+
+	output := map[string]any{
+		"success":            len(failed) == 0,
+		"chat_jid":           chatJID,
+		"media_messages":     len(items),
+		"already_downloaded": present,
+		"downloaded":         downloaded,
+		"downloaded_bytes":   downloadedBytes,
+		"reused":             reused,        // Same content already downloaded for another message
+		"unavailable":        unavailable,   // No download metadata stored
+		"skipped_by_rule":    skippedByRule, // By media_skip_* / media_max_size: group, type or size
+		"failed":             failed,
+	}
+	return printJSON(output)
+}
@@ -0,0 +1,735 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// cmdExport writes a chat's history as JSON, as CSV (--format csv, or by a .csv
+// --output), or with --format txt or whatsapp-txt in the format of WhatsApp's
+// own export, with "[dd/mm/yyyy, hh:mm]" or iOS's "[dd/mm/yyyy, hh:mm:ss]"
+// timestamps (a .zip output also gets the media files). --since and --until bound
+// the time range. With --redact, phone numbers and JIDs become stable
+// pseudonyms, names are dropped, and media references are stripped, so the
+// transcript can be shared. --contact instead collects everything involving
+// one person into a zip archive.
+//
+// The JSON schema is {chat_jid, chat_name, count, messages}, each message
+// having id, sender_jid, timestamp and is_from_me, and when set sender_name,
+// text, media_type, mime_type, media_file_path, reply_to_id, reply_to_sender,
+// reply_to_text and reactions ([{emoji, sender_jid, sender_name}]). CSV has
+// one row per message with exportCSVColumns, always in that order.
+// Usage: export [--chat] <jid> [--format json|csv|txt|whatsapp-txt] [--since=TIME] [--until=TIME]
+//
+//	[--redact] [--output FILE]
+//	export --contact <jid> [--output FILE.zip]
+func cmdExport(args []string) error {
+	usage := fmt.Errorf("usage: export [--chat] <jid> [--format json|csv|txt|whatsapp-txt] [--since=TIME] [--until=TIME] [--redact] [--output FILE] | export --contact <jid> [--output FILE.zip]")
+	var chatJID, contactJID, outputPath, format string
+	var since, until time.Time
+	redact := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--since="), strings.HasPrefix(args[i], "--until="),
+			(args[i] == "--since" || args[i] == "--until") && i+1 < len(args):
+			name, value, hasValue := strings.Cut(args[i], "=")
+			if !hasValue {
+				value = args[i+1]
+				i++
+			}
+			t, err := parseTimeBound(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if name == "--since" {
+				since = t
+			} else {
+				until = t
+			}
+		case !strings.HasPrefix(args[i], "--") && chatJID == "":
+			chatJID = args[i]
+		case strings.HasPrefix(args[i], "--chat="):
+			chatJID = strings.TrimPrefix(args[i], "--chat=")
+		case args[i] == "--chat" && i+1 < len(args):
+			chatJID = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--contact="):
+			contactJID = strings.TrimPrefix(args[i], "--contact=")
+		case args[i] == "--contact" && i+1 < len(args):
+			contactJID = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--output="):
+			outputPath = strings.TrimPrefix(args[i], "--output=")
+		case args[i] == "--output" && i+1 < len(args):
+			outputPath = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--format="):
+			format = strings.TrimPrefix(args[i], "--format=")
+		case args[i] == "--format" && i+1 < len(args):
+			format = args[i+1]
+			i++
+		case args[i] == "--redact":
+			redact = true
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	if (chatJID == "") == (contactJID == "") {
+		return usage
+	}
+	if contactJID != "" {
+		if redact || format != "" || !since.IsZero() || !until.IsZero() {
+			return fmt.Errorf("--redact, --format, --since and --until apply to chat exports only")
+		}
+		return exportContact(contactJID, outputPath)
+	}
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(outputPath), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "json" && format != "csv" && format != "txt" && format != "whatsapp-txt" {
+		return fmt.Errorf("unknown format %q (expected json, csv, txt, or whatsapp-txt)", format)
+	}
+	// Chat exports are written like the global --output
+	outputFile = outputPath
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	chatJID = canonicalJID(normalizeJID(chatJID))
+
+	where := "m.chat_jid = ?"
+	whereArgs := []any{chatJID}
+	if !since.IsZero() {
+		where += " AND m.timestamp >= ?"
+		whereArgs = append(whereArgs, since.Unix())
+	}
+	if !until.IsZero() {
+		where += " AND m.timestamp < ?"
+		whereArgs = append(whereArgs, until.Unix())
+	}
+
+	// Read in one transaction, so the count matches the messages exported
+	tx, err := messageDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM messages m WHERE `+where, whereArgs...).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	chatName := chatDisplayName(chatJID)
+	if chatName == "" {
+		chatName = strings.Split(chatJID, "@")[0]
+	}
+	fields := map[string]any{
+		"chat_jid":  chatJID,
+		"chat_name": chatName,
+		"count":     count,
+	}
+	var r *redactor
+	if redact {
+		if r, err = newRedactor(); err != nil {
+			return err
+		}
+		fields["chat_jid"] = r.pseudonym(chatJID)
+		chatName = r.pseudonym(chatJID)
+		delete(fields, "chat_name")
+		fields["redacted"] = true
+	}
+
+	var sink exportSink
+	switch format {
+	case "whatsapp-txt":
+		sink, err = newTxtExport(chatName, ownName(redact), whatsAppTxtTime, outputPath)
+	case "txt":
+		sink, err = newTxtExport(chatName, ownName(redact), plainTxtTime, outputPath)
+	case "csv":
+		sink, err = newCSVExport()
+	default:
+		sink, err = newListStream("messages", fields)
+	}
+	if err != nil {
+		return err
+	}
+	defer sink.abort()
+	err = forEachExportMessage(tx, false, where, whereArgs, func(msg map[string]any) error {
+		if r != nil {
+			r.redactMessage(msg)
+		}
+		return sink.add(msg)
+	})
+	if err != nil {
+		return err
+	}
+	return sink.close()
+}
+
+// exportSink writes a chat export as its messages are read, oldest first.
+// abort discards an unfinished output, and is a no-op after close.
+type exportSink interface {
+	add(msg map[string]any) error
+	close() error
+	abort()
+}
+
+// exportCSVColumns are the columns of a CSV export. New columns go at the end,
+// so scripts reading columns by position keep working.
+var exportCSVColumns = []string{
+	"id", "timestamp", "time", "sender_jid", "sender_name", "is_from_me", "text",
+	"media_type", "mime_type", "media_file_path", "reply_to_id", "reply_to_sender", "reply_to_text",
+	"reactions",
+}
+
+// csvExport writes exported messages one per row. time is the timestamp in
+// RFC 3339 (UTC), and reactions are JSON, as in the JSON export.
+type csvExport struct {
+	out *outputStream
+	w   *csv.Writer
+}
+
+func newCSVExport() (*csvExport, error) {
+	out, err := newOutputStream(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(out)
+	_ = w.Write(exportCSVColumns)
+	return &csvExport{out: out, w: w}, nil
+}
+
+func (e *csvExport) add(msg map[string]any) error {
+	row := make([]string, len(exportCSVColumns))
+	for i, column := range exportCSVColumns {
+		switch column {
+		case "time":
+			row[i] = time.Unix(msg["timestamp"].(int64), 0).UTC().Format(time.RFC3339)
+		case "reactions":
+			if reactions, ok := msg["reactions"]; ok {
+				data, err := json.Marshal(reactions)
+				if err != nil {
+					return err
+				}
+				row[i] = string(data)
+			}
+		default:
+			if v, ok := msg[column]; ok {
+				row[i] = fmt.Sprint(v)
+			}
+		}
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvExport) close() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		e.out.abort()
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return e.out.commit()
+}
+
+func (e *csvExport) abort() { e.out.abort() }
+
+// txtExport prints the chat in WhatsApp's export format, or for a .zip output
+// writes it as _chat.txt alongside the media, like WhatsApp's "Attach media".
+type txtExport struct {
+	txt *whatsAppTxtWriter
+	out *outputStream // Text output
+
+	// Zip output: a zip is written one file at a time, so the text waits in a
+	// temp file until the media are in
+	archive *zipArchive
+	chat    *os.File
+	chatBuf *bufio.Writer
+	path    string
+}
+
+func newTxtExport(chatName, ownName, layout, outputPath string) (*txtExport, error) {
+	e := &txtExport{txt: &whatsAppTxtWriter{chatName: chatName, ownName: ownName, layout: layout}, path: outputPath}
+	if !strings.EqualFold(filepath.Ext(outputPath), ".zip") {
+		out, err := newOutputStream(outputPath)
+		if err != nil {
+			return nil, err
+		}
+		e.out, e.txt.w = out, out
+		return e, nil
+	}
+
+	archive, err := createZipArchive(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	chat, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".*.txt")
+	if err != nil {
+		archive.abort()
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	e.archive, e.txt.archive, e.chat = archive, archive, chat
+	e.chatBuf = bufio.NewWriter(chat)
+	e.txt.w = e.chatBuf
+	return e, nil
+}
+
+func (e *txtExport) add(msg map[string]any) error { return e.txt.add(msg) }
+
+func (e *txtExport) close() error {
+	if e.out != nil {
+		return e.out.commit()
+	}
+	err := e.chatBuf.Flush()
+	if err == nil {
+		_, err = e.archive.addFile("_chat.txt", e.chat.Name())
+	}
+	if err != nil {
+		e.abort()
+		return err
+	}
+	if err := e.archive.commit(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", e.path)
+	return nil
+}
+
+func (e *txtExport) abort() {
+	if e.out != nil {
+		e.out.abort()
+		return
+	}
+	e.archive.abort()
+	_ = e.chat.Close()
+	_ = os.Remove(e.chat.Name())
+}
+
+// ownName is the name our messages are exported under: our push name as seen
+// in contacts, or "You". Redacted exports leave our pseudonymous JID instead.
+func ownName(redact bool) string {
+	if redact {
+		return ""
+	}
+	var name sql.NullString
+	_ = messageDB.QueryRow(`
+		SELECT COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''))
+		FROM messages m JOIN contacts ct ON ct.jid = m.sender_jid
+		WHERE m.is_from_me = 1 LIMIT 1
+	`).Scan(&name)
+	if name.Valid && name.String != "" {
+		return name.String
+	}
+	return "You"
+}
+
+// exportMessages returns the stored messages matching where, read as
+// forEachExportMessage reads them, for exports that need them all at once.
+func exportMessages(withChat bool, where string, args ...any) ([]map[string]any, error) {
+	tx, err := messageDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	messages := []map[string]any{}
+	err = forEachExportMessage(tx, withChat, where, args, func(msg map[string]any) error {
+		messages = append(messages, msg)
+		return nil
+	})
+	return messages, err
+}
+
+// forEachExportMessage calls fn with each stored message matching where (over
+// messages m), oldest first, with its reactions. withChat adds each message's
+// chat, for exports that span chats.
+func forEachExportMessage(tx *sql.Tx, withChat bool, where string, args []any, fn func(map[string]any) error) error {
+	rows, err := tx.Query(`
+		SELECT m.rowid, m.id, m.chat_jid, m.sender_jid, m.sender_name, m.timestamp, m.text, m.media_type, m.is_from_me,
+			m.mime_type_full, m.media_file_path, m.reply_to_id, m.reply_to_sender, m.reply_to_text
+		FROM messages m
+		WHERE `+where+`
+		ORDER BY m.timestamp, m.rowid
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	// Reactions are read in their messages' order, alongside them. The
+	// transaction keeps both reads on the same snapshot, so they line up.
+	reactionRows, err := tx.Query(`
+		SELECT m.rowid, r.sender_jid, r.sender_name, r.emoji
+		FROM reactions r
+		JOIN messages m ON m.id = r.message_id AND m.chat_jid = r.chat_jid
+		WHERE `+where+`
+		ORDER BY m.timestamp, m.rowid, r.rowid
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query reactions: %w", err)
+	}
+	defer func() { _ = reactionRows.Close() }()
+	var reactionRowID int64
+	var reaction map[string]any
+	nextReaction := func() error {
+		reaction = nil
+		if !reactionRows.Next() {
+			return reactionRows.Err()
+		}
+		var senderJID, emoji string
+		var senderName sql.NullString
+		if err := reactionRows.Scan(&reactionRowID, &senderJID, &senderName, &emoji); err != nil {
+			return fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		reaction = map[string]any{
+			"emoji":      emoji,
+			"sender_jid": senderJID,
+		}
+		if senderName.Valid && senderName.String != "" {
+			reaction["sender_name"] = senderName.String
+		}
+		return nil
+	}
+	if err := nextReaction(); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var rowID int64
+		var id, chatJID, senderJID string
+		var senderName, text, mediaType, mimeType, mediaFilePath sql.NullString
+		var replyToID, replyToSender, replyToText sql.NullString
+		var timestamp int64
+		var isFromMe int
+		if err := rows.Scan(&rowID, &id, &chatJID, &senderJID, &senderName, &timestamp, &text, &mediaType, &isFromMe,
+			&mimeType, &mediaFilePath, &replyToID, &replyToSender, &replyToText); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		msg := map[string]any{
+			"id":         id,
+			"sender_jid": senderJID,
+			"timestamp":  timestamp,
+			"is_from_me": isFromMe == 1,
+		}
+		if withChat {
+			msg["chat_jid"] = chatJID
+		}
+		if senderName.Valid && senderName.String != "" {
+			msg["sender_name"] = senderName.String
+		}
+		if text.Valid && text.String != "" {
+			msg["text"] = text.String
+		}
+		if mediaType.Valid && mediaType.String != "" {
+			msg["media_type"] = mediaType.String
+			if mimeType.Valid && mimeType.String != "" {
+				msg["mime_type"] = mimeType.String
+			}
+			if mediaFilePath.Valid && mediaFilePath.String != "" {
+				msg["media_file_path"] = mediaFilePath.String
+			}
+		}
+		if replyToID.Valid && replyToID.String != "" {
+			msg["reply_to_id"] = replyToID.String
+			if replyToSender.Valid && replyToSender.String != "" {
+				msg["reply_to_sender"] = replyToSender.String
+			}
+			if replyToText.Valid && replyToText.String != "" {
+				msg["reply_to_text"] = replyToText.String
+			}
+		}
+		var reactions []map[string]any
+		for reaction != nil && reactionRowID == rowID {
+			reactions = append(reactions, reaction)
+			if err := nextReaction(); err != nil {
+				return err
+			}
+		}
+		if reactions != nil {
+			msg["reactions"] = reactions
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return nil
+}
+
+var (
+	// identifierPattern matches JIDs and phone numbers written out in text,
+	// including @mentions, which WhatsApp writes as the bare number.
+	identifierPattern = regexp.MustCompile(`\b[0-9a-zA-Z.\-]+@(?:s\.whatsapp\.net|g\.us|lid|broadcast|newsletter)\b|\+?\d[\d \-().]{6,}\d`)
+	datePattern       = regexp.MustCompile(`^\d{4}-\d{1,2}-\d{1,2}$`)
+)
+
+// redactor maps identifiers to pseudonyms that are stable across exports (so
+// the same person is recognizable in two shared transcripts) but can't be
+// reversed without the local key, unlike a plain hash of a phone number.
+type redactor struct {
+	key []byte
+}
+
+// newRedactor loads the pseudonym key from the config directory, creating it
+// on first use.
+func newRedactor() (*redactor, error) {
+	path := filepath.Join(configDir, "redact.key")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("invalid redaction key in %s", path)
+		}
+		return &redactor{key: key}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read redaction key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate redaction key: %w", err)
+	}
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write redaction key: %w", err)
+	}
+	return &redactor{key: key}, nil
+}
+
+// pseudonym returns e.g. "user-3fa2b1c9" for a person or "group-..." for a group.
+// Phone numbers hash the same as their JID, so a number quoted in text matches
+// its sender.
+func (r *redactor) pseudonym(jid string) string {
+	prefix := "user-"
+	if strings.HasSuffix(jid, "@g.us") {
+		prefix = "group-"
+	}
+	user := strings.Split(jid, "@")[0]
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(user))
+	return prefix + hex.EncodeToString(mac.Sum(nil))[:8]
+}
+
+// redactText replaces JIDs and phone numbers in free text, in one pass so a
+// pseudonym is never mistaken for a number.
+func (r *redactor) redactText(text string) string {
+	return identifierPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if strings.Contains(match, "@") {
+			return r.pseudonym(match)
+		}
+		var digits strings.Builder
+		for _, c := range match {
+			if c >= '0' && c <= '9' {
+				digits.WriteRune(c)
+			}
+		}
+		if digits.Len() < 7 || datePattern.MatchString(match) {
+			return match
+		}
+		return r.pseudonym(digits.String())
+	})
+}
+
+// redactMessage rewrites an exported message in place.
+func (r *redactor) redactMessage(msg map[string]any) {
+	for _, key := range []string{"sender_jid", "reply_to_sender"} {
+		if jid, ok := msg[key].(string); ok {
+			msg[key] = r.pseudonym(jid)
+		}
+	}
+	for _, key := range []string{"text", "reply_to_text"} {
+		if text, ok := msg[key].(string); ok {
+			msg[key] = r.redactText(text)
+		}
+	}
+	delete(msg, "sender_name")
+	delete(msg, "media_file_path")
+	delete(msg, "mime_type")
+	if reactions, ok := msg["reactions"].([]map[string]any); ok {
+		for _, reaction := range reactions {
+			reaction["sender_jid"] = r.pseudonym(reaction["sender_jid"].(string))
+			delete(reaction, "sender_name")
+		}
+	}
+}
+
+// exportContact writes a zip of everything stored about one person: their
+// contact record and aliases, messages in their DM and those they sent in
+// groups, their reactions everywhere, their calls, and the media files of those
+// messages.
+func exportContact(contactJID, outputPath string) error {
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	contactJID = canonicalJID(normalizeJID(contactJID))
+	if outputPath == "" {
+		outputPath = "whatsapp-contact-" + strings.Split(contactJID, "@")[0] + ".zip"
+	}
+
+	contact := map[string]any{"jid": contactJID}
+	var name, pushName sql.NullString
+	if err := messageDB.QueryRow(`SELECT name, push_name FROM contacts WHERE jid = ?`, contactJID).Scan(&name, &pushName); err == nil {
+		if name.Valid && name.String != "" {
+			contact["name"] = name.String
+		}
+		if pushName.Valid && pushName.String != "" {
+			contact["push_name"] = pushName.String
+		}
+	}
+	aliases := []string{}
+	aliasRows, err := messageDB.Query(`SELECT alias_jid FROM contact_aliases WHERE canonical_jid = ? ORDER BY alias_jid`, contactJID)
+	if err != nil {
+		return fmt.Errorf("failed to query aliases: %w", err)
+	}
+	for aliasRows.Next() {
+		var alias string
+		if err := aliasRows.Scan(&alias); err != nil {
+			_ = aliasRows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		aliases = append(aliases, alias)
+	}
+	_ = aliasRows.Close()
+	contact["aliases"] = aliases
+
+	messages, err := exportMessages(true, "m.chat_jid = ? OR m.sender_jid = ?", contactJID, contactJID)
+	if err != nil {
+		return err
+	}
+
+	reactions := []map[string]any{}
+	rows, err := messageDB.Query(`
+		SELECT message_id, chat_jid, emoji, timestamp FROM reactions
+		WHERE sender_jid = ? ORDER BY timestamp
+	`, contactJID)
+	if err != nil {
+		return fmt.Errorf("failed to query reactions: %w", err)
+	}
+	for rows.Next() {
+		var msgID, chatJID, emoji string
+		var timestamp int64
+		if err := rows.Scan(&msgID, &chatJID, &emoji, &timestamp); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		reactions = append(reactions, map[string]any{
+			"message_id": msgID,
+			"chat_jid":   chatJID,
+			"emoji":      emoji,
+			"timestamp":  timestamp,
+		})
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	calls := []map[string]any{}
+	callRows, err := messageDB.Query(`
+		SELECT call_id, group_jid, media, status, reason, started_at, accepted_at, ended_at FROM calls
+		WHERE caller_jid = ? ORDER BY started_at
+	`, contactJID)
+	if err != nil {
+		return fmt.Errorf("failed to query calls: %w", err)
+	}
+	for callRows.Next() {
+		var callID, groupJID, media, status, reason string
+		var started int64
+		var accepted, ended sql.NullInt64
+		if err := callRows.Scan(&callID, &groupJID, &media, &status, &reason, &started, &accepted, &ended); err != nil {
+			_ = callRows.Close()
+			return fmt.Errorf("failed to scan call: %w", err)
+		}
+		call := map[string]any{"id": callID, "media": media, "status": status, "timestamp": started}
+		if groupJID != "" {
+			call["group_jid"] = groupJID
+		}
+		if reason != "" {
+			call["reason"] = reason
+		}
+		if accepted.Valid {
+			call["accepted_at"] = accepted.Int64
+		}
+		if ended.Valid {
+			call["ended_at"] = ended.Int64
+		}
+		calls = append(calls, call)
+	}
+	_ = callRows.Close()
+	if err := callRows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	archive, err := createZipArchive(outputPath)
+	if err != nil {
+		return err
+	}
+
+	// Media goes under media/, and each message points at its copy in the archive
+	mediaFiles, mediaMissing := 0, 0
+	for _, msg := range messages {
+		path, ok := msg["media_file_path"].(string)
+		if !ok {
+			continue
+		}
+		delete(msg, "media_file_path")
+		archived := "media/" + msg["id"].(string) + filepath.Ext(path)
+		found, err := archive.addFile(archived, path)
+		if err != nil {
+			archive.abort()
+			return err
+		}
+		if !found {
+			mediaMissing++
+			continue
+		}
+		msg["media_file"] = archived
+		mediaFiles++
+	}
+
+	for name, v := range map[string]any{
+		"contact.json":   contact,
+		"messages.json":  messages,
+		"reactions.json": reactions,
+		"calls.json":     calls,
+	} {
+		if err := archive.addJSON(name, v); err != nil {
+			archive.abort()
+			return err
+		}
+	}
+	if err := archive.commit(); err != nil {
+		return err
+	}
+
+	output := map[string]any{
+		"success":       true,
+		"contact_jid":   contactJID,
+		"archive":       outputPath,
+		"messages":      len(messages),
+		"reactions":     len(reactions),
+		"calls":         len(calls),
+		"media_files":   mediaFiles,
+		"media_missing": mediaMissing,
+	}
+	return printJSON(output)
+}
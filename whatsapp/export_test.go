@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCSVExport(t *testing.T) {
+	oldOutputFile := outputFile
+	outputFile = filepath.Join(t.TempDir(), "chat.csv")
+	t.Cleanup(func() { outputFile = oldOutputFile })
+
+	e, err := newCSVExport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []map[string]any{
+		{
+			"id": "3EB0ABC001", "timestamp": int64(1700000000), "sender_jid": "12025551234@s.whatsapp.net",
+			"sender_name": "Alice", "is_from_me": false, "text": "Hi, \"you\"\nthere",
+			"reactions": []map[string]any{{"emoji": "👍", "sender_jid": "me"}},
+		},
+		{
+			"id": "3EB0ABC002", "timestamp": int64(1700000060), "is_from_me": true, "text": "Photo",
+			"media_type": "image", "reply_to_id": "3EB0ABC001",
+		},
+	} {
+		if err := e.add(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 rows", len(records))
+	}
+	if !slices.Equal(records[0], exportCSVColumns) {
+		t.Errorf("header = %q, want %q", records[0], exportCSVColumns)
+	}
+
+	row := func(r int) map[string]string {
+		m := map[string]string{}
+		for i, column := range exportCSVColumns {
+			m[column] = records[r][i]
+		}
+		return m
+	}
+	first, second := row(1), row(2)
+	for column, want := range map[string]string{
+		"timestamp":   "1700000000",
+		"time":        "2023-11-14T22:13:20Z",
+		"sender_name": "Alice",
+		"is_from_me":  "false",
+		"text":        "Hi, \"you\"\nthere",
+		"media_type":  "",
+		"reactions":   `[{"emoji":"👍","sender_jid":"me"}]`,
+	} {
+		if first[column] != want {
+			t.Errorf("row 1 %s = %q, want %q", column, first[column], want)
+		}
+	}
+	for column, want := range map[string]string{
+		"is_from_me":  "true",
+		"media_type":  "image",
+		"reply_to_id": "3EB0ABC001",
+		"sender_jid":  "",
+		"reactions":   "",
+	} {
+		if second[column] != want {
+			t.Errorf("row 2 %s = %q, want %q", column, second[column], want)
+		}
+	}
+}
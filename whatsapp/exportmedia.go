@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cmdExportMedia gathers a chat's media into a browsable folder:
+// <output>/<chat name>/<YYYY-MM>/<YYYY-MM-DD_HHMMSS>_<sender>_<id><ext>.
+// Items not downloaded yet are fetched first. Files are hardlinked from the media
+// directory when possible (no extra space), or copied with --copy.
+// Usage: export-media --chat <jid> --output <dir> [--copy]
+func cmdExportMedia(args []string) error {
+	var chatJID, outputDir string
+	forceCopy := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--chat="):
+			chatJID = strings.TrimPrefix(args[i], "--chat=")
+		case args[i] == "--chat" && i+1 < len(args):
+			chatJID = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--output="):
+			outputDir = strings.TrimPrefix(args[i], "--output=")
+		case args[i] == "--output" && i+1 < len(args):
+			outputDir = args[i+1]
+			i++
+		case args[i] == "--copy":
+			forceCopy = true
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	if chatJID == "" || outputDir == "" {
+		return fmt.Errorf("usage: export-media --chat <jid> --output <dir> [--copy]")
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	rows, err := messageDB.Query(`
+		SELECT id, timestamp, sender_jid, sender_name, media_type, mime_type_full,
+			media_key, file_sha256, file_enc_sha256, file_length, direct_path, media_file_path
+		FROM messages
+		WHERE chat_jid = ? AND media_type IS NOT NULL AND media_type != ''
+		ORDER BY timestamp, id
+	`, chatJID)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+
+	type mediaItem struct {
+		id, senderJID, mediaType string
+		senderName, mimeType     sql.NullString
+		directPath, existingPath sql.NullString
+		timestamp                int64
+		mediaKey, fileSHA256     []byte
+		fileEncSHA256            []byte
+		fileLength               sql.NullInt64
+	}
+	var items []mediaItem
+	for rows.Next() {
+		var it mediaItem
+		if err := rows.Scan(&it.id, &it.timestamp, &it.senderJID, &it.senderName, &it.mediaType, &it.mimeType,
+			&it.mediaKey, &it.fileSHA256, &it.fileEncSHA256, &it.fileLength, &it.directPath, &it.existingPath); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		items = append(items, it)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	chatName := chatDisplayName(chatJID)
+	if chatName == "" {
+		chatName = strings.Split(chatJID, "@")[0]
+	}
+	chatDir := filepath.Join(outputDir, sanitizeFilenamePart(chatName))
+
+	ctx := context.Background()
+	defer func() {
+		// downloadMediaForMessage connects on demand
+		if client != nil && client.IsConnected() {
+			client.Disconnect()
+		}
+	}()
+
+	exported, downloaded, skipped, skippedByRule := 0, 0, 0, 0
+	failed := []string{}
+	for _, it := range items {
+		path := it.existingPath.String
+		if path != "" {
+			if _, err := os.Stat(path); err != nil {
+				path = ""
+			}
+		}
+		if path == "" {
+			path = downloadMediaForMessage(ctx, it.id, chatJID, it.mediaType, it.mimeType.String, it.mediaKey, it.fileSHA256,
+				it.fileEncSHA256, it.fileLength.Int64, it.directPath.String)
+			if path == "" {
+				if mediaSkipReason(chatJID, it.mediaType, it.fileLength.Int64) != "" {
+					skippedByRule++
+				} else {
+					failed = append(failed, it.id)
+				}
+				continue
+			}
+			downloaded++
+		}
+
+		t := time.Unix(it.timestamp, 0)
+		sender := it.senderName.String
+		if sender == "" {
+			sender = strings.Split(it.senderJID, "@")[0]
+		}
+		ext := filepath.Ext(path)
+		if ext == "" {
+			ext = getExtensionFromMime(it.mimeType.String)
+		}
+		name := fmt.Sprintf("%s_%s_%s%s", t.Format("2006-01-02_150405"),
+			sanitizeFilenamePart(sender), sanitizeFilenamePart(it.id), ext)
+		dest := filepath.Join(chatDir, t.Format("2006-01"), name)
+
+		// Re-running an export only adds what's new
+		if _, err := os.Stat(dest); err == nil {
+			skipped++
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if forceCopy || os.Link(path, dest) != nil {
+			if err := copyFile(path, dest); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to export %s: %v\n", it.id, err)
+				failed = append(failed, it.id)
+				continue
+			}
+		}
+		exported++
+	}
+
+	output := map[string]any{
+		"success":         len(failed) == 0,
+		"chat_jid":        chatJID,
+		"output_dir":      chatDir,
+		"exported":        exported,
+		"downloaded":      downloaded,
+		"skipped":         skipped,
+		"skipped_by_rule": skippedByRule, // media_skip_* / media_max_size settings
+		"failed":          failed,
+	}
+	return printJSON(output)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fetchTimeout bounds downloading a URL passed to send-file.
+const fetchTimeout = 2 * time.Minute
+
+// isFileURL reports whether send-file's source is a URL to fetch.
+func isFileURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// readFileSource reads what send-file sends: a local file, stdin ("-") or an
+// http(s) URL. It returns the bytes, a file name (the URL's last path segment
+// for URLs, empty for stdin) and the MIME type the server declared, if any.
+func readFileSource(source string) ([]byte, string, string, error) {
+	switch {
+	case source == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to read stdin: %w", err)
+		}
+		return data, "", "", nil
+	case isFileURL(source):
+		u, err := url.Parse(source)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("invalid URL: %w", err)
+		}
+		resp, err := (&http.Client{Timeout: fetchTimeout}).Get(source)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to fetch %s: %w", source, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", "", fmt.Errorf("failed to fetch %s: %s", source, resp.Status)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to fetch %s: %w", source, err)
+		}
+		name := path.Base(u.Path)
+		if name == "/" || name == "." {
+			name = ""
+		}
+		mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		return data, name, mimeType, nil
+	default:
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to read file: %w", err)
+		}
+		return data, filepath.Base(source), "", nil
+	}
+}
+
+// fileSourceMimeType picks the MIME type to send a file as: the file name's
+// extension, then what the server declared, then (without an extension to go
+// on, as for stdin) a sniff of the bytes.
+func fileSourceMimeType(name, declared string, data []byte) string {
+	ext := filepath.Ext(name)
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	if declared != "" {
+		return declared
+	}
+	if ext == "" {
+		if t, _, err := mime.ParseMediaType(http.DetectContentType(data)); err == nil {
+			return t
+		}
+	}
+	return "application/octet-stream"
+}
+
+// localFileFor returns a path to data on disk for tools like ffmpeg that need
+// one: source itself if it's a local file, otherwise a temporary copy that the
+// returned function removes.
+func localFileFor(source, name string, data []byte) (string, func(), error) {
+	if source != "-" && !isFileURL(source) {
+		return source, func() {}, nil
+	}
+	f, err := os.CreateTemp("", "whatsapp-send-*"+filepath.Ext(name))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(f.Name()) }
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	return f.Name(), cleanup, nil
+}
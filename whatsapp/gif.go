@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gifToMP4 converts a GIF with ffmpeg to the MP4 WhatsApp plays as a GIF.
+// Frame sizes are rounded down to even numbers, which H.264 needs.
+func gifToMP4(filePath string) ([]byte, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg is needed to convert %s to a video (or pass an MP4)", filepath.Base(filePath))
+	}
+	out, err := os.CreateTemp("", "whatsapp-gif-*.mp4")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	_ = out.Close()
+	defer func() { _ = os.Remove(out.Name()) }()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-v", "error", "-y", "-i", filePath, "-an", "-movflags", "faststart",
+		"-pix_fmt", "yuv420p", "-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2", "-c:v", "libx264", out.Name())
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to convert GIF: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(out.Name())
+}
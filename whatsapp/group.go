@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // set-picture accepts PNGs, re-encoded as JPEG
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/term"
+)
+
+// cmdGroup handles group subcommands.
+// Usage: group set-name|set-description|set-picture|leave|history <group-jid> ...,
+// group requests|approve|reject <group-jid> ..., or group join|invite-info <invite-url>
+func cmdGroup(args []string) error {
+	usage := fmt.Errorf("usage: group set-name|set-description|set-picture|leave|history|requests|approve|reject <group-jid> ... | group join|invite-info <invite-url>")
+	if len(args) < 1 {
+		return usage
+	}
+
+	switch args[0] {
+	case "set-name":
+		return cmdGroupSetName(args[1:])
+	case "set-description":
+		return cmdGroupSetDescription(args[1:])
+	case "set-picture":
+		return cmdGroupSetPicture(args[1:])
+	case "leave":
+		return cmdGroupLeave(args[1:])
+	case "join":
+		return cmdGroupJoin(args[1:])
+	case "invite-info":
+		return cmdGroupInviteInfo(args[1:])
+	case "history":
+		return cmdGroupHistory(args[1:])
+	case "requests":
+		return cmdGroupRequests(args[1:])
+	case "approve":
+		return cmdGroupRequestAction(args[1:], whatsmeow.ParticipantChangeApprove)
+	case "reject":
+		return cmdGroupRequestAction(args[1:], whatsmeow.ParticipantChangeReject)
+	default:
+		return fmt.Errorf("unknown group subcommand: %s", args[0])
+	}
+}
+
+// parseGroupJID parses a group JID argument, which must be a @g.us JID.
+func parseGroupJID(s string) (types.JID, error) {
+	jid, err := types.ParseJID(s)
+	if err != nil {
+		return types.JID{}, fmt.Errorf("invalid group JID: %w", err)
+	}
+	if jid.Server != types.GroupServer {
+		return types.JID{}, fmt.Errorf("not a group JID (must end with @g.us)")
+	}
+	return jid, nil
+}
+
+// connectForGroup checks a group change is allowed, then opens the message
+// database and connects.
+func connectForGroup(ctx context.Context, jid types.JID) error {
+	if err := checkProfileSend(jid); err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	return connectClient(ctx)
+}
+
+// cmdGroupSetName renames a group (its subject) and the local chat.
+// Usage: group set-name <group-jid> <name...>
+func cmdGroupSetName(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: group set-name <group-jid> <name>")
+	}
+	jid, err := parseGroupJID(args[0])
+	if err != nil {
+		return err
+	}
+	name := strings.Join(args[1:], " ")
+
+	ctx := context.Background()
+	if err := connectForGroup(ctx, jid); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SetGroupName(ctx, jid, name); err != nil {
+		return fmt.Errorf("failed to set group name: %w", err)
+	}
+	if err := saveChat(messageDB, jid.String(), name, true, 0, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update local chat name: %v\n", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":   true,
+		"group_jid": jid.String(),
+		"name":      name,
+	})
+}
+
+// cmdGroupSetDescription sets a group's description; an empty one removes it.
+// Usage: group set-description <group-jid> <description...>
+func cmdGroupSetDescription(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: group set-description <group-jid> <description>")
+	}
+	jid, err := parseGroupJID(args[0])
+	if err != nil {
+		return err
+	}
+	description := strings.Join(args[1:], " ")
+
+	ctx := context.Background()
+	if err := connectForGroup(ctx, jid); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SetGroupTopic(ctx, jid, "", "", description); err != nil {
+		return fmt.Errorf("failed to set group description: %w", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":     true,
+		"group_jid":   jid.String(),
+		"description": description,
+	})
+}
+
+// cmdGroupSetPicture sets a group's picture from a JPEG or PNG, or removes it.
+// Usage: group set-picture <group-jid> <image> | --remove
+func cmdGroupSetPicture(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: group set-picture <group-jid> <image> | --remove")
+	}
+	jid, err := parseGroupJID(args[0])
+	if err != nil {
+		return err
+	}
+
+	var avatar []byte
+	if args[1] != "--remove" {
+		if avatar, err = groupPicture(args[1]); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	if err := connectForGroup(ctx, jid); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	pictureID, err := client.SetGroupPhoto(ctx, jid, avatar)
+	if err != nil {
+		return fmt.Errorf("failed to set group picture: %w", err)
+	}
+
+	output := map[string]any{
+		"success":   true,
+		"group_jid": jid.String(),
+	}
+	if avatar == nil {
+		output["removed"] = true
+	} else {
+		output["picture_id"] = pictureID
+	}
+	return printJSON(output)
+}
+
+// groupPicture reads an image for a group picture. WhatsApp only takes JPEGs,
+// so anything else is decoded and re-encoded.
+func groupPicture(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if http.DetectContentType(data) != "image/jpeg" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s isn't a JPEG or PNG image: %w", path, err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, fmt.Errorf("failed to convert image to JPEG: %w", err)
+		}
+		data = buf.Bytes()
+	}
+	return data, nil
+}
+
+// cmdGroupLeave leaves a group after confirming, and marks the chat as left so
+// chats stops listing it. Its messages stay.
+// Usage: group leave <group-jid> [--yes]
+func cmdGroupLeave(args []string) error {
+	var groupArg string
+	yes := false
+	for _, arg := range args {
+		switch {
+		case arg == "--yes":
+			yes = true
+		case groupArg == "":
+			groupArg = arg
+		default:
+			return fmt.Errorf("unexpected argument: %s", arg)
+		}
+	}
+	if groupArg == "" {
+		return fmt.Errorf("usage: group leave <group-jid> [--yes]")
+	}
+	jid, err := parseGroupJID(groupArg)
+	if err != nil {
+		return err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	if !yes {
+		var name string
+		_ = messageDB.QueryRow(`SELECT COALESCE(name, '') FROM chats WHERE jid = ?`, jid.String()).Scan(&name)
+		label := jid.String()
+		if name != "" {
+			label = fmt.Sprintf("%q (%s)", name, jid)
+		}
+		if ok, err := confirm(fmt.Sprintf("Leave group %s?", label)); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("not leaving %s", jid)
+		}
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.LeaveGroup(ctx, jid); err != nil {
+		return fmt.Errorf("failed to leave group: %w", err)
+	}
+	if err := markChatLeft(jid.String(), time.Now().Unix()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to mark chat as left: %v\n", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":   true,
+		"group_jid": jid.String(),
+		"left":      true,
+	})
+}
+
+// markChatLeft records when we left a group (0 to clear it on rejoining).
+func markChatLeft(chatJID string, leftAt int64) error {
+	value := sql.NullInt64{Int64: leftAt, Valid: leftAt != 0}
+	_, err := messageDB.Exec(`UPDATE chats SET left_at = ? WHERE jid = ?`, value, normalizeJID(chatJID))
+	return err
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal to ask
+// on it fails, so scripts must confirm with a flag instead.
+func confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("%s Pass --yes to confirm without a terminal", question)
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, nil
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// inviteCode extracts the code from a group invite link; a bare code is
+// returned as is.
+func inviteCode(link string) (string, error) {
+	code := strings.TrimSpace(link)
+	for _, prefix := range []string{whatsmeow.InviteLinkPrefix, "http://chat.whatsapp.com/", "chat.whatsapp.com/"} {
+		code = strings.TrimPrefix(code, prefix)
+	}
+	code, _, _ = strings.Cut(code, "?")
+	code = strings.TrimSuffix(code, "/")
+	if code == "" || strings.ContainsAny(code, "/:") {
+		return "", fmt.Errorf("invalid invite link: %s", link)
+	}
+	return code, nil
+}
+
+// cmdGroupJoin joins a group from an invite link and adds it to the local
+// chats (clearing left_at if we'd left it before).
+// Usage: group join <invite-url>
+func cmdGroupJoin(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: group join <invite-url>")
+	}
+	code, err := inviteCode(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// Look the group up first so profiles can refuse it before we join
+	info, err := client.GetGroupInfoFromLink(ctx, code)
+	if err != nil {
+		return fmt.Errorf("failed to get invite info: %w", err)
+	}
+	if err := checkProfileSend(info.JID); err != nil {
+		return err
+	}
+
+	jid, err := client.JoinGroupWithLink(ctx, code)
+	if err != nil {
+		return fmt.Errorf("failed to join group: %w", err)
+	}
+	if err := saveChat(messageDB, jid.String(), info.Name, true, 0, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save chat: %v\n", err)
+	} else if err := markChatLeft(jid.String(), 0); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update chat: %v\n", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":   true,
+		"group_jid": jid.String(),
+		"name":      info.Name,
+	})
+}
+
+// cmdGroupInviteInfo shows what group an invite link is for without joining.
+// Usage: group invite-info <invite-url>
+func cmdGroupInviteInfo(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: group invite-info <invite-url>")
+	}
+	code, err := inviteCode(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	info, err := client.GetGroupInfoFromLink(ctx, code)
+	if err != nil {
+		return fmt.Errorf("failed to get invite info: %w", err)
+	}
+
+	size := info.ParticipantCount
+	if size == 0 {
+		size = len(info.Participants)
+	}
+	output := map[string]any{
+		"group_jid":         info.JID.String(),
+		"name":              info.Name,
+		"participant_count": size,
+	}
+	if info.Topic != "" {
+		output["description"] = info.Topic
+	}
+	if !info.OwnerJID.IsEmpty() {
+		output["creator"] = info.OwnerJID.String()
+	}
+	if !info.OwnerPN.IsEmpty() {
+		output["creator_phone"] = info.OwnerPN.User
+	}
+	if !info.GroupCreated.IsZero() {
+		output["created"] = info.GroupCreated.Unix()
+	}
+	if info.IsJoinApprovalRequired {
+		output["approval_required"] = true
+	}
+	return printJSON(output)
+}
+
+// cmdGroups lists the groups we're in from WhatsApp, updating the group cache
+// and each one's name in the local chats as it goes.
+// Usage: groups
+func cmdGroups(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: groups")
+	}
+
+	ctx := context.Background()
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	joined, err := refreshGroupCache(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups := make([]map[string]any, 0, len(joined))
+	updated := 0
+	for _, info := range joined {
+		size := info.ParticipantCount
+		if size == 0 {
+			size = len(info.Participants)
+		}
+		group := map[string]any{
+			"jid":               info.JID.String(),
+			"name":              info.Name,
+			"participant_count": size,
+		}
+		if info.IsAnnounce {
+			group["announce"] = true
+		}
+		if info.IsLocked {
+			group["locked"] = true
+		}
+		groups = append(groups, group)
+
+		// Being in the group also means we haven't left it
+		if err := saveChat(messageDB, info.JID.String(), info.Name, true, 0, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save chat %s: %v\n", info.JID, err)
+		} else if err := markChatLeft(info.JID.String(), 0); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update chat %s: %v\n", info.JID, err)
+		} else {
+			updated++
+		}
+	}
+
+	return printJSON(map[string]any{
+		"groups":        groups,
+		"chats_updated": updated,
+	})
+}
+
+// cmdGroupRequests lists pending requests to join a group that needs admin
+// approval.
+// Usage: group requests <group-jid>
+func cmdGroupRequests(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: group requests <group-jid>")
+	}
+	jid, err := parseGroupJID(args[0])
+	if err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	pending, err := client.GetGroupRequestParticipants(ctx, jid)
+	if err != nil {
+		return fmt.Errorf("failed to get join requests: %w", err)
+	}
+
+	requests := make([]map[string]any, 0, len(pending))
+	for _, r := range pending {
+		request := map[string]any{
+			"jid":          r.JID.String(),
+			"requested_at": r.RequestedAt.Unix(),
+		}
+		if phone := requestPhone(ctx, r.JID); phone != "" {
+			request["phone"] = phone
+		}
+		var name string
+		_ = messageDB.QueryRow(`SELECT COALESCE(NULLIF(name, ''), NULLIF(push_name, ''), '') FROM contacts WHERE jid = ?`,
+			r.JID.String()).Scan(&name)
+		if name != "" {
+			request["name"] = name
+		}
+		requests = append(requests, request)
+	}
+
+	return printJSON(map[string]any{
+		"group_jid": jid.String(),
+		"requests":  requests,
+	})
+}
+
+// cmdGroupRequestAction approves or rejects pending join requests. Each
+// requester is given as a phone number or JID, and must have a pending request.
+// Usage: group approve|reject <group-jid> <phone>...
+func cmdGroupRequestAction(args []string, action whatsmeow.ParticipantRequestChange) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: group %s <group-jid> <phone>...", action)
+	}
+	jid, err := parseGroupJID(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := connectForGroup(ctx, jid); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	// Requests can come from a lid, so match what was given against the
+	// pending list rather than sending it as is
+	pending, err := client.GetGroupRequestParticipants(ctx, jid)
+	if err != nil {
+		return fmt.Errorf("failed to get join requests: %w", err)
+	}
+	var requesters []types.JID
+	for _, arg := range args[1:] {
+		want, err := parseJID(arg)
+		if err != nil {
+			return fmt.Errorf("invalid phone or JID %q: %w", arg, err)
+		}
+		found := false
+		for _, r := range pending {
+			if r.JID.User == want.User || requestPhone(ctx, r.JID) == want.User {
+				requesters = append(requesters, r.JID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no pending join request from %s", arg)
+		}
+	}
+
+	updated, err := client.UpdateGroupRequestParticipants(ctx, jid, requesters, action)
+	if err != nil {
+		return fmt.Errorf("failed to %s join requests: %w", action, err)
+	}
+
+	results := make([]map[string]any, 0, len(updated))
+	failed := 0
+	for _, p := range updated {
+		result := map[string]any{"jid": p.JID.String(), "success": p.Error == 0}
+		if p.Error != 0 {
+			result["error_code"] = p.Error
+			failed++
+		}
+		results = append(results, result)
+	}
+	return printJSON(map[string]any{
+		"success":   failed == 0,
+		"group_jid": jid.String(),
+		"action":    string(action),
+		"results":   results,
+	})
+}
+
+// requestPhone returns the phone number behind a join request's JID, or ""
+// if it's a lid we have no mapping for.
+func requestPhone(ctx context.Context, jid types.JID) string {
+	if jid.Server == types.DefaultUserServer {
+		return jid.User
+	}
+	if jid.Server == types.HiddenUserServer {
+		if pn, err := client.Store.LIDs.GetPNForLID(ctx, jid.ToNonAD()); err == nil && !pn.IsEmpty() {
+			return pn.User
+		}
+	}
+	return ""
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// refreshGroupCache replaces the cached metadata and participants of every
+// group we're in with what WhatsApp reports now. Sync and the daemon run it on
+// connect; GroupInfo events keep the cache current after that.
+func refreshGroupCache(ctx context.Context) ([]*types.GroupInfo, error) {
+	joined, err := client.GetJoinedGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get groups: %w", err)
+	}
+	for _, info := range joined {
+		if err := saveGroupInfo(info); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache group %s: %v\n", info.JID, err)
+		}
+	}
+	return joined, nil
+}
+
+// saveGroupInfo caches a group's metadata and replaces its participant list.
+func saveGroupInfo(info *types.GroupInfo) error {
+	groupJID := normalizeJID(info.JID.String())
+	if !chatSynced(groupJID) {
+		return nil
+	}
+	size := info.ParticipantCount
+	if size == 0 {
+		size = len(info.Participants)
+	}
+	var created sql.NullInt64
+	if !info.GroupCreated.IsZero() {
+		created = sql.NullInt64{Int64: info.GroupCreated.Unix(), Valid: true}
+	}
+
+	tx, err := messageDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`
+		INSERT INTO groups (jid, name, topic, owner_jid, participant_count, is_announce, is_locked, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(jid) DO UPDATE SET
+			name = excluded.name,
+			topic = excluded.topic,
+			owner_jid = excluded.owner_jid,
+			participant_count = excluded.participant_count,
+			is_announce = excluded.is_announce,
+			is_locked = excluded.is_locked,
+			created_at = COALESCE(excluded.created_at, groups.created_at),
+			updated_at = excluded.updated_at
+	`, groupJID, info.Name, info.Topic, jidString(info.OwnerJID), size,
+		boolToInt(info.IsAnnounce), boolToInt(info.IsLocked), created, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	// Only replace participants when WhatsApp listed them; invite previews
+	// carry a count but no list
+	if len(info.Participants) > 0 {
+		if _, err := tx.Exec(`DELETE FROM participants WHERE group_jid = ?`, groupJID); err != nil {
+			return err
+		}
+		for _, p := range info.Participants {
+			if _, err := tx.Exec(`
+				INSERT OR REPLACE INTO participants (group_jid, jid, phone_jid, lid, display_name, is_admin, is_super_admin)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, groupJID, canonicalJID(normalizeJID(p.JID.String())), jidString(p.PhoneNumber), jidString(p.LID),
+				p.DisplayName, boolToInt(p.IsAdmin || p.IsSuperAdmin), boolToInt(p.IsSuperAdmin)); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// applyGroupChange updates the cache from a GroupInfo event: renames, topic
+// and setting changes, and members joining, leaving, or changing role.
+func applyGroupChange(evt *events.GroupInfo) error {
+	groupJID := normalizeJID(evt.JID.String())
+	if !chatSynced(groupJID) {
+		return nil
+	}
+	now := time.Now().Unix()
+	// Make sure there's a row to update; a full refresh fills in the rest
+	if _, err := messageDB.Exec(`INSERT OR IGNORE INTO groups (jid, updated_at) VALUES (?, ?)`, groupJID, now); err != nil {
+		return err
+	}
+
+	if evt.Name != nil {
+		if _, err := messageDB.Exec(`UPDATE groups SET name = ?, updated_at = ? WHERE jid = ?`, evt.Name.Name, now, groupJID); err != nil {
+			return err
+		}
+		if err := saveChat(messageDB, groupJID, evt.Name.Name, true, 0, false); err != nil {
+			return err
+		}
+	}
+	if evt.Topic != nil {
+		if _, err := messageDB.Exec(`UPDATE groups SET topic = ?, updated_at = ? WHERE jid = ?`, evt.Topic.Topic, now, groupJID); err != nil {
+			return err
+		}
+	}
+	if evt.Announce != nil {
+		if _, err := messageDB.Exec(`UPDATE groups SET is_announce = ?, updated_at = ? WHERE jid = ?`, boolToInt(evt.Announce.IsAnnounce), now, groupJID); err != nil {
+			return err
+		}
+	}
+	if evt.Locked != nil {
+		if _, err := messageDB.Exec(`UPDATE groups SET is_locked = ?, updated_at = ? WHERE jid = ?`, boolToInt(evt.Locked.IsLocked), now, groupJID); err != nil {
+			return err
+		}
+	}
+
+	for _, jid := range evt.Join {
+		if _, err := messageDB.Exec(`INSERT OR IGNORE INTO participants (group_jid, jid) VALUES (?, ?)`,
+			groupJID, canonicalJID(normalizeJID(jid.String()))); err != nil {
+			return err
+		}
+	}
+	for _, jid := range evt.Leave {
+		if _, err := messageDB.Exec(`DELETE FROM participants WHERE group_jid = ? AND (jid = ? OR lid = ?)`,
+			groupJID, canonicalJID(normalizeJID(jid.String())), jid.String()); err != nil {
+			return err
+		}
+	}
+	for _, jid := range evt.Promote {
+		if _, err := messageDB.Exec(`UPDATE participants SET is_admin = 1 WHERE group_jid = ? AND (jid = ? OR lid = ?)`,
+			groupJID, canonicalJID(normalizeJID(jid.String())), jid.String()); err != nil {
+			return err
+		}
+	}
+	for _, jid := range evt.Demote {
+		if _, err := messageDB.Exec(`UPDATE participants SET is_admin = 0, is_super_admin = 0 WHERE group_jid = ? AND (jid = ? OR lid = ?)`,
+			groupJID, canonicalJID(normalizeJID(jid.String())), jid.String()); err != nil {
+			return err
+		}
+	}
+	if len(evt.Join) > 0 || len(evt.Leave) > 0 {
+		if _, err := messageDB.Exec(`
+			UPDATE groups SET participant_count = (SELECT COUNT(*) FROM participants WHERE group_jid = ?), updated_at = ?
+			WHERE jid = ?
+		`, groupJID, now, groupJID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cachedParticipants lists a group's cached participants with names from the
+// local contacts. ok is false if the group has never been cached.
+func cachedParticipants(groupJID string) (name string, participants []map[string]any, ok bool, err error) {
+	groupJID = normalizeJID(groupJID)
+	if err := messageDB.QueryRow(`SELECT COALESCE(name, '') FROM groups WHERE jid = ?`, groupJID).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, false, nil
+		}
+		return "", nil, false, fmt.Errorf("failed to query group: %w", err)
+	}
+
+	rows, err := messageDB.Query(`
+		SELECT p.jid, p.phone_jid, p.is_admin, p.is_super_admin,
+			COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''), NULLIF(pc.name, ''), NULLIF(pc.push_name, ''), NULLIF(p.display_name, ''), '')
+		FROM participants p
+		LEFT JOIN contacts ct ON ct.jid = p.jid
+		LEFT JOIN contacts pc ON pc.jid = p.phone_jid
+		WHERE p.group_jid = ?
+		ORDER BY p.is_super_admin DESC, p.is_admin DESC, p.jid
+	`, groupJID)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to query participants: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	participants = []map[string]any{}
+	for rows.Next() {
+		var jid, participantName string
+		var phoneJID sql.NullString
+		var isAdmin, isSuperAdmin int
+		if err := rows.Scan(&jid, &phoneJID, &isAdmin, &isSuperAdmin, &participantName); err != nil {
+			return "", nil, false, fmt.Errorf("failed to scan row: %w", err)
+		}
+		participant := map[string]any{"jid": jid}
+		if phoneJID.Valid && phoneJID.String != "" && phoneJID.String != jid {
+			participant["phone_jid"] = phoneJID.String
+		}
+		if isAdmin == 1 {
+			participant["is_admin"] = true
+		}
+		if isSuperAdmin == 1 {
+			participant["is_super_admin"] = true
+		}
+		if participantName != "" {
+			participant["name"] = participantName
+		}
+		participants = append(participants, participant)
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, false, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return name, participants, true, nil
+}
+
+// jidString formats a JID for storage, empty if it isn't set.
+func jidString(jid types.JID) string {
+	if jid.IsEmpty() {
+		return ""
+	}
+	return jid.String()
+}
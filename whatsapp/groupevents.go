@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// groupEvent is one change to a group, as stored in group_events.
+type groupEvent struct {
+	kind   string // join, leave, promote, demote, name, description, picture, announce, locked, disappearing
+	target string // the member affected, for membership and role changes
+	value  string // the new name, description, setting or picture ID
+}
+
+// saveGroupEvents records the changes in a GroupInfo event. Events replayed
+// after a reconnect are ignored by the unique index.
+func saveGroupEvents(evt *events.GroupInfo) error {
+	var actor string
+	if evt.Sender != nil {
+		actor = evt.Sender.String()
+	}
+	return insertGroupEvents(evt.JID, actor, evt.Timestamp.Unix(), groupEventChanges(evt))
+}
+
+// groupEventChanges lists the changes a GroupInfo event carries.
+func groupEventChanges(evt *events.GroupInfo) []groupEvent {
+	var changes []groupEvent
+	for _, jid := range evt.Join {
+		changes = append(changes, groupEvent{kind: "join", target: jid.String(), value: evt.JoinReason})
+	}
+	for _, jid := range evt.Leave {
+		changes = append(changes, groupEvent{kind: "leave", target: jid.String()})
+	}
+	for _, jid := range evt.Promote {
+		changes = append(changes, groupEvent{kind: "promote", target: jid.String()})
+	}
+	for _, jid := range evt.Demote {
+		changes = append(changes, groupEvent{kind: "demote", target: jid.String()})
+	}
+	if evt.Name != nil {
+		changes = append(changes, groupEvent{kind: "name", value: evt.Name.Name})
+	}
+	if evt.Topic != nil {
+		changes = append(changes, groupEvent{kind: "description", value: evt.Topic.Topic})
+	}
+	if evt.Announce != nil {
+		changes = append(changes, groupEvent{kind: "announce", value: onOff(evt.Announce.IsAnnounce)})
+	}
+	if evt.Locked != nil {
+		changes = append(changes, groupEvent{kind: "locked", value: onOff(evt.Locked.IsLocked)})
+	}
+	if evt.Ephemeral != nil {
+		value := "off"
+		if evt.Ephemeral.IsEphemeral {
+			value = strconv.FormatUint(uint64(evt.Ephemeral.DisappearingTimer), 10)
+		}
+		changes = append(changes, groupEvent{kind: "disappearing", value: value})
+	}
+	return changes
+}
+
+// saveGroupPictureEvent records a group's picture being changed or removed.
+func saveGroupPictureEvent(evt *events.Picture) error {
+	value := evt.PictureID
+	if evt.Remove {
+		value = "removed"
+	}
+	return insertGroupEvents(evt.JID, evt.Author.String(), evt.Timestamp.Unix(), []groupEvent{{kind: "picture", value: value}})
+}
+
+func insertGroupEvents(group types.JID, actor string, timestamp int64, changes []groupEvent) error {
+	groupJID := normalizeJID(group.String())
+	if len(changes) == 0 || !chatSynced(groupJID) {
+		return nil
+	}
+	if actor != "" {
+		actor = canonicalJID(normalizeJID(actor))
+	}
+	for _, c := range changes {
+		target := c.target
+		if target != "" {
+			target = canonicalJID(normalizeJID(target))
+		}
+		if _, err := messageDB.Exec(`
+			INSERT OR IGNORE INTO group_events (group_jid, type, actor_jid, target_jid, value, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, groupJID, c.kind, actor, target, c.value, timestamp); err != nil {
+			return fmt.Errorf("failed to save group event: %w", err)
+		}
+	}
+	return nil
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// cmdGroupHistory lists a group's recorded membership and settings changes,
+// newest first.
+// Usage: group history <group-jid> [--max-results=N]
+func cmdGroupHistory(args []string) error {
+	var groupArg string
+	limit := 100
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--max-results="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-results="))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--max-results must be a positive number")
+			}
+			limit = n
+		case groupArg == "":
+			groupArg = arg
+		default:
+			return fmt.Errorf("unexpected argument: %s", arg)
+		}
+	}
+	if groupArg == "" {
+		return fmt.Errorf("usage: group history <group-jid> [--max-results=N]")
+	}
+	jid, err := parseGroupJID(groupArg)
+	if err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	rows, err := messageDB.Query(`
+		SELECT e.type, e.actor_jid, e.target_jid, e.value, e.timestamp,
+			COALESCE(NULLIF(a.name, ''), NULLIF(a.push_name, ''), ''),
+			COALESCE(NULLIF(t.name, ''), NULLIF(t.push_name, ''), '')
+		FROM group_events e
+		LEFT JOIN contacts a ON a.jid = e.actor_jid
+		LEFT JOIN contacts t ON t.jid = e.target_jid
+		WHERE e.group_jid = ?
+		ORDER BY e.timestamp DESC, e.id DESC
+		LIMIT ?
+	`, normalizeJID(jid.String()), limit)
+	if err != nil {
+		return fmt.Errorf("failed to query group events: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	history := []map[string]any{}
+	for rows.Next() {
+		var kind, actor, target, value, actorName, targetName string
+		var timestamp int64
+		if err := rows.Scan(&kind, &actor, &target, &value, &timestamp, &actorName, &targetName); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		event := map[string]any{"type": kind, "timestamp": timestamp}
+		if actor != "" {
+			event["actor_jid"] = actor
+		}
+		if actorName != "" {
+			event["actor_name"] = actorName
+		}
+		if target != "" {
+			event["target_jid"] = target
+		}
+		if targetName != "" {
+			event["target_name"] = targetName
+		}
+		if value != "" {
+			event["value"] = value
+		}
+		history = append(history, event)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return printJSON(map[string]any{
+		"group_jid": jid.String(),
+		"events":    history,
+	})
+}
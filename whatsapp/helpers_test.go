@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// useTestDirs points the CLI at empty temporary directories, restoring them
+// and closing messages.db when the test ends.
+func useTestDirs(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	oldConfigDir, oldDataDir := configDir, dataDir
+	configDir, dataDir = filepath.Join(dir, "config"), filepath.Join(dir, "data")
+	t.Setenv("WHATSAPP_MEDIA_DIR", filepath.Join(dir, "media"))
+	t.Cleanup(func() {
+		if messageDB != nil {
+			_ = messageDB.Close()
+			messageDB = nil
+		}
+		configDir, dataDir = oldConfigDir, oldDataDir
+	})
+}
+
+// openTestDB opens messages.db in temporary directories, migrated to the
+// latest schema.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	useTestDirs(t)
+	if err := initMessageDB(); err != nil {
+		t.Fatalf("initMessageDB: %v", err)
+	}
+}
+
+// insertTestMessage stores a minimal incoming message.
+func insertTestMessage(t *testing.T, id, chatJID string, timestamp int64, replyTo string) {
+	t.Helper()
+	if _, err := messageDB.Exec(`
+		INSERT INTO messages (id, chat_jid, sender_jid, timestamp, text, is_from_me, is_read, created_at, reply_to_id)
+		VALUES (?, ?, ?, ?, ?, 0, 0, 0, NULLIF(?, ''))
+	`, id, chatJID, chatJID, timestamp, "text of "+id, replyTo); err != nil {
+		t.Fatalf("insert message %s: %v", id, err)
+	}
+}
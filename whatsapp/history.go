@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+)
+
+// dbWriter is what the save functions write through: messageDB, or the
+// transaction a history sync conversation is saved in.
+type dbWriter interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// preparedTx is a transaction that prepares each distinct query once, so
+// saving thousands of messages doesn't parse the same INSERT thousands of
+// times. The statements close with the transaction.
+type preparedTx struct {
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt
+}
+
+func beginPreparedTx() (*preparedTx, error) {
+	tx, err := messageDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &preparedTx{tx: tx, stmts: map[string]*sql.Stmt{}}, nil
+}
+
+func (p *preparedTx) stmt(query string) (*sql.Stmt, error) {
+	if stmt, ok := p.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := p.tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	p.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (p *preparedTx) Exec(query string, args ...any) (sql.Result, error) {
+	stmt, err := p.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+func (p *preparedTx) QueryRow(query string, args ...any) *sql.Row {
+	stmt, err := p.stmt(query)
+	if err != nil {
+		// Unprepared, the query reports the same error from Scan
+		return p.tx.QueryRow(query, args...)
+	}
+	return stmt.QueryRow(args...)
+}
+
+// saveHistoryConversation saves one conversation from a history sync in a
+// single transaction, returning how many messages it saved. WhatsApp's unread
+// count is authoritative: the newest that many incoming messages are saved
+// unread, the rest read. On-demand syncs (backfill) carry old messages only,
+// so they say nothing about what's unread now, or about mute and timer state:
+// their messages are saved as read and existing chat state is left alone.
+func saveHistoryConversation(ctx context.Context, conv *waHistorySync.Conversation, onDemand bool) (int64, error) {
+	// Messages are saved under the normalized, merged chat (see
+	// saveNormalizedMessage), so the read marks and chat row go there too
+	chatJID := canonicalJID(normalizeJID(conv.GetID()))
+	isGroup := strings.HasSuffix(chatJID, "@g.us")
+	unreadCount := int(conv.GetUnreadCount())
+	if onDemand {
+		unreadCount = 0
+	}
+
+	// Collect messages sorted by timestamp (newest first) to mark unread correctly
+	type msgInfo struct {
+		msg       *waWeb.WebMessageInfo
+		timestamp int64
+		isFromMe  bool
+	}
+	var messages []msgInfo
+	var latestTimestamp int64
+	for _, msg := range conv.Messages {
+		if m := msg.Message; m != nil {
+			ts := int64(m.GetMessageTimestamp())
+			messages = append(messages, msgInfo{m, ts, m.GetKey().GetFromMe()})
+			if ts > latestTimestamp {
+				latestTimestamp = ts
+			}
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].timestamp > messages[j].timestamp
+	})
+
+	// May ask WhatsApp, so before the transaction rather than holding it open
+	chatName := getChatName(ctx, chatJID, isGroup)
+
+	tx, err := beginPreparedTx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.tx.Rollback() }()
+
+	// If unreadCount is 0, mark ALL existing messages in this chat as read.
+	// This handles the case where messages were marked read on the phone before sync.
+	// The MAX(is_read, excluded.is_read) in saveNormalizedMessage prevents us from
+	// downgrading read status, so we need to explicitly update here.
+	if unreadCount == 0 && !conv.GetMarkedAsUnread() && !onDemand {
+		if _, err := tx.Exec(`UPDATE messages SET is_read = 1 WHERE chat_jid = ? AND is_read = 0`, chatJID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to mark chat messages read during history sync: %v\n", err)
+		}
+	}
+
+	// The first unreadCount incoming messages are unread; messages from self
+	// are always read. Only messages actually saved (not reactions or protocol
+	// messages) count toward the unread budget.
+	var saved int64
+	incomingCount := 0
+	for _, m := range messages {
+		isRead := m.isFromMe || incomingCount >= unreadCount
+		ok, err := saveHistoryMessageWithReadStatus(tx, chatJID, m.msg, isRead)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save history message: %v\n", err)
+		} else if ok {
+			saved++
+			if !m.isFromMe {
+				incomingCount++
+			}
+		}
+	}
+
+	if latestTimestamp > 0 || chatName != "" {
+		if err := saveChat(tx, chatJID, chatName, isGroup, latestTimestamp, conv.GetMarkedAsUnread()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save chat %s: %v\n", chatJID, err)
+		}
+	}
+	if conv.MuteEndTime != nil && !onDemand {
+		if err := saveMute(tx, chatJID, historyMuteUntil(conv.GetMuteEndTime())); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save mute for %s: %v\n", chatJID, err)
+		}
+	}
+	if conv.EphemeralExpiration != nil && !onDemand {
+		if err := saveDisappearingTimer(tx, chatJID, conv.GetEphemeralExpiration()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save disappearing timer for %s: %v\n", chatJID, err)
+		}
+	}
+
+	if err := tx.tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to save history for %s: %w", chatJID, err)
+	}
+	return saved, nil
+}
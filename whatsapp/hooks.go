@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// hookTimeout bounds each hook and alert command.
+const hookTimeout = 30 * time.Second
+
+var hookPending sync.WaitGroup
+
+// installHooks registers the configured on_* hooks and reports whether
+// on_message is set. Like the webhook, on_message is a notifier, so the
+// notification rules apply and the caller must install notificationHandler;
+// receipts, calls and group changes come from their own event handler.
+func installHooks() bool {
+	if cfg.OnReceipt != "" || cfg.OnCall != "" || cfg.OnGroupChange != "" {
+		client.AddEventHandler(hookEventHandler)
+	}
+	if cfg.OnMessage == "" {
+		return false
+	}
+	notifiers = append(notifiers, func(n Notification) {
+		if n.Event == eventMessage {
+			runHook(cfg.OnMessage, n)
+		}
+	})
+	return true
+}
+
+func hookEventHandler(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Receipt:
+		if payload, ok := receiptPayload(v); ok && cfg.OnReceipt != "" {
+			runHook(cfg.OnReceipt, payload)
+		}
+	case *events.CallOffer, *events.CallOfferNotice, *events.CallAccept, *events.CallReject, *events.CallTerminate:
+		if payload, ok := callPayload(v); ok && cfg.OnCall != "" {
+			runHook(cfg.OnCall, payload)
+		}
+	case *events.GroupInfo:
+		if payload, ok := groupChangePayload(v); ok && cfg.OnGroupChange != "" {
+			runHook(cfg.OnGroupChange, payload)
+		}
+	}
+}
+
+// groupChangePayload describes a GroupInfo event's changes for hooks and
+// plugins. It returns false if there are none or sync doesn't save the group.
+func groupChangePayload(v *events.GroupInfo) (map[string]any, bool) {
+	groupJID := normalizeJID(v.JID.String())
+	changes := groupEventChanges(v)
+	if len(changes) == 0 || !chatSynced(groupJID) {
+		return nil, false
+	}
+	list := make([]map[string]any, len(changes))
+	for i, c := range changes {
+		change := map[string]any{"type": c.kind}
+		if c.target != "" {
+			change["target_jid"] = canonicalJID(normalizeJID(c.target))
+		}
+		if c.value != "" {
+			change["value"] = c.value
+		}
+		list[i] = change
+	}
+	payload := map[string]any{
+		"event":     "group_change",
+		"group_jid": groupJID,
+		"changes":   list,
+		"timestamp": v.Timestamp.Unix(),
+	}
+	if v.Sender != nil {
+		payload["actor_jid"] = canonicalJID(normalizeJID(v.Sender.String()))
+	}
+	return payload, true
+}
+
+// runHook runs command in the background; flushHooks waits for it.
+func runHook(command string, payload any) {
+	hookPending.Add(1)
+	go func() {
+		defer hookPending.Done()
+		runCommandWithJSON(command, payload)
+	}()
+}
+
+// runCommandWithJSON runs command with sh -c, passing payload as JSON on
+// stdin. Failures are warnings, like other notifier failures.
+func runCommandWithJSON(command string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to encode hook payload: %v\n", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: command %q failed: %v %s\n", command, err, strings.TrimSpace(string(out)))
+	}
+}
+
+// flushHooks waits for hooks still running.
+func flushHooks() {
+	hookPending.Wait()
+}
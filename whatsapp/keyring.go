@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/util/keys"
+)
+
+// keyringService names the keyring items holding session secrets. The account
+// is the config directory, so each config directory has its own item.
+const keyringService = "jean-claude-whatsapp"
+
+// sessionSecrets are the device's private keys. With session_keyring on they
+// live in the OS keyring, and session.db keeps zeros in their place: whatsmeow
+// only writes them when a device is first saved, so the zeros stay put.
+type sessionSecrets struct {
+	JID          string `json:"jid"`
+	NoiseKey     []byte `json:"noise_key"`
+	IdentityKey  []byte `json:"identity_key"`
+	SignedPreKey []byte `json:"signed_pre_key"`
+	AdvKey       []byte `json:"adv_key"`
+}
+
+// syncSessionKeyring moves the session secrets in session.db to where
+// session_keyring says they belong, in either direction, and returns them if
+// they're in the keyring, for applySessionSecrets. A session paired with
+// session_keyring on is written to session.db first and moved on the next run.
+func syncSessionKeyring(dbPath string) (*sessionSecrets, error) {
+	db, err := sql.Open("sqlite", "file:"+dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session database: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var secrets sessionSecrets
+	err = db.QueryRow(`SELECT jid, noise_key, identity_key, signed_pre_key, adv_key FROM whatsmeow_device LIMIT 1`).
+		Scan(&secrets.JID, &secrets.NoiseKey, &secrets.IdentityKey, &secrets.SignedPreKey, &secrets.AdvKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	inKeyring := isZeroKey(secrets.NoiseKey) && isZeroKey(secrets.IdentityKey) && isZeroKey(secrets.SignedPreKey)
+
+	switch {
+	case cfg.SessionKeyring && !inKeyring:
+		encoded, err := json.Marshal(secrets)
+		if err != nil {
+			return nil, err
+		}
+		if err := keyringSet(string(encoded)); err != nil {
+			return nil, fmt.Errorf("failed to store session keys in the OS keyring: %w", err)
+		}
+		// Only scrub session.db once the keyring is known to hold the keys
+		stored, err := loadSessionSecrets(secrets.JID)
+		if err != nil {
+			return nil, err
+		}
+		zero := make([]byte, 32)
+		if _, err := db.Exec(`UPDATE whatsmeow_device SET noise_key = ?, identity_key = ?, signed_pre_key = ?, adv_key = ? WHERE jid = ?`,
+			zero, zero, zero, zero, secrets.JID); err != nil {
+			return nil, fmt.Errorf("failed to remove session keys from session.db: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "Moved session keys to the OS keyring")
+		return stored, nil
+
+	case cfg.SessionKeyring:
+		return loadSessionSecrets(secrets.JID)
+
+	case inKeyring:
+		stored, err := loadSessionSecrets(secrets.JID)
+		if err != nil {
+			return nil, fmt.Errorf("%w (or set session_keyring back to true)", err)
+		}
+		if _, err := db.Exec(`UPDATE whatsmeow_device SET noise_key = ?, identity_key = ?, signed_pre_key = ?, adv_key = ? WHERE jid = ?`,
+			stored.NoiseKey, stored.IdentityKey, stored.SignedPreKey, stored.AdvKey, secrets.JID); err != nil {
+			return nil, fmt.Errorf("failed to restore session keys to session.db: %w", err)
+		}
+		if err := keyringDelete(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove session keys from the OS keyring: %v\n", err)
+		}
+		fmt.Fprintln(os.Stderr, "Moved session keys from the OS keyring back to session.db")
+		return nil, nil
+	}
+	return nil, nil
+}
+
+// loadSessionSecrets reads the session secrets from the keyring, checking
+// they belong to the device in session.db.
+func loadSessionSecrets(jid string) (*sessionSecrets, error) {
+	encoded, err := keyringGet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session keys from the OS keyring: %w", err)
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("session keys are missing from the OS keyring; delete %s and run 'auth' again",
+			filepath.Join(configDir, "session.db"))
+	}
+	var secrets sessionSecrets
+	if err := json.Unmarshal([]byte(encoded), &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse session keys from the OS keyring: %w", err)
+	}
+	if secrets.JID != jid {
+		return nil, fmt.Errorf("the OS keyring holds session keys for %s, not %s", secrets.JID, jid)
+	}
+	for _, key := range [][]byte{secrets.NoiseKey, secrets.IdentityKey, secrets.SignedPreKey} {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("session keys in the OS keyring are invalid")
+		}
+	}
+	return &secrets, nil
+}
+
+// applySessionSecrets puts keys loaded from the keyring on the device
+// whatsmeow loaded with zeros in their place.
+func applySessionSecrets(device *store.Device, secrets *sessionSecrets) error {
+	if device.ID == nil || device.ID.String() != secrets.JID {
+		return fmt.Errorf("session keys in the OS keyring don't match the session in session.db")
+	}
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey([32]byte(secrets.NoiseKey))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey([32]byte(secrets.IdentityKey))
+	device.SignedPreKey.KeyPair = *keys.NewKeyPairFromPrivateKey([32]byte(secrets.SignedPreKey))
+	device.AdvSecretKey = secrets.AdvKey
+	return nil
+}
+
+// removeSessionSecrets deletes the keyring item after logout.
+func removeSessionSecrets() {
+	if !cfg.SessionKeyring {
+		return
+	}
+	if err := keyringDelete(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove session keys from the OS keyring: %v\n", err)
+	}
+}
+
+func isZeroKey(key []byte) bool {
+	return len(key) == 32 && bytes.Count(key, []byte{0}) == 32
+}
+
+// keyringAccount is the config directory, made absolute so it names the same
+// item however the directory was given.
+func keyringAccount() string {
+	if abs, err := filepath.Abs(configDir); err == nil {
+		return abs
+	}
+	return configDir
+}
+
+// keyringSet stores secret with security on macOS (the login Keychain) and
+// secret-tool elsewhere (the Secret Service, e.g. GNOME Keyring or KWallet).
+// Neither sees the secret in its arguments, where other processes could.
+func keyringSet(secret string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// security -i reads commands from stdin; -X takes the secret as hex
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n",
+			securityQuote(keyringService), securityQuote(keyringAccount()), hex.EncodeToString([]byte(secret))))
+	} else {
+		path, err := secretTool()
+		if err != nil {
+			return err
+		}
+		cmd = exec.Command(path, "store", "--label=WhatsApp session ("+keyringAccount()+")",
+			"service", keyringService, "account", keyringAccount())
+		cmd.Stdin = strings.NewReader(secret)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// keyringGet returns the stored secret, or "" if there is none.
+func keyringGet() (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount(), "-w")
+	} else {
+		path, err := secretTool()
+		if err != nil {
+			return "", err
+		}
+		cmd = exec.Command(path, "lookup", "service", keyringService, "account", keyringAccount())
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// security exits 44 for a missing item; secret-tool exits 1 silently
+		if (runtime.GOOS == "darwin" && exitErr.ExitCode() == 44) || (runtime.GOOS != "darwin" && stderr.Len() == 0) {
+			return "", nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// keyringDelete removes the stored secret. A missing one isn't an error.
+func keyringDelete() error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", keyringAccount())
+	} else {
+		path, err := secretTool()
+		if err != nil {
+			return err
+		}
+		cmd = exec.Command(path, "clear", "service", keyringService, "account", keyringAccount())
+	}
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && runtime.GOOS == "darwin" && exitErr.ExitCode() == 44 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func secretTool() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("session_keyring is only supported on macOS and Linux")
+	}
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return "", fmt.Errorf("secret-tool was not found (install libsecret-tools)")
+	}
+	return path, nil
+}
+
+// securityQuote quotes an argument for security -i, which splits its input
+// like a shell.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
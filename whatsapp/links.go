@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// urlPattern matches URLs in message text: http(s) links and bare www. ones.
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+
+// saveLinkPreview records the preview WhatsApp attached to a message with a
+// link: the URL it previews and the page's title and description.
+func saveLinkPreview(db dbWriter, msg *NormalizedMessage) error {
+	ext := msg.Message.GetExtendedTextMessage()
+	if ext.GetMatchedText() == "" {
+		return nil
+	}
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO link_previews (message_id, chat_jid, url, title, description)
+		VALUES (?, ?, ?, ?, ?)
+	`, msg.ID, msg.ChatJID, ext.GetMatchedText(), ext.GetTitle(), ext.GetDescription())
+	return err
+}
+
+// extractURLs returns the URLs in text, in order, without trailing
+// punctuation, and without a closing parenthesis the URL didn't open.
+func extractURLs(text string) []string {
+	var urls []string
+	for _, u := range urlPattern.FindAllString(text, -1) {
+		u = strings.TrimRight(u, ".,;:!?'*_~")
+		if strings.HasSuffix(u, ")") && !strings.Contains(u, "(") {
+			u = strings.TrimRight(u, ")")
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// cmdLinks lists the URLs shared in messages, newest first, with the link
+// preview's title and description where WhatsApp sent one.
+// Usage: links [--chat=JID] [--since=TIME] [--max-results=N]
+func cmdLinks(args []string) error {
+	var chatArg string
+	var since time.Time
+	limit := 50
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("usage: links [--chat=JID] [--since=TIME] [--max-results=N]")
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--chat":
+			chatArg = value
+		case "--since":
+			t, err := parseTimeBound(value)
+			if err != nil {
+				return fmt.Errorf("--since: %w", err)
+			}
+			since = t
+		case "--max-results":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--max-results must be a positive number")
+			}
+			limit = n
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT m.id, m.chat_jid, m.sender_jid, COALESCE(m.sender_name, ''), m.timestamp, m.is_from_me,
+			COALESCE(m.text, ''), COALESCE(lp.url, ''), COALESCE(lp.title, ''), COALESCE(lp.description, '')
+		FROM messages m
+		LEFT JOIN link_previews lp ON lp.message_id = m.id AND lp.chat_jid = m.chat_jid
+		WHERE (lp.url IS NOT NULL OR m.text LIKE '%http%' OR m.text LIKE '%www.%')
+			AND m.timestamp >= ?`
+	var cutoff int64
+	if !since.IsZero() {
+		cutoff = since.Unix()
+	}
+	queryArgs := []any{cutoff}
+	if chatArg != "" {
+		jid, err := parseJID(chatArg)
+		if err != nil {
+			return err
+		}
+		query += ` AND m.chat_jid = ?`
+		queryArgs = append(queryArgs, canonicalJID(normalizeJID(jid.String())))
+	}
+	query += ` ORDER BY m.timestamp DESC, m.rowid DESC`
+
+	rows, err := messageDB.Query(query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := []map[string]any{}
+	chatNames := map[string]string{}
+	for rows.Next() && len(links) < limit {
+		var id, chatJID, senderJID, senderName, text, previewURL, title, description string
+		var timestamp int64
+		var isFromMe int
+		if err := rows.Scan(&id, &chatJID, &senderJID, &senderName, &timestamp, &isFromMe,
+			&text, &previewURL, &title, &description); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		urls := extractURLs(text)
+		if previewURL != "" && !containsURL(urls, previewURL) {
+			urls = append(urls, previewURL)
+		}
+		if _, ok := chatNames[chatJID]; !ok {
+			chatNames[chatJID] = chatDisplayName(chatJID)
+		}
+		for _, u := range urls {
+			if len(links) >= limit {
+				break
+			}
+			link := map[string]any{
+				"url":        u,
+				"message_id": id,
+				"chat_jid":   chatJID,
+				"sender_jid": senderJID,
+				"timestamp":  timestamp,
+				"is_from_me": isFromMe == 1,
+			}
+			if name := chatNames[chatJID]; name != "" {
+				link["chat_name"] = name
+			}
+			if senderName != "" {
+				link["sender_name"] = senderName
+			}
+			if previewURL != "" && sameURL(u, previewURL) {
+				if title != "" {
+					link["title"] = title
+				}
+				if description != "" {
+					link["description"] = description
+				}
+			}
+			links = append(links, link)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return printJSON(links)
+}
+
+func containsURL(urls []string, u string) bool {
+	for _, candidate := range urls {
+		if sameURL(candidate, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameURL compares URLs ignoring the scheme and a trailing slash, since the
+// preview's URL isn't always written exactly as in the text.
+func sameURL(a, b string) bool {
+	normalize := func(u string) string {
+		u = strings.ToLower(u)
+		for _, prefix := range []string{"https://", "http://"} {
+			u = strings.TrimPrefix(u, prefix)
+		}
+		return strings.TrimSuffix(u, "/")
+	}
+	return normalize(a) == normalize(b)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"no links here", nil},
+		{"see https://example.com/a?b=c", []string{"https://example.com/a?b=c"}},
+		{"first http://a.example, then https://b.example/x.", []string{"http://a.example", "https://b.example/x"}},
+		{"is it https://example.com/page?!", []string{"https://example.com/page"}},
+		{"*https://example.com/bold*", []string{"https://example.com/bold"}},
+		// A closing parenthesis is kept only if the URL opened one
+		{"(see https://example.com/docs)", []string{"https://example.com/docs"}},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language)", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+	}
+	for _, tt := range tests {
+		if got := extractURLs(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("extractURLs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSameURL(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://example.com/a", "https://example.com/a", true},
+		{"https://Example.com/a/", "http://example.com/a", true},
+		{"example.com", "https://example.com/", true},
+		{"https://example.com/a", "https://example.com/b", false},
+		{"https://example.com/a?x=1", "https://example.com/a", false},
+	}
+	for _, tt := range tests {
+		if got := sameURL(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameURL(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lockingCommands write to messages.db for a long time, and sync ones hold
+// the WhatsApp connection too, so two of them must not run at once: a cron
+// sync started while the daemon runs would fight it for the session. They
+// hold an advisory lock on messages.db.lock for as long as they run. Other
+// commands don't take it; WAL mode lets them read while a writer works, and
+// busy_timeout makes their short writes wait for it. Any command that
+// connects also takes the session lock (see lockSession).
+var lockingCommands = map[string]bool{
+	"sync":     true,
+	"backfill": true,
+	"daemon":   true,
+	"watch":    true,
+	"purge":    true,
+}
+
+// lockingSubcommands are the subcommands that take the lock for commands
+// that otherwise don't.
+var lockingSubcommands = map[string]string{
+	"db":    "vacuum",
+	"media": "gc",
+}
+
+// lockFile holds the advisory lock open for the rest of the process. Left
+// unreferenced, its finalizer would close it, and so release the lock, on
+// the next garbage collection.
+var lockFile *os.File
+
+// sessionLockFile holds session.db.lock next to session.db, taken by every process that connects
+// to WhatsApp. A second connection with the same session makes the server
+// replace the first one's stream, so at most one may be open.
+var sessionLockFile *os.File
+
+// lockMessageDB takes the advisory lock if cmd needs it. It fails at once,
+// naming the holder, rather than waiting: the holder may be a daemon that
+// never finishes. The lock is released when the process exits.
+func lockMessageDB(cmd string, args []string) error {
+	sub, hasSub := lockingSubcommands[cmd]
+	if !lockingCommands[cmd] && !(hasSub && len(args) > 0 && args[0] == sub) {
+		return nil
+	}
+	f, holder, err := takeLock(dataDir, "messages.db.lock", strings.TrimSpace(cmd+" "+strings.Join(args, " ")))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		if holder != "" {
+			return fmt.Errorf("messages.db is in use by %s; wait for it to finish or stop it", holder)
+		}
+		return fmt.Errorf("messages.db is in use by another sync, backfill, daemon, watch, or purge")
+	}
+	lockFile = f
+	return nil
+}
+
+// lockSession takes the session lock before connecting, failing at once if
+// another process is connected. Commands that only send or mark read can go
+// through a running daemon with rpc instead.
+func lockSession() error {
+	if sessionLockFile != nil {
+		return nil
+	}
+	// Only the command, since a send's arguments include the message
+	f, holder, err := takeLock(configDir, "session.db.lock", os.Args[1])
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		if holder == "" {
+			holder = "another process"
+		}
+		return fmt.Errorf("the WhatsApp session is in use by %s; stop it first, or with the daemon running "+
+			"use rpc send, rpc mark-read or rpc download", holder)
+	}
+	sessionLockFile = f
+	return nil
+}
+
+// takeLock takes an advisory lock on name in dir without waiting and records
+// holder in it. If another process has it, the returned file is nil and
+// holder is what that process recorded.
+func takeLock(dir, name, holder string) (*os.File, string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	locked, err := tryLockFile(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, "", fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	if !locked {
+		current, _ := os.ReadFile(path)
+		_ = f.Close()
+		return nil, strings.TrimSpace(string(current)), nil
+	}
+	// Record the holder for the errors above
+	_ = f.Truncate(0)
+	_, _ = fmt.Fprintf(f, "%s (pid %d)\n", holder, os.Getpid())
+	return f, "", nil
+}
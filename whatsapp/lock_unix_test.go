@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTakeLockNamesHolder(t *testing.T) {
+	dir := t.TempDir()
+	f, holder, err := takeLock(dir, "session.db.lock", "daemon")
+	if err != nil || f == nil {
+		t.Fatalf("takeLock = %v, %q, %v", f, holder, err)
+	}
+
+	// flock is per open file, so a second open in this process is refused too
+	second, holder, err := takeLock(dir, "session.db.lock", "send")
+	if err != nil || second != nil {
+		t.Fatalf("second takeLock = %v, %q, %v; want refused", second, holder, err)
+	}
+	if !strings.HasPrefix(holder, "daemon (pid ") {
+		t.Errorf("holder = %q, want it to name the daemon", holder)
+	}
+
+	_ = f.Close()
+	if f, _, err := takeLock(dir, "session.db.lock", "send"); err != nil || f == nil {
+		t.Fatalf("takeLock after release = %v, %v", f, err)
+	} else {
+		_ = f.Close()
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,11 +16,15 @@ var (
 	// XDG-compliant directory layout:
 	// - configDir: ~/.config/jean-claude/whatsapp/ (auth/session state)
 	// - dataDir: ~/.local/share/jean-claude/whatsapp/ (user data: messages, media)
+	//   Media lives in dataDir/media unless media_dir is configured (see mediaDir)
 	configDir string
 	dataDir   string
 	client    *whatsmeow.Client
 	messageDB *sql.DB
 	logger    waLog.Logger
+
+	// outputFile redirects printJSON to a file (global --output flag)
+	outputFile string
 )
 
 func init() {
@@ -67,6 +72,50 @@ func main() {
 		logger = waLog.Noop
 	}
 
+	if !commandsWithOwnOutput[cmd] {
+		var err error
+		args, outputFile, err = extractOutputFlag(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	args, readOnly = extractReadOnlyFlag(args)
+	var profileName string
+	{
+		var err error
+		args, profileName, err = extractProfileFlag(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	readOnly = readOnly || cfg.ReadOnly
+	if profileName != "" {
+		if err := loadProfile(profileName); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := checkReadOnly(cmd, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := checkProfileCommand(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := lockMessageDB(cmd, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Ensure database is closed on exit
 	defer func() {
 		if messageDB != nil {
@@ -77,33 +126,119 @@ func main() {
 	var err error
 	switch cmd {
 	case "auth":
-		err = cmdAuth()
+		err = cmdAuth(args)
 	case "send":
 		err = cmdSend(args)
 	case "send-file":
 		err = cmdSendFile(args)
+	case "send-contact":
+		err = cmdSendContact(args)
+	case "send-poll":
+		err = cmdSendPoll(args)
+	case "poll-results":
+		err = cmdPollResults(args)
+	case "group":
+		err = cmdGroup(args)
+	case "profile":
+		err = cmdProfile(args)
+	case "scheduled":
+		err = cmdScheduled(args)
+	case "send-batch":
+		err = cmdSendBatch(args)
+	case "set-disappearing":
+		err = cmdSetDisappearing(args)
+	case "undo":
+		err = cmdUndo(args)
 	case "sync":
 		err = cmdSync()
+	case "backfill":
+		err = cmdBackfill(args)
+	case "daemon":
+		err = cmdDaemon(args)
+	case "watch":
+		err = cmdWatch(args)
+	case "rpc":
+		err = cmdRPC(args)
+	case "activity":
+		err = cmdActivity(args)
+	case "alerts":
+		err = cmdAlerts(args)
+	case "rules":
+		err = cmdRules(args)
+	case "purge":
+		err = cmdPurge(args)
+	case "du":
+		err = cmdDu(args)
+	case "stats":
+		err = cmdStats(args)
+	case "db":
+		err = cmdDB(args)
+	case "digest":
+		err = cmdDigest(args)
 	case "messages":
 		err = cmdMessages(args)
+	case "calls":
+		err = cmdCalls(args)
+	case "check":
+		err = cmdCheck(args)
+	case "user-info":
+		err = cmdUserInfo(args)
 	case "contacts":
-		err = cmdContacts()
+		err = cmdContacts(args)
 	case "chats":
 		err = cmdChats(args)
+	case "export":
+		err = cmdExport(args)
+	case "thread":
+		err = cmdThread(args)
+	case "context":
+		err = cmdContext(args)
+	case "message-context":
+		err = cmdMessageContext(args)
 	case "search":
 		err = cmdSearch(args)
+	case "links":
+		err = cmdLinks(args)
 	case "participants":
 		err = cmdParticipants(args)
+	case "groups":
+		err = cmdGroups(args)
 	case "refresh":
 		err = cmdRefresh()
+	case "mark-unread":
+		err = cmdMarkUnread(args)
 	case "mark-read":
 		err = cmdMarkRead(args)
+	case "star":
+		err = cmdStar(args, true)
+	case "unstar":
+		err = cmdStar(args, false)
+	case "mute":
+		err = cmdMute(args)
+	case "unmute":
+		err = cmdUnmute(args)
+	case "chat-settings":
+		err = cmdChatSettings(args)
 	case "mark-all-read":
 		err = cmdMarkAllRead()
 	case "download":
 		err = cmdDownload(args)
+	case "download-all":
+		err = cmdDownloadAll(args)
+	case "names":
+		err = cmdNames(args)
+	case "receipts":
+		err = cmdReceipts(args)
+	case "export-media":
+		err = cmdExportMedia(args)
+	case "media":
+		err = cmdMedia(args)
+	case "presence":
+		err = cmdPresence(args)
 	case "status":
 		err = cmdStatus()
+	case "config":
+		err = cmdConfig(args)
 	case "logout":
 		err = cmdLogout()
 	case "help", "-h", "--help":
@@ -115,7 +250,12 @@ func main() {
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1) //nolint:gocritic // intentional exit after error
+		code := 1
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+		}
+		os.Exit(code) //nolint:gocritic // intentional exit after error
 	}
 }
 
@@ -126,22 +266,214 @@ Usage:
   whatsapp-cli <command> [options]
 
 Commands:
-  auth          Authenticate with WhatsApp (scan QR code)
+  auth          Authenticate with WhatsApp (scan QR code): auth [--no-open] [--qr=stdout|<file.png>|none]
+                [--timeout=SECONDS] [--json] [--wait] (exit 2 on timeout, 3 on cancel,
+                4 if --wait saw no history sync)
+                Without a camera: auth --phone <number> prints an 8-character pairing code
+                to enter on the phone (--json emits it as a pairing_code event)
   send          Send a message: send <phone> <message>
+                --mention=WHO mentions a phone, JID or contact name (repeatable); an @Name
+                in the message becomes the mention, otherwise it's prepended
+                --at=TIME queues it for the daemon to send (2006-01-02T15:04 local time,
+                RFC 3339, or +2h)
+                --typing[=DURATION] shows "typing..." first (default scales with length, max 8s;
+                going online for it needs announce_presence)
+                Several recipients over one connection: send --to=A --to=B [--name=NAME...]
+                <message> (prints a result per recipient)
+  scheduled     Messages queued with send --at: scheduled list [--all] | scheduled cancel <id>
   send-file     Send a file: send-file <phone> <file-path>
+                --caption=TEXT captions an image, video or document
+                --voice sends audio as a voice note (converted to ogg/opus with ffmpeg)
+                --gif sends a video, or a .gif converted to MP4 with ffmpeg, as a looping GIF
+                <file-path> may be - for stdin or an http(s) URL to fetch; --filename=NAME
+                and --mime=TYPE override the name and type sent
+  send-contact  Share a contact card: send-contact <phone> --vcf FILE | --name NAME --phone NUMBER
+  send-poll     Send a poll: send-poll <phone> "Question" --option A --option B [--multi]
+  send-batch    Send one message per row of a CSV (with header) or JSONL file over one
+                connection: send-batch --input FILE [--template TEXT] [--delay 3s]
+                Rows need recipient (or to/phone) and message columns, or --template;
+                {{column}} is replaced by the row's value. Prints a result per row
+  poll-results  Tally the votes on a poll: poll-results <message-id> [--chat=JID]
+  set-disappearing  Set a chat's disappearing-message timer: set-disappearing <chat> <off|24h|7d|90d>
+                (sends follow the chat's timer automatically)
+  undo          Delete the last message sent with this CLI for everyone (within 48h): undo [--dry-run]
   sync          Sync messages from WhatsApp to local database
-  messages      List messages from local database
-  search        Search message history: search <query>
-  contacts      List contacts from local database
-  chats         List recent chats
-  participants  List group participants: participants <group-jid>
+  backfill      Fetch older history from the phone: backfill [--chat JID] [--count 50]
+                (all chats if --chat is omitted; repeat to go further back)
+  daemon        Stay connected and save messages as they arrive: daemon [--interval=5m]
+                Serves JSON-RPC 2.0 on <data dir>/daemon.sock, one request per line:
+                send {to,text,reply_to,mentions}, mark-read {chat,before,up_to},
+                download {message_id,chat}, query {sql,args} (read-only), status
+                Also runs the configured plugins, which speak the same protocol over stdio
+  watch         Stream incoming messages as JSON lines while connected (saved as by sync):
+                watch [--chat <jid>] [--from <jid>]
+  rpc           Call the running daemon: rpc <method> [params-json], e.g. rpc send '{"to":"...","text":"hi"}'
+  calls         Incoming calls seen while connected (sync, watch, daemon), newest first:
+                calls [--missed] [--from=JID] [--max-results=N]
+  activity      Who is typing or recording (recorded by the daemon): activity [--chat <jid>]
+  rules         Daemon notification rules per chat/sender (notify, silent-log, drop):
+                rules [list] | rules add [--chat=JID] [--sender=JID] --action=ACTION
+                rules remove <n> | rules default <action>
+                Alert when a contact comes online: rules watch <jid> [--last-seen] | rules unwatch <jid>
+  alerts        Daemon keyword alerts, overriding the rules (e.g. your name in any group):
+                alerts [list] | alerts add <regex> [--chat=JID] [--notify=CMD] | alerts remove <n>
+                (fire notifiers and webhooks; CMD runs via sh with the alert JSON on stdin)
+  purge         Delete old messages/media: purge [--messages-older-than=AGE] [--media-older-than=AGE]
+                [--disappeared] (messages whose own disappearing timer ran out); starred
+                messages outlive --messages-older-than
+  du            Show disk usage by database, media, and chat: du [--max-results=N]
+  db            Maintain messages.db and session.db: db vacuum (reclaim deleted space),
+                db integrity-check (fails on corruption), db stats (rows and bytes per
+                table and index, free pages, message counts)
+  stats         Message counts by chat, sender, hour of day (local), and media type:
+                stats [--chat=JID] [--since=TIME] [--max-results=N] (top chats/senders, default 20)
+  messages      List messages from local database (--threads tags reply threads,
+                --mentions-me keeps messages that @mention you, --starred starred ones,
+                --since=TIME/--until=TIME bound the time range: RFC 3339, 2006-01-02T15:04,
+                or an age like 24h or 7d before now, --media-only keeps media messages,
+                --media-type=image|video|audio|sticker|document one type of media)
+                Listed messages get short refs (^1, ^2, ...) usable in place of a message ID
+                by download, receipts, thread, and send --reply-to until the next listing
+  thread        Show the whole reply thread around a message: thread <message-id> [--chat=JID]
+                (unstored_parent has the quoted text when the thread starts with a reply to
+                a message that isn't stored)
+  search        Search message history, ignoring case and accents: search <query>
+                Each result has a snippet around the match, with match_offsets giving
+                the [start, end) offsets of each match within it, in Unicode code points
+  links         URLs shared in messages, newest first, with link preview titles:
+                links [--chat=JID] [--since=TIME] [--max-results=N]
+  export        Export a chat's history: export [--chat] <jid> [--format json|csv|txt|whatsapp-txt]
+                [--since=TIME] [--until=TIME] [--redact] [--output FILE] (--redact pseudonymizes
+                numbers/JIDs and strips names and media; txt is WhatsApp's "[dd/mm/yyyy, hh:mm]
+                Name: message" export format, whatsapp-txt its iOS variant with seconds; both to
+                a .zip include the media files; csv columns: id, timestamp, time, sender_jid, sender_name,
+                is_from_me, text, media_type, mime_type, media_file_path, reply_to_id,
+                reply_to_sender, reply_to_text, reactions as JSON)
+                Everything involving one person as a zip: export --contact <jid> [--output FILE.zip]
+  context       Compact chat transcript for LLM prompts:
+                context --chat <jid> [--since 7d] [--max-tokens 4000]
+  message-context  Messages around one message, oldest first, as JSON (the message has is_target):
+                message-context <message-id> [--chat=JID] [--before 5] [--after 5]
+  contacts      List contacts from local database. Merge identities of one person:
+                contacts merge <canonical-jid> <alias-jid> | contacts merge --suggest
+                contacts unmerge <alias-jid>
+  user-info     Show a contact's about text, devices, business name and picture ID:
+                user-info <phone> [--refresh] (stored after the first lookup)
+  check         Check which numbers are on WhatsApp: check <phone>...
+  chats         List recent chats: chats [--unread] [--muted|--unmuted] [--group-only|--dm-only]
+                [--all] [--sort=last_message|unread|name] [--limit=N] (--all includes groups you left)
+  digest        Inbox overview: unread chats, newest first, with counts and previews of the
+                newest unread messages: digest [--previews=3] [--unmuted]
+  names         Refresh stored sender names from contacts: names backfill [--dry-run]
+  participants  List group participants: participants <group-jid> [--refresh]
+                (from the group cache sync keeps; --refresh asks WhatsApp)
+  groups        List the groups you're in (with participant counts and announce/locked
+                flags) and refresh their names in chats
+  group         Manage a group: group set-name <group-jid> <name>
+                group set-description <group-jid> <text> (empty removes it)
+                group set-picture <group-jid> <image.jpg|png> | --remove
+                group leave <group-jid> [--yes] (asks to confirm without --yes)
+                group join <invite-url>
+                group invite-info <invite-url> (name, size and creator, without joining)
+                group history <group-jid> [--max-results=N] (joins, leaves, admin and
+                settings changes recorded by sync/daemon)
+                group requests <group-jid> (pending join requests, for admin-approval groups)
+                group approve|reject <group-jid> <phone>...
   refresh       Fetch chat/group names from WhatsApp
-  mark-read     Mark messages in a chat as read: mark-read <chat-jid>
+  mark-read     Mark messages in a chat as read: mark-read <chat-jid> [--before=TIME | --up-to=MESSAGE_ID]
+                (--before takes Unix seconds, RFC 3339 or 2006-01-02T15:04; --up-to includes
+                the message and older ones, not later ones in the same second)
   mark-all-read Mark all messages in all chats as read
-  download      Download media from a message: download <message-id> [--output path]
+  mark-unread   Mark a chat as unread on all devices: mark-unread <chat-jid>
+  star          Star a message on all devices: star <message-id> [--chat=JID]
+                (list them with messages --starred)
+  unstar        Unstar a message: unstar <message-id> [--chat=JID]
+  mute          Mute a chat on all devices: mute <chat> [--duration=8h|1w|forever] (default forever)
+  unmute        Unmute a chat: unmute <chat>
+  chat-settings Show or change per-chat settings: chat-settings [<chat-jid> [--read-receipts=on|off]]
+  download      Download media from a message: download <message-id> [--chat=JID] [--output path]
+  download-all  Download a chat's media not yet on disk, honoring the media_skip_* settings:
+                download-all --chat <jid> [--media-type image|video|audio|sticker|document]
+                [--since TIME]
+  receipts      Show delivery/read receipts for a message: receipts <message-id> [--chat=JID]
+  export-media  Copy a chat's media into dated folders: export-media --chat <jid> --output <dir> [--copy]
+  media         Inspect downloaded media: media list [--chat=JID] [--max-results=N] lists files,
+                newest first, with their size and messages; media list --orphaned lists files
+                no message refers to; media stats totals them by type and counts content
+                shared between messages; media gc [--older-than=AGE] [--max-size=SIZE]
+                [--dry-run] deletes files older than AGE, then the oldest (re-downloadable
+                ones first) until the rest fit in SIZE, e.g. --older-than 90d --max-size 5GB
+                (default: retain_media, media_cache_max_size)
+  presence      Set own presence: presence set available|unavailable (remembered; the
+                daemon's announce_presence repeats it)
+                Stream contacts' online/last-seen updates as JSON lines: presence watch <jid>...
+                Show recorded updates (also logged by the daemon for rules watch):
+                presence log [<jid>] [--max-results=N]
+  profile       Change your own profile: profile set-name <name> | profile set-about <text>
+                profile set-picture <image.jpg|png> (cropped square, scaled to 640px)
+                profile remove-picture
   status        Show connection status
+  config        Show or change settings: config [show | set <key> <value> | unset <key>]
   logout        Log out and clear credentials
 
 Options:
-  -v, --verbose   Enable verbose logging`)
+  -v, --verbose   Enable verbose logging
+  --output FILE   Write results to FILE instead of stdout (atomically). Format
+                  follows the extension: .csv, .md, otherwise JSON
+  --profile NAME  Restrict this run to a profile from profiles.json (or WHATSAPP_PROFILE):
+                  {"profiles": {"NAME": {"commands": [...], "recipients": [...],
+                  "max_sends_per_hour": N}}}; empty fields don't restrict
+  --read-only     Refuse commands with side effects on WhatsApp (auth, backfill, send
+                  including send --at, send-file, send-contact, send-poll, send-batch,
+                  set-disappearing, undo, mark-read, mark-all-read, mark-unread, mute,
+                  unmute, star, unstar, presence set, group changes, profile changes,
+                  logout) and config changes; the daemon sends no scheduled messages
+
+Settings (config set <key> <value>):
+  announce_presence         Appear online while sync or the daemon is connected (default false)
+  read_only                 Always run as with --read-only (default false; edit config.json to undo)
+  suppress_group_receipts   Never send read receipts to groups (default false)
+  retain_messages           Prune messages older than this after sync, e.g. 2y; starred messages
+                            are kept (default: keep all)
+  purge_disappearing        Delete local copies of messages sent with a disappearing timer once it
+                            runs out, after sync/daemon; older history stays (default false)
+  retain_media              Delete media files older than this after sync, e.g. 90d (default: keep all)
+  media_cache_max_size      Delete the oldest media files after sync once they take more than this,
+                            re-downloadable ones first, e.g. 5GB (default: no limit)
+  media_dir                 Where downloaded media is stored (default: <data dir>/media;
+                            WHATSAPP_MEDIA_DIR overrides). Existing files move on change.
+  media_filename_template   Download filename inside media_dir (default {sha256}{ext}), e.g.
+                            {chat_name}/{date}_{sender}_{id}{ext}. Also: {chat_jid} {time} {type}.
+                            Must include {id} or {sha256}
+  backups                   Number of messages.db backups to keep, taken daily while the daemon
+                            runs and always before an upgrade migrates the database (default 0:
+                            no daily backups, only the latest pre-migration one is kept)
+  backup_dir                Where backups go (default: <data dir>/backups)
+  session_keyring           Keep session keys in the macOS Keychain or Secret Service (secret-tool)
+                            instead of session.db; they move on the next run (default false)
+  ignore_chats              JSON list of chats sync doesn't save, e.g. '["123@g.us"]'
+  only_chats                JSON list of chats to save exclusively (default: all)
+  media_skip_groups         Don't auto-download media from groups (default false)
+  media_max_size            Don't auto-download files larger than this, e.g. 20MB
+  media_skip_types          JSON list of media types not auto-downloaded, e.g. '["video"]'
+  desktop_notifications     Native notification per message in watch/daemon, subject to rules
+                            (notify-send, terminal-notifier or osascript; default false)
+  quiet_hours               No desktop notifications during this local time, e.g. 22:00-07:00
+  on_message                Shell command run per incoming message during sync/daemon, with the
+                            event JSON on stdin (rules apply). Also: on_receipt, on_call,
+                            on_group_change
+  script                    Starlark file for the daemon: on_message(msg) runs per message the
+                            rules let through (msg.chat_jid, msg.sender_jid, msg.text, ...),
+                            and may call send(to, text, reply_to=""), mark_read(chat,
+                            before="", up_to="") and download(message_id, chat="") -> file path;
+                            a call stops after 10 million Starlark steps
+  plugins                   JSON list of commands the daemon keeps running (restarted on exit).
+                            Each gets {"jsonrpc":"2.0","method":"event","params":{...}} lines on
+                            stdin (messages per rules, alerts, receipts, calls, group changes)
+                            and may write JSON-RPC requests (send, mark-read, download, query,
+                            status) to stdout; responses come back on stdin
+  webhook_url               POST each new incoming message as JSON during sync/daemon (rules apply)
+  webhook_secret            Sign webhook bodies: X-Signature-256: sha256=<HMAC-SHA256 hex>
+  webhook_events            JSON list of events to post: message, receipt, reaction, alert
+                            (default ["message", "alert"])`)
 }
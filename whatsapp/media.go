@@ -0,0 +1,376 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultMediaFilenameTemplate names files by content hash, which deduplicates
+// identical media across messages without any extra bookkeeping.
+const defaultMediaFilenameTemplate = "{sha256}{ext}"
+
+// mediaDir returns the directory downloaded media is stored in.
+// Precedence: WHATSAPP_MEDIA_DIR env var, media_dir config, then dataDir/media.
+func mediaDir() string {
+	if dir := os.Getenv("WHATSAPP_MEDIA_DIR"); dir != "" {
+		return dir
+	}
+	if cfg.MediaDir != "" {
+		return expandHome(cfg.MediaDir)
+	}
+	return filepath.Join(dataDir, "media")
+}
+
+// expandHome expands a leading ~/ so config values can be written portably.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// legacyMediaDir is where media was stored before the directory was
+// configurable: media/ in the data directory, so a WHATSAPP_DATA_DIR database
+// never claims the files of the one in ~/.local/share.
+func legacyMediaDir() string {
+	return filepath.Join(dataDir, "media")
+}
+
+// getMeta reads a value from the meta table, returning "" if unset.
+func getMeta(key string) (string, error) {
+	var value string
+	err := messageDB.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// setMeta writes a value to the meta table.
+func setMeta(key, value string) error {
+	_, err := messageDB.Exec(`
+		INSERT INTO meta (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	return err
+}
+
+// migrateMediaDir moves media files and thumbnails and rewrites their paths
+// when the media directory has changed since the last run. Only paths inside
+// the old directory are touched; files saved elsewhere with download --output
+// stay put.
+func migrateMediaDir() error {
+	newDir := mediaDir()
+	oldDir, err := getMeta("media_dir")
+	if err != nil {
+		return fmt.Errorf("failed to read media dir: %w", err)
+	}
+	if oldDir == "" {
+		// First run since the directory became configurable
+		oldDir = legacyMediaDir()
+	}
+	if filepath.Clean(oldDir) == filepath.Clean(newDir) {
+		return setMeta("media_dir", newDir)
+	}
+
+	// Thumbnails live inside the media directory too
+	prefix := escapeLike(filepath.Clean(oldDir)+string(filepath.Separator)) + "%"
+	rows, err := messageDB.Query(`
+		SELECT media_file_path FROM messages WHERE media_file_path LIKE ? ESCAPE '\'
+		UNION
+		SELECT thumbnail_path FROM messages WHERE thumbnail_path LIKE ? ESCAPE '\'
+	`, prefix, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to query media paths: %w", err)
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	if len(paths) > 0 {
+		if err := os.MkdirAll(newDir, 0755); err != nil {
+			return fmt.Errorf("failed to create media directory: %w", err)
+		}
+	}
+
+	moved := 0
+	for _, oldPath := range paths {
+		rel, err := filepath.Rel(oldDir, oldPath)
+		if err != nil {
+			continue
+		}
+		newPath := filepath.Join(newDir, rel)
+		if _, err := os.Stat(oldPath); err == nil {
+			if _, err := os.Stat(newPath); errors.Is(err, os.ErrNotExist) {
+				if err := moveFile(oldPath, newPath); err != nil {
+					// Leave this row pointing at the old file so nothing is lost
+					fmt.Fprintf(os.Stderr, "Warning: failed to move %s: %v\n", oldPath, err)
+					continue
+				}
+				moved++
+			}
+		}
+		if _, err := messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE media_file_path = ?`, newPath, oldPath); err != nil {
+			return fmt.Errorf("failed to update media path: %w", err)
+		}
+		if _, err := messageDB.Exec(`UPDATE messages SET thumbnail_path = ? WHERE thumbnail_path = ?`, newPath, oldPath); err != nil {
+			return fmt.Errorf("failed to update thumbnail path: %w", err)
+		}
+	}
+
+	if len(paths) > 0 {
+		fmt.Fprintf(os.Stderr, "Migrated media directory to %s (%d files moved)\n", newDir, moved)
+	}
+	return setMeta("media_dir", newDir)
+}
+
+// moveFile renames src to dst, falling back to copy+delete when they're on
+// different filesystems (e.g. moving media onto a NAS mount).
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to a new file at dst, failing if dst already exists.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// escapeLike escapes LIKE wildcards so a literal string can be used in a
+// pattern with ESCAPE '\'.
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `%`, `\%`)
+	return strings.ReplaceAll(s, `_`, `\_`)
+}
+
+// mediaTemplateFields are the placeholders available in media_filename_template.
+var mediaTemplateFields = []string{"{chat_name}", "{chat_jid}", "{date}", "{time}", "{sender}", "{id}", "{type}", "{sha256}", "{ext}"}
+
+// validateMediaTemplate rejects templates that could escape the media directory,
+// that contain placeholders we don't know how to fill, or that could give
+// different media the same name: an existing file is reused without another
+// download, so the name must say which media it holds.
+func validateMediaTemplate(tmpl string) error {
+	rest := tmpl
+	for _, field := range mediaTemplateFields {
+		rest = strings.ReplaceAll(rest, field, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("unknown placeholder in %q (available: %s)", tmpl, strings.Join(mediaTemplateFields, " "))
+	}
+	for _, part := range strings.Split(filepath.ToSlash(tmpl), "/") {
+		if part == ".." {
+			return fmt.Errorf("template must stay inside the media directory: %q", tmpl)
+		}
+	}
+	if filepath.IsAbs(tmpl) {
+		return fmt.Errorf("template must be relative to the media directory: %q", tmpl)
+	}
+	if !strings.Contains(tmpl, "{id}") && !strings.Contains(tmpl, "{sha256}") {
+		return fmt.Errorf("template must include {id} or {sha256} so different media can't share a name: %q", tmpl)
+	}
+	return nil
+}
+
+// sanitizeFilenamePart makes a value safe to use as a single path component.
+func sanitizeFilenamePart(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, s)
+	s = strings.Trim(strings.TrimSpace(s), ".")
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// mediaPathForMessage returns where a message's media should be saved, rendering
+// media_filename_template with details looked up from the database.
+func mediaPathForMessage(messageID, chatJID, mediaType, mimeType string, fileSHA256 []byte) string {
+	tmpl := cfg.MediaFilenameTemplate
+	if tmpl == "" {
+		tmpl = defaultMediaFilenameTemplate
+	}
+
+	values := map[string]string{
+		"{id}":     messageID,
+		"{type}":   strings.TrimPrefix(mediaType, "viewonce_"),
+		"{sha256}": hex.EncodeToString(fileSHA256),
+		"{ext}":    getExtensionFromMime(mimeType),
+	}
+	if len(fileSHA256) == 0 {
+		// Still unique without a hash, as for thumbnails
+		values["{sha256}"] = sanitizeFilenamePart(chatJID) + "_" + sanitizeFilenamePart(messageID)
+	}
+
+	// Only hit the database when the template needs message details
+	if tmpl != defaultMediaFilenameTemplate {
+		var senderJID string
+		var chatName, senderName sql.NullString
+		var timestamp int64
+		err := messageDB.QueryRow(`
+			SELECT m.sender_jid, m.sender_name, m.timestamp,
+				CASE
+					WHEN c.is_group = 1 THEN COALESCE(NULLIF(c.name, ''), '')
+					ELSE COALESCE(NULLIF(c.name, ''), ct.name, ct.push_name, '')
+				END
+			FROM messages m
+			LEFT JOIN chats c ON m.chat_jid = c.jid
+			LEFT JOIN contacts ct ON m.chat_jid = ct.jid
+			WHERE m.id = ? AND m.chat_jid = ?
+		`, messageID, chatJID).Scan(&senderJID, &senderName, &timestamp, &chatName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to look up message for media filename: %v\n", err)
+		}
+
+		t := time.Unix(timestamp, 0)
+		values["{chat_jid}"] = chatJID
+		values["{chat_name}"] = chatName.String
+		if values["{chat_name}"] == "" {
+			values["{chat_name}"] = strings.Split(chatJID, "@")[0]
+		}
+		values["{sender}"] = senderName.String
+		if values["{sender}"] == "" {
+			values["{sender}"] = strings.Split(senderJID, "@")[0]
+		}
+		values["{date}"] = t.Format("2006-01-02")
+		values["{time}"] = t.Format("150405")
+	}
+
+	// Substitute within each path component so values can't introduce separators
+	parts := strings.Split(filepath.ToSlash(tmpl), "/")
+	for i, part := range parts {
+		for _, field := range mediaTemplateFields {
+			if strings.Contains(part, field) {
+				value := values[field]
+				if field != "{ext}" {
+					value = sanitizeFilenamePart(value)
+				}
+				part = strings.ReplaceAll(part, field, value)
+			}
+		}
+		parts[i] = part
+	}
+	return filepath.Join(append([]string{mediaDir()}, parts...)...)
+}
+
+// mediaSkipReason returns why automatic download of a message's media is
+// disabled by the media_skip_* / media_max_size settings, or "" if allowed.
+func mediaSkipReason(chatJID, mediaType string, fileLength int64) string {
+	if cfg.MediaSkipGroups && strings.HasSuffix(chatJID, "@g.us") {
+		return "group"
+	}
+	baseType := strings.TrimPrefix(mediaType, "viewonce_")
+	for _, t := range cfg.MediaSkipTypes {
+		if strings.EqualFold(t, baseType) {
+			return "type"
+		}
+	}
+	if cfg.MediaMaxSize != "" && fileLength > 0 {
+		// Validated when the config was loaded
+		if maxSize, _ := parseSize(cfg.MediaMaxSize); fileLength > maxSize {
+			return "size"
+		}
+	}
+	return ""
+}
+
+// findExistingMedia returns a downloaded file with the given content hash, if any
+// message already has one on disk. media_files is the dedupe index for templated names.
+func findExistingMedia(fileSHA256 []byte) string {
+	if len(fileSHA256) == 0 {
+		return ""
+	}
+	rows, err := messageDB.Query(`SELECT path FROM media_files WHERE sha256 = ? AND ref_count > 0`, fileSHA256)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var path string
+		if rows.Scan(&path) == nil {
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// placeCachedMedia makes outputPath available without downloading, either because
+// it already exists or by hardlinking an identical file saved under another name.
+// Returns true and records the path on the message if it succeeded.
+func placeCachedMedia(messageID, chatJID, outputPath string, fileSHA256 []byte) bool {
+	if _, err := os.Stat(outputPath); err != nil {
+		existing := findExistingMedia(fileSHA256)
+		if existing == "" {
+			return false
+		}
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return false
+		}
+		// Hardlinks share storage; fall back to a copy across filesystems
+		if err := os.Link(existing, outputPath); err != nil {
+			if err := copyFile(existing, outputPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to reuse cached media: %v\n", err)
+				return false
+			}
+		}
+	}
+	_, _ = messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = ? AND chat_jid = ?`, outputPath, messageID, chatJID)
+	return true
+}
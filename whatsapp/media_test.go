@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestValidateMediaTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		wantErr bool
+	}{
+		{"{sha256}{ext}", false},
+		{"{chat_name}/{date}_{id}{ext}", false},
+		{"{type}/{sender}-{time}-{sha256}{ext}", false},
+		{"{chat_name}/{date}{ext}", true}, // Different media could share a name
+		{"{id}_{unknown}{ext}", true},     // Unknown placeholder
+		{"{id{ext}", true},                // Stray brace
+		{"../{id}{ext}", true},            // Escapes the media directory
+		{"{chat_name}/../../{id}{ext}", true},
+		{"/tmp/{id}{ext}", true}, // Absolute
+	}
+	for _, tt := range tests {
+		if err := validateMediaTemplate(tt.tmpl); (err != nil) != tt.wantErr {
+			t.Errorf("validateMediaTemplate(%q) error = %v, want error %v", tt.tmpl, err, tt.wantErr)
+		}
+	}
+}
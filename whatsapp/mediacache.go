@@ -0,0 +1,500 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cmdMedia inspects the downloaded media cache.
+// Usage: media list [--chat=JID] [--orphaned] [--max-results=N] | media stats | media gc [--older-than=AGE] [--max-size=SIZE] [--dry-run]
+func cmdMedia(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: media list [--chat=JID] [--orphaned] [--max-results=N] | media stats | media gc [--older-than=AGE] [--max-size=SIZE] [--dry-run]")
+	}
+	switch args[0] {
+	case "list":
+		return cmdMediaList(args[1:])
+	case "stats":
+		return cmdMediaStats(args[1:])
+	case "gc":
+		return cmdMediaGC(args[1:])
+	default:
+		return fmt.Errorf("unknown media subcommand: %s (expected list, stats, or gc)", args[0])
+	}
+}
+
+// rebuildMediaRefs recomputes media_files from messages. Used to seed the
+// table when it was added.
+func rebuildMediaRefs(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		DELETE FROM media_files;
+		INSERT INTO media_files (path, sha256, size, ref_count)
+		SELECT media_file_path, MAX(file_sha256), MAX(file_length), COUNT(*) FROM messages
+		WHERE media_file_path IS NOT NULL AND media_file_path != ''
+		GROUP BY media_file_path;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild media references: %w", err)
+	}
+	return nil
+}
+
+// releaseMedia deletes the files media_files says no message refers to any
+// more, as left by deleting messages or clearing their media_file_path. Other
+// names for the same content are separate files and stay.
+func releaseMedia(report *PruneReport) error {
+	rows, err := messageDB.Query(`SELECT path FROM media_files WHERE ref_count <= 0`)
+	if err != nil {
+		return fmt.Errorf("failed to query media files: %w", err)
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	for _, path := range paths {
+		// A download may have claimed the file again since the query
+		result, err := messageDB.Exec(`DELETE FROM media_files WHERE path = ? AND ref_count <= 0`, path)
+		if err != nil {
+			return fmt.Errorf("failed to release media file: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			// Left behind, it shows up in media list --orphaned
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete media file: %v\n", err)
+			continue
+		}
+		report.MediaFilesDeleted++
+		report.MediaBytesFreed += info.Size()
+	}
+	return nil
+}
+
+// mediaFile is a downloaded file and the messages recorded as having it.
+type mediaFile struct {
+	path      string
+	mediaType string
+	mimeType  string
+	timestamp int64 // The newest message's
+	messages  []messageKey
+}
+
+// downloadedMedia returns the files recorded in media_file_path, newest
+// message first, optionally for one chat. A file saved for several messages
+// (same content) is listed once.
+func downloadedMedia(chatJID string) ([]*mediaFile, error) {
+	query := `SELECT media_file_path, id, chat_jid, COALESCE(media_type, ''), COALESCE(mime_type_full, ''), timestamp
+		FROM messages WHERE media_file_path IS NOT NULL AND media_file_path != ''`
+	var args []any
+	if chatJID != "" {
+		query += " AND chat_jid = ?"
+		args = append(args, chatJID)
+	}
+	rows, err := messageDB.Query(query+" ORDER BY timestamp DESC, rowid DESC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query media files: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var files []*mediaFile
+	byPath := map[string]*mediaFile{}
+	for rows.Next() {
+		var path, mediaType, mimeType string
+		var key messageKey
+		var timestamp int64
+		if err := rows.Scan(&path, &key.ID, &key.ChatJID, &mediaType, &mimeType, &timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		f := byPath[path]
+		if f == nil {
+			f = &mediaFile{path: path, mediaType: strings.TrimPrefix(mediaType, "viewonce_"), mimeType: mimeType, timestamp: timestamp}
+			byPath[path] = f
+			files = append(files, f)
+		}
+		f.messages = append(f.messages, key)
+	}
+	return files, rows.Err()
+}
+
+// orphanedFile is a file in the media directory no message refers to, left
+// behind when its messages were deleted.
+type orphanedFile struct {
+	path     string
+	size     int64
+	modified int64
+}
+
+// orphanedMedia walks the media directory, skipping thumbnails, for files
+// media_files doesn't count a reference to.
+func orphanedMedia() ([]orphanedFile, error) {
+	referenced := map[string]bool{}
+	rows, err := messageDB.Query(`SELECT path FROM media_files WHERE ref_count > 0`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query media files: %w", err)
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		referenced[filepath.Clean(path)] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	thumbnails := filepath.Clean(thumbnailDir())
+	var orphans []orphanedFile
+	err = filepath.WalkDir(mediaDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Missing or unreadable entries have nothing to report
+		}
+		if d.IsDir() {
+			if filepath.Clean(path) == thumbnails {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if referenced[filepath.Clean(path)] {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			orphans = append(orphans, orphanedFile{path: path, size: info.Size(), modified: info.ModTime().Unix()})
+		}
+		return nil
+	})
+	return orphans, err
+}
+
+// cmdMediaList lists downloaded files with their size and the messages and
+// chats they came from, newest first. Files recorded but gone from disk are
+// marked missing. With --orphaned it lists files no message refers to instead.
+func cmdMediaList(args []string) error {
+	var chatJID string
+	orphaned := false
+	limit := 50
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--chat="):
+			chatJID = strings.TrimPrefix(arg, "--chat=")
+		case arg == "--orphaned":
+			orphaned = true
+		case strings.HasPrefix(arg, "--max-results="):
+			_, _ = fmt.Sscanf(strings.TrimPrefix(arg, "--max-results="), "%d", &limit)
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+	if orphaned && chatJID != "" {
+		return fmt.Errorf("--orphaned files belong to no chat, so it can't be combined with --chat")
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	if orphaned {
+		orphans, err := orphanedMedia()
+		if err != nil {
+			return err
+		}
+		// Largest first: those are the ones worth deleting
+		sort.Slice(orphans, func(i, j int) bool {
+			if orphans[i].size != orphans[j].size {
+				return orphans[i].size > orphans[j].size
+			}
+			return orphans[i].path < orphans[j].path
+		})
+		if limit >= 0 && len(orphans) > limit {
+			orphans = orphans[:limit]
+		}
+		list := []map[string]any{}
+		for _, o := range orphans {
+			list = append(list, map[string]any{"path": o.path, "bytes": o.size, "modified": o.modified})
+		}
+		return printJSON(list)
+	}
+
+	if chatJID != "" {
+		chatJID = canonicalJID(normalizeJID(chatJID))
+	}
+	files, err := downloadedMedia(chatJID)
+	if err != nil {
+		return err
+	}
+	if limit >= 0 && len(files) > limit {
+		files = files[:limit]
+	}
+
+	chatNames := map[string]string{}
+	list := []map[string]any{}
+	for _, f := range files {
+		entry := map[string]any{
+			"path":      f.path,
+			"timestamp": f.timestamp,
+		}
+		if info, err := os.Stat(f.path); err == nil {
+			entry["bytes"] = info.Size()
+		} else {
+			entry["missing"] = true
+		}
+		if f.mediaType != "" {
+			entry["media_type"] = f.mediaType
+		}
+		if f.mimeType != "" {
+			entry["mime_type"] = f.mimeType
+		}
+		messages := []map[string]any{}
+		for _, key := range f.messages {
+			name, ok := chatNames[key.ChatJID]
+			if !ok {
+				name = chatDisplayName(key.ChatJID)
+				chatNames[key.ChatJID] = name
+			}
+			msg := map[string]any{"id": key.ID, "chat_jid": key.ChatJID}
+			if name != "" {
+				msg["chat_name"] = name
+			}
+			messages = append(messages, msg)
+		}
+		entry["messages"] = messages
+		list = append(list, entry)
+	}
+	return printJSON(list)
+}
+
+// cmdMediaStats summarizes the media cache: downloaded files and bytes by
+// type, files recorded but missing from disk, orphaned files, media messages
+// not downloaded yet, and content shared between messages. du breaks the same storage down by chat.
+func cmdMediaStats(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: media stats")
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	files, err := downloadedMedia("")
+	if err != nil {
+		return err
+	}
+	type usage struct {
+		Files int   `json:"files"`
+		Bytes int64 `json:"bytes"`
+	}
+	var downloaded usage
+	missing := 0
+	byType := map[string]*usage{}
+	chats := map[string]bool{}
+	messages := 0
+	for _, f := range files {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			missing++
+			continue
+		}
+		downloaded.Files++
+		downloaded.Bytes += info.Size()
+		mediaType := f.mediaType
+		if mediaType == "" {
+			mediaType = "unknown"
+		}
+		u := byType[mediaType]
+		if u == nil {
+			u = &usage{}
+			byType[mediaType] = u
+		}
+		u.Files++
+		u.Bytes += info.Size()
+		messages += len(f.messages)
+		for _, key := range f.messages {
+			chats[key.ChatJID] = true
+		}
+	}
+
+	orphans, err := orphanedMedia()
+	if err != nil {
+		return err
+	}
+	var orphaned usage
+	for _, o := range orphans {
+		orphaned.Files++
+		orphaned.Bytes += o.size
+	}
+
+	// Not downloaded: media with download metadata but no recorded file
+	var placeholders []string
+	var queryArgs []any
+	for _, t := range downloadableMediaTypes {
+		placeholders = append(placeholders, "?", "?")
+		queryArgs = append(queryArgs, t, "viewonce_"+t)
+	}
+	var notDownloaded int64
+	if err := messageDB.QueryRow(`
+		SELECT COUNT(*) FROM messages
+		WHERE media_type IN (`+strings.Join(placeholders, ", ")+`) AND media_key IS NOT NULL
+			AND (media_file_path IS NULL OR media_file_path = '')
+	`, queryArgs...).Scan(&notDownloaded); err != nil {
+		return fmt.Errorf("failed to count media messages: %w", err)
+	}
+
+	// Content saved once but used by several messages, under one name or
+	// hardlinked under several
+	var shared usage
+	var sharedMessages, savedBytes int64
+	rows, err := messageDB.Query(`
+		SELECT MAX(COALESCE(size, 0)), SUM(ref_count) FROM media_files
+		WHERE ref_count > 0
+		GROUP BY COALESCE(hex(sha256), path)
+		HAVING SUM(ref_count) > 1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query media files: %w", err)
+	}
+	for rows.Next() {
+		var size, refs int64
+		if err := rows.Scan(&size, &refs); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		shared.Files++
+		shared.Bytes += size
+		sharedMessages += refs
+		savedBytes += size * (refs - 1)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	output := map[string]any{
+		"dir":            mediaDir(),
+		"downloaded":     downloaded,
+		"by_type":        byType,
+		"messages":       messages, // Messages whose file is on disk; identical files are shared
+		"chats":          len(chats),
+		"missing":        missing,  // Files recorded on a message but gone from disk
+		"orphaned":       orphaned, // On disk, but no message refers to it
+		"not_downloaded": notDownloaded,
+		"deduplicated": map[string]any{
+			"files":       shared.Files,
+			"bytes":       shared.Bytes,
+			"messages":    sharedMessages,
+			"bytes_saved": savedBytes, // Not downloaded again thanks to sharing
+		},
+	}
+	return printJSON(output)
+}
+
+// cmdMediaGC deletes downloaded files whose messages are all older than
+// --older-than, then the oldest files until the cache fits in --max-size,
+// clearing their media_file_path. Files that can be downloaded again from
+// their stored media key go first. Without flags it applies retain_media and
+// media_cache_max_size from config, as sync and the daemon do.
+func cmdMediaGC(args []string) error {
+	policy := configuredRetention()
+	dryRun := false
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch {
+		case args[i] == "--dry-run":
+			dryRun = true
+		case strings.HasPrefix(args[i], "--older-than="), args[i] == "--older-than" && i+1 < len(args):
+			_, value, hasValue := strings.Cut(args[i], "=")
+			if !hasValue {
+				value = args[i+1]
+				i++
+			}
+			policy.media, err = parseAge(value)
+		case strings.HasPrefix(args[i], "--max-size="), args[i] == "--max-size" && i+1 < len(args):
+			_, value, hasValue := strings.Cut(args[i], "=")
+			if !hasValue {
+				value = args[i+1]
+				i++
+			}
+			policy.mediaSize, err = parseSize(value)
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if policy.media == 0 && policy.mediaSize == 0 {
+		return fmt.Errorf("nothing to collect: set retain_media/media_cache_max_size in config or pass --older-than/--max-size")
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	var cutoff int64
+	if policy.media > 0 {
+		cutoff = time.Now().Add(-policy.media).Unix()
+	}
+	files, err := planMediaPrune(cutoff, policy.mediaSize)
+	if err != nil {
+		return err
+	}
+
+	var report PruneReport
+	if dryRun {
+		list := []map[string]any{}
+		for _, f := range files {
+			if f.missing {
+				continue
+			}
+			report.MediaFilesDeleted++
+			report.MediaBytesFreed += f.size
+			list = append(list, map[string]any{
+				"path":        f.path,
+				"bytes":       f.size,
+				"timestamp":   f.newest,
+				"refetchable": f.refetchable,
+			})
+		}
+		return printJSON(map[string]any{
+			"success":             true,
+			"dry_run":             true,
+			"media_files_deleted": report.MediaFilesDeleted,
+			"media_bytes_freed":   report.MediaBytesFreed,
+			"files":               list,
+		})
+	}
+
+	if err := deleteMedia(files, &report); err != nil {
+		return err
+	}
+	return printJSON(map[string]any{
+		"success":             true,
+		"media_files_deleted": report.MediaFilesDeleted,
+		"media_bytes_freed":   report.MediaBytesFreed,
+	})
+}
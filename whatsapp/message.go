@@ -37,6 +37,7 @@ type MediaMetadata struct {
 	FileLength    int64  // File size in bytes
 	DirectPath    string // WhatsApp CDN path
 	URL           string // Full download URL
+	Thumbnail     []byte // Inline JPEG preview (images and videos)
 }
 
 // ReplyContext holds information about the message being replied to.
@@ -117,20 +118,38 @@ func normalizeFromHistory(chatJID string, msg *waWeb.WebMessageInfo) *Normalized
 }
 
 func saveMessage(evt *events.Message) error {
+	noteDisappearingTimer(evt)
+
+	// Votes go to poll_votes, not messages
+	if update := evt.Message.GetPollUpdateMessage(); update != nil {
+		if err := savePollVote(evt, update); err != nil {
+			return fmt.Errorf("failed to save poll vote: %w", err)
+		}
+		return nil
+	}
 	normalized := normalizeFromEvent(evt)
-	_, err := saveNormalizedMessage(&normalized, normalized.IsFromMe, true)
+	_, err := saveNormalizedMessage(messageDB, &normalized, normalized.IsFromMe, true)
 	return err
 }
 
 // saveHistoryMessageWithReadStatus saves a message from history sync with the specified read status.
 // Returns (saved, err) where saved indicates if the message was inserted into the messages table
 // (as opposed to skipped or saved as a reaction). This helps the caller track unread counts correctly.
-func saveHistoryMessageWithReadStatus(chatJID string, msg *waWeb.WebMessageInfo, isRead bool) (bool, error) {
+func saveHistoryMessageWithReadStatus(db dbWriter, chatJID string, msg *waWeb.WebMessageInfo, isRead bool) (bool, error) {
 	normalized := normalizeFromHistory(chatJID, msg)
 	if normalized == nil {
 		return false, nil
 	}
-	return saveNormalizedMessage(normalized, isRead, false)
+	saved, err := saveNormalizedMessage(db, normalized, isRead, false)
+	if err == nil && len(msg.GetPollUpdates()) > 0 && chatSynced(normalized.ChatJID) {
+		saveHistoryPollVotes(db, normalized, msg.GetPollUpdates())
+	}
+	if saved && msg.GetStarred() {
+		if err := setStarred(db, normalized.ID, normalized.ChatJID, true); err != nil {
+			return saved, err
+		}
+	}
+	return saved, err
 }
 
 // saveNormalizedMessage saves a message to the database.
@@ -138,21 +157,30 @@ func saveHistoryMessageWithReadStatus(chatJID string, msg *waWeb.WebMessageInfo,
 // isLive indicates whether this is from a live event (updates text/media on conflict, triggers chat update).
 // Returns (saved, err) where saved indicates if the message was inserted into the messages table.
 // Reactions, protocol messages, and empty messages return saved=false.
-func saveNormalizedMessage(msg *NormalizedMessage, isRead bool, isLive bool) (bool, error) {
+func saveNormalizedMessage(db dbWriter, msg *NormalizedMessage, isRead bool, isLive bool) (bool, error) {
 	if msg.Message == nil {
 		return false, nil
 	}
 
+	// Identities merged with 'contacts merge' keep landing in the canonical chat
+	msg.ChatJID = canonicalJID(normalizeJID(msg.ChatJID))
+	msg.SenderJID = canonicalJID(normalizeJID(msg.SenderJID))
+
+	// Chats excluded by ignore_chats/only_chats aren't archived
+	if !chatSynced(msg.ChatJID) {
+		return false, nil
+	}
+
 	// Handle reaction messages separately - they go to reactions table, not messages
 	if rm := msg.Message.GetReactionMessage(); rm != nil {
-		return false, saveReaction(msg, rm)
+		return false, saveReaction(db, msg, rm)
 	}
 
 	content := extractMessageContentFull(msg.Message)
 
 	// Skip system/protocol messages that have no user-visible content
 	switch content.MediaType {
-	case "key_distribution", "context_info", "protocol":
+	case "key_distribution", "context_info", "protocol", "poll_update":
 		return false, nil
 	}
 
@@ -163,7 +191,7 @@ func saveNormalizedMessage(msg *NormalizedMessage, isRead bool, isLive bool) (bo
 
 	// Save contact info from history sync messages (live events use PushName handler)
 	if !isLive && msg.PushName != "" && msg.SenderJID != "" {
-		_ = saveContact(msg.SenderJID, "", msg.PushName)
+		_ = saveContact(db, msg.SenderJID, "", msg.PushName)
 	}
 
 	// Prepare media metadata for storage
@@ -187,20 +215,21 @@ func saveNormalizedMessage(msg *NormalizedMessage, isRead bool, isLive bool) (bo
 	var replyToID, replyToSender, replyToText sql.NullString
 	if content.Reply != nil {
 		replyToID = sql.NullString{String: content.Reply.ID, Valid: content.Reply.ID != ""}
-		replyToSender = sql.NullString{String: content.Reply.Sender, Valid: content.Reply.Sender != ""}
+		replyToSender = sql.NullString{String: normalizeJID(content.Reply.Sender), Valid: content.Reply.Sender != ""}
 		replyToText = sql.NullString{String: content.Reply.Text, Valid: content.Reply.Text != ""}
 	}
 
 	// Choose SQL based on whether to update content on conflict (live messages can be edits)
 	var err error
 	if isLive {
-		_, err = messageDB.Exec(`
+		_, err = db.Exec(`
 			INSERT INTO messages (id, chat_jid, sender_jid, sender_name, timestamp, text, media_type, is_from_me, is_read, created_at,
 				mime_type_full, media_key, file_sha256, file_enc_sha256, file_length, direct_path, media_url,
-				reply_to_id, reply_to_sender, reply_to_text)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(id) DO UPDATE SET
+				reply_to_id, reply_to_sender, reply_to_text, search_text)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id, chat_jid) DO UPDATE SET
 				text = excluded.text,
+				search_text = excluded.search_text,
 				media_type = excluded.media_type,
 				is_read = MAX(messages.is_read, excluded.is_read),
 				mime_type_full = COALESCE(excluded.mime_type_full, messages.mime_type_full),
@@ -216,15 +245,15 @@ func saveNormalizedMessage(msg *NormalizedMessage, isRead bool, isLive bool) (bo
 		`, msg.ID, msg.ChatJID, msg.SenderJID, msg.PushName, msg.Timestamp,
 			content.Text, content.MediaType, boolToInt(msg.IsFromMe), boolToInt(isRead), time.Now().Unix(),
 			mimeType, mediaKey, fileSHA256, fileEncSHA256, fileLength, directPath, mediaURL,
-			replyToID, replyToSender, replyToText)
+			replyToID, replyToSender, replyToText, searchText(content.Text))
 	} else {
 		// History sync: don't update text/media_type on conflict (preserve existing content)
-		_, err = messageDB.Exec(`
+		_, err = db.Exec(`
 			INSERT INTO messages (id, chat_jid, sender_jid, sender_name, timestamp, text, media_type, is_from_me, is_read, created_at,
 				mime_type_full, media_key, file_sha256, file_enc_sha256, file_length, direct_path, media_url,
-				reply_to_id, reply_to_sender, reply_to_text)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(id) DO UPDATE SET
+				reply_to_id, reply_to_sender, reply_to_text, search_text)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id, chat_jid) DO UPDATE SET
 				is_read = MAX(messages.is_read, excluded.is_read),
 				mime_type_full = COALESCE(excluded.mime_type_full, messages.mime_type_full),
 				media_key = COALESCE(excluded.media_key, messages.media_key),
@@ -239,29 +268,70 @@ func saveNormalizedMessage(msg *NormalizedMessage, isRead bool, isLive bool) (bo
 		`, msg.ID, msg.ChatJID, msg.SenderJID, msg.PushName, msg.Timestamp,
 			content.Text, content.MediaType, boolToInt(msg.IsFromMe), boolToInt(isRead), time.Now().Unix(),
 			mimeType, mediaKey, fileSHA256, fileEncSHA256, fileLength, directPath, mediaURL,
-			replyToID, replyToSender, replyToText)
+			replyToID, replyToSender, replyToText, searchText(content.Text))
+	}
+
+	if err == nil {
+		if err := saveMentions(db, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save mentions: %v\n", err)
+		}
+		if err := saveMessageExpiry(db, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save message expiry: %v\n", err)
+		}
+		if err := saveLinkPreview(db, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save link preview: %v\n", err)
+		}
+		if err := saveThumbnail(db, msg.ID, msg.ChatJID, content.Media); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save thumbnail: %v\n", err)
+		}
+	}
+
+	if poll := pollCreation(msg.Message); poll != nil && err == nil {
+		if err := savePoll(db, msg.ID, msg.ChatJID, poll); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save poll options: %v\n", err)
+		}
 	}
 
 	if err == nil && isLive {
 		// Update chat timestamp (best-effort, don't fail message save)
-		_ = saveChat(msg.ChatJID, "", msg.IsGroup, msg.Timestamp, false)
+		_ = saveChat(db, msg.ChatJID, "", msg.IsGroup, msg.Timestamp, false)
 	}
 
 	return err == nil, err
 }
 
-func saveContact(jid, name, pushName string) error {
-	_, err := messageDB.Exec(`
-		INSERT OR REPLACE INTO contacts (jid, name, push_name, updated_at)
+// saveMentions records the JIDs a message @mentions.
+func saveMentions(db dbWriter, msg *NormalizedMessage) error {
+	for _, jid := range messageContextInfo(msg.Message).GetMentionedJID() {
+		if _, err := db.Exec(`
+			INSERT OR IGNORE INTO mentions (message_id, chat_jid, mentioned_jid) VALUES (?, ?, ?)
+		`, msg.ID, msg.ChatJID, canonicalJID(normalizeJID(jid))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveContact(db dbWriter, jid, name, pushName string) error {
+	_, err := db.Exec(`
+		INSERT INTO contacts (jid, name, push_name, updated_at)
 		VALUES (?, ?, ?, ?)
-	`, jid, name, pushName, time.Now().Unix())
+		ON CONFLICT(jid) DO UPDATE SET
+			name = excluded.name,
+			push_name = excluded.push_name,
+			updated_at = excluded.updated_at
+	`, normalizeJID(jid), name, pushName, time.Now().Unix())
 	return err
 }
 
-func saveChat(jid, name string, isGroup bool, lastMessageTime int64, markedAsUnread bool) error {
+func saveChat(db dbWriter, jid, name string, isGroup bool, lastMessageTime int64, markedAsUnread bool) error {
+	jid = normalizeJID(jid)
+	if !chatSynced(jid) {
+		return nil
+	}
 	// UPSERT: preserve name if we have it, update marked_as_unread only if setting to true
-	// (unread_count is computed from messages table, not stored here)
-	_, err := messageDB.Exec(`
+	// (unread counts live in chat_unread, maintained by triggers on messages)
+	_, err := db.Exec(`
 		INSERT INTO chats (jid, name, is_group, last_message_time, marked_as_unread, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(jid) DO UPDATE SET
@@ -273,13 +343,14 @@ func saveChat(jid, name string, isGroup bool, lastMessageTime int64, markedAsUnr
 	return err
 }
 
-func markMessageRead(msgID string) error {
-	_, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE id = ?`, msgID)
+func markMessageRead(msgID, chatJID string) error {
+	_, err := messageDB.Exec(`UPDATE messages SET is_read = 1 WHERE id = ? AND chat_jid = ?`,
+		msgID, canonicalJID(normalizeJID(chatJID)))
 	return err
 }
 
 // saveReaction saves a reaction to the reactions table using the normalized message info.
-func saveReaction(msg *NormalizedMessage, rm *waE2E.ReactionMessage) error {
+func saveReaction(db dbWriter, msg *NormalizedMessage, rm *waE2E.ReactionMessage) error {
 	emoji := rm.GetText()
 	targetKey := rm.GetKey()
 	if targetKey == nil {
@@ -289,16 +360,16 @@ func saveReaction(msg *NormalizedMessage, rm *waE2E.ReactionMessage) error {
 
 	// Empty emoji means reaction was removed
 	if emoji == "" {
-		_, err := messageDB.Exec(`DELETE FROM reactions WHERE message_id = ? AND sender_jid = ?`,
-			messageID, msg.SenderJID)
+		_, err := db.Exec(`DELETE FROM reactions WHERE message_id = ? AND chat_jid = ? AND sender_jid = ?`,
+			messageID, msg.ChatJID, msg.SenderJID)
 		return err
 	}
 
 	// UPSERT: update emoji if sender already reacted
-	_, err := messageDB.Exec(`
+	_, err := db.Exec(`
 		INSERT INTO reactions (message_id, chat_jid, sender_jid, sender_name, emoji, timestamp)
 		VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(message_id, sender_jid) DO UPDATE SET
+		ON CONFLICT(message_id, chat_jid, sender_jid) DO UPDATE SET
 			emoji = excluded.emoji,
 			timestamp = excluded.timestamp
 	`, messageID, msg.ChatJID, msg.SenderJID, msg.PushName, emoji, msg.Timestamp)
@@ -362,6 +433,7 @@ func extractMessageContentFull(m *waE2E.Message) MessageContent {
 			FileLength:    int64(img.GetFileLength()),
 			DirectPath:    img.GetDirectPath(),
 			URL:           img.GetURL(),
+			Thumbnail:     img.GetJPEGThumbnail(),
 		}
 		extractReply(img.GetContextInfo())
 	case m.GetVideoMessage() != nil:
@@ -377,6 +449,7 @@ func extractMessageContentFull(m *waE2E.Message) MessageContent {
 			FileLength:    int64(vid.GetFileLength()),
 			DirectPath:    vid.GetDirectPath(),
 			URL:           vid.GetURL(),
+			Thumbnail:     vid.GetJPEGThumbnail(),
 		}
 		extractReply(vid.GetContextInfo())
 	case m.GetAudioMessage() != nil:
@@ -462,18 +535,9 @@ func extractMessageContentFull(m *waE2E.Message) MessageContent {
 		content.Text = inv.GetGroupName()
 
 	// Polls
-	case m.GetPollCreationMessage() != nil:
-		content.MediaType = "poll"
-		poll := m.GetPollCreationMessage()
-		content.Text = poll.GetName()
-	case m.GetPollCreationMessageV2() != nil:
+	case pollCreation(m) != nil:
 		content.MediaType = "poll"
-		poll := m.GetPollCreationMessageV2()
-		content.Text = poll.GetName()
-	case m.GetPollCreationMessageV3() != nil:
-		content.MediaType = "poll"
-		poll := m.GetPollCreationMessageV3()
-		content.Text = poll.GetName()
+		content.Text = pollCreation(m).GetName()
 	case m.GetPollUpdateMessage() != nil:
 		content.MediaType = "poll_update"
 
@@ -536,6 +600,7 @@ func extractMessageContentFull(m *waE2E.Message) MessageContent {
 			FileLength:    int64(vid.GetFileLength()),
 			DirectPath:    vid.GetDirectPath(),
 			URL:           vid.GetURL(),
+			Thumbnail:     vid.GetJPEGThumbnail(),
 		}
 		extractReply(vid.GetContextInfo())
 
@@ -556,6 +621,29 @@ func extractMessageContentFull(m *waE2E.Message) MessageContent {
 	return content
 }
 
+// messageContextInfo returns the ContextInfo of whichever message type m
+// holds, looking inside ephemeral and view-once wrappers, or nil if it has none.
+func messageContextInfo(m *waE2E.Message) *waE2E.ContextInfo {
+	var ci *waE2E.ContextInfo
+	m.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return true
+		}
+		inner := v.Message()
+		if f := inner.Descriptor().Fields().ByName("contextInfo"); f != nil && inner.Has(f) {
+			ci, _ = inner.Get(f).Message().Interface().(*waE2E.ContextInfo)
+			return false
+		}
+		// Wrappers are FutureProofMessages holding the real message
+		if wrapped, ok := inner.Interface().(*waE2E.FutureProofMessage); ok {
+			ci = messageContextInfo(wrapped.GetMessage())
+			return ci == nil
+		}
+		return true
+	})
+	return ci
+}
+
 // extractViewOnceContent extracts content from a ViewOnce message wrapper.
 // Prefixes the media type with "viewonce_" to indicate ephemeral content.
 func extractViewOnceContent(inner *waE2E.Message) MessageContent {
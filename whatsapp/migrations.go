@@ -0,0 +1,572 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// migration is one step of the messages.db schema. Each runs in its own
+// transaction together with its schema_version row, so a failed migration
+// leaves the database as it was and is retried on the next run.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change in order. Append new ones with the
+// next version; never edit, renumber, or remove one that has shipped.
+//
+// Databases created before schema_version existed are at version 0 but may
+// already have any of migrations 1-35 applied, so those check before changing
+// anything. Later migrations run exactly once and needn't.
+var migrations = []migration{
+	{1, "create messages, contacts and chats", execMigration(`
+		CREATE TABLE IF NOT EXISTS messages (
+			id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			sender_jid TEXT NOT NULL,
+			sender_name TEXT,
+			timestamp INTEGER NOT NULL,
+			text TEXT,
+			media_type TEXT,
+			is_from_me INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (id, chat_jid)
+		);
+		CREATE INDEX IF NOT EXISTS idx_messages_chat ON messages(chat_jid);
+		CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
+
+		CREATE TABLE IF NOT EXISTS contacts (
+			jid TEXT PRIMARY KEY,
+			name TEXT,
+			push_name TEXT,
+			updated_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS chats (
+			jid TEXT PRIMARY KEY,
+			name TEXT,
+			is_group INTEGER NOT NULL,
+			last_message_time INTEGER,
+			marked_as_unread INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL
+		);
+	`)},
+	{2, "populate chats from messages", func(tx *sql.Tx) error {
+		// Older versions only stored messages; databases with chats already have them
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO chats (jid, name, is_group, last_message_time, updated_at)
+			SELECT chat_jid, '', CASE WHEN chat_jid LIKE '%@g.us' THEN 1 ELSE 0 END, MAX(timestamp), strftime('%s', 'now')
+			FROM messages
+			WHERE NOT EXISTS (SELECT 1 FROM chats)
+			GROUP BY chat_jid
+		`)
+		return err
+	}},
+	{3, "populate contacts from messages", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO contacts (jid, name, push_name, updated_at)
+			SELECT sender_jid, '', sender_name, strftime('%s', 'now')
+			FROM messages
+			WHERE sender_name IS NOT NULL AND sender_name != '' AND NOT EXISTS (SELECT 1 FROM contacts)
+			GROUP BY sender_jid
+		`)
+		return err
+	}},
+	{4, "add messages.is_read", func(tx *sql.Tx) error {
+		if err := addColumns(tx, "messages", "is_read INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(is_read, chat_jid)`)
+		return err
+	}},
+	{5, "add chats.marked_as_unread", addColumnsMigration("chats", "marked_as_unread INTEGER NOT NULL DEFAULT 0")},
+	{6, "add messages.is_starred", addColumnsMigration("messages", "is_starred INTEGER NOT NULL DEFAULT 0")},
+	{7, "add chats.muted_until", addColumnsMigration("chats", "muted_until INTEGER NOT NULL DEFAULT 0")},
+	{8, "add chats.left_at", addColumnsMigration("chats", "left_at INTEGER")},
+	{9, "add chats.disappearing_timer", addColumnsMigration("chats", "disappearing_timer INTEGER NOT NULL DEFAULT 0")},
+	{10, "add messages.search_text", func(tx *sql.Tx) error {
+		// Text folded for accent- and case-insensitive search
+		if hasColumn(tx, "messages", "search_text") {
+			return nil
+		}
+		if err := addColumns(tx, "messages", "search_text TEXT"); err != nil {
+			return err
+		}
+		return backfillSearchText(tx)
+	}},
+	{11, "add contact user-info columns", addColumnsMigration("contacts",
+		"about TEXT",              // About (status) text
+		"devices TEXT",            // Comma-separated device JIDs
+		"verified_name TEXT",      // Verified business name
+		"picture_id TEXT",         // Current profile picture ID
+		"lid TEXT",                // Hidden-number identity
+		"info_updated_at INTEGER", // When user-info last looked the contact up
+	)},
+	{12, "add media metadata columns", addColumnsMigration("messages",
+		"mime_type_full TEXT",  // Full MIME type (e.g., image/jpeg)
+		"media_key BLOB",       // Decryption key
+		"file_sha256 BLOB",     // SHA256 hash of decrypted file
+		"file_enc_sha256 BLOB", // SHA256 hash of encrypted file
+		"file_length INTEGER",  // File size in bytes
+		"direct_path TEXT",     // WhatsApp CDN path
+		"media_url TEXT",       // Full download URL
+		"media_file_path TEXT", // Local file path after download
+	)},
+	{13, "add reply context columns", addColumnsMigration("messages",
+		"reply_to_id TEXT",     // ID of message being replied to
+		"reply_to_sender TEXT", // Sender of the quoted message
+		"reply_to_text TEXT",   // Preview of quoted message text
+	)},
+	{14, "create reactions", execMigration(`
+		CREATE TABLE IF NOT EXISTS reactions (
+			message_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			sender_jid TEXT NOT NULL,
+			sender_name TEXT,
+			emoji TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			PRIMARY KEY (message_id, chat_jid, sender_jid)
+		);
+		CREATE INDEX IF NOT EXISTS idx_reactions_message ON reactions(message_id);
+		CREATE INDEX IF NOT EXISTS idx_reactions_chat ON reactions(chat_jid);
+	`)},
+	{15, "key messages and reactions by chat", func(tx *sql.Tx) error {
+		// Message IDs are only unique within a chat; otherwise a colliding ID
+		// overwrites another chat's message
+		if err := rebuildWithPrimaryKey(tx, "messages", "id", "chat_jid"); err != nil {
+			return fmt.Errorf("messages: %w", err)
+		}
+		if err := rebuildWithPrimaryKey(tx, "reactions", "message_id", "chat_jid", "sender_jid"); err != nil {
+			return fmt.Errorf("reactions: %w", err)
+		}
+		return nil
+	}},
+	// Content hashes, so identical media can be reused across messages
+	{16, "index media hashes", execMigration(`CREATE INDEX IF NOT EXISTS idx_messages_sha256 ON messages(file_sha256)`)},
+	// Replies, so threads can be walked from the root down
+	{17, "index replies", execMigration(`CREATE INDEX IF NOT EXISTS idx_messages_reply ON messages(chat_jid, reply_to_id)`)},
+	// Per-chat local preferences
+	{18, "create chat_settings", execMigration(`
+		CREATE TABLE IF NOT EXISTS chat_settings (
+			chat_jid TEXT PRIMARY KEY,
+			suppress_read_receipts INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL
+		);
+	`)},
+	// CLI bookkeeping (e.g., last-used media directory)
+	{19, "create meta", execMigration(`
+		CREATE TABLE IF NOT EXISTS meta (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+	`)},
+	// Per-chat unread counts kept current by triggers, so listing chats
+	// doesn't have to count over the whole messages table
+	{20, "create chat_unread", execMigration(`
+		CREATE TABLE IF NOT EXISTS chat_unread (
+			chat_jid TEXT PRIMARY KEY,
+			unread INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TRIGGER IF NOT EXISTS trg_messages_unread_insert AFTER INSERT ON messages
+		WHEN NEW.is_read = 0 AND NEW.is_from_me = 0
+		BEGIN
+			INSERT INTO chat_unread (chat_jid, unread) VALUES (NEW.chat_jid, 1)
+			ON CONFLICT(chat_jid) DO UPDATE SET unread = unread + 1;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS trg_messages_unread_delete AFTER DELETE ON messages
+		WHEN OLD.is_read = 0 AND OLD.is_from_me = 0
+		BEGIN
+			UPDATE chat_unread SET unread = unread - 1 WHERE chat_jid = OLD.chat_jid;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS trg_messages_unread_update AFTER UPDATE OF is_read, is_from_me, chat_jid ON messages
+		WHEN (OLD.is_read = 0 AND OLD.is_from_me = 0) != (NEW.is_read = 0 AND NEW.is_from_me = 0)
+			OR OLD.chat_jid != NEW.chat_jid
+		BEGIN
+			UPDATE chat_unread SET unread = unread - 1
+			WHERE chat_jid = OLD.chat_jid AND OLD.is_read = 0 AND OLD.is_from_me = 0;
+			INSERT INTO chat_unread (chat_jid, unread)
+			SELECT NEW.chat_jid, 1 WHERE NEW.is_read = 0 AND NEW.is_from_me = 0
+			ON CONFLICT(chat_jid) DO UPDATE SET unread = unread + 1;
+		END;
+	`)},
+	{21, "seed unread counters", rebuildUnreadCounters},
+	// Every delivery/read receipt, not just the is_read flag
+	{22, "create receipts", execMigration(`
+		CREATE TABLE IF NOT EXISTS receipts (
+			message_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			participant_jid TEXT NOT NULL,
+			type TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			PRIMARY KEY (message_id, chat_jid, participant_jid, type)
+		);
+		CREATE INDEX IF NOT EXISTS idx_receipts_chat ON receipts(chat_jid, timestamp);
+	`)},
+	// What this CLI sent, so undo can find the last one
+	{23, "create sent_messages", execMigration(`
+		CREATE TABLE IF NOT EXISTS sent_messages (
+			id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			command TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			revoked_at INTEGER,
+			PRIMARY KEY (id, chat_jid)
+		);
+		CREATE INDEX IF NOT EXISTS idx_sent_messages_timestamp ON sent_messages(timestamp);
+	`)},
+	// Each participant's latest typing/recording state per chat, recorded by
+	// the daemon
+	{24, "create chat_activity", execMigration(`
+		CREATE TABLE IF NOT EXISTS chat_activity (
+			chat_jid TEXT NOT NULL,
+			sender_jid TEXT NOT NULL,
+			state TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			PRIMARY KEY (chat_jid, sender_jid)
+		);
+	`)},
+	// Each poll's options, and each voter's latest vote as the names of the
+	// options they picked (an empty list once withdrawn)
+	{25, "create polls", execMigration(`
+		CREATE TABLE IF NOT EXISTS polls (
+			message_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			question TEXT NOT NULL,
+			options TEXT NOT NULL,
+			selectable_count INTEGER NOT NULL,
+			PRIMARY KEY (message_id, chat_jid)
+		);
+
+		CREATE TABLE IF NOT EXISTS poll_votes (
+			poll_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			voter_jid TEXT NOT NULL,
+			options TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			PRIMARY KEY (poll_id, chat_jid, voter_jid)
+		);
+	`)},
+	// Who each message @mentions
+	{26, "create mentions", execMigration(`
+		CREATE TABLE IF NOT EXISTS mentions (
+			message_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			mentioned_jid TEXT NOT NULL,
+			PRIMARY KEY (message_id, chat_jid, mentioned_jid)
+		);
+		CREATE INDEX IF NOT EXISTS idx_mentions_mentioned ON mentions(mentioned_jid);
+	`)},
+	// The preview WhatsApp attached to a shared link
+	{27, "create link_previews", execMigration(`
+		CREATE TABLE IF NOT EXISTS link_previews (
+			message_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			url TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (message_id, chat_jid)
+		);
+	`)},
+	// Group metadata and members cached during sync, so participants works
+	// offline
+	{28, "create groups and participants", execMigration(`
+		CREATE TABLE IF NOT EXISTS groups (
+			jid TEXT PRIMARY KEY,
+			name TEXT,
+			topic TEXT,
+			owner_jid TEXT,
+			participant_count INTEGER NOT NULL DEFAULT 0,
+			is_announce INTEGER NOT NULL DEFAULT 0,
+			is_locked INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER,
+			updated_at INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS participants (
+			group_jid TEXT NOT NULL,
+			jid TEXT NOT NULL,
+			phone_jid TEXT,
+			lid TEXT,
+			display_name TEXT,
+			is_admin INTEGER NOT NULL DEFAULT 0,
+			is_super_admin INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (group_jid, jid)
+		);
+		CREATE INDEX IF NOT EXISTS idx_participants_jid ON participants(jid);
+	`)},
+	// Membership and settings changes per group. Columns are '' rather than
+	// NULL when unset so the unique index drops replayed events
+	{29, "create group_events", execMigration(`
+		CREATE TABLE IF NOT EXISTS group_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_jid TEXT NOT NULL,
+			type TEXT NOT NULL,
+			actor_jid TEXT NOT NULL DEFAULT '',
+			target_jid TEXT NOT NULL DEFAULT '',
+			value TEXT NOT NULL DEFAULT '',
+			timestamp INTEGER NOT NULL
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_group_events_unique
+			ON group_events(group_jid, type, actor_jid, target_jid, value, timestamp);
+	`)},
+	// Incoming calls seen while connected. Columns are '' rather than NULL
+	// when unset, like group_events
+	{30, "create calls", execMigration(`
+		CREATE TABLE IF NOT EXISTS calls (
+			call_id TEXT PRIMARY KEY,
+			caller_jid TEXT NOT NULL,
+			group_jid TEXT NOT NULL DEFAULT '',
+			media TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			started_at INTEGER NOT NULL,
+			accepted_at INTEGER,
+			ended_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_calls_caller ON calls(caller_jid, started_at);
+	`)},
+	// Online/offline updates of subscribed contacts
+	{31, "create presence_log", execMigration(`
+		CREATE TABLE IF NOT EXISTS presence_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			jid TEXT NOT NULL,
+			online INTEGER NOT NULL,
+			last_seen INTEGER,
+			timestamp INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_presence_log_jid ON presence_log(jid, timestamp);
+	`)},
+	// Messages queued with send --at for the daemon
+	{32, "create scheduled", execMigration(`
+		CREATE TABLE IF NOT EXISTS scheduled (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_jid TEXT NOT NULL,
+			text TEXT NOT NULL,
+			reply_to TEXT NOT NULL DEFAULT '',
+			mentions TEXT NOT NULL DEFAULT '[]',
+			send_at INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			message_id TEXT,
+			error TEXT,
+			created_at INTEGER NOT NULL,
+			sent_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_scheduled_pending ON scheduled(status, send_at);
+	`)},
+	// Votes used to be saved as opaque poll_update messages
+	{33, "remove poll update messages", execMigration(`DELETE FROM messages WHERE media_type = 'poll_update'`)},
+	// Merged identities and the rows each merge rewrote, so a merge can be
+	// undone exactly
+	{34, "create contact alias tables", execMigration(`
+		CREATE TABLE IF NOT EXISTS contact_aliases (
+			alias_jid TEXT PRIMARY KEY,
+			canonical_jid TEXT NOT NULL,
+			alias_chat_name TEXT,
+			merged_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_contact_aliases_canonical ON contact_aliases(canonical_jid);
+
+		CREATE TABLE IF NOT EXISTS contact_merge_log (
+			alias_jid TEXT NOT NULL,
+			table_name TEXT NOT NULL,
+			column_name TEXT NOT NULL,
+			row_id INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_contact_merge_log_alias ON contact_merge_log(alias_jid);
+	`)},
+	// Legacy JIDs with device suffixes or mixed-case servers
+	{35, "normalize stored JIDs", normalizeStoredJIDs},
+	// Downloaded files and how many messages use each, kept current by
+	// triggers. Identical content is shared, so a file is only deleted once
+	// nothing refers to it; sha256 groups the names one blob is saved under.
+	{36, "create media_files", execMigration(`
+		CREATE TABLE IF NOT EXISTS media_files (
+			path TEXT PRIMARY KEY,
+			sha256 BLOB,
+			size INTEGER,
+			ref_count INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_media_files_sha256 ON media_files(sha256);
+
+		CREATE TRIGGER IF NOT EXISTS trg_messages_media_insert AFTER INSERT ON messages
+		WHEN NEW.media_file_path IS NOT NULL AND NEW.media_file_path != ''
+		BEGIN
+			INSERT INTO media_files (path, sha256, size, ref_count)
+			VALUES (NEW.media_file_path, NEW.file_sha256, NEW.file_length, 1)
+			ON CONFLICT(path) DO UPDATE SET ref_count = ref_count + 1,
+				sha256 = COALESCE(sha256, excluded.sha256), size = COALESCE(size, excluded.size);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS trg_messages_media_delete AFTER DELETE ON messages
+		WHEN OLD.media_file_path IS NOT NULL AND OLD.media_file_path != ''
+		BEGIN
+			UPDATE media_files SET ref_count = ref_count - 1 WHERE path = OLD.media_file_path;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS trg_messages_media_update AFTER UPDATE OF media_file_path ON messages
+		WHEN OLD.media_file_path IS NOT NEW.media_file_path
+		BEGIN
+			UPDATE media_files SET ref_count = ref_count - 1
+			WHERE path = OLD.media_file_path AND OLD.media_file_path != '';
+			INSERT INTO media_files (path, sha256, size, ref_count)
+			SELECT NEW.media_file_path, NEW.file_sha256, NEW.file_length, 1
+			WHERE NEW.media_file_path IS NOT NULL AND NEW.media_file_path != ''
+			ON CONFLICT(path) DO UPDATE SET ref_count = ref_count + 1,
+				sha256 = COALESCE(sha256, excluded.sha256), size = COALESCE(size, excluded.size);
+		END;
+	`)},
+	{37, "seed media file references", rebuildMediaRefs},
+	{38, "add thumbnail column", addColumnsMigration("messages",
+		"thumbnail_path TEXT", // Local preview image, from the message or made on download
+	)},
+	// When a message sent with a disappearing timer expires. A chat's current
+	// timer says nothing about messages sent before it was turned on
+	{39, "add message expiry", func(tx *sql.Tx) error {
+		if err := addColumns(tx, "messages", "expires_at INTEGER"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at) WHERE expires_at IS NOT NULL`)
+		return err
+	}},
+	// A message's mentions, link preview and poll go with it, however it's
+	// deleted. Clears what earlier deletes left behind, except polls: one
+	// sent from the CLI is saved before its message arrives
+	{40, "delete message details with messages", execMigration(`
+		DELETE FROM mentions WHERE NOT EXISTS (SELECT 1 FROM messages m
+			WHERE m.id = mentions.message_id AND m.chat_jid = mentions.chat_jid);
+		DELETE FROM link_previews WHERE NOT EXISTS (SELECT 1 FROM messages m
+			WHERE m.id = link_previews.message_id AND m.chat_jid = link_previews.chat_jid);
+		DELETE FROM poll_votes WHERE NOT EXISTS (SELECT 1 FROM polls p
+			WHERE p.message_id = poll_votes.poll_id AND p.chat_jid = poll_votes.chat_jid);
+
+		CREATE TRIGGER IF NOT EXISTS trg_messages_details_delete AFTER DELETE ON messages
+		BEGIN
+			DELETE FROM mentions WHERE message_id = OLD.id AND chat_jid = OLD.chat_jid;
+			DELETE FROM link_previews WHERE message_id = OLD.id AND chat_jid = OLD.chat_jid;
+			DELETE FROM polls WHERE message_id = OLD.id AND chat_jid = OLD.chat_jid;
+			DELETE FROM poll_votes WHERE poll_id = OLD.id AND chat_jid = OLD.chat_jid;
+		END;
+	`)},
+}
+
+// migrateMessageDB applies the migrations messages.db hasn't had yet, in
+// order, backing it up first if it holds data.
+func migrateMessageDB() error {
+	if _, err := messageDB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at INTEGER NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	current, err := schemaVersion(messageDB.QueryRow)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("messages.db is at schema version %d, newer than this version of the CLI supports (%d); upgrade it", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+	if err := backupBeforeMigration(); err != nil {
+		return err
+	}
+
+	// Migrations go through their own handle whose transactions take the
+	// write lock at BEGIN. A deferred one starts by reading the version, and
+	// if another process migrates meanwhile it can't upgrade to a write lock
+	// and fails with SQLITE_BUSY instead of waiting out the busy timeout.
+	migrationDB, err := sql.Open("sqlite", messageDBDSN(filepath.Join(dataDir, "messages.db"), false)+"&_txlock=immediate")
+	if err != nil {
+		return fmt.Errorf("failed to open message database: %w", err)
+	}
+	defer func() { _ = migrationDB.Close() }()
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(migrationDB, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs one migration and records it in a single transaction.
+// Another process may have applied it meanwhile, so the version is checked
+// again inside the transaction.
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	current, err := schemaVersion(tx.QueryRow)
+	if err != nil {
+		return err
+	}
+	if m.version <= current {
+		return nil
+	}
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion returns the newest migration applied, 0 for none.
+func schemaVersion(queryRow func(string, ...any) *sql.Row) (int, error) {
+	var version int
+	if err := queryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// execMigration is a migration that runs fixed SQL.
+func execMigration(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// addColumnsMigration is a migration that adds columns to table.
+func addColumnsMigration(table string, defs ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return addColumns(tx, table, defs...)
+	}
+}
+
+// addColumns adds each column (a name followed by its type and constraints)
+// that table doesn't have yet.
+// SAFETY: table and defs must be trusted literals, not user input.
+func addColumns(tx *sql.Tx, table string, defs ...string) error {
+	for _, def := range defs {
+		name := strings.Fields(def)[0]
+		if hasColumn(tx, table, name) {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + def); err != nil {
+			return fmt.Errorf("failed to add %s column: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Fatalf("migration %d (%s) has version %d", i+1, m.name, m.version)
+		}
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	openTestDB(t)
+
+	version, err := schemaVersion(messageDB.QueryRow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latestSchemaVersion() {
+		t.Fatalf("schema version = %d, want %d", version, latestSchemaVersion())
+	}
+
+	// Running again applies nothing
+	if err := migrateMessageDB(); err != nil {
+		t.Fatalf("second migrateMessageDB: %v", err)
+	}
+	var applied int
+	if err := messageDB.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(migrations) {
+		t.Fatalf("schema_version has %d rows, want %d", applied, len(migrations))
+	}
+}
+
+// A database from before schema_version existed, as the Python test fixture
+// builds it, is migrated in place and keeps its rows.
+func TestMigrateLegacyDatabase(t *testing.T) {
+	useTestDirs(t)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := sql.Open("sqlite", filepath.Join(dataDir, "messages.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Exec(`
+		CREATE TABLE messages (
+			id TEXT PRIMARY KEY, chat_jid TEXT NOT NULL, sender_jid TEXT NOT NULL, sender_name TEXT,
+			timestamp INTEGER NOT NULL, text TEXT, media_type TEXT, is_from_me INTEGER NOT NULL,
+			is_read INTEGER NOT NULL DEFAULT 0, created_at INTEGER NOT NULL
+		);
+		CREATE TABLE contacts (jid TEXT PRIMARY KEY, name TEXT, push_name TEXT, updated_at INTEGER NOT NULL);
+		CREATE TABLE chats (
+			jid TEXT PRIMARY KEY, name TEXT, is_group INTEGER NOT NULL, last_message_time INTEGER,
+			marked_as_unread INTEGER NOT NULL DEFAULT 0, updated_at INTEGER NOT NULL
+		);
+		INSERT INTO chats VALUES ('12025551234@s.whatsapp.net', 'Alice', 0, 1700000000, 0, 0);
+		INSERT INTO messages VALUES ('M1', '12025551234@s.whatsapp.net', '12025551234@s.whatsapp.net', 'Alice', 1700000000, 'Café?', NULL, 0, 0, 0);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	_ = legacy.Close()
+
+	if err := initMessageDB(); err != nil {
+		t.Fatalf("initMessageDB: %v", err)
+	}
+	version, err := schemaVersion(messageDB.QueryRow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latestSchemaVersion() {
+		t.Fatalf("schema version = %d, want %d", version, latestSchemaVersion())
+	}
+
+	var searchable string
+	var unread int
+	if err := messageDB.QueryRow(`SELECT search_text FROM messages WHERE id = 'M1'`).Scan(&searchable); err != nil {
+		t.Fatal(err)
+	}
+	if searchable != "cafe?" {
+		t.Errorf("search_text = %q, want %q", searchable, "cafe?")
+	}
+	if err := messageDB.QueryRow(`SELECT unread FROM chat_unread WHERE chat_jid = '12025551234@s.whatsapp.net'`).Scan(&unread); err != nil {
+		t.Fatal(err)
+	}
+	if unread != 1 {
+		t.Errorf("chat_unread = %d, want 1", unread)
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	openTestDB(t)
+	if _, err := messageDB.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'from the future', 0)`,
+		latestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateMessageDB(); err == nil {
+		t.Fatal("migrateMessageDB accepted a newer schema")
+	}
+}
+
+// Deleting a message, by any path, takes its mentions, link preview and poll
+// with it.
+func TestDeletingMessageDeletesDetails(t *testing.T) {
+	openTestDB(t)
+	const chat = "120363277025153496@g.us"
+	insertTestMessage(t, "P1", chat, 1700000000, "")
+	insertTestMessage(t, "P2", chat, 1700000001, "")
+	for _, stmt := range []string{
+		`INSERT INTO mentions (message_id, chat_jid, mentioned_jid) VALUES ('P1', '` + chat + `', 'x@s.whatsapp.net')`,
+		`INSERT INTO link_previews (message_id, chat_jid, url) VALUES ('P1', '` + chat + `', 'https://example.com')`,
+		`INSERT INTO polls (message_id, chat_jid, question, options, selectable_count) VALUES ('P1', '` + chat + `', 'Q?', '["a","b"]', 1)`,
+		`INSERT INTO poll_votes (poll_id, chat_jid, voter_jid, options, timestamp) VALUES ('P1', '` + chat + `', 'x@s.whatsapp.net', '["a"]', 0)`,
+		`INSERT INTO mentions (message_id, chat_jid, mentioned_jid) VALUES ('P2', '` + chat + `', 'x@s.whatsapp.net')`,
+	} {
+		if _, err := messageDB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := messageDB.Exec(`DELETE FROM messages WHERE id = 'P1'`); err != nil {
+		t.Fatal(err)
+	}
+	for table, want := range map[string]int{"mentions": 1, "link_previews": 0, "polls": 0, "poll_votes": 0} {
+		var n int
+		if err := messageDB.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("%s has %d rows, want %d", table, n, want)
+		}
+	}
+}
+
+// media_files counts the messages using each file through inserts, path
+// changes and deletes, and releaseMedia deletes a file only once none do.
+func TestMediaFilesCountReferences(t *testing.T) {
+	openTestDB(t)
+	const chat = "12025551234@s.whatsapp.net"
+	dir := t.TempDir()
+	shared, other := filepath.Join(dir, "shared.jpg"), filepath.Join(dir, "other.jpg")
+	for _, path := range []string{shared, other} {
+		if err := os.WriteFile(path, make([]byte, 10), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"M1", "M2", "M3"} {
+		insertTestMessage(t, id, chat, 1700000000, "")
+	}
+	setPath := func(id, path string) {
+		t.Helper()
+		if _, err := messageDB.Exec(`UPDATE messages SET media_file_path = NULLIF(?, '') WHERE id = ?`, path, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refs := func(path string) int {
+		t.Helper()
+		var n int
+		if err := messageDB.QueryRow(`SELECT COALESCE((SELECT ref_count FROM media_files WHERE path = ?), 0)`, path).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	setPath("M1", shared)
+	setPath("M2", shared)
+	setPath("M3", other)
+	if refs(shared) != 2 || refs(other) != 1 {
+		t.Fatalf("ref counts = %d, %d, want 2, 1", refs(shared), refs(other))
+	}
+
+	// Moving M3 onto the shared file, then deleting M1, leaves other unused
+	setPath("M3", shared)
+	if _, err := messageDB.Exec(`DELETE FROM messages WHERE id = 'M1'`); err != nil {
+		t.Fatal(err)
+	}
+	if refs(shared) != 2 || refs(other) != 0 {
+		t.Fatalf("ref counts = %d, %d, want 2, 0", refs(shared), refs(other))
+	}
+
+	var report PruneReport
+	if err := releaseMedia(&report); err != nil {
+		t.Fatalf("releaseMedia: %v", err)
+	}
+	if report.MediaFilesDeleted != 1 {
+		t.Errorf("MediaFilesDeleted = %d, want 1", report.MediaFilesDeleted)
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Errorf("unused file still there: %v", err)
+	}
+	if _, err := os.Stat(shared); err != nil {
+		t.Errorf("shared file removed: %v", err)
+	}
+}
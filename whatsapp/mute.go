@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waSyncAction"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// mutedForever is chats.muted_until for a chat muted with no end.
+const mutedForever = -1
+
+// mutedSQL is true for chats (aliased c) that are muted now.
+const mutedSQL = `(c.muted_until = -1 OR c.muted_until > strftime('%s', 'now'))`
+
+// cmdMute mutes a chat on every device by pushing a mute to app state.
+// Usage: mute <chat> [--duration=8h|1w|forever]
+func cmdMute(args []string) error {
+	usage := fmt.Errorf("usage: mute <chat> [--duration=8h|1w|forever]")
+	var chatArg, durationArg string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--duration" && i+1 < len(args):
+			durationArg = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--duration="):
+			durationArg = strings.TrimPrefix(args[i], "--duration=")
+		case chatArg == "":
+			chatArg = args[i]
+		default:
+			return usage
+		}
+	}
+	if chatArg == "" {
+		return usage
+	}
+
+	var duration time.Duration
+	if durationArg != "" && durationArg != "forever" {
+		d, err := parseAge(durationArg)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("--duration must be positive")
+		}
+		duration = d
+	}
+	return setMuted(chatArg, true, duration)
+}
+
+// cmdUnmute unmutes a chat on every device.
+// Usage: unmute <chat>
+func cmdUnmute(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: unmute <chat>")
+	}
+	return setMuted(args[0], false, 0)
+}
+
+// setMuted pushes a mute or unmute for a chat (a zero duration mutes forever)
+// and stores the result locally.
+func setMuted(chatArg string, mute bool, duration time.Duration) error {
+	jid, err := parseJID(chatArg)
+	if err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SendAppState(ctx, appstate.BuildMute(jid, mute, duration)); err != nil {
+		return fmt.Errorf("failed to update mute: %w", err)
+	}
+
+	var until int64
+	if mute {
+		until = mutedForever
+		if duration > 0 {
+			until = time.Now().Add(duration).Unix()
+		}
+	}
+	if err := saveMute(messageDB, jid.String(), until); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save mute: %v\n", err)
+	}
+
+	output := map[string]any{
+		"success": true,
+		"chat":    jid.String(),
+		"muted":   mute,
+	}
+	if until > 0 {
+		output["muted_until"] = until
+	}
+	return printJSON(output)
+}
+
+// saveMute stores when a chat's mute ends: a Unix time, mutedForever, or 0
+// for not muted.
+func saveMute(db dbWriter, chatJID string, until int64) error {
+	chatJID = canonicalJID(normalizeJID(chatJID))
+	if !chatSynced(chatJID) {
+		return nil
+	}
+	_, err := db.Exec(`
+		INSERT INTO chats (jid, name, is_group, muted_until, updated_at)
+		VALUES (?, '', ?, ?, ?)
+		ON CONFLICT(jid) DO UPDATE SET muted_until = excluded.muted_until, updated_at = excluded.updated_at
+	`, chatJID, boolToInt(strings.HasSuffix(chatJID, "@g.us")), until, time.Now().Unix())
+	return err
+}
+
+// saveMuteEvent stores a mute change made on another device.
+func saveMuteEvent(evt *events.Mute) error {
+	return saveMute(messageDB, evt.JID.String(), muteActionUntil(evt.Action))
+}
+
+// muteActionUntil converts an app state mute to a muted_until value. Its end
+// timestamp is in milliseconds, with -1 meaning forever.
+func muteActionUntil(action *waSyncAction.MuteAction) int64 {
+	if !action.GetMuted() {
+		return 0
+	}
+	end := action.GetMuteEndTimestamp()
+	if end <= 0 {
+		return mutedForever
+	}
+	return end / 1000
+}
+
+// historyMuteUntil converts a history sync conversation's mute end time to a
+// muted_until value. WhatsApp sends it in seconds or milliseconds depending on
+// the client, and as an all-ones value for forever.
+func historyMuteUntil(end uint64) int64 {
+	switch {
+	case end == 0:
+		return 0
+	case end > math.MaxInt64:
+		return mutedForever
+	case end > 1e12:
+		return int64(end / 1000)
+	default:
+		return int64(end)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+)
+
+// senderNameExpr is the freshest known name for messages.sender_jid: the saved
+// contact name, then the contact's current push name.
+const senderNameExpr = `(
+	SELECT COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''))
+	FROM contacts ct WHERE ct.jid = messages.sender_jid
+)`
+
+// cmdNames handles name maintenance subcommands.
+// Usage: names backfill [--dry-run]
+func cmdNames(args []string) error {
+	if len(args) < 1 || args[0] != "backfill" {
+		return fmt.Errorf("usage: names backfill [--dry-run]")
+	}
+	dryRun := false
+	for _, arg := range args[1:] {
+		if arg == "--dry-run" {
+			dryRun = true
+		} else {
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+	return namesBackfill(dryRun)
+}
+
+// namesBackfill rewrites messages.sender_name from current contact data. Each
+// message stores the push name the sender had at the time, so old rows go stale
+// and leak outdated names into the chat-name fallback in chats.
+func namesBackfill(dryRun bool) error {
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	// Messages from others whose stored name differs from the contact's
+	staleWhere := `is_from_me = 0 AND ` + senderNameExpr + ` IS NOT NULL
+		AND COALESCE(sender_name, '') != ` + senderNameExpr
+	// Blank names in DMs with no contact row: fall back to the chat's name
+	blankWhere := `is_from_me = 0 AND COALESCE(sender_name, '') = '' AND sender_jid = chat_jid
+		AND ` + senderNameExpr + ` IS NULL
+		AND EXISTS (SELECT 1 FROM chats c WHERE c.jid = messages.chat_jid AND c.name IS NOT NULL AND c.name != '')`
+
+	var updated, filled int64
+	if err := messageDB.QueryRow(`SELECT COUNT(*) FROM messages WHERE ` + staleWhere).Scan(&updated); err != nil {
+		return fmt.Errorf("failed to count stale names: %w", err)
+	}
+	if err := messageDB.QueryRow(`SELECT COUNT(*) FROM messages WHERE ` + blankWhere).Scan(&filled); err != nil {
+		return fmt.Errorf("failed to count blank names: %w", err)
+	}
+
+	if !dryRun {
+		if _, err := messageDB.Exec(`UPDATE messages SET sender_name = ` + senderNameExpr + ` WHERE ` + staleWhere); err != nil {
+			return fmt.Errorf("failed to update sender names: %w", err)
+		}
+		if _, err := messageDB.Exec(`
+			UPDATE messages SET sender_name = (SELECT c.name FROM chats c WHERE c.jid = messages.chat_jid)
+			WHERE ` + blankWhere); err != nil {
+			return fmt.Errorf("failed to fill sender names: %w", err)
+		}
+	}
+
+	output := map[string]any{
+		"success": true,
+		"dry_run": dryRun,
+		"updated": updated,
+		"filled":  filled,
+	}
+	return printJSON(output)
+}
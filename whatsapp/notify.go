@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Notification actions, as stored in rules.json.
+const (
+	actionNotify    = "notify"     // Log and fire notifiers (hooks, webhooks, desktop)
+	actionSilentLog = "silent-log" // Log only
+	actionDrop      = "drop"       // Neither; the message is still saved
+)
+
+// NotifyRule matches incoming messages by chat and/or sender. Entries use the
+// same form as ignore_chats: a JID, or a bare number for a DM or sender.
+type NotifyRule struct {
+	Chat   string `json:"chat,omitempty"`
+	Sender string `json:"sender,omitempty"`
+	Action string `json:"action"`
+}
+
+// WatchRule asks the daemon to alert when a contact comes online, and with
+// LastSeen also whenever their last-seen time changes.
+type WatchRule struct {
+	Contact  string `json:"contact"`
+	LastSeen bool   `json:"last_seen,omitempty"`
+}
+
+// NotifyRules is the contents of rules.json. The first matching rule wins;
+// messages matching none get Default. These are local to the daemon and
+// independent of WhatsApp's own mute state.
+type NotifyRules struct {
+	Default string       `json:"default,omitempty"`
+	Rules   []NotifyRule `json:"rules"`
+	Watch   []WatchRule  `json:"watch,omitempty"`
+	Alerts  []AlertRule  `json:"alerts,omitempty"`
+}
+
+// Notification events.
+const (
+	eventMessage  = "message"
+	eventOnline   = "online"
+	eventLastSeen = "last_seen"
+	eventAlert    = "alert"
+)
+
+// Notification is what notifiers receive: a message the rules let through, a
+// message matching an alert, or a presence change of a watched contact.
+type Notification struct {
+	Event      string `json:"event"`
+	MessageID  string `json:"message_id,omitempty"`
+	ChatJID    string `json:"chat_jid,omitempty"`
+	ChatName   string `json:"chat_name,omitempty"`
+	SenderJID  string `json:"sender_jid"`
+	SenderName string `json:"sender_name,omitempty"`
+	Text       string `json:"text,omitempty"`
+	MediaType  string `json:"media_type,omitempty"`
+	LastSeen   int64  `json:"last_seen,omitempty"`
+	Alert      string `json:"alert,omitempty"` // The matched alert pattern
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// notifiers are called for every message whose rule action is notify.
+// Notification channels register themselves here.
+var notifiers []func(Notification)
+
+func rulesPath() string {
+	return filepath.Join(configDir, "rules.json")
+}
+
+func validAction(action string) bool {
+	return action == actionNotify || action == actionSilentLog || action == actionDrop
+}
+
+// loadRules reads rules.json. A missing file means notify for everything.
+func loadRules() (NotifyRules, error) {
+	rules := NotifyRules{Rules: []NotifyRule{}}
+	data, err := os.ReadFile(rulesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return rules, fmt.Errorf("failed to read rules: %w", err)
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("failed to parse %s: %w", rulesPath(), err)
+	}
+	if rules.Default != "" && !validAction(rules.Default) {
+		return rules, fmt.Errorf("invalid default action %q in %s", rules.Default, rulesPath())
+	}
+	for i, r := range rules.Rules {
+		if !validAction(r.Action) {
+			return rules, fmt.Errorf("rule %d: invalid action %q", i+1, r.Action)
+		}
+		if r.Chat == "" && r.Sender == "" {
+			return rules, fmt.Errorf("rule %d: needs a chat or sender", i+1)
+		}
+	}
+	for i, a := range rules.Alerts {
+		if _, err := regexp.Compile(a.Pattern); err != nil || a.Pattern == "" {
+			return rules, fmt.Errorf("alert %d: invalid pattern %q", i+1, a.Pattern)
+		}
+	}
+	for i, w := range rules.Watch {
+		if _, err := parseJID(w.Contact); err != nil || w.Contact == "" {
+			return rules, fmt.Errorf("watch %d: invalid contact %q", i+1, w.Contact)
+		}
+	}
+	return rules, nil
+}
+
+func saveRules(rules NotifyRules) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rules: %w", err)
+	}
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(rulesPath(), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write rules: %w", err)
+	}
+	return nil
+}
+
+// evaluate returns the action for a message in chatJID from senderJID.
+func (r NotifyRules) evaluate(chatJID, senderJID string) string {
+	for _, rule := range r.Rules {
+		if rule.Chat != "" && !chatListed([]string{rule.Chat}, chatJID) {
+			continue
+		}
+		if rule.Sender != "" && !chatListed([]string{rule.Sender}, senderJID) {
+			continue
+		}
+		return rule.Action
+	}
+	if r.Default != "" {
+		return r.Default
+	}
+	return actionNotify
+}
+
+// cmdRules lists or edits notification rules and watched contacts.
+// Usage: rules [list | add [--chat=JID] [--sender=JID] --action=ACTION | remove <n> | default <action>
+//
+//	| watch <jid> [--last-seen] | unwatch <jid>]
+func cmdRules(args []string) error {
+	rules, err := loadRules()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		return printJSON(rules)
+	}
+
+	switch args[0] {
+	case "add":
+		var rule NotifyRule
+		for _, arg := range args[1:] {
+			switch {
+			case strings.HasPrefix(arg, "--chat="):
+				rule.Chat = strings.TrimPrefix(arg, "--chat=")
+			case strings.HasPrefix(arg, "--sender="):
+				rule.Sender = strings.TrimPrefix(arg, "--sender=")
+			case strings.HasPrefix(arg, "--action="):
+				rule.Action = strings.TrimPrefix(arg, "--action=")
+			default:
+				return fmt.Errorf("unknown option: %s", arg)
+			}
+		}
+		if rule.Chat == "" && rule.Sender == "" {
+			return fmt.Errorf("usage: rules add [--chat=JID] [--sender=JID] --action=notify|silent-log|drop")
+		}
+		if !validAction(rule.Action) {
+			return fmt.Errorf("--action must be notify, silent-log, or drop")
+		}
+		rules.Rules = append(rules.Rules, rule)
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: rules remove <n> (1-based, as listed)")
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > len(rules.Rules) {
+			return fmt.Errorf("no rule %s (have %d)", args[1], len(rules.Rules))
+		}
+		rules.Rules = append(rules.Rules[:n-1], rules.Rules[n:]...)
+	case "default":
+		if len(args) != 2 || !validAction(args[1]) {
+			return fmt.Errorf("usage: rules default notify|silent-log|drop")
+		}
+		rules.Default = args[1]
+	case "watch":
+		if len(args) < 2 || len(args) > 3 || (len(args) == 3 && args[2] != "--last-seen") {
+			return fmt.Errorf("usage: rules watch <jid> [--last-seen]")
+		}
+		jid, err := parseJID(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid contact %q: %w", args[1], err)
+		}
+		watch := WatchRule{Contact: jid.String(), LastSeen: len(args) == 3}
+		rules.Watch = slices.DeleteFunc(rules.Watch, func(w WatchRule) bool { return w.Contact == watch.Contact })
+		rules.Watch = append(rules.Watch, watch)
+	case "unwatch":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: rules unwatch <jid>")
+		}
+		jid, err := parseJID(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid contact %q: %w", args[1], err)
+		}
+		n := len(rules.Watch)
+		rules.Watch = slices.DeleteFunc(rules.Watch, func(w WatchRule) bool { return w.Contact == jid.String() })
+		if len(rules.Watch) == n {
+			return fmt.Errorf("not watching %s", jid)
+		}
+	default:
+		return fmt.Errorf("unknown rules subcommand: %s", args[0])
+	}
+
+	if err := saveRules(rules); err != nil {
+		return err
+	}
+	return printJSON(rules)
+}
+
+// notificationHandler evaluates the rules for each incoming message and logs
+// or dispatches it to the notifiers. A message matching an alert fires as the
+// alert instead, whatever its rule. Installed by the daemon after the handler
+// that saves messages.
+func notificationHandler(rules NotifyRules) func(evt interface{}) {
+	alerts := compileAlerts(rules.Alerts)
+	return func(evt interface{}) {
+		v, ok := evt.(*events.Message)
+		if !ok {
+			return
+		}
+		n, ok := messageNotification(v)
+		if !ok {
+			return
+		}
+
+		if matched := matchAlerts(alerts, n); len(matched) > 0 {
+			for _, a := range matched {
+				fireAlert(a, n)
+			}
+			return
+		}
+
+		action := rules.evaluate(n.ChatJID, n.SenderJID)
+		if action == actionDrop {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", action, notificationSummary(n))
+		if action == actionNotify {
+			fireNotifiers(n)
+		}
+	}
+}
+
+// messageNotification describes an incoming message with visible content.
+// It returns false for our own messages, reactions, protocol messages, and
+// chats that sync doesn't save.
+func messageNotification(v *events.Message) (Notification, bool) {
+	if v.Info.IsFromMe || v.Message == nil || v.Message.GetReactionMessage() != nil {
+		return Notification{}, false
+	}
+	content := extractMessageContentFull(v.Message)
+	switch content.MediaType {
+	case "key_distribution", "context_info", "protocol":
+		return Notification{}, false
+	}
+	if content.MediaType == "" && content.Text == "" {
+		return Notification{}, false
+	}
+
+	chatJID := canonicalJID(normalizeJID(v.Info.Chat.String()))
+	if !chatSynced(chatJID) {
+		return Notification{}, false
+	}
+	senderJID := canonicalJID(normalizeJID(v.Info.Sender.String()))
+
+	return Notification{
+		Event:      eventMessage,
+		MessageID:  v.Info.ID,
+		ChatJID:    chatJID,
+		ChatName:   chatDisplayName(chatJID),
+		SenderJID:  senderJID,
+		SenderName: v.Info.PushName,
+		Text:       content.Text,
+		MediaType:  content.MediaType,
+		Timestamp:  v.Info.Timestamp.Unix(),
+	}, true
+}
+
+func fireNotifiers(n Notification) {
+	for _, notify := range notifiers {
+		notify(n)
+	}
+}
+
+// presenceWatchHandler subscribes to the presence of watched contacts on every
+// connect (subscriptions don't survive reconnects) and alerts when one comes
+// online or, for LastSeen watches, when their last-seen time changes.
+func presenceWatchHandler(ctx context.Context, rules NotifyRules) func(evt interface{}) {
+	watches := map[string]WatchRule{}
+	for _, w := range rules.Watch {
+		watches[w.Contact] = w
+	}
+	var mu sync.Mutex
+	online := map[string]bool{}
+	lastSeen := map[string]int64{}
+
+	return func(evt interface{}) {
+		switch v := evt.(type) {
+		case *events.Connected:
+			if len(watches) == 0 {
+				return
+			}
+			if !cfg.AnnouncePresence {
+				fmt.Fprintf(os.Stderr, "Warning: WhatsApp only sends presence to online clients; set announce_presence for contact alerts\n")
+			}
+			go func() {
+				for contact := range watches {
+					jid, _ := parseJID(contact)
+					if err := client.SubscribePresence(ctx, jid); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: failed to subscribe to presence of %s: %v\n", contact, err)
+					}
+				}
+			}()
+		case *events.Presence:
+			contact := v.From.ToNonAD().String()
+			w, ok := watches[contact]
+			if !ok {
+				return
+			}
+			var seen int64
+			if !v.LastSeen.IsZero() {
+				seen = v.LastSeen.Unix()
+			}
+
+			mu.Lock()
+			cameOnline := !v.Unavailable && !online[contact]
+			seenChanged := seen != 0 && seen != lastSeen[contact]
+			online[contact] = !v.Unavailable
+			if seen != 0 {
+				lastSeen[contact] = seen
+			}
+			mu.Unlock()
+
+			event := ""
+			switch {
+			case cameOnline:
+				event = eventOnline
+			case w.LastSeen && seenChanged:
+				event = eventLastSeen
+			default:
+				return
+			}
+			n := Notification{
+				Event:     event,
+				SenderJID: contact,
+				LastSeen:  seen,
+				Timestamp: time.Now().Unix(),
+			}
+			if name := chatDisplayName(contact); name != "" {
+				n.SenderName = name
+			}
+			fmt.Fprintf(os.Stderr, "[%s] %s\n", event, notificationSummary(n))
+			fireNotifiers(n)
+		}
+	}
+}
+
+// notificationSummary is a one-line description like "Family: Alice: hi" or
+// "Alice is online".
+func notificationSummary(n Notification) string {
+	sender := n.SenderName
+	if sender == "" {
+		sender = strings.Split(n.SenderJID, "@")[0]
+	}
+	switch n.Event {
+	case eventOnline:
+		return sender + " is online"
+	case eventLastSeen:
+		return sender + " was last seen at " + time.Unix(n.LastSeen, 0).Format("2006-01-02 15:04")
+	}
+	body := n.Text
+	if body == "" {
+		body = "[" + n.MediaType + "]"
+	}
+	if n.ChatName != "" && n.ChatJID != n.SenderJID {
+		return n.ChatName + ": " + sender + ": " + body
+	}
+	return sender + ": " + body
+}
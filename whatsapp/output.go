@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// commandsWithOwnOutput take --output as their own option (a destination for
+// files), so the global --output flag isn't extracted for them.
+var commandsWithOwnOutput = map[string]bool{
+	"download":     true,
+	"export":       true,
+	"export-media": true,
+}
+
+// extractOutputFlag removes a global --output <file> (or --output=<file>) from args.
+func extractOutputFlag(args []string) ([]string, string, error) {
+	var rest []string
+	var path string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--output="):
+			path = strings.TrimPrefix(args[i], "--output=")
+		case args[i] == "--output":
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("--output requires a file path")
+			}
+			path = args[i+1]
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, path, nil
+}
+
+// writeOutputFile renders v in the format implied by the file extension (.csv,
+// .md, otherwise JSON) and replaces the file atomically.
+func writeOutputFile(path string, v any) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		data, err = renderCSV(v)
+	case ".md", ".markdown":
+		data, err = renderMarkdown(v)
+	default:
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	return nil
+}
+
+// printText writes plain-text output to stdout, or to the --output file as is.
+func printText(text string) error {
+	if outputFile != "" {
+		if err := writeFileAtomic(outputFile, []byte(text)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", outputFile)
+		return nil
+	}
+	_, err := fmt.Print(text)
+	return err
+}
+
+// writeFileAtomic replaces path with data via a temp file and rename, so
+// readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // No-op after a successful rename
+	_ = tmp.Chmod(0644)                          // CreateTemp uses 0600
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// tabulate flattens command output into rows for CSV and Markdown. Lists of
+// objects become one row each; an object wrapping a single such list (like
+// {"messages": [...], "_status": {...}}) uses that list; any other object is one row.
+// Nested values are JSON-encoded into their cell.
+func tabulate(v any) ([]string, [][]string, error) {
+	// Round-trip through JSON so structs and maps look the same
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, nil, err
+	}
+
+	var records []map[string]any
+	switch g := generic.(type) {
+	case []any:
+		records = objectList(g)
+	case map[string]any:
+		var lists [][]map[string]any
+		for _, value := range g {
+			if list, ok := value.([]any); ok {
+				if objs := objectList(list); objs != nil {
+					lists = append(lists, objs)
+				}
+			}
+		}
+		if len(lists) == 1 {
+			records = lists[0]
+		} else {
+			records = []map[string]any{g}
+		}
+	default:
+		records = []map[string]any{{"value": g}}
+	}
+
+	keySet := map[string]bool{}
+	for _, r := range records {
+		for k := range r {
+			keySet[k] = true
+		}
+	}
+	headers := make([]string, 0, len(keySet))
+	for k := range keySet {
+		headers = append(headers, k)
+	}
+	sort.Strings(headers)
+
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		row := make([]string, len(headers))
+		for i, h := range headers {
+			row[i] = cellString(r[h])
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows, nil
+}
+
+// objectList returns list as objects, or nil if any element isn't an object.
+func objectList(list []any) []map[string]any {
+	objs := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil
+		}
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+func cellString(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	default:
+		data, _ := json.Marshal(x)
+		return string(data)
+	}
+}
+
+func renderCSV(v any) ([]byte, error) {
+	headers, rows, err := tabulate(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(headers)
+	_ = w.WriteAll(rows) // Flushes
+	return buf.Bytes(), w.Error()
+}
+
+func renderMarkdown(v any) ([]byte, error) {
+	headers, rows, err := tabulate(v)
+	if err != nil {
+		return nil, err
+	}
+	escape := func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		return strings.ReplaceAll(s, "\n", "<br>")
+	}
+	var buf bytes.Buffer
+	line := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for i, c := range cells {
+			escaped[i] = escape(c)
+		}
+		buf.WriteString("| " + strings.Join(escaped, " | ") + " |\n")
+	}
+	line(headers)
+	sep := make([]string, len(headers))
+	for i := range sep {
+		sep[i] = "---"
+	}
+	line(sep)
+	for _, row := range rows {
+		line(row)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestRenderCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{
+			"list of objects",
+			[]map[string]any{{"b": 1, "a": "x"}, {"a": "y", "c": true}},
+			"a,b,c\nx,1,\ny,,true\n",
+		},
+		{
+			"object wrapping one list",
+			map[string]any{"messages": []map[string]any{{"id": "M1"}, {"id": "M2"}}, "_status": map[string]any{"more": false}},
+			"id\nM1\nM2\n",
+		},
+		{
+			"single object with nested values",
+			map[string]any{"chats": 3, "top": []string{"a", "b"}},
+			"chats,top\n3,\"[\"\"a\"\",\"\"b\"\"]\"\n",
+		},
+		{
+			"large numbers stay exact",
+			[]map[string]any{{"size": int64(9007199254740993)}},
+			"size\n9007199254740993\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := renderCSV(tt.v)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	pluginRestartDelay = 10 * time.Second // Before restarting a plugin that exited
+	pluginStopTimeout  = 5 * time.Second  // For a plugin to exit once its stdin closes
+)
+
+// plugin is one long-running plugin process. The daemon writes JSON-RPC 2.0
+// lines to its stdin: "event" notifications, and responses to its requests.
+// It reads the plugin's stdout as JSON-RPC requests for the same methods as
+// the control socket (send, mark-read, query, status).
+type plugin struct {
+	command string
+	server  *rpcServer
+
+	mu       sync.Mutex
+	process  *os.Process
+	stdin    io.WriteCloser // nil while the plugin isn't running
+	enc      *json.Encoder
+	stopping bool
+	done     chan struct{} // Closed when the supervisor returns
+}
+
+// startPlugins launches the configured plugins and streams them events from
+// then on: messages the notification rules let through (and alerts and
+// presence notifications), receipts, calls and group changes. The returned
+// function stops them.
+func startPlugins(server *rpcServer) func() {
+	if len(cfg.Plugins) == 0 {
+		return func() {}
+	}
+	plugins := make([]*plugin, len(cfg.Plugins))
+	for i, command := range cfg.Plugins {
+		plugins[i] = &plugin{command: command, server: server, done: make(chan struct{})}
+		go plugins[i].supervise()
+	}
+
+	broadcast := func(payload any) {
+		for _, p := range plugins {
+			p.write(rpcRequest{JSONRPC: "2.0", Method: "event", Params: mustJSON(payload)})
+		}
+	}
+	notifiers = append(notifiers, func(n Notification) { broadcast(n) })
+	client.AddEventHandler(func(evt interface{}) {
+		var payload map[string]any
+		var ok bool
+		switch v := evt.(type) {
+		case *events.Receipt:
+			payload, ok = receiptPayload(v)
+		case *events.CallOffer, *events.CallOfferNotice, *events.CallAccept, *events.CallReject, *events.CallTerminate:
+			payload, ok = callPayload(v)
+		case *events.GroupInfo:
+			payload, ok = groupChangePayload(v)
+		}
+		if ok {
+			broadcast(payload)
+		}
+	})
+
+	return func() {
+		for _, p := range plugins {
+			p.stop()
+		}
+	}
+}
+
+// supervise runs the plugin, restarting it after a delay whenever it exits,
+// until stop is called.
+func (p *plugin) supervise() {
+	defer close(p.done)
+	for {
+		if err := p.run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: plugin %q: %v\n", p.command, err)
+		}
+		p.mu.Lock()
+		stopping := p.stopping
+		p.mu.Unlock()
+		if stopping {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Warning: plugin %q exited; restarting in %s\n", p.command, pluginRestartDelay)
+		time.Sleep(pluginRestartDelay)
+	}
+}
+
+// run starts the plugin and serves its requests until its stdout closes.
+func (p *plugin) run() error {
+	cmd := exec.Command("sh", "-c", p.command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	p.mu.Lock()
+	p.process, p.stdin, p.enc = cmd.Process, stdin, json.NewEncoder(stdin)
+	p.mu.Unlock()
+
+	p.server.serveLines(stdout, func(resp rpcResponse) error { return p.write(resp) })
+
+	p.mu.Lock()
+	p.stdin, p.enc = nil, nil
+	p.mu.Unlock()
+	_ = stdin.Close()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err = <-exited:
+	case <-time.After(pluginStopTimeout):
+		_ = cmd.Process.Kill()
+		err = <-exited
+	}
+	if err != nil {
+		return fmt.Errorf("exited: %w", err)
+	}
+	return nil
+}
+
+// write sends one line to the plugin, dropping it if the plugin isn't
+// running. A write error means the plugin is going away; run notices.
+func (p *plugin) write(v any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.enc == nil {
+		return nil
+	}
+	return p.enc.Encode(v)
+}
+
+// stop closes the plugin's stdin, its cue to exit, and waits for it, killing
+// it if it takes longer than pluginStopTimeout.
+func (p *plugin) stop() {
+	p.mu.Lock()
+	p.stopping = true
+	if p.stdin != nil {
+		_ = p.stdin.Close()
+	}
+	process := p.process
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+	case <-time.After(pluginStopTimeout):
+		if process != nil {
+			_ = process.Kill()
+		}
+	}
+}
+
+func mustJSON(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
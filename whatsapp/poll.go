@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxPollOptions is the most options WhatsApp allows in a poll.
+const maxPollOptions = 12
+
+// pollCreation returns the poll in a message, whichever version it was sent as.
+func pollCreation(m *waE2E.Message) *waE2E.PollCreationMessage {
+	switch {
+	case m.GetPollCreationMessage() != nil:
+		return m.GetPollCreationMessage()
+	case m.GetPollCreationMessageV2() != nil:
+		return m.GetPollCreationMessageV2()
+	case m.GetPollCreationMessageV3() != nil:
+		return m.GetPollCreationMessageV3()
+	case m.GetPollCreationMessageV5() != nil:
+		return m.GetPollCreationMessageV5()
+	}
+	return nil
+}
+
+// savePoll records a poll's question and options, so votes (which only carry
+// hashes of the option names) can be tallied.
+func savePoll(db dbWriter, messageID, chatJID string, poll *waE2E.PollCreationMessage) error {
+	options := make([]string, 0, len(poll.GetOptions()))
+	for _, option := range poll.GetOptions() {
+		options = append(options, option.GetOptionName())
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO polls (message_id, chat_jid, question, options, selectable_count)
+		VALUES (?, ?, ?, ?, ?)
+	`, messageID, chatJID, poll.GetName(), string(data), poll.GetSelectableOptionsCount())
+	return err
+}
+
+// savePollVote decrypts a live vote and records it. Votes are encrypted with
+// the poll's message secret, which whatsmeow keeps when it receives the poll.
+func savePollVote(evt *events.Message, update *waE2E.PollUpdateMessage) error {
+	chatJID := canonicalJID(normalizeJID(evt.Info.Chat.String()))
+	if !chatSynced(chatJID) {
+		return nil
+	}
+	vote, err := client.DecryptPollVote(context.Background(), evt)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt poll vote: %w", err)
+	}
+	return recordPollVote(messageDB, update.GetPollCreationMessageKey().GetID(), chatJID,
+		canonicalJID(normalizeJID(evt.Info.Sender.String())), vote.GetSelectedOptions(), evt.Info.Timestamp.Unix())
+}
+
+// saveHistoryPollVotes records the votes history sync attaches to a poll,
+// which the phone sends already decrypted.
+func saveHistoryPollVotes(db dbWriter, msg *NormalizedMessage, updates []*waWeb.PollUpdate) {
+	for _, update := range updates {
+		key := update.GetPollUpdateMessageKey()
+		var voter string
+		switch {
+		case key.GetFromMe():
+			if client.Store.ID != nil {
+				voter = client.Store.ID.String()
+			}
+		case key.GetParticipant() != "":
+			voter = key.GetParticipant()
+		default:
+			voter = key.GetRemoteJID()
+		}
+		if voter == "" {
+			continue
+		}
+		timestamp := update.GetSenderTimestampMS() / 1000
+		if err := recordPollVote(db, msg.ID, msg.ChatJID, canonicalJID(normalizeJID(voter)),
+			update.GetVote().GetSelectedOptions(), timestamp); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save poll vote: %v\n", err)
+		}
+	}
+}
+
+// recordPollVote keeps a voter's latest vote, translating the option hashes
+// it carries into option names. An empty selection means the vote was withdrawn.
+func recordPollVote(db dbWriter, pollID, chatJID, voterJID string, selected [][]byte, timestamp int64) error {
+	var optionsJSON string
+	err := db.QueryRow(`SELECT options FROM polls WHERE message_id = ? AND chat_jid = ?`,
+		pollID, chatJID).Scan(&optionsJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("vote for unknown poll %s", pollID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up poll: %w", err)
+	}
+	var options []string
+	if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+		return fmt.Errorf("failed to parse poll options: %w", err)
+	}
+
+	picked := []string{}
+	for i, hash := range whatsmeow.HashPollOptions(options) {
+		for _, s := range selected {
+			if bytes.Equal(hash, s) {
+				picked = append(picked, options[i])
+				break
+			}
+		}
+	}
+	data, err := json.Marshal(picked)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO poll_votes (poll_id, chat_jid, voter_jid, options, timestamp)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(poll_id, chat_jid, voter_jid) DO UPDATE SET
+			options = excluded.options,
+			timestamp = excluded.timestamp
+		WHERE excluded.timestamp >= poll_votes.timestamp
+	`, pollID, chatJID, voterJID, string(data), timestamp)
+	return err
+}
+
+// migratePollUpdates decrypts votes saved encrypted in the old poll_updates
+// table into poll_votes, then drops the table. Votes that can't be decrypted
+// are dropped with it; they couldn't be counted before either.
+func migratePollUpdates() error {
+	var exists int
+	if err := messageDB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'poll_updates'`).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to read migration state: %w", err)
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	rows, err := messageDB.Query(`
+		SELECT poll_id, chat_jid, voter_jid, event_chat, event_sender, is_from_me, update_proto, timestamp
+		FROM poll_updates
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query poll updates: %w", err)
+	}
+	type pollUpdate struct {
+		pollID, chatJID, voterJID, eventChat, eventSender string
+		isFromMe                                          int
+		data                                              []byte
+		timestamp                                         int64
+	}
+	var updates []pollUpdate
+	for rows.Next() {
+		var u pollUpdate
+		if err := rows.Scan(&u.pollID, &u.chatJID, &u.voterJID, &u.eventChat, &u.eventSender, &u.isFromMe, &u.data, &u.timestamp); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		updates = append(updates, u)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	failed := 0
+	for _, u := range updates {
+		selected, err := decryptPollVote(context.Background(), u.eventChat, u.eventSender, u.isFromMe == 1, u.data)
+		if err == nil {
+			err = recordPollVote(messageDB, u.pollID, u.chatJID, u.voterJID, selected, u.timestamp)
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d of %d saved poll votes couldn't be decrypted\n", failed, len(updates))
+	}
+
+	// Merges journaled rows of the old table; there's nothing left to undo there
+	if _, err := messageDB.Exec(`
+		DELETE FROM contact_merge_log WHERE table_name = 'poll_updates';
+		DROP TABLE poll_updates;
+	`); err != nil {
+		return fmt.Errorf("failed to drop poll_updates table: %w", err)
+	}
+	return nil
+}
+
+// cmdSendPoll sends a poll. Voters pick one option, or any number with --multi.
+// Usage: send-poll <recipient> <question> --option A --option B [--multi]
+func cmdSendPoll(args []string) error {
+	usage := fmt.Errorf("usage: send-poll <recipient> <question> --option A --option B [--option ...] [--multi]")
+	var options, positionalArgs []string
+	multi := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--multi":
+			multi = true
+		case strings.HasPrefix(args[i], "--option="):
+			options = append(options, strings.TrimPrefix(args[i], "--option="))
+		case args[i] == "--option":
+			if i+1 >= len(args) {
+				return usage
+			}
+			options = append(options, args[i+1])
+			i++
+		case strings.HasPrefix(args[i], "--"):
+			return fmt.Errorf("unknown option: %s", args[i])
+		default:
+			positionalArgs = append(positionalArgs, args[i])
+		}
+	}
+	if len(positionalArgs) < 2 {
+		return usage
+	}
+	question := strings.Join(positionalArgs[1:], " ")
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return fmt.Errorf("a poll needs 2 to %d options", maxPollOptions)
+	}
+	seen := map[string]bool{}
+	for _, option := range options {
+		if strings.TrimSpace(option) == "" {
+			return fmt.Errorf("poll options can't be empty")
+		}
+		// Votes identify options by a hash of the name, so names must differ
+		if seen[option] {
+			return fmt.Errorf("duplicate poll option: %s", option)
+		}
+		seen[option] = true
+	}
+
+	jid, err := parseJID(positionalArgs[0])
+	if err != nil {
+		return err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	selectable := 1
+	if multi {
+		selectable = 0 // Any number
+	}
+	msg := client.BuildPollCreation(question, options, selectable)
+	resp, err := client.SendMessage(ctx, jid, withDisappearingTimer(ctx, jid, msg))
+	if err != nil {
+		return fmt.Errorf("failed to send poll: %w", err)
+	}
+	recordSent("send-poll", jid.String(), resp)
+
+	// Our own polls don't come back from WhatsApp, so remember the options now
+	if err := savePoll(messageDB, resp.ID, canonicalJID(normalizeJID(jid.String())), msg.GetPollCreationMessage()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save poll: %v\n", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":   true,
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+		"recipient": jid.String(),
+		"question":  question,
+		"options":   options,
+		"multi":     multi,
+	})
+}
+
+// cmdPollResults tallies the votes recorded for a poll per option. Only each
+// voter's latest vote counts.
+// Usage: poll-results <message-id> [--chat=JID]
+func cmdPollResults(args []string) error {
+	var messageID, chatJID string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--chat="):
+			chatJID = strings.TrimPrefix(arg, "--chat=")
+		case messageID == "":
+			messageID = arg
+		default:
+			return fmt.Errorf("unexpected argument: %s", arg)
+		}
+	}
+	if messageID == "" {
+		return fmt.Errorf("usage: poll-results <message-id> [--chat=JID]")
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	// Polls we sent aren't in messages, so look in polls first
+	if chatJID == "" && !isRef(messageID) {
+		_ = messageDB.QueryRow(`SELECT chat_jid FROM polls WHERE message_id = ?`, messageID).Scan(&chatJID)
+	}
+	messageID, chatJID, err := resolveMessage(messageID, chatJID)
+	if err != nil {
+		return err
+	}
+	chatJID = canonicalJID(chatJID)
+
+	result, err := tallyPoll(messageID, chatJID, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no poll %s in %s (polls are recorded as they're synced)", messageID, chatJID)
+	}
+	if err != nil {
+		return err
+	}
+	result["poll_id"] = messageID
+	result["chat_jid"] = chatJID
+	return printJSON(result)
+}
+
+// tallyPoll counts a poll's recorded votes per option, listing who voted for
+// what if withVoters is set. Returns sql.ErrNoRows if the poll isn't recorded.
+func tallyPoll(pollID, chatJID string, withVoters bool) (map[string]any, error) {
+	var question, optionsJSON string
+	var selectable int
+	err := messageDB.QueryRow(`SELECT question, options, selectable_count FROM polls WHERE message_id = ? AND chat_jid = ?`,
+		pollID, chatJID).Scan(&question, &optionsJSON, &selectable)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up poll: %w", err)
+	}
+	var options []string
+	if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+		return nil, fmt.Errorf("failed to parse poll options: %w", err)
+	}
+
+	rows, err := messageDB.Query(`
+		SELECT v.voter_jid, v.options, v.timestamp, COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''))
+		FROM poll_votes v
+		LEFT JOIN contacts ct ON ct.jid = v.voter_jid
+		WHERE v.poll_id = ? AND v.chat_jid = ?
+		ORDER BY v.timestamp
+	`, pollID, chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query poll votes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	index := make(map[string]int, len(options))
+	for i, option := range options {
+		index[option] = i
+	}
+	voters := make([][]map[string]any, len(options))
+	totalVoters := 0
+	for rows.Next() {
+		var voterJID, pickedJSON string
+		var timestamp int64
+		var voterName sql.NullString
+		if err := rows.Scan(&voterJID, &pickedJSON, &timestamp, &voterName); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		var picked []string
+		if err := json.Unmarshal([]byte(pickedJSON), &picked); err != nil {
+			return nil, fmt.Errorf("failed to parse poll vote: %w", err)
+		}
+		if len(picked) == 0 {
+			// Vote withdrawn
+			continue
+		}
+		totalVoters++
+		voter := map[string]any{"jid": voterJID, "timestamp": timestamp}
+		if voterName.Valid {
+			voter["name"] = voterName.String
+		}
+		for _, option := range picked {
+			if i, ok := index[option]; ok {
+				voters[i] = append(voters[i], voter)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	results := make([]map[string]any, len(options))
+	for i, option := range options {
+		results[i] = map[string]any{
+			"name":  option,
+			"votes": len(voters[i]),
+		}
+		if withVoters {
+			results[i]["voters"] = voters[i]
+			if voters[i] == nil {
+				results[i]["voters"] = []map[string]any{}
+			}
+		}
+	}
+	return map[string]any{
+		"question":     question,
+		"multi":        selectable != 1,
+		"total_voters": totalVoters,
+		"options":      results,
+	}, nil
+}
+
+// decryptPollVote decrypts a poll update saved by an older version, returning
+// the hashes of the selected options.
+func decryptPollVote(ctx context.Context, eventChat, eventSender string, isFromMe bool, data []byte) ([][]byte, error) {
+	var update waE2E.PollUpdateMessage
+	if err := proto.Unmarshal(data, &update); err != nil {
+		return nil, fmt.Errorf("failed to decode poll update: %w", err)
+	}
+	chat, err := types.ParseJID(eventChat)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := types.ParseJID(eventSender)
+	if err != nil {
+		return nil, err
+	}
+	vote, err := client.DecryptPollVote(ctx, &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsFromMe: isFromMe},
+		},
+		Message: &waE2E.Message{PollUpdateMessage: &update},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vote.GetSelectedOptions(), nil
+}
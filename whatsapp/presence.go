@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// cmdPresence handles presence subcommands: presence set available|unavailable,
+// presence watch <jid>..., presence log [<jid>]
+func cmdPresence(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: presence set available|unavailable | presence watch <jid>... | presence log [<jid>]")
+	}
+
+	switch args[0] {
+	case "set":
+		return cmdPresenceSet(args[1:])
+	case "watch":
+		return cmdPresenceWatch(args[1:])
+	case "log":
+		return cmdPresenceLog(args[1:])
+	default:
+		return fmt.Errorf("unknown presence subcommand: %s", args[0])
+	}
+}
+
+// cmdPresenceSet sends a presence update for our own account and remembers
+// it, so announce_presence repeats it rather than going back online.
+func cmdPresenceSet(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: presence set available|unavailable")
+	}
+
+	var state types.Presence
+	switch args[0] {
+	case "available":
+		state = types.PresenceAvailable
+	case "unavailable":
+		state = types.PresenceUnavailable
+	default:
+		return fmt.Errorf("invalid presence %q (expected available or unavailable)", args[0])
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SendPresence(ctx, state); err != nil {
+		return fmt.Errorf("failed to send presence: %w", err)
+	}
+	if err := setMeta(presenceMetaKey, string(state)); err != nil {
+		return fmt.Errorf("failed to save presence: %w", err)
+	}
+
+	output := map[string]any{
+		"success":  true,
+		"presence": string(state),
+	}
+	return printJSON(output)
+}
+
+// presenceRefreshInterval is how often the daemon repeats its available
+// presence, so a long-running connection keeps counting as online.
+const presenceRefreshInterval = 4 * time.Minute
+
+// presenceMetaKey is the meta key for the state last chosen with presence set.
+const presenceMetaKey = "presence"
+
+// chosenPresence returns the state last chosen with presence set, available
+// if none was.
+func chosenPresence() types.Presence {
+	if messageDB == nil {
+		return types.PresenceAvailable
+	}
+	state, err := getMeta(presenceMetaKey)
+	if err != nil || state != string(types.PresenceUnavailable) {
+		return types.PresenceAvailable
+	}
+	return types.PresenceUnavailable
+}
+
+// announcePresence marks us as online when announce_presence is enabled, except
+// in read-only mode, or repeats unavailable if that was chosen with presence
+// set. WhatsApp never sees us online otherwise, since whatsmeow doesn't send
+// presence on its own. Failures are warnings: presence is cosmetic.
+func announcePresence(ctx context.Context) {
+	if !cfg.AnnouncePresence || readOnly {
+		return
+	}
+	if err := client.SendPresence(ctx, chosenPresence()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to announce presence: %v\n", err)
+	}
+}
+
+// presenceLogHandler records presence updates in presence_log. WhatsApp only
+// sends them for contacts we've subscribed to, while we're online.
+func presenceLogHandler(evt interface{}) {
+	v, ok := evt.(*events.Presence)
+	if !ok {
+		return
+	}
+	jid := canonicalJID(normalizeJID(v.From.ToNonAD().String()))
+	if !chatSynced(jid) {
+		return
+	}
+	var lastSeen sql.NullInt64
+	if !v.LastSeen.IsZero() {
+		lastSeen = sql.NullInt64{Int64: v.LastSeen.Unix(), Valid: true}
+	}
+	if _, err := messageDB.Exec(`
+		INSERT INTO presence_log (jid, online, last_seen, timestamp) VALUES (?, ?, ?, ?)
+	`, jid, boolToInt(!v.Unavailable), lastSeen, time.Now().Unix()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save presence: %v\n", err)
+	}
+}
+
+// cmdPresenceWatch subscribes to contacts' presence and prints each update as
+// one JSON object per line until interrupted. Updates are saved to
+// presence_log, and messages arriving meanwhile are saved as by sync.
+// Usage: presence watch <jid>...
+func cmdPresenceWatch(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: presence watch <jid>...")
+	}
+	var jids []types.JID
+	for _, arg := range args {
+		jid, err := parseJID(arg)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(jid.String(), "@g.us") {
+			return fmt.Errorf("presence is per contact, not group: %s", arg)
+		}
+		jids = append(jids, jid)
+	}
+
+	ctx := context.Background()
+	if err := initClient(ctx); err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if client.Store.ID == nil {
+		return fmt.Errorf("not authenticated. Run 'auth' first")
+	}
+
+	var messageCount atomic.Int64
+	var mu sync.Mutex
+	enc := json.NewEncoder(os.Stdout)
+	client.AddEventHandler(syncEventHandler(ctx, &messageCount))
+	client.AddEventHandler(presenceLogHandler)
+	ended := watchSessionEnd()
+	client.AddEventHandler(func(evt interface{}) {
+		switch v := evt.(type) {
+		case *events.Connected:
+			// Subscriptions don't survive reconnects, and WhatsApp only sends
+			// presence to clients that are online themselves
+			go func() {
+				if readOnly {
+					fmt.Fprintf(os.Stderr, "Warning: read-only mode doesn't announce presence; WhatsApp may send no updates\n")
+				} else if err := client.SendPresence(ctx, types.PresenceAvailable); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to send presence: %v\n", err)
+				}
+				for _, jid := range jids {
+					if err := client.SubscribePresence(ctx, jid); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: failed to subscribe to presence of %s: %v\n", jid, err)
+					}
+				}
+			}()
+		case *events.Presence:
+			jid := canonicalJID(normalizeJID(v.From.ToNonAD().String()))
+			update := map[string]any{
+				"jid":       jid,
+				"online":    !v.Unavailable,
+				"timestamp": time.Now().Unix(),
+			}
+			if name := chatDisplayName(jid); name != "" {
+				update["name"] = name
+			}
+			if !v.LastSeen.IsZero() {
+				update["last_seen"] = v.LastSeen.Unix()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err := enc.Encode(update); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to write presence: %v\n", err)
+			}
+		}
+	})
+
+	if err := connectSession(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Disconnect()
+
+	fmt.Fprintln(os.Stderr, "Watching presence. Press Ctrl+C to stop.")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sigChan:
+		return nil
+	case err := <-ended:
+		return err
+	}
+}
+
+// cmdPresenceLog lists recorded presence updates, newest first.
+// Usage: presence log [<jid>] [--max-results=N]
+func cmdPresenceLog(args []string) error {
+	var jidArg string
+	limit := 100
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--max-results="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-results="))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--max-results must be a positive number")
+			}
+			limit = n
+		case jidArg == "":
+			jidArg = arg
+		default:
+			return fmt.Errorf("unexpected argument: %s", arg)
+		}
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT p.jid, COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''), ''), p.online, p.last_seen, p.timestamp
+		FROM presence_log p
+		LEFT JOIN contacts ct ON ct.jid = p.jid`
+	var queryArgs []any
+	if jidArg != "" {
+		jid, err := parseJID(jidArg)
+		if err != nil {
+			return err
+		}
+		query += ` WHERE p.jid = ?`
+		queryArgs = append(queryArgs, canonicalJID(normalizeJID(jid.String())))
+	}
+	query += ` ORDER BY p.timestamp DESC, p.id DESC LIMIT ?`
+	queryArgs = append(queryArgs, limit)
+
+	rows, err := messageDB.Query(query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to query presence log: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	updates := []map[string]any{}
+	for rows.Next() {
+		var jid, name string
+		var online int
+		var lastSeen sql.NullInt64
+		var timestamp int64
+		if err := rows.Scan(&jid, &name, &online, &lastSeen, &timestamp); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		update := map[string]any{"jid": jid, "online": online == 1, "timestamp": timestamp}
+		if name != "" {
+			update["name"] = name
+		}
+		if lastSeen.Valid {
+			update["last_seen"] = lastSeen.Int64
+		}
+		updates = append(updates, update)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return printJSON(updates)
+}
+
+// typingDelay is how long send --typing shows "typing..." when no duration is
+// given: about a fast typist's pace for the message, within a few seconds.
+func typingDelay(text string) time.Duration {
+	d := time.Second + time.Duration(len([]rune(text)))*50*time.Millisecond
+	return min(d, 8*time.Second)
+}
+
+// showTyping shows "typing..." in a chat for d. Chat states only show while
+// we're online, so we go online first if announce_presence allows it and
+// presence set hasn't chosen unavailable; otherwise the indicator may not
+// appear. Failures are warnings: the message matters more than the indicator.
+func showTyping(ctx context.Context, jid types.JID, d time.Duration) {
+	if cfg.AnnouncePresence && chosenPresence() == types.PresenceAvailable {
+		if err := client.SendPresence(ctx, types.PresenceAvailable); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to send presence: %v\n", err)
+		}
+	}
+	if err := client.SendChatPresence(ctx, jid, types.ChatPresenceComposing, types.ChatPresenceMediaText); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send typing indicator: %v\n", err)
+		return
+	}
+	time.Sleep(d)
+}
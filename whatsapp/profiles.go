@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Profile limits what a run may do, for handing the CLI to an automated
+// assistant. Profiles are defined in profiles.json in the config directory and
+// selected with --profile NAME or WHATSAPP_PROFILE.
+type Profile struct {
+	// Commands allowed to run (e.g. ["messages", "search", "send"]). Empty allows all.
+	Commands []string `json:"commands"`
+	// Recipients that send, send-file, and undo may target, in the same form as
+	// ignore_chats. Empty allows any recipient.
+	Recipients []string `json:"recipients"`
+	// MaxSendsPerHour caps messages sent in any rolling hour. 0 means no cap.
+	MaxSendsPerHour int `json:"max_sends_per_hour"`
+}
+
+// activeProfile is the selected profile, or nil when none is.
+var (
+	activeProfile     *Profile
+	activeProfileName string
+)
+
+// extractProfileFlag removes a global --profile NAME (or --profile=NAME) from
+// args, falling back to WHATSAPP_PROFILE.
+func extractProfileFlag(args []string) ([]string, string, error) {
+	name := os.Getenv("WHATSAPP_PROFILE")
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--profile="):
+			name = strings.TrimPrefix(args[i], "--profile=")
+		case args[i] == "--profile":
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("--profile requires a name")
+			}
+			name = args[i+1]
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, name, nil
+}
+
+// loadProfile selects the named profile from profiles.json.
+func loadProfile(name string) error {
+	path := filepath.Join(configDir, "profiles.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("profile %q not found: %s doesn't exist", name, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read profiles: %w", err)
+	}
+	var file struct {
+		Profiles map[string]*Profile `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	profile, ok := file.Profiles[name]
+	if !ok || profile == nil {
+		return fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	if profile.MaxSendsPerHour < 0 {
+		return fmt.Errorf("profile %q: max_sends_per_hour must not be negative", name)
+	}
+	activeProfile = profile
+	activeProfileName = name
+	return nil
+}
+
+// checkProfileCommand refuses commands outside the active profile.
+func checkProfileCommand(cmd string) error {
+	if activeProfile == nil || len(activeProfile.Commands) == 0 || cmd == "help" {
+		return nil
+	}
+	if !slices.Contains(activeProfile.Commands, cmd) {
+		return fmt.Errorf("%s is not allowed by profile %q", cmd, activeProfileName)
+	}
+	return nil
+}
+
+// checkProfileSend refuses a send to recipient that the active profile doesn't
+// allow, or that would exceed its hourly cap. Sends are counted from
+// sent_messages, so this covers every sender in the CLI.
+func checkProfileSend(recipient types.JID) error {
+	if activeProfile == nil {
+		return nil
+	}
+	if messageDB == nil {
+		if err := initMessageDB(); err != nil {
+			return err
+		}
+	}
+	jid := normalizeJID(recipient.String())
+	if len(activeProfile.Recipients) > 0 && !chatListed(activeProfile.Recipients, jid) {
+		return fmt.Errorf("sending to %s is not allowed by profile %q", jid, activeProfileName)
+	}
+	if activeProfile.MaxSendsPerHour > 0 {
+		var sent int
+		since := time.Now().Add(-time.Hour).Unix()
+		if err := messageDB.QueryRow(`SELECT COUNT(*) FROM sent_messages WHERE timestamp > ?`, since).Scan(&sent); err != nil {
+			return fmt.Errorf("failed to count recent sends: %w", err)
+		}
+		if sent >= activeProfile.MaxSendsPerHour {
+			return fmt.Errorf("profile %q allows %d sends per hour; %d sent in the last hour",
+				activeProfileName, activeProfile.MaxSendsPerHour, sent)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// readOnly refuses commands with side effects on WhatsApp (global --read-only
+// flag or the read_only setting), so the archive can be browsed by an agent
+// without risk of sending, marking read, or changing anything remotely.
+var readOnly bool
+
+// sideEffectCommands change state on WhatsApp or the linked device.
+var sideEffectCommands = map[string]bool{
+	"auth":             true,
+	"backfill":         true, // Sends history requests to the phone
+	"send":             true,
+	"send-file":        true,
+	"send-contact":     true,
+	"send-poll":        true,
+	"send-batch":       true,
+	"set-disappearing": true,
+	"undo":             true,
+	"mark-read":        true,
+	"mark-all-read":    true,
+	"mark-unread":      true,
+	"mute":             true,
+	"unmute":           true,
+	"star":             true,
+	"unstar":           true,
+	"logout":           true,
+}
+
+// groupSideEffects are the group subcommands that change the group.
+var groupSideEffects = map[string]bool{
+	"set-name":        true,
+	"set-description": true,
+	"set-picture":     true,
+	"leave":           true,
+	"join":            true,
+	"approve":         true,
+	"reject":          true,
+}
+
+// profileSideEffects are the profile subcommands that change our profile.
+var profileSideEffects = map[string]bool{
+	"set-name":       true,
+	"set-about":      true,
+	"set-picture":    true,
+	"remove-picture": true,
+}
+
+// extractReadOnlyFlag removes a global --read-only from args.
+func extractReadOnlyFlag(args []string) ([]string, bool) {
+	i := slices.Index(args, "--read-only")
+	if i < 0 {
+		return args, false
+	}
+	return slices.Delete(args, i, i+1), true
+}
+
+// checkReadOnly returns an error if cmd may not run in read-only mode.
+func checkReadOnly(cmd string, args []string) error {
+	if !readOnly {
+		return nil
+	}
+	refused := sideEffectCommands[cmd]
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch cmd {
+	case "presence":
+		refused = sub == "set"
+	case "group":
+		refused = groupSideEffects[sub]
+	case "profile":
+		refused = profileSideEffects[sub]
+	case "config":
+		// Otherwise read_only could simply be switched off from the CLI
+		refused = sub == "set" || sub == "unset"
+	}
+	if !refused {
+		return nil
+	}
+	if sub != "" && (cmd == "presence" || cmd == "config" || cmd == "group" || cmd == "profile") {
+		cmd += " " + sub
+	}
+	return fmt.Errorf("%s is disabled in read-only mode", cmd)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// receiptTypeName maps receipt types to stored names, or "" for receipt types
+// that say nothing about delivery or reading (retries, errors, ...).
+func receiptTypeName(t types.ReceiptType) string {
+	switch t {
+	case types.ReceiptTypeDelivered:
+		return "delivered"
+	case types.ReceiptTypeSender, types.ReceiptTypeRead, types.ReceiptTypeReadSelf,
+		types.ReceiptTypePlayed, types.ReceiptTypePlayedSelf:
+		return string(t)
+	default:
+		return ""
+	}
+}
+
+// saveReceipt records a receipt for each message it covers. The first time a
+// participant reached each state is kept, so repeated receipts don't move it.
+func saveReceipt(evt *events.Receipt) error {
+	receiptType := receiptTypeName(evt.Type)
+	if receiptType == "" {
+		return nil
+	}
+	chatJID := canonicalJID(normalizeJID(evt.Chat.String()))
+	participant := canonicalJID(normalizeJID(evt.Sender.String()))
+	if !chatSynced(chatJID) {
+		return nil
+	}
+	for _, msgID := range evt.MessageIDs {
+		if _, err := messageDB.Exec(`
+			INSERT INTO receipts (message_id, chat_jid, participant_jid, type, timestamp)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(message_id, chat_jid, participant_jid, type) DO UPDATE SET
+				timestamp = MIN(receipts.timestamp, excluded.timestamp)
+		`, msgID, chatJID, participant, receiptType, evt.Timestamp.Unix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cmdReceipts lists the receipts recorded for a message, with the delay between
+// sending and each receipt.
+// Usage: receipts <message-id> [--chat=JID]
+func cmdReceipts(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: receipts <message-id> [--chat=JID]")
+	}
+	messageID := args[0]
+	var chatJID string
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "--chat=") {
+			chatJID = strings.TrimPrefix(arg, "--chat=")
+		} else {
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	messageID, chatJID, err := resolveMessage(messageID, chatJID)
+	if err != nil {
+		return err
+	}
+
+	var sentAt sql.NullInt64
+	_ = messageDB.QueryRow(`SELECT timestamp FROM messages WHERE id = ? AND chat_jid = ?`, messageID, chatJID).Scan(&sentAt)
+
+	rows, err := messageDB.Query(`
+		SELECT r.participant_jid, COALESCE(NULLIF(ct.name, ''), ct.push_name), r.type, r.timestamp
+		FROM receipts r
+		LEFT JOIN contacts ct ON ct.jid = r.participant_jid
+		WHERE r.message_id = ? AND r.chat_jid = ?
+		ORDER BY r.timestamp, r.participant_jid
+	`, messageID, chatJID)
+	if err != nil {
+		return fmt.Errorf("failed to query receipts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	receipts := []map[string]any{}
+	for rows.Next() {
+		var participant, receiptType string
+		var name sql.NullString
+		var timestamp int64
+		if err := rows.Scan(&participant, &name, &receiptType, &timestamp); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		receipt := map[string]any{
+			"participant_jid": participant,
+			"type":            receiptType,
+			"timestamp":       timestamp,
+		}
+		if name.Valid && name.String != "" {
+			receipt["participant_name"] = name.String
+		}
+		if sentAt.Valid {
+			receipt["latency_seconds"] = timestamp - sentAt.Int64
+		}
+		receipts = append(receipts, receipt)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	output := map[string]any{
+		"message_id": messageID,
+		"chat_jid":   chatJID,
+		"receipts":   receipts,
+	}
+	return printJSON(output)
+}
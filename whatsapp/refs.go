@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Short refs: list commands number the messages they print (^1, ^2, ...) and
+// save the numbering, so follow-up commands can take "^2" instead of a long
+// message ID. Each listing replaces the previous numbering.
+
+func refsPath() string {
+	return filepath.Join(dataDir, "refs.json")
+}
+
+// assignRefs adds a "ref" to each listed message and saves the numbering.
+// keys[i] identifies messages[i]. Failing to save only warns.
+func assignRefs(messages []map[string]any, keys []messageKey) {
+	for i, msg := range messages {
+		msg["ref"] = refName(i)
+	}
+	saveRefs(keys)
+}
+
+// refName is the ref of the i'th (from 0) message in a listing.
+func refName(i int) string {
+	return "^" + strconv.Itoa(i+1)
+}
+
+// saveRefs saves the numbering of a listing whose messages carry their
+// refName, for commands that print messages as they go.
+func saveRefs(keys []messageKey) {
+	data, err := json.Marshal(keys)
+	if err == nil {
+		err = writeFileAtomic(refsPath(), data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save message refs: %v\n", err)
+	}
+}
+
+// isRef reports whether arg is a short ref like ^3.
+func isRef(arg string) bool {
+	return strings.HasPrefix(arg, "^")
+}
+
+// lookupRef returns the message a short ref points to.
+func lookupRef(ref string) (messageKey, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(ref, "^"))
+	if err != nil || n < 1 {
+		return messageKey{}, fmt.Errorf("invalid message ref %q (expected e.g. ^1)", ref)
+	}
+	data, err := os.ReadFile(refsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return messageKey{}, fmt.Errorf("no message refs yet; list messages first")
+	}
+	if err != nil {
+		return messageKey{}, fmt.Errorf("failed to read message refs: %w", err)
+	}
+	var keys []messageKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return messageKey{}, fmt.Errorf("failed to parse message refs: %w", err)
+	}
+	if n > len(keys) {
+		return messageKey{}, fmt.Errorf("no message %s in the last listing (%d messages)", ref, len(keys))
+	}
+	return keys[n-1], nil
+}
+
+// resolveMessage turns a message argument (ID or short ref) and optional
+// --chat into a message ID and its chat.
+func resolveMessage(messageID, chatJID string) (string, string, error) {
+	if isRef(messageID) {
+		key, err := lookupRef(messageID)
+		if err != nil {
+			return "", "", err
+		}
+		return key.ID, key.ChatJID, nil
+	}
+	chatJID, err := resolveMessageChat(messageID, chatJID)
+	return messageID, chatJID, err
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PruneReport summarizes what a retention pass removed.
+type PruneReport struct {
+	MessagesDeleted   int64 `json:"messages_deleted"`
+	ReactionsDeleted  int64 `json:"reactions_deleted"`
+	MediaFilesDeleted int   `json:"media_files_deleted"`
+	MediaBytesFreed   int64 `json:"media_bytes_freed"`
+}
+
+// retentionPolicy holds parsed retention ages; zero means keep forever.
+// mediaSize caps the media cache in bytes; zero means no cap.
+// disappearing also prunes messages whose chat's disappearing timer expired.
+type retentionPolicy struct {
+	messages     time.Duration
+	media        time.Duration
+	mediaSize    int64
+	disappearing bool
+}
+
+func (p retentionPolicy) isSet() bool {
+	return p.messages > 0 || p.media > 0 || p.mediaSize > 0 || p.disappearing
+}
+
+// configuredRetention returns the retention policy from config.
+// Values were validated when the config was loaded, so parse errors can't occur.
+func configuredRetention() retentionPolicy {
+	var p retentionPolicy
+	if cfg.RetainMessages != "" {
+		p.messages, _ = parseAge(cfg.RetainMessages)
+	}
+	if cfg.RetainMedia != "" {
+		p.media, _ = parseAge(cfg.RetainMedia)
+	}
+	if cfg.MediaCacheMaxSize != "" {
+		p.mediaSize, _ = parseSize(cfg.MediaCacheMaxSize)
+	}
+	p.disappearing = cfg.PurgeDisappearing
+	return p
+}
+
+// applyRetention prunes messages and media older than the policy allows, then
+// media beyond the cache size cap. Starred messages are kept whatever their age.
+func applyRetention(policy retentionPolicy, now time.Time) (PruneReport, error) {
+	var report PruneReport
+
+	if policy.messages > 0 {
+		cutoff := now.Add(-policy.messages).Unix()
+
+		result, err := messageDB.Exec(`DELETE FROM messages WHERE timestamp < ? AND is_starred = 0`, cutoff)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune messages: %w", err)
+		}
+		report.MessagesDeleted, _ = result.RowsAffected()
+
+		// Files the remaining messages still use stay
+		if err := releaseMedia(&report); err != nil {
+			return report, err
+		}
+		if err := releaseThumbnails(); err != nil {
+			return report, err
+		}
+
+		// Reactions to messages that no longer exist are unreachable
+		result, err = messageDB.Exec(`
+			DELETE FROM reactions
+			WHERE timestamp < ? AND NOT EXISTS (
+				SELECT 1 FROM messages m
+				WHERE m.id = reactions.message_id AND m.chat_jid = reactions.chat_jid
+			)
+		`, cutoff)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune reactions: %w", err)
+		}
+		report.ReactionsDeleted, _ = result.RowsAffected()
+
+		if _, err := messageDB.Exec(`
+			DELETE FROM receipts
+			WHERE timestamp < ? AND NOT EXISTS (
+				SELECT 1 FROM messages m
+				WHERE m.id = receipts.message_id AND m.chat_jid = receipts.chat_jid
+			)
+		`, cutoff); err != nil {
+			return report, fmt.Errorf("failed to prune receipts: %w", err)
+		}
+	}
+
+	if policy.media > 0 || policy.mediaSize > 0 {
+		var cutoff int64
+		if policy.media > 0 {
+			cutoff = now.Add(-policy.media).Unix()
+		}
+		if err := pruneMedia(cutoff, policy.mediaSize, &report); err != nil {
+			return report, err
+		}
+	}
+
+	if policy.disappearing {
+		if err := pruneDisappeared(now.Unix(), &report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// cachedMedia is a downloaded file as retention sees it.
+type cachedMedia struct {
+	path        string
+	size        int64
+	missing     bool  // Recorded on a message but gone from disk
+	newest      int64 // Timestamp of the newest message referring to it
+	refetchable bool  // Some message still has the metadata to download it again
+}
+
+// planMediaPrune picks the downloaded files to delete: those whose messages
+// are all older than cutoff (0: none), then, while the rest add up to more
+// than maxSize bytes (0: no limit), the oldest of what's left. Files that can
+// be downloaded again from their stored media key go before ones that can't.
+// Files are shared between messages with identical content, so a file's age
+// is that of its newest message.
+func planMediaPrune(cutoff, maxSize int64) ([]cachedMedia, error) {
+	rows, err := messageDB.Query(`
+		SELECT media_file_path, MAX(timestamp),
+			MAX(media_key IS NOT NULL AND direct_path IS NOT NULL AND direct_path != '')
+		FROM messages
+		WHERE media_file_path IS NOT NULL AND media_file_path != ''
+		GROUP BY media_file_path
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query media files: %w", err)
+	}
+	var files []cachedMedia
+	for rows.Next() {
+		var f cachedMedia
+		if err := rows.Scan(&f.path, &f.newest, &f.refetchable); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		files = append(files, f)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	var prune, keep []cachedMedia
+	var kept int64
+	for _, f := range files {
+		if info, err := os.Stat(f.path); err == nil {
+			f.size = info.Size()
+		} else if errors.Is(err, os.ErrNotExist) {
+			f.missing = true
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: failed to stat media file: %v\n", err)
+			continue
+		}
+		if cutoff > 0 && f.newest < cutoff {
+			prune = append(prune, f)
+		} else if !f.missing {
+			keep = append(keep, f)
+			kept += f.size
+		}
+	}
+
+	if maxSize > 0 && kept > maxSize {
+		sort.Slice(keep, func(i, j int) bool {
+			if keep[i].refetchable != keep[j].refetchable {
+				return keep[i].refetchable
+			}
+			if keep[i].newest != keep[j].newest {
+				return keep[i].newest < keep[j].newest
+			}
+			return keep[i].path < keep[j].path
+		})
+		for _, f := range keep {
+			if kept <= maxSize {
+				break
+			}
+			prune = append(prune, f)
+			kept -= f.size
+		}
+	}
+	return prune, nil
+}
+
+// pruneMedia deletes downloaded media files as planMediaPrune picks them and
+// clears media_file_path. Download metadata is kept so the files can be
+// fetched again on demand.
+func pruneMedia(cutoff, maxSize int64, report *PruneReport) error {
+	files, err := planMediaPrune(cutoff, maxSize)
+	if err != nil {
+		return err
+	}
+	return deleteMedia(files, report)
+}
+
+func deleteMedia(files []cachedMedia, report *PruneReport) error {
+	for _, f := range files {
+		if _, err := messageDB.Exec(`UPDATE messages SET media_file_path = NULL WHERE media_file_path = ?`, f.path); err != nil {
+			return fmt.Errorf("failed to clear media path: %w", err)
+		}
+	}
+	return releaseMedia(report)
+}
+
+// runRetention applies the configured policy, returning nil if none is set.
+// Used after sync and on every daemon tick.
+func runRetention() (*PruneReport, error) {
+	policy := configuredRetention()
+	if !policy.isSet() {
+		return nil, nil
+	}
+	report, err := applyRetention(policy, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// cmdPurge prunes old messages and media on demand.
+// Usage: purge [--messages-older-than=AGE] [--media-older-than=AGE] [--disappeared]
+// Without flags, applies the retention policy from config.
+func cmdPurge(args []string) error {
+	policy := configuredRetention()
+	for _, arg := range args {
+		var err error
+		switch {
+		case arg == "--disappeared":
+			policy.disappearing = true
+		case strings.HasPrefix(arg, "--messages-older-than="):
+			policy.messages, err = parseAge(strings.TrimPrefix(arg, "--messages-older-than="))
+		case strings.HasPrefix(arg, "--media-older-than="):
+			policy.media, err = parseAge(strings.TrimPrefix(arg, "--media-older-than="))
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !policy.isSet() {
+		return fmt.Errorf("no retention policy: set retain_messages/retain_media/media_cache_max_size/purge_disappearing in config or pass --messages-older-than/--media-older-than/--disappeared")
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	report, err := applyRetention(policy, time.Now())
+	if err != nil {
+		return err
+	}
+
+	output := map[string]any{
+		"success": true,
+		"pruned":  report,
+	}
+	return printJSON(output)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestApplyRetentionKeepsStarred(t *testing.T) {
+	openTestDB(t)
+	now := time.Unix(1700000000, 0)
+	old := now.Add(-400 * 24 * time.Hour).Unix()
+	chat := "12025551234@s.whatsapp.net"
+	insertTestMessage(t, "old", chat, old, "")
+	insertTestMessage(t, "starred", chat, old, "")
+	insertTestMessage(t, "recent", chat, now.Unix(), "")
+	if _, err := messageDB.Exec(`UPDATE messages SET is_starred = 1 WHERE id = 'starred'`); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := applyRetention(retentionPolicy{messages: 365 * 24 * time.Hour}, now)
+	if err != nil {
+		t.Fatalf("applyRetention: %v", err)
+	}
+	if report.MessagesDeleted != 1 {
+		t.Errorf("MessagesDeleted = %d, want 1", report.MessagesDeleted)
+	}
+
+	rows, err := messageDB.Query(`SELECT id FROM messages ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+	var kept []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		kept = append(kept, id)
+	}
+	if want := []string{"recent", "starred"}; !slices.Equal(kept, want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+}
+
+func TestPlanMediaPrune(t *testing.T) {
+	openTestDB(t)
+	dir := t.TempDir()
+	chat := "12025551234@s.whatsapp.net"
+	// File, newest timestamp, whether it can be downloaded again
+	files := []struct {
+		name        string
+		timestamp   int64
+		refetchable bool
+	}{
+		{"old", 100, true},
+		{"kept", 200, false},
+		{"refetch-older", 300, true},
+		{"kept-newer", 400, false},
+		{"refetch-newer", 500, true},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, make([]byte, 100), 0600); err != nil {
+			t.Fatal(err)
+		}
+		insertTestMessage(t, f.name, chat, f.timestamp, "")
+		directPath := ""
+		if f.refetchable {
+			directPath = "/v/t62/" + f.name
+		}
+		if _, err := messageDB.Exec(`UPDATE messages SET media_type = 'image', media_file_path = ?, media_key = ?, direct_path = ? WHERE id = ?`,
+			path, []byte("key"), directPath, f.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An older message sharing the newest file doesn't make it old
+	insertTestMessage(t, "shared", chat, 50, "")
+	if _, err := messageDB.Exec(`UPDATE messages SET media_file_path = ? WHERE id = 'shared'`,
+		filepath.Join(dir, "refetch-newer")); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned := func(cutoff, maxSize int64) []string {
+		t.Helper()
+		plan, err := planMediaPrune(cutoff, maxSize)
+		if err != nil {
+			t.Fatalf("planMediaPrune: %v", err)
+		}
+		var names []string
+		for _, f := range plan {
+			names = append(names, filepath.Base(f.path))
+		}
+		slices.Sort(names)
+		return names
+	}
+	if got := pruned(150, 0); !slices.Equal(got, []string{"old"}) {
+		t.Errorf("by age: pruned %v, want [old]", got)
+	}
+	// 400 bytes are left after the age cutoff; re-downloadable files go first
+	if got, want := pruned(150, 250), []string{"old", "refetch-newer", "refetch-older"}; !slices.Equal(got, want) {
+		t.Errorf("by age and size: pruned %v, want %v", got, want)
+	}
+	// Newer re-downloadable files go before an older one that isn't
+	if got, want := pruned(0, 250), []string{"old", "refetch-newer", "refetch-older"}; !slices.Equal(got, want) {
+		t.Errorf("by size: pruned %v, want %v", got, want)
+	}
+	if got := pruned(0, 0); got != nil {
+		t.Errorf("no policy: pruned %v", got)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// maxRPCQueryRows caps the rows a query call returns.
+const maxRPCQueryRows = 10000
+
+// socketPath is the daemon's control socket.
+func socketPath() string {
+	return filepath.Join(dataDir, "daemon.sock")
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcServer answers JSON-RPC calls on the daemon's control socket, one request
+// per line, using the daemon's connection instead of opening a new one.
+type rpcServer struct {
+	ctx          context.Context
+	started      time.Time
+	messageCount *atomic.Int64
+	queryDB      *sql.DB
+}
+
+// listenControlSocket starts serving the control socket and returns the
+// server, which scripts and plugins share. The returned function stops the
+// listener and removes the socket.
+func listenControlSocket(ctx context.Context, messageCount *atomic.Int64) (*rpcServer, func(), error) {
+	path := socketPath()
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("another daemon is already listening on %s", path)
+	}
+	// A socket left behind by a daemon that didn't shut down cleanly
+	_ = os.Remove(path)
+
+	// Queries get their own read-only connection, so they can't modify the archive
+	queryDB, err := sql.Open("sqlite", messageDBDSN(filepath.Join(dataDir, "messages.db"), true))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open message database: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		_ = queryDB.Close()
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		_ = queryDB.Close()
+		return nil, nil, fmt.Errorf("failed to restrict %s: %w", path, err)
+	}
+
+	s := &rpcServer{ctx: ctx, started: time.Now(), messageCount: messageCount, queryDB: queryDB}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					fmt.Fprintf(os.Stderr, "Warning: control socket: %v\n", err)
+				}
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s, func() {
+		_ = listener.Close()
+		_ = queryDB.Close()
+		_ = os.Remove(path)
+	}, nil
+}
+
+// serve handles requests from one connection until it closes.
+func (s *rpcServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	enc := json.NewEncoder(conn)
+	s.serveLines(conn, func(resp rpcResponse) error { return enc.Encode(resp) })
+}
+
+// serveLines answers one request per line from r until it ends or reply
+// fails. Notifications (requests without an id) run but get no response.
+func (s *rpcServer) serveLines(r io.Reader, reply func(rpcResponse) error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req rpcRequest
+		resp := rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null")}
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			resp.Error = &rpcError{Code: rpcParseError, Message: "parse error: " + err.Error()}
+		} else {
+			if req.ID != nil {
+				resp.ID = req.ID
+			}
+			if req.JSONRPC != "2.0" || req.Method == "" {
+				resp.Error = &rpcError{Code: rpcInvalidRequest, Message: "invalid request"}
+			} else {
+				result, err := s.call(req.Method, req.Params)
+				if err != nil {
+					var rerr *rpcError
+					if !errors.As(err, &rerr) {
+						rerr = &rpcError{Code: rpcServerError, Message: err.Error()}
+					}
+					resp.Error = rerr
+				} else {
+					resp.Result = result
+				}
+			}
+			if req.ID == nil {
+				continue
+			}
+		}
+		if err := reply(resp); err != nil {
+			return
+		}
+	}
+}
+
+// call runs one method. Read-only mode and the daemon's profile apply just as
+// they do to the equivalent commands.
+func (s *rpcServer) call(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "send", "mark-read", "download", "query", "status":
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + method}
+	}
+	if err := checkReadOnly(method, nil); err != nil {
+		return nil, err
+	}
+	if err := checkProfileCommand(method); err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case "send":
+		return s.send(params)
+	case "mark-read":
+		return s.markRead(params)
+	case "download":
+		return s.download(params)
+	case "query":
+		return s.query(params)
+	default:
+		return s.status()
+	}
+}
+
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+// send: {"to": "<phone or JID>", "text": "...", "reply_to": "<message ID or ^N>",
+// "mentions": ["<phone, JID or contact name>", ...]}
+func (s *rpcServer) send(params json.RawMessage) (any, error) {
+	var p struct {
+		To       string   `json:"to"`
+		Text     string   `json:"text"`
+		ReplyTo  string   `json:"reply_to"`
+		Mentions []string `json:"mentions"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.To == "" || p.Text == "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "send requires to and text"}
+	}
+	jid, err := parseJID(p.To)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return nil, err
+	}
+	text := p.Text
+	var mentioned []string
+	if len(p.Mentions) > 0 {
+		if text, mentioned, err = resolveMentions(p.Text, p.Mentions); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+	msg, replyTo, err := buildTextMessage(jid, text, p.ReplyTo, mentioned)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.SendMessage(s.ctx, jid, withDisappearingTimer(s.ctx, jid, msg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	recordSent("send", jid.String(), resp)
+
+	result := map[string]any{
+		"success":   true,
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+		"recipient": jid.String(),
+	}
+	if replyTo != "" {
+		result["reply_to"] = replyTo
+	}
+	if len(mentioned) > 0 {
+		result["mentions"] = mentioned
+	}
+	return result, nil
+}
+
+// mark-read: {"chat": "<chat JID>", "before": "<time>", "up_to": "<message ID>"}
+// (before and up_to are optional, as for the mark-read command)
+func (s *rpcServer) markRead(params json.RawMessage) (any, error) {
+	var p struct {
+		Chat   string `json:"chat"`
+		Before string `json:"before"`
+		UpTo   string `json:"up_to"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Chat == "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "mark-read requires chat"}
+	}
+	if p.Before != "" && p.UpTo != "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "before and up_to can't be combined"}
+	}
+	p.Chat = canonicalJID(normalizeJID(p.Chat))
+	bound, err := markReadBound(p.Chat, p.Before, p.UpTo)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	messageIDs, senderJID, err := unreadMessages(p.Chat, bound)
+	if err != nil {
+		return nil, err
+	}
+	receiptsSent := 0
+	suppressed := receiptsSuppressed(p.Chat)
+	if len(messageIDs) > 0 && !suppressed && client.IsConnected() {
+		receiptsSent = sendReadReceipts(s.ctx, p.Chat, messageIDs, senderJID)
+	}
+	affected, err := markChatReadLocally(p.Chat, bound)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]any{
+		"success":         true,
+		"chat_jid":        p.Chat,
+		"messages_marked": affected,
+		"receipts_sent":   receiptsSent,
+	}
+	if suppressed {
+		result["receipts_suppressed"] = true
+	}
+	return result, nil
+}
+
+// download: {"message_id": "<message ID or ^N>", "chat": "<chat JID>"} saves the
+// media as the download command does (chat is optional for unambiguous IDs).
+func (s *rpcServer) download(params json.RawMessage) (any, error) {
+	var p struct {
+		MessageID string `json:"message_id"`
+		Chat      string `json:"chat"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.MessageID == "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "download requires message_id"}
+	}
+	messageID, chat, err := resolveMessage(p.MessageID, p.Chat)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return downloadMessage(s.ctx, messageID, chat, "")
+}
+
+// query: {"sql": "SELECT ...", "args": [...]} against a read-only connection
+// to messages.db. Returns {"columns": [...], "rows": [[...], ...]}.
+func (s *rpcServer) query(params json.RawMessage) (any, error) {
+	var p struct {
+		SQL  string `json:"sql"`
+		Args []any  `json:"args"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(p.SQL) == "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "query requires sql"}
+	}
+	rows, err := s.queryDB.QueryContext(s.ctx, p.SQL, p.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	result := [][]any{}
+	truncated := false
+	for rows.Next() {
+		if len(result) == maxRPCQueryRows {
+			truncated = true
+			break
+		}
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result = append(result, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	out := map[string]any{
+		"columns": columns,
+		"rows":    result,
+	}
+	if truncated {
+		out["truncated"] = true
+	}
+	return out, nil
+}
+
+func (s *rpcServer) status() (any, error) {
+	status := map[string]any{
+		"connected":      client.IsConnected(),
+		"logged_in":      client.IsLoggedIn(),
+		"messages_saved": s.messageCount.Load(),
+		"uptime_seconds": int64(time.Since(s.started).Seconds()),
+		"read_only":      readOnly,
+	}
+	if client.Store.ID != nil {
+		status["phone"] = client.Store.ID.User
+	}
+	if activeProfileName != "" {
+		status["profile"] = activeProfileName
+	}
+	return status, nil
+}
+
+// cmdRPC sends one JSON-RPC call to the running daemon and prints the result.
+// Usage: rpc <method> [params-json]
+func cmdRPC(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: rpc <method> [params-json]")
+	}
+	// The daemon enforces its own settings; this run's --read-only and
+	// --profile apply to the call as well
+	if err := checkReadOnly(args[0], nil); err != nil {
+		return err
+	}
+	if err := checkProfileCommand(args[0]); err != nil {
+		return err
+	}
+
+	params := json.RawMessage("{}")
+	if len(args) == 2 {
+		if !json.Valid([]byte(args[1])) {
+			return fmt.Errorf("params must be valid JSON")
+		}
+		params = json.RawMessage(args[1])
+	}
+
+	conn, err := net.Dial("unix", socketPath())
+	if err != nil {
+		return fmt.Errorf("failed to reach daemon (is it running?): %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	req := rpcRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: args[0], Params: params}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s", resp.Error.Message)
+	}
+	var result any
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return printJSON(result)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// scheduledCheckInterval is how often the daemon looks for scheduled messages
+// that are due.
+const scheduledCheckInterval = 30 * time.Second
+
+// parseSendAt parses send --at: a local date and time, an RFC 3339 timestamp,
+// or +AGE (e.g. +2h, +1d) from now. The time must be in the future.
+func parseSendAt(s string) (time.Time, error) {
+	var at time.Time
+	if rest, ok := strings.CutPrefix(s, "+"); ok {
+		d, err := parseAge(rest)
+		if err != nil {
+			return time.Time{}, err
+		}
+		at = time.Now().Add(d)
+	} else {
+		t, err := parseTimestamp(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid --at time %q: use 2006-01-02T15:04, RFC 3339, or +2h", s)
+		}
+		at = t
+	}
+	if !at.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("--at %s is in the past", at.Format(time.RFC3339))
+	}
+	return at, nil
+}
+
+// scheduleMessage queues a text message for the daemon to send at a time.
+// The reply and mentions are resolved now, so refs and names mean what they
+// meant when the message was scheduled.
+func scheduleMessage(jid types.JID, text, replyTo string, mentioned []string, at time.Time) error {
+	if messageDB == nil {
+		if err := initMessageDB(); err != nil {
+			return err
+		}
+	}
+	// Building the message checks the reply target exists
+	_, replyTo, err := buildTextMessage(jid, text, replyTo, mentioned)
+	if err != nil {
+		return err
+	}
+	mentionsJSON, err := json.Marshal(mentioned)
+	if err != nil {
+		return err
+	}
+	res, err := messageDB.Exec(`
+		INSERT INTO scheduled (chat_jid, text, reply_to, mentions, send_at, status, created_at)
+		VALUES (?, ?, ?, ?, ?, 'pending', ?)
+	`, jid.String(), text, replyTo, string(mentionsJSON), at.Unix(), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to schedule message: %w", err)
+	}
+	id, _ := res.LastInsertId()
+
+	output := map[string]any{
+		"success":   true,
+		"scheduled": true,
+		"id":        id,
+		"send_at":   at.Unix(),
+		"recipient": jid.String(),
+	}
+	if replyTo != "" {
+		output["reply_to"] = replyTo
+	}
+	if len(mentioned) > 0 {
+		output["mentions"] = mentioned
+	}
+	return printJSON(output)
+}
+
+// deliverScheduled sends scheduled messages that are due. It runs in the
+// daemon; messages due while it wasn't running or was disconnected go out
+// late. Failures mark the message failed rather than retrying, so nothing is
+// sent twice.
+func deliverScheduled(ctx context.Context) {
+	if err := checkReadOnly("send", nil); err != nil {
+		return
+	}
+	if !client.IsConnected() {
+		return // Left pending for the next check after reconnecting
+	}
+	rows, err := messageDB.Query(`
+		SELECT id, chat_jid, text, reply_to, mentions FROM scheduled
+		WHERE status = 'pending' AND send_at <= ?
+		ORDER BY send_at, id
+	`, time.Now().Unix())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to query scheduled messages: %v\n", err)
+		return
+	}
+	type scheduledMessage struct {
+		id                               int64
+		chatJID, text, replyTo, mentions string
+	}
+	var due []scheduledMessage
+	for rows.Next() {
+		var m scheduledMessage
+		if err := rows.Scan(&m.id, &m.chatJID, &m.text, &m.replyTo, &m.mentions); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to scan scheduled message: %v\n", err)
+			continue
+		}
+		due = append(due, m)
+	}
+	_ = rows.Close()
+
+	for _, m := range due {
+		if !client.IsConnected() {
+			return
+		}
+		messageID, err := sendScheduled(ctx, m.chatJID, m.text, m.replyTo, m.mentions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: scheduled message %d to %s failed: %v\n", m.id, m.chatJID, err)
+			_, err = messageDB.Exec(`UPDATE scheduled SET status = 'failed', error = ?, sent_at = ? WHERE id = ?`,
+				err.Error(), time.Now().Unix(), m.id)
+		} else {
+			fmt.Fprintf(os.Stderr, "Sent scheduled message %d to %s\n", m.id, m.chatJID)
+			_, err = messageDB.Exec(`UPDATE scheduled SET status = 'sent', message_id = ?, sent_at = ? WHERE id = ?`,
+				messageID, time.Now().Unix(), m.id)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update scheduled message %d: %v\n", m.id, err)
+		}
+	}
+}
+
+// sendScheduled sends one scheduled message, returning its WhatsApp ID.
+func sendScheduled(ctx context.Context, chatJID, text, replyTo, mentionsJSON string) (string, error) {
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return "", err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return "", err
+	}
+	var mentioned []string
+	if err := json.Unmarshal([]byte(mentionsJSON), &mentioned); err != nil {
+		return "", fmt.Errorf("failed to parse mentions: %w", err)
+	}
+	msg, _, err := buildTextMessage(jid, text, replyTo, mentioned)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.SendMessage(ctx, jid, withDisappearingTimer(ctx, jid, msg))
+	if err != nil {
+		return "", fmt.Errorf("failed to send message: %w", err)
+	}
+	recordSent("send", jid.String(), resp)
+	return resp.ID, nil
+}
+
+// cmdScheduled lists or cancels messages queued with send --at.
+// Usage: scheduled list [--all] | scheduled cancel <id>
+func cmdScheduled(args []string) error {
+	usage := fmt.Errorf("usage: scheduled list [--all] | scheduled cancel <id>")
+	if len(args) < 1 {
+		return usage
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		all := false
+		for _, arg := range args[1:] {
+			if arg != "--all" {
+				return fmt.Errorf("unknown option: %s", arg)
+			}
+			all = true
+		}
+		return listScheduled(all)
+	case "cancel":
+		if len(args) != 2 {
+			return usage
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid scheduled message ID: %s", args[1])
+		}
+		res, err := messageDB.Exec(`UPDATE scheduled SET status = 'cancelled' WHERE id = ? AND status = 'pending'`, id)
+		if err != nil {
+			return fmt.Errorf("failed to cancel scheduled message: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("no pending scheduled message %d", id)
+		}
+		return printJSON(map[string]any{"success": true, "id": id, "status": "cancelled"})
+	default:
+		return fmt.Errorf("unknown scheduled subcommand: %s", args[0])
+	}
+}
+
+// listScheduled prints pending scheduled messages, soonest first, or every
+// scheduled message if all is set.
+func listScheduled(all bool) error {
+	query := `SELECT id, chat_jid, text, reply_to, mentions, send_at, status, message_id, error, sent_at FROM scheduled`
+	if !all {
+		query += ` WHERE status = 'pending'`
+	}
+	query += ` ORDER BY send_at, id`
+	rows, err := messageDB.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	scheduled := []map[string]any{}
+	for rows.Next() {
+		var id, sendAt int64
+		var chatJID, text, replyTo, mentionsJSON, status string
+		var messageID, errMsg sql.NullString
+		var sentAt sql.NullInt64
+		if err := rows.Scan(&id, &chatJID, &text, &replyTo, &mentionsJSON, &sendAt, &status, &messageID, &errMsg, &sentAt); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry := map[string]any{
+			"id":        id,
+			"recipient": chatJID,
+			"text":      text,
+			"send_at":   sendAt,
+			"status":    status,
+		}
+		if replyTo != "" {
+			entry["reply_to"] = replyTo
+		}
+		var mentioned []string
+		if json.Unmarshal([]byte(mentionsJSON), &mentioned) == nil && len(mentioned) > 0 {
+			entry["mentions"] = mentioned
+		}
+		if messageID.Valid {
+			entry["message_id"] = messageID.String
+		}
+		if errMsg.Valid {
+			entry["error"] = errMsg.String
+		}
+		if sentAt.Valid {
+			entry["sent_at"] = sentAt.Int64
+		}
+		scheduled = append(scheduled, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return printJSON(map[string]any{"scheduled": scheduled})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// scriptQueueSize is how many messages can wait for the script.
+const scriptQueueSize = 100
+
+// scriptMaxSteps bounds each on_message call (and loading the script), so a
+// runaway loop fails that message instead of stalling every later one.
+const scriptMaxSteps = 10_000_000
+
+// installScript loads the Starlark script named by the script setting and
+// registers its on_message(msg) function as a notifier, so it sees each
+// message the notification rules let through. The script can reply with
+// send(), mark_read() and download(), which use the daemon's connection and
+// are subject to read-only mode and the profile like the RPC methods.
+func installScript(srv *rpcServer) error {
+	if cfg.Script == "" {
+		return nil
+	}
+	predeclared := starlark.StringDict{
+		"send":      starlark.NewBuiltin("send", srv.scriptSend),
+		"mark_read": starlark.NewBuiltin("mark_read", srv.scriptMarkRead),
+		"download":  starlark.NewBuiltin("download", srv.scriptDownload),
+	}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, scriptThread("load"), cfg.Script, nil, predeclared)
+	if err != nil {
+		return fmt.Errorf("failed to load script %s: %w", cfg.Script, err)
+	}
+	onMessage, ok := globals["on_message"].(starlark.Callable)
+	if !ok {
+		return fmt.Errorf("script %s doesn't define on_message(msg)", cfg.Script)
+	}
+
+	// One message at a time, in arrival order, so scripts needn't lock. A
+	// script that falls behind holds up event handling rather than losing
+	// messages
+	queue := make(chan Notification, scriptQueueSize)
+	go func() {
+		for n := range queue {
+			thread := scriptThread(n.MessageID)
+			// Interrupt a call in progress when the daemon shuts down
+			stop := context.AfterFunc(srv.ctx, func() { thread.Cancel("daemon stopping") })
+			_, err := starlark.Call(thread, onMessage, starlark.Tuple{scriptMessage(n)}, nil)
+			stop()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: script failed on message %s: %v\n", n.MessageID, scriptError(err))
+			}
+		}
+	}()
+	notifiers = append(notifiers, func(n Notification) {
+		if n.Event == eventMessage {
+			queue <- n
+		}
+	})
+	return nil
+}
+
+// scriptThread runs script code with print() going to stderr, within a fresh
+// step budget.
+func scriptThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintf(os.Stderr, "[script] %s\n", msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+	return thread
+}
+
+// scriptError includes the Starlark backtrace, which says where the script failed.
+func scriptError(err error) string {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return evalErr.Backtrace()
+	}
+	return err.Error()
+}
+
+// scriptMessage passes a notification to on_message as a struct with the same
+// fields as the webhook payload, e.g. msg.chat_jid and msg.text.
+func scriptMessage(n Notification) starlark.Value {
+	return starlarkstruct.FromStringDict(starlark.String("message"), starlark.StringDict{
+		"id":          starlark.String(n.MessageID),
+		"chat_jid":    starlark.String(n.ChatJID),
+		"chat_name":   starlark.String(n.ChatName),
+		"sender_jid":  starlark.String(n.SenderJID),
+		"sender_name": starlark.String(n.SenderName),
+		"text":        starlark.String(n.Text),
+		"media_type":  starlark.String(n.MediaType),
+		"is_group":    starlark.Bool(strings.HasSuffix(n.ChatJID, "@g.us")),
+		"timestamp":   starlark.MakeInt64(n.Timestamp),
+	})
+}
+
+// scriptSend: send(to, text, reply_to="") returns the send result as a dict.
+func (s *rpcServer) scriptSend(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var to, text, replyTo string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "to", &to, "text", &text, "reply_to?", &replyTo); err != nil {
+		return nil, err
+	}
+	return s.scriptCall("send", map[string]any{"to": to, "text": text, "reply_to": replyTo})
+}
+
+// scriptMarkRead: mark_read(chat, before="", up_to="") returns the result as a dict.
+func (s *rpcServer) scriptMarkRead(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var chat, before, upTo string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "chat", &chat, "before?", &before, "up_to?", &upTo); err != nil {
+		return nil, err
+	}
+	return s.scriptCall("mark-read", map[string]any{"chat": chat, "before": before, "up_to": upTo})
+}
+
+// scriptDownload: download(message_id, chat="") returns the saved file's path.
+func (s *rpcServer) scriptDownload(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var messageID, chat string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "message_id", &messageID, "chat?", &chat); err != nil {
+		return nil, err
+	}
+	result, err := s.scriptCall("download", map[string]any{"message_id": messageID, "chat": chat})
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := result.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("%s: unexpected result %s", b.Name(), result)
+	}
+	file, _, _ := dict.Get(starlark.String("file"))
+	path, ok := file.(starlark.String)
+	if !ok {
+		return nil, fmt.Errorf("%s: no file in result %s", b.Name(), result)
+	}
+	return path, nil
+}
+
+// scriptCall runs an RPC method for the script, with the same checks as the
+// control socket, and converts its result to Starlark.
+func (s *rpcServer) scriptCall(method string, params map[string]any) (starlark.Value, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.call(method, raw)
+	if err != nil {
+		return nil, err
+	}
+	// Round-trip through JSON so the result is made of plain maps and lists
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var plain any
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return nil, err
+	}
+	return toStarlark(plain), nil
+}
+
+// toStarlark converts a decoded JSON value to Starlark.
+func toStarlark(v any) starlark.Value {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(v)
+	case float64:
+		if v == float64(int64(v)) {
+			return starlark.MakeInt64(int64(v))
+		}
+		return starlark.Float(v)
+	case string:
+		return starlark.String(v)
+	case []any:
+		list := make([]starlark.Value, len(v))
+		for i, item := range v {
+			list[i] = toStarlark(item)
+		}
+		return starlark.NewList(list)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, k := range keys {
+			_ = dict.SetKey(starlark.String(k), toStarlark(v[k]))
+		}
+		return dict
+	default:
+		return starlark.String(fmt.Sprint(v))
+	}
+}
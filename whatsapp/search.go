@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// snippetContext is how many characters of text a search snippet keeps on
+// each side of the first match.
+const snippetContext = 40
+
+// searchSnippet returns the fragment of text around the first match of query
+// (ignoring accents and case), trimmed to word boundaries and marked with "…"
+// where cut, and the [start, end) offsets of each match within it, so
+// consumers can highlight matches without the whole text. Offsets count
+// Unicode code points (runes), not bytes or UTF-16 units.
+//
+// search matches substrings of search_text with LIKE rather than FTS5 tokens,
+// so "caf" finds "café" and no index has to be kept; FTS5's snippet() isn't
+// available without an FTS5 match, hence cutting the fragment here.
+func searchSnippet(text, query string) (string, [][2]int) {
+	runes := []rune(text)
+	matches := findFolded(runes, []rune(query))
+	if len(matches) == 0 {
+		return "", nil
+	}
+
+	start := matches[0][0] - snippetContext
+	if start <= 0 {
+		start = 0
+	} else {
+		// Start at the next word rather than mid-word
+		for i := start; i < matches[0][0]; i++ {
+			if unicode.IsSpace(runes[i]) {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := matches[0][1] + snippetContext
+	if end >= len(runes) {
+		end = len(runes)
+	} else {
+		for i := end; i > matches[0][1]; i-- {
+			if unicode.IsSpace(runes[i]) {
+				end = i
+				break
+			}
+		}
+	}
+
+	// Newlines become spaces one for one, keeping the offsets simple
+	fragment := make([]rune, 0, end-start+2)
+	if start > 0 {
+		fragment = append(fragment, '…')
+	}
+	for _, r := range runes[start:end] {
+		if unicode.IsSpace(r) {
+			r = ' '
+		}
+		fragment = append(fragment, r)
+	}
+	if end < len(runes) {
+		fragment = append(fragment, '…')
+	}
+
+	shift := start
+	if start > 0 {
+		shift-- // The leading "…"
+	}
+	offsets := [][2]int{}
+	for _, m := range matches {
+		if m[0] >= start && m[1] <= end {
+			offsets = append(offsets, [2]int{m[0] - shift, m[1] - shift})
+		}
+	}
+	return string(fragment), offsets
+}
+
+// findFolded returns the [start, end) rune offsets in text of the
+// non-overlapping occurrences of query, compared folded as by searchText.
+func findFolded(text, query []rune) [][2]int {
+	foldedQuery, _ := foldRunes(query)
+	if len(foldedQuery) == 0 {
+		return nil
+	}
+	folded, origin := foldRunes(text)
+	var matches [][2]int
+	for i := 0; i+len(foldedQuery) <= len(folded); i++ {
+		if string(folded[i:i+len(foldedQuery)]) == string(foldedQuery) {
+			matches = append(matches, [2]int{origin[i], origin[i+len(foldedQuery)-1] + 1})
+			i += len(foldedQuery) - 1
+		}
+	}
+	return matches
+}
+
+// searchText folds text for search, stored as messages.search_text: accents
+// are stripped and case folded, so "cafe" finds "Café", "strasse" finds
+// "Straße" and "istanbul" finds "İstanbul".
+func searchText(text string) string {
+	folded, _ := foldRunes([]rune(text))
+	return string(folded)
+}
+
+// foldRunes folds each rune of text, returning the folded runes and, for
+// each, the index of the rune in text it came from.
+func foldRunes(text []rune) (folded []rune, origin []int) {
+	folded = make([]rune, 0, len(text))
+	origin = make([]int, 0, len(text))
+	for i, r := range text {
+		if r <= unicode.MaxASCII {
+			folded = append(folded, unicode.ToLower(r))
+			origin = append(origin, i)
+			continue
+		}
+		// Decompose, so accents become combining marks that can be dropped
+		for _, d := range norm.NFD.String(string(r)) {
+			if unicode.Is(unicode.Mn, d) {
+				continue
+			}
+			var replacement string
+			switch d = unicode.ToLower(d); d {
+			case 'ß':
+				replacement = "ss"
+			case 'ı': // Turkish dotless i
+				replacement = "i"
+			default:
+				replacement = string(d)
+			}
+			for _, f := range replacement {
+				folded = append(folded, f)
+				origin = append(origin, i)
+			}
+		}
+	}
+	return folded, origin
+}
+
+// backfillSearchText fills in search_text for messages saved before the
+// column existed.
+func backfillSearchText(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT rowid, text FROM messages WHERE text IS NOT NULL AND text != ''`)
+	if err != nil {
+		return err
+	}
+	type message struct {
+		rowid int64
+		text  string
+	}
+	var messages []message
+	for rows.Next() {
+		var m message
+		if err := rows.Scan(&m.rowid, &m.text); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		messages = append(messages, m)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if _, err := tx.Exec(`UPDATE messages SET search_text = ? WHERE rowid = ?`, searchText(m.text), m.rowid); err != nil {
+			return err
+		}
+	}
+	if len(messages) > 0 {
+		fmt.Fprintf(os.Stderr, "Indexed %d messages for search\n", len(messages))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchText(t *testing.T) {
+	tests := map[string]string{
+		"Café au LAIT": "cafe au lait",
+		"Straße":       "strasse",
+		"İstanbul":     "istanbul",
+		"naïve résumé": "naive resume",
+		"100% sure_":   "100% sure_",
+	}
+	for in, want := range tests {
+		if got := searchText(in); got != want {
+			t.Errorf("searchText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := strings.Repeat("word ", 20)
+	tests := []struct {
+		name, text, query string
+		snippet           string
+		offsets           [][2]int
+	}{
+		{"no match", "hello world", "bye", "", nil},
+		{"whole short text", "Lunch at noon?", "noon", "Lunch at noon?", [][2]int{{9, 13}}},
+		{"every match", "ab ab ab", "ab", "ab ab ab", [][2]int{{0, 2}, {3, 5}, {6, 8}}},
+		{"accents and case", "Meet at the Café", "cafe", "Meet at the Café", [][2]int{{12, 16}}},
+		// "ß" folds to "ss", so a match can cover fewer runes than the query
+		{"folding changes length", "Hauptstraße 5", "strasse", "Hauptstraße 5", [][2]int{{5, 11}}},
+		// Offsets count runes: the emoji would be two UTF-16 units and four bytes
+		{"offsets in runes", "🎉 party time", "party", "🎉 party time", [][2]int{{2, 7}}},
+		{"newlines become spaces", "one\ntwo", "two", "one two", [][2]int{{4, 7}}},
+		{
+			"cut at words on both sides",
+			long + "needle " + long,
+			"needle",
+			"…word word word word word word word needle word word word word word word word word…",
+			[][2]int{{36, 42}},
+		},
+	}
+	for _, tt := range tests {
+		snippet, offsets := searchSnippet(tt.text, tt.query)
+		if snippet != tt.snippet {
+			t.Errorf("%s: snippet = %q, want %q", tt.name, snippet, tt.snippet)
+		}
+		if !slices.Equal(offsets, tt.offsets) {
+			t.Errorf("%s: offsets = %v, want %v", tt.name, offsets, tt.offsets)
+		}
+		for _, o := range offsets {
+			if got := []rune(snippet)[o[0]:o[1]]; searchText(string(got)) != searchText(tt.query) {
+				t.Errorf("%s: offsets %v cover %q, not the query", tt.name, o, string(got))
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// vcardPattern matches one vCard in a .vcf file, which may hold several.
+var vcardPattern = regexp.MustCompile(`(?is)BEGIN:VCARD\r?\n.*?END:VCARD`)
+
+// cmdSendContact sends a contact card, either from a .vcf file or built from
+// --name and --phone. A file with several vCards is sent as one contacts message.
+// Usage: send-contact <recipient> --vcf FILE | --name NAME --phone NUMBER
+func cmdSendContact(args []string) error {
+	usage := fmt.Errorf("usage: send-contact <recipient> --vcf FILE | --name NAME --phone NUMBER")
+	var vcfPath, name, phone string
+	var positionalArgs []string
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			positionalArgs = append(positionalArgs, args[i])
+			continue
+		}
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return usage
+			}
+			value = args[i+1]
+			i++
+		}
+		switch flag {
+		case "--vcf":
+			vcfPath = value
+		case "--name":
+			name = value
+		case "--phone":
+			phone = value
+		default:
+			return fmt.Errorf("unknown option: %s", flag)
+		}
+	}
+	if len(positionalArgs) != 1 {
+		return usage
+	}
+	if vcfPath != "" && (name != "" || phone != "") {
+		return fmt.Errorf("use either --vcf or --name/--phone, not both")
+	}
+
+	var cards []string
+	switch {
+	case vcfPath != "":
+		data, err := os.ReadFile(vcfPath)
+		if err != nil {
+			return fmt.Errorf("failed to read vCard file: %w", err)
+		}
+		cards = vcardPattern.FindAllString(string(data), -1)
+		if len(cards) == 0 {
+			return fmt.Errorf("no vCard found in %s", vcfPath)
+		}
+	case name != "" && phone != "":
+		card, err := buildVCard(name, phone)
+		if err != nil {
+			return err
+		}
+		cards = []string{card}
+	default:
+		return usage
+	}
+
+	jid, err := parseJID(positionalArgs[0])
+	if err != nil {
+		return err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return err
+	}
+
+	contacts := make([]*waE2E.ContactMessage, len(cards))
+	names := make([]string, len(cards))
+	for i, card := range cards {
+		names[i] = vcardDisplayName(card)
+		contacts[i] = &waE2E.ContactMessage{DisplayName: &names[i], Vcard: &cards[i]}
+	}
+	msg := &waE2E.Message{ContactMessage: contacts[0]}
+	if len(contacts) > 1 {
+		displayName := fmt.Sprintf("%d contacts", len(contacts))
+		msg = &waE2E.Message{ContactsArrayMessage: &waE2E.ContactsArrayMessage{
+			DisplayName: &displayName,
+			Contacts:    contacts,
+		}}
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	resp, err := client.SendMessage(ctx, jid, withDisappearingTimer(ctx, jid, msg))
+	if err != nil {
+		return fmt.Errorf("failed to send contact: %w", err)
+	}
+	recordSent("send-contact", jid.String(), resp)
+
+	return printJSON(map[string]any{
+		"success":   true,
+		"id":        resp.ID,
+		"timestamp": resp.Timestamp.Unix(),
+		"recipient": jid.String(),
+		"contacts":  names,
+	})
+}
+
+// buildVCard builds a vCard for one phone number. The waid parameter is what
+// makes WhatsApp show "Message" and "Add contact" buttons on the card.
+func buildVCard(name, phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if digits == "" {
+		return "", fmt.Errorf("--phone must be a phone number in international format: %s", phone)
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`).Replace(name)
+	return fmt.Sprintf("BEGIN:VCARD\nVERSION:3.0\nFN:%s\nTEL;type=CELL;waid=%s:+%s\nEND:VCARD", escaped, digits, digits), nil
+}
+
+// vcardDisplayName returns a vCard's formatted name (FN), falling back to the
+// structured name (N) and then its first phone number.
+func vcardDisplayName(card string) string {
+	// Unfold continuation lines (RFC 6350 3.2)
+	card = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(card)
+	fields := map[string]string{}
+	for _, line := range strings.Split(card, "\n") {
+		key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+		key, _, _ = strings.Cut(strings.ToUpper(key), ";")
+		// Grouped properties look like item1.TEL
+		if _, k, grouped := strings.Cut(key, "."); grouped {
+			key = k
+		}
+		if _, seen := fields[key]; !seen {
+			fields[key] = value
+		}
+	}
+	unescape := strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`)
+	if fn := strings.TrimSpace(unescape.Replace(fields["FN"])); fn != "" {
+		return fn
+	}
+	if n := fields["N"]; n != "" {
+		// N is family;given;additional;prefix;suffix
+		parts := strings.Split(n, ";")
+		if len(parts) > 1 {
+			parts[0], parts[1] = parts[1], parts[0]
+		}
+		if s := strings.Join(strings.Fields(unescape.Replace(strings.Join(parts, " "))), " "); s != "" {
+			return s
+		}
+	}
+	if tel := strings.TrimSpace(fields["TEL"]); tel != "" {
+		return tel
+	}
+	return "Contact"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// cmdStar stars or unstars a message on every device.
+// Usage: star|unstar <message-id> [--chat=JID]
+func cmdStar(args []string, starred bool) error {
+	command := "star"
+	if !starred {
+		command = "unstar"
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("usage: %s <message-id> [--chat=JID]", command)
+	}
+	messageID := args[0]
+	var chatJID string
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "--chat=") {
+			chatJID = strings.TrimPrefix(arg, "--chat=")
+		} else {
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	messageID, chatJID, err := resolveMessage(messageID, chatJID)
+	if err != nil {
+		return err
+	}
+	var senderJID string
+	var isFromMe int
+	if err := messageDB.QueryRow(`SELECT sender_jid, is_from_me FROM messages WHERE id = ? AND chat_jid = ?`,
+		messageID, chatJID).Scan(&senderJID, &isFromMe); err != nil {
+		return fmt.Errorf("failed to look up message: %w", err)
+	}
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return fmt.Errorf("invalid chat JID: %w", err)
+	}
+	// Only incoming group messages are keyed by their sender
+	sender := chat
+	if chat.Server == types.GroupServer && isFromMe == 0 {
+		if sender, err = types.ParseJID(senderJID); err != nil {
+			return fmt.Errorf("invalid sender JID: %w", err)
+		}
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.SendAppState(ctx, appstate.BuildStar(chat, sender, messageID, isFromMe == 1, starred)); err != nil {
+		return fmt.Errorf("failed to %s message: %w", command, err)
+	}
+	if err := setStarred(messageDB, messageID, chatJID, starred); err != nil {
+		return fmt.Errorf("failed to save star: %w", err)
+	}
+
+	return printJSON(map[string]any{
+		"success":    true,
+		"message_id": messageID,
+		"chat_jid":   chatJID,
+		"starred":    starred,
+	})
+}
+
+// setStarred records whether a stored message is starred.
+func setStarred(db dbWriter, messageID, chatJID string, starred bool) error {
+	_, err := db.Exec(`UPDATE messages SET is_starred = ? WHERE id = ? AND chat_jid = ?`,
+		boolToInt(starred), messageID, canonicalJID(normalizeJID(chatJID)))
+	return err
+}
+
+// saveStarEvent records a message being starred or unstarred on another device.
+func saveStarEvent(evt *events.Star) error {
+	return setStarred(messageDB, evt.MessageID, evt.ChatJID.String(), evt.Action.GetStarred())
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cmdStats summarizes stored messages: how many per chat, per sender, per hour
+// of the day (local time), and per media type, for dashboards and "who talks
+// most here" questions. --max-results bounds the chat and sender lists.
+// Usage: stats [--chat=JID] [--since=TIME] [--max-results=N]
+func cmdStats(args []string) error {
+	var chatArg string
+	var since time.Time
+	limit := 20
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("usage: stats [--chat=JID] [--since=TIME] [--max-results=N]")
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--chat":
+			chatArg = value
+		case "--since":
+			t, err := parseTimeBound(value)
+			if err != nil {
+				return fmt.Errorf("--since: %w", err)
+			}
+			since = t
+		case "--max-results":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("--max-results must be a positive number")
+			}
+			limit = n
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	// Every query shares the filter
+	where := ` WHERE m.timestamp >= ?`
+	var cutoff int64
+	if !since.IsZero() {
+		cutoff = since.Unix()
+	}
+	filterArgs := []any{cutoff}
+	output := map[string]any{}
+	if chatArg != "" {
+		jid, err := parseJID(chatArg)
+		if err != nil {
+			return err
+		}
+		chatJID := canonicalJID(normalizeJID(jid.String()))
+		where += ` AND m.chat_jid = ?`
+		filterArgs = append(filterArgs, chatJID)
+		output["chat_jid"] = chatJID
+		if name := chatDisplayName(chatJID); name != "" {
+			output["chat_name"] = name
+		}
+	}
+	if cutoff > 0 {
+		output["since"] = cutoff
+	}
+
+	var total int64
+	var first, last sql.NullInt64
+	if err := messageDB.QueryRow(`SELECT COUNT(*), MIN(m.timestamp), MAX(m.timestamp) FROM messages m`+where,
+		filterArgs...).Scan(&total, &first, &last); err != nil {
+		return fmt.Errorf("failed to count messages: %w", err)
+	}
+	output["messages"] = total
+	if first.Valid {
+		output["first_message"] = first.Int64
+		output["last_message"] = last.Int64
+	}
+
+	byChat := []map[string]any{}
+	err := queryStats(`
+		SELECT m.chat_jid, COUNT(*), SUM(m.is_from_me) FROM messages m`+where+`
+		GROUP BY m.chat_jid ORDER BY COUNT(*) DESC, m.chat_jid LIMIT ?
+	`, append(filterArgs, limit), func(rows *sql.Rows) error {
+		var chatJID string
+		var count, fromMe int64
+		if err := rows.Scan(&chatJID, &count, &fromMe); err != nil {
+			return err
+		}
+		chat := map[string]any{"chat_jid": chatJID, "messages": count, "from_me": fromMe}
+		if name := chatDisplayName(chatJID); name != "" {
+			chat["chat_name"] = name
+		}
+		byChat = append(byChat, chat)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if chatArg == "" {
+		output["by_chat"] = byChat
+	}
+
+	bySender := []map[string]any{}
+	err = queryStats(`
+		SELECT m.sender_jid, MAX(m.is_from_me),
+			COALESCE(NULLIF(ct.name, ''), NULLIF(ct.push_name, ''), MAX(NULLIF(m.sender_name, '')), ''),
+			COUNT(*)
+		FROM messages m
+		LEFT JOIN contacts ct ON ct.jid = m.sender_jid`+where+`
+		GROUP BY m.sender_jid ORDER BY COUNT(*) DESC, m.sender_jid LIMIT ?
+	`, append(filterArgs, limit), func(rows *sql.Rows) error {
+		var senderJID, name string
+		var isFromMe int
+		var count int64
+		if err := rows.Scan(&senderJID, &isFromMe, &name, &count); err != nil {
+			return err
+		}
+		sender := map[string]any{"sender_jid": senderJID, "messages": count}
+		if isFromMe == 1 {
+			sender["is_from_me"] = true
+		}
+		if name != "" {
+			sender["sender_name"] = name
+		}
+		bySender = append(bySender, sender)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	output["by_sender"] = bySender
+
+	byHour := make([]int64, 24)
+	err = queryStats(`
+		SELECT CAST(strftime('%H', m.timestamp, 'unixepoch', 'localtime') AS INTEGER), COUNT(*)
+		FROM messages m`+where+` GROUP BY 1
+	`, filterArgs, func(rows *sql.Rows) error {
+		var hour int
+		var count int64
+		if err := rows.Scan(&hour, &count); err != nil {
+			return err
+		}
+		if hour >= 0 && hour < 24 {
+			byHour[hour] = count
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	output["by_hour"] = byHour
+
+	byMediaType := map[string]int64{}
+	err = queryStats(`
+		SELECT COALESCE(NULLIF(m.media_type, ''), 'text'), COUNT(*) FROM messages m`+where+` GROUP BY 1
+	`, filterArgs, func(rows *sql.Rows) error {
+		var mediaType string
+		var count int64
+		if err := rows.Scan(&mediaType, &count); err != nil {
+			return err
+		}
+		byMediaType[mediaType] = count
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	output["by_media_type"] = byMediaType
+
+	return printJSON(output)
+}
+
+// queryStats runs a stats query, calling scan for each row.
+func queryStats(query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := messageDB.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query stats: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return nil
+}
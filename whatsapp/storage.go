@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// thumbnailDir is where preview thumbnails are kept, inside the media directory.
+func thumbnailDir() string {
+	return filepath.Join(mediaDir(), "thumbnails")
+}
+
+// sqliteFileSize returns the size of a SQLite database including its WAL and
+// shared-memory files, which can be much larger than the main file.
+func sqliteFileSize(path string) int64 {
+	var total int64
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if info, err := os.Stat(path + suffix); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// dirUsage returns the total size and file count under dir, skipping any
+// subdirectories listed in exclude.
+func dirUsage(dir string, exclude ...string) (size int64, files int) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Missing or unreadable entries count as empty
+		}
+		if d.IsDir() {
+			for _, ex := range exclude {
+				if filepath.Clean(path) == filepath.Clean(ex) {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
+
+// cmdDu reports disk usage by database, media, and thumbnails, plus the chats
+// using the most media storage.
+// Usage: du [--max-results=N]
+func cmdDu(args []string) error {
+	limit := 10
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--max-results=") {
+			_, _ = fmt.Sscanf(strings.TrimPrefix(arg, "--max-results="), "%d", &limit)
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	messagesDBSize := sqliteFileSize(filepath.Join(dataDir, "messages.db"))
+	sessionDBSize := sqliteFileSize(filepath.Join(configDir, "session.db"))
+	mediaSize, mediaFiles := dirUsage(mediaDir(), thumbnailDir())
+	thumbSize, thumbFiles := dirUsage(thumbnailDir())
+
+	// Per-chat media usage. A file shared by several messages in one chat counts
+	// once for that chat; a file shared across chats counts toward each of them.
+	rows, err := messageDB.Query(`
+		SELECT DISTINCT chat_jid, media_file_path FROM messages
+		WHERE media_file_path IS NOT NULL AND media_file_path != ''
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query media files: %w", err)
+	}
+	type chatUsage struct {
+		jid        string
+		mediaBytes int64
+		mediaFiles int
+	}
+	usage := map[string]*chatUsage{}
+	fileSizes := map[string]int64{}
+	for rows.Next() {
+		var chatJID, path string
+		if err := rows.Scan(&chatJID, &path); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		size, ok := fileSizes[path]
+		if !ok {
+			if info, err := os.Stat(path); err == nil {
+				size = info.Size()
+			} else {
+				size = -1 // Recorded but missing on disk
+			}
+			fileSizes[path] = size
+		}
+		if size < 0 {
+			continue
+		}
+		u := usage[chatJID]
+		if u == nil {
+			u = &chatUsage{jid: chatJID}
+			usage[chatJID] = u
+		}
+		u.mediaBytes += size
+		u.mediaFiles++
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	ranked := make([]*chatUsage, 0, len(usage))
+	for _, u := range usage {
+		ranked = append(ranked, u)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].mediaBytes != ranked[j].mediaBytes {
+			return ranked[i].mediaBytes > ranked[j].mediaBytes
+		}
+		return ranked[i].jid < ranked[j].jid
+	})
+	if limit >= 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	largest := []map[string]any{}
+	for _, u := range ranked {
+		var messageCount int64
+		_ = messageDB.QueryRow(`SELECT COUNT(*) FROM messages WHERE chat_jid = ?`, u.jid).Scan(&messageCount)
+		name := chatDisplayName(u.jid)
+		chat := map[string]any{
+			"chat_jid":    u.jid,
+			"media_bytes": u.mediaBytes,
+			"media_files": u.mediaFiles,
+			"messages":    messageCount,
+		}
+		if name != "" {
+			chat["chat_name"] = name
+		}
+		largest = append(largest, chat)
+	}
+
+	output := map[string]any{
+		"databases": map[string]any{
+			"messages_bytes": messagesDBSize,
+			"session_bytes":  sessionDBSize,
+		},
+		"media": map[string]any{
+			"dir":   mediaDir(),
+			"bytes": mediaSize,
+			"files": mediaFiles,
+		},
+		"thumbnails": map[string]any{
+			"bytes": thumbSize,
+			"files": thumbFiles,
+		},
+		"total_bytes":   messagesDBSize + sessionDBSize + mediaSize + thumbSize,
+		"largest_chats": largest,
+	}
+	return printJSON(output)
+}
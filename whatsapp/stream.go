@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Commands that can list a whole chat (messages, search, export) write each
+// message as soon as it's scanned rather than collecting them for printJSON,
+// so their memory use doesn't grow with the chat. The JSON is laid out exactly
+// as printJSON would lay out the same value.
+
+// outputStream is stdout, or the --output file, written through a temp file
+// that commit renames into place so readers never see a partial file.
+type outputStream struct {
+	*bufio.Writer
+	path string
+	tmp  *os.File
+}
+
+// newOutputStream opens path for writing, or stdout if path is empty.
+func newOutputStream(path string) (*outputStream, error) {
+	if path == "" {
+		return &outputStream{Writer: bufio.NewWriter(os.Stdout)}, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	_ = tmp.Chmod(0644) // CreateTemp uses 0600
+	return &outputStream{Writer: bufio.NewWriter(tmp), path: path, tmp: tmp}, nil
+}
+
+// commit flushes the output and moves a file into place.
+func (s *outputStream) commit() error {
+	if err := s.Flush(); err != nil {
+		s.abort()
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if s.tmp == nil {
+		return nil
+	}
+	defer func() { _ = os.Remove(s.tmp.Name()) }() // No-op after a successful rename
+	if err := s.tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Rename(s.tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", s.path)
+	return nil
+}
+
+// abort discards a file output. It's a no-op after commit, and for stdout,
+// where anything already written stays written.
+func (s *outputStream) abort() {
+	if s.tmp != nil {
+		_ = s.tmp.Close()
+		_ = os.Remove(s.tmp.Name())
+	}
+}
+
+// isTableOutput reports whether writeOutputFile renders path as a table,
+// which needs every row's columns before writing the header.
+func isTableOutput(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// jsonArray writes a JSON array an element at a time, indented as it would
+// be nested under indent.
+type jsonArray struct {
+	w      io.Writer
+	indent string
+	n      int
+}
+
+func (a *jsonArray) add(v any) error {
+	data, err := json.MarshalIndent(v, a.indent+"  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := "[\n"
+	if a.n > 0 {
+		sep = ",\n"
+	}
+	a.n++
+	_, err = fmt.Fprintf(a.w, "%s%s  %s", sep, a.indent, data)
+	return err
+}
+
+func (a *jsonArray) close() error {
+	if a.n == 0 {
+		_, err := io.WriteString(a.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintf(a.w, "\n%s]", a.indent)
+	return err
+}
+
+// listStream prints a list to the --output file or stdout, like printJSON:
+// as a bare array, or with fields, as an object of the fields and the list
+// under key. Table outputs are collected and rendered at the end.
+type listStream struct {
+	key    string
+	fields map[string]any
+	out    *outputStream
+	list   jsonArray
+	items  []map[string]any // Table outputs only
+}
+
+func newListStream(key string, fields map[string]any) (*listStream, error) {
+	s := &listStream{key: key, fields: fields}
+	if isTableOutput(outputFile) {
+		s.items = []map[string]any{}
+		return s, nil
+	}
+	out, err := newOutputStream(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	s.out = out
+	s.list.w = out
+	if fields != nil {
+		// Keys are written in sorted order, as encoding/json writes a map
+		s.list.indent = "  "
+		_, _ = out.WriteString("{\n")
+		for _, k := range s.fieldKeys(func(k string) bool { return k < key }) {
+			if err := s.writeField(k); err != nil {
+				return nil, err
+			}
+			_, _ = out.WriteString(",\n")
+		}
+		name, _ := json.Marshal(key)
+		_, _ = fmt.Fprintf(out, "  %s: ", name)
+	}
+	return s, nil
+}
+
+func (s *listStream) fieldKeys(keep func(string) bool) []string {
+	var keys []string
+	for _, k := range slices.Sorted(maps.Keys(s.fields)) {
+		if keep(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *listStream) writeField(k string) error {
+	name, _ := json.Marshal(k)
+	value, err := json.MarshalIndent(s.fields[k], "  ", "  ")
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(s.out, "  %s: %s", name, value)
+	return nil
+}
+
+func (s *listStream) add(item map[string]any) error {
+	if s.out == nil {
+		s.items = append(s.items, item)
+		return nil
+	}
+	return s.list.add(item)
+}
+
+// close finishes the output. Write errors surface here.
+func (s *listStream) close() error {
+	if s.out == nil {
+		if s.fields == nil {
+			return printJSON(s.items)
+		}
+		output := maps.Clone(s.fields)
+		output[s.key] = s.items
+		return printJSON(output)
+	}
+	_ = s.list.close()
+	if s.fields != nil {
+		for _, k := range s.fieldKeys(func(k string) bool { return k > s.key }) {
+			_, _ = s.out.WriteString(",\n")
+			if err := s.writeField(k); err != nil {
+				s.out.abort()
+				return err
+			}
+		}
+		_, _ = s.out.WriteString("\n}")
+	}
+	_, _ = s.out.WriteString("\n")
+	return s.out.commit()
+}
+
+// abort discards a file output; see outputStream.abort.
+func (s *listStream) abort() {
+	if s.out != nil {
+		s.out.abort()
+	}
+}
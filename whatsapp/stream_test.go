@@ -0,0 +1,65 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A streamed list must read exactly as printJSON would print it.
+func TestListStreamMatchesPrintJSON(t *testing.T) {
+	oldOutputFile := outputFile
+	t.Cleanup(func() { outputFile = oldOutputFile })
+	dir := t.TempDir()
+
+	items := []map[string]any{
+		{"id": "M1", "text": "Café <b>&</b>", "reactions": []map[string]any{{"emoji": "👍"}}},
+		{"id": "M2", "text": nil},
+	}
+	fields := map[string]any{"_status": map[string]any{"authenticated": true}, "count": 2, "more": false}
+	tests := []struct {
+		name   string
+		fields map[string]any
+		items  []map[string]any
+	}{
+		{"bare list", nil, items},
+		{"empty bare list", nil, nil},
+		{"fields on both sides of the list", fields, items},
+		{"fields around an empty list", fields, nil},
+	}
+	for _, ext := range []string{".json", ".csv"} {
+		for _, tt := range tests {
+			outputFile = filepath.Join(dir, "want"+ext)
+			var want any = append([]map[string]any{}, tt.items...)
+			if tt.fields != nil {
+				output := maps.Clone(tt.fields)
+				output["messages"] = want
+				want = output
+			}
+			if err := printJSON(want); err != nil {
+				t.Fatalf("%s%s: printJSON: %v", tt.name, ext, err)
+			}
+
+			outputFile = filepath.Join(dir, "got"+ext)
+			s, err := newListStream("messages", tt.fields)
+			if err != nil {
+				t.Fatalf("%s%s: newListStream: %v", tt.name, ext, err)
+			}
+			for _, item := range tt.items {
+				if err := s.add(item); err != nil {
+					t.Fatalf("%s%s: add: %v", tt.name, ext, err)
+				}
+			}
+			if err := s.close(); err != nil {
+				t.Fatalf("%s%s: close: %v", tt.name, ext, err)
+			}
+
+			wantData, _ := os.ReadFile(filepath.Join(dir, "want"+ext))
+			gotData, _ := os.ReadFile(filepath.Join(dir, "got"+ext))
+			if string(gotData) != string(wantData) {
+				t.Errorf("%s%s: streamed\n%s\nwant\n%s", tt.name, ext, gotData, wantData)
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// maxThreadDepth bounds reply chain walks, in case of cycles in stored data.
+const maxThreadDepth = 1000
+
+// threadRoot follows reply_to_id from a message up to the oldest stored
+// ancestor in the same chat.
+func threadRoot(messageID, chatJID string) (string, error) {
+	var root string
+	err := messageDB.QueryRow(`
+		WITH RECURSIVE up(id, reply_to_id, n) AS (
+			SELECT id, reply_to_id, 0 FROM messages WHERE id = ? AND chat_jid = ?
+			UNION ALL
+			SELECT m.id, m.reply_to_id, up.n + 1
+			FROM messages m JOIN up ON m.id = up.reply_to_id AND m.chat_jid = ?
+			WHERE up.n < ?
+		)
+		SELECT id FROM up ORDER BY n DESC LIMIT 1
+	`, messageID, chatJID, chatJID, maxThreadDepth).Scan(&root)
+	return root, err
+}
+
+// threadQuery selects a thread's messages, oldest first, given the root ID,
+// chat, maxThreadDepth and chat again, with each message's depth below the
+// root. Rows differ by depth, so a cycle is only cut off by the depth limit;
+// GROUP BY keeps one row per message.
+const threadQuery = `
+	WITH RECURSIVE down(id, depth) AS (
+		SELECT ?, 0
+		UNION ALL
+		SELECT m.id, down.depth + 1
+		FROM messages m JOIN down ON m.reply_to_id = down.id
+		WHERE m.chat_jid = ? AND down.depth < ?
+	)
+	SELECT m.id, m.sender_jid, m.sender_name, m.timestamp, m.text, m.media_type, m.is_from_me,
+		m.reply_to_id, MIN(down.depth)
+	FROM down JOIN messages m ON m.id = down.id AND m.chat_jid = ?
+	GROUP BY m.id
+	ORDER BY m.timestamp, m.rowid`
+
+// listedThread is the reply thread a listed message belongs to.
+type listedThread struct {
+	root string
+	size int
+}
+
+// listedThreads finds the threads of many messages in two queries, rather
+// than two per message: each message's root, then each root's thread size.
+// Messages that aren't part of a thread (size 1) are left out.
+func listedThreads(keys []messageKey) (map[messageKey]listedThread, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	values := make([]string, len(keys))
+	args := make([]any, 0, 2*len(keys)+1)
+	for i, key := range keys {
+		values[i] = "(?, ?)"
+		args = append(args, key.ID, key.ChatJID)
+	}
+	args = append(args, maxThreadDepth)
+
+	// Walk up from every message at once, keeping the furthest ancestor
+	rows, err := messageDB.Query(`
+		WITH RECURSIVE up(start_id, chat_jid, id, reply_to_id, n) AS (
+			SELECT id, chat_jid, id, reply_to_id, 0 FROM messages
+			WHERE (id, chat_jid) IN (VALUES `+strings.Join(values, ", ")+`)
+			UNION ALL
+			SELECT up.start_id, up.chat_jid, m.id, m.reply_to_id, up.n + 1
+			FROM messages m JOIN up ON m.id = up.reply_to_id AND m.chat_jid = up.chat_jid
+			WHERE up.n < ?
+		)
+		SELECT start_id, chat_jid, id, n FROM up
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find thread roots: %w", err)
+	}
+	type ancestor struct {
+		root string
+		n    int
+	}
+	roots := map[messageKey]ancestor{}
+	for rows.Next() {
+		var key messageKey
+		var a ancestor
+		if err := rows.Scan(&key.ID, &key.ChatJID, &a.root, &a.n); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if prev, ok := roots[key]; !ok || a.n > prev.n {
+			roots[key] = a
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	// Then down from every distinct root, counting each thread's messages
+	rootKeys := map[messageKey]bool{}
+	values, args = values[:0], args[:0]
+	for key, a := range roots {
+		rootKey := messageKey{ID: a.root, ChatJID: key.ChatJID}
+		if !rootKeys[rootKey] {
+			rootKeys[rootKey] = true
+			values = append(values, "(?, ?)")
+			args = append(args, rootKey.ID, rootKey.ChatJID)
+		}
+	}
+	args = append(args, maxThreadDepth)
+	rows, err = messageDB.Query(`
+		WITH RECURSIVE down(root, chat_jid, id, depth) AS (
+			SELECT id, chat_jid, id, 0 FROM messages
+			WHERE (id, chat_jid) IN (VALUES `+strings.Join(values, ", ")+`)
+			UNION ALL
+			SELECT down.root, down.chat_jid, m.id, down.depth + 1
+			FROM messages m JOIN down ON m.reply_to_id = down.id AND m.chat_jid = down.chat_jid
+			WHERE down.depth < ?
+		)
+		SELECT root, chat_jid, COUNT(DISTINCT id) FROM down GROUP BY root, chat_jid
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count thread messages: %w", err)
+	}
+	sizes := map[messageKey]int{}
+	for rows.Next() {
+		var rootKey messageKey
+		var size int
+		if err := rows.Scan(&rootKey.ID, &rootKey.ChatJID, &size); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		sizes[rootKey] = size
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	threads := map[messageKey]listedThread{}
+	for key, a := range roots {
+		if size := sizes[messageKey{ID: a.root, ChatJID: key.ChatJID}]; size > 1 {
+			threads[key] = listedThread{root: a.root, size: size}
+		}
+	}
+	return threads, nil
+}
+
+// cmdThread prints the whole reply thread a message belongs to: from the
+// oldest stored message it (transitively) replies to, through every reply to
+// it and to those replies, in order. If the oldest stored message quotes one
+// that isn't stored, the quote is included as unstored_parent.
+// Usage: thread <message-id> [--chat=JID]
+func cmdThread(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: thread <message-id> [--chat=JID]")
+	}
+	messageID := args[0]
+	var chatJID string
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "--chat=") {
+			chatJID = strings.TrimPrefix(arg, "--chat=")
+		} else {
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	messageID, chatJID, err := resolveMessage(messageID, chatJID)
+	if err != nil {
+		return err
+	}
+	root, err := threadRoot(messageID, chatJID)
+	if err != nil {
+		return fmt.Errorf("failed to find thread root: %w", err)
+	}
+
+	rows, err := messageDB.Query(threadQuery, root, chatJID, maxThreadDepth, chatJID)
+	if err != nil {
+		return fmt.Errorf("failed to query thread: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	messages := []map[string]any{}
+	var keys []messageKey
+	for rows.Next() {
+		var id, senderJID string
+		var senderName, text, mediaType, replyToID sql.NullString
+		var timestamp int64
+		var isFromMe, depth int
+		if err := rows.Scan(&id, &senderJID, &senderName, &timestamp, &text, &mediaType, &isFromMe, &replyToID, &depth); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		msg := map[string]any{
+			"id":         id,
+			"sender_jid": senderJID,
+			"timestamp":  timestamp,
+			"is_from_me": isFromMe == 1,
+			"depth":      depth,
+		}
+		if senderName.Valid && senderName.String != "" {
+			msg["sender_name"] = senderName.String
+		}
+		if text.Valid {
+			msg["text"] = text.String
+		}
+		if mediaType.Valid && mediaType.String != "" {
+			msg["media_type"] = mediaType.String
+		}
+		if replyToID.Valid && replyToID.String != "" {
+			msg["reply_to_id"] = replyToID.String
+		}
+		messages = append(messages, msg)
+		keys = append(keys, messageKey{ID: id, ChatJID: chatJID})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	assignRefs(messages, keys)
+
+	output := map[string]any{
+		"chat_jid": chatJID,
+		"root_id":  root,
+		"count":    len(messages),
+		"messages": messages,
+	}
+	// A root that quotes a message we never stored (from before the archive,
+	// say) starts the thread mid-conversation; include what the quote preserved
+	var parentID, parentSender, parentText sql.NullString
+	_ = messageDB.QueryRow(`SELECT reply_to_id, reply_to_sender, reply_to_text FROM messages WHERE id = ? AND chat_jid = ?`,
+		root, chatJID).Scan(&parentID, &parentSender, &parentText)
+	if parentID.String != "" {
+		parent := map[string]any{"id": parentID.String}
+		if parentSender.String != "" {
+			parent["sender_jid"] = parentSender.String
+		}
+		if parentText.String != "" {
+			parent["text"] = parentText.String
+		}
+		output["unstored_parent"] = parent
+	}
+	return printJSON(output)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestListedThreads(t *testing.T) {
+	openTestDB(t)
+	const chat, other = "120363277025153496@g.us", "12025551234@s.whatsapp.net"
+	// R <- C1 <- C2, R <- C3; L stands alone; X replies to R's ID in another chat
+	insertTestMessage(t, "R", chat, 100, "")
+	insertTestMessage(t, "C1", chat, 110, "R")
+	insertTestMessage(t, "C2", chat, 120, "C1")
+	insertTestMessage(t, "C3", chat, 130, "R")
+	insertTestMessage(t, "L", chat, 140, "")
+	insertTestMessage(t, "X", other, 150, "R")
+	// A reply cycle, as corrupt data could have
+	insertTestMessage(t, "Y1", chat, 160, "Y2")
+	insertTestMessage(t, "Y2", chat, 170, "Y1")
+
+	keys := []messageKey{{"R", chat}, {"C2", chat}, {"C3", chat}, {"L", chat}, {"X", other}, {"Y1", chat}}
+	got, err := listedThreads(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[messageKey]listedThread{
+		{"R", chat}:  {root: "R", size: 4},
+		{"C2", chat}: {root: "R", size: 4},
+		{"C3", chat}: {root: "R", size: 4},
+	}
+	// The cycle has no true root; whichever is chosen, both messages count
+	if th, ok := got[messageKey{"Y1", chat}]; ok {
+		if th.size != 2 {
+			t.Errorf("cycle thread = %+v, want size 2", th)
+		}
+		delete(got, messageKey{"Y1", chat})
+	} else {
+		t.Error("cycle thread missing")
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("listedThreads = %+v, want %+v", got, want)
+	}
+
+	if got, err := listedThreads(nil); err != nil || got != nil {
+		t.Errorf("listedThreads(nil) = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Thumbnails: WhatsApp sends a small inline JPEG with image and video
+// messages. It's saved to thumbnailDir as the message arrives, and made from
+// the file when a download comes without one, so listings can point at a
+// preview without downloading the media. Thumbnails outlive media gc and are
+// only deleted with their messages.
+
+// thumbnailMaxSide is the longest side of thumbnails made from downloads,
+// about the size of the ones WhatsApp sends.
+const thumbnailMaxSide = 100
+
+// thumbnailPath names a message's thumbnail after its media's content hash,
+// so identical media shares one, or after the message if the hash is unknown.
+func thumbnailPath(messageID, chatJID string, fileSHA256 []byte) string {
+	name := hex.EncodeToString(fileSHA256)
+	if len(fileSHA256) == 0 {
+		name = sanitizeFilenamePart(chatJID) + "_" + sanitizeFilenamePart(messageID)
+	}
+	return filepath.Join(thumbnailDir(), name+".jpg")
+}
+
+// saveThumbnail writes the inline thumbnail a message came with, if any, and
+// records it on the message.
+func saveThumbnail(db dbWriter, messageID, chatJID string, media *MediaMetadata) error {
+	if media == nil || len(media.Thumbnail) == 0 {
+		return nil
+	}
+	path := thumbnailPath(messageID, chatJID, media.FileSHA256)
+	if err := writeThumbnail(path, media.Thumbnail); err != nil {
+		return err
+	}
+	_, err := db.Exec(`UPDATE messages SET thumbnail_path = ? WHERE id = ? AND chat_jid = ? AND thumbnail_path IS NULL`,
+		path, messageID, chatJID)
+	return err
+}
+
+// writeThumbnail saves data at path unless a thumbnail is already there.
+func writeThumbnail(path string, data []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// ensureThumbnail makes a thumbnail from a downloaded image or video for a
+// message that has none. Failures only warn, since the download succeeded;
+// formats Go can't decode (e.g. WebP) and videos without ffmpeg are skipped.
+func ensureThumbnail(messageID, chatJID, mediaType, filePath string, fileSHA256 []byte) {
+	baseType := strings.TrimPrefix(mediaType, "viewonce_")
+	if baseType != "image" && baseType != "video" {
+		return
+	}
+	var existing sql.NullString
+	if err := messageDB.QueryRow(`SELECT thumbnail_path FROM messages WHERE id = ? AND chat_jid = ?`,
+		messageID, chatJID).Scan(&existing); err != nil {
+		return
+	}
+	if existing.Valid && existing.String != "" {
+		if _, err := os.Stat(existing.String); err == nil {
+			return
+		}
+	}
+
+	path := thumbnailPath(messageID, chatJID, fileSHA256)
+	if _, err := os.Stat(path); err != nil {
+		var data []byte
+		if baseType == "image" {
+			data, err = imageThumbnail(filePath)
+		} else {
+			data, err = videoThumbnail(filePath)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to make thumbnail for %s: %v\n", messageID, err)
+			return
+		}
+		if data == nil {
+			return
+		}
+		if err := writeThumbnail(path, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save thumbnail: %v\n", err)
+			return
+		}
+	}
+	if _, err := messageDB.Exec(`UPDATE messages SET thumbnail_path = ? WHERE id = ? AND chat_jid = ?`,
+		path, messageID, chatJID); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record thumbnail: %v\n", err)
+	}
+}
+
+// imageThumbnail scales a JPEG, PNG or GIF down to a JPEG thumbnail. It
+// returns nil for other formats.
+func imageThumbnail(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	src, _, err := image.Decode(f)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleDown(src, thumbnailMaxSide), &jpeg.Options{Quality: 75}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown shrinks src to fit in maxSide x maxSide, averaging a few samples
+// from the area behind each pixel: plenty for a thumbnail, and fast on photos.
+func scaleDown(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			dw, dh = maxSide, max(1, h*maxSide/w)
+		} else {
+			dw, dh = max(1, w*maxSide/h), maxSide
+		}
+	}
+
+	const samples = 4 // Per side of each pixel's area
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy += max(1, (y1-y0)/samples) {
+				for sx := x0; sx < x1; sx += max(1, (x1-x0)/samples) {
+					cr, cg, cb, ca := src.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			// Premultiplied 16-bit channels, as RGBA() returns them
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// videoThumbnail grabs a video's first frame as a JPEG thumbnail with ffmpeg.
+// It returns nil if ffmpeg isn't installed.
+func videoThumbnail(filePath string) ([]byte, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, nil
+	}
+	side := strconv.Itoa(thumbnailMaxSide)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-v", "error", "-i", filePath, "-frames:v", "1",
+		"-vf", "scale="+side+":"+side+":force_original_aspect_ratio=decrease",
+		"-f", "image2pipe", "-c:v", "mjpeg", "pipe:1")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// releaseThumbnails deletes thumbnails no message refers to any more, as left
+// by deleting messages. Recent files are kept: their message may be in a
+// history sync transaction that hasn't committed yet.
+func releaseThumbnails() error {
+	recent := time.Now().Add(-time.Hour)
+	referenced := map[string]bool{}
+	rows, err := messageDB.Query(`SELECT DISTINCT thumbnail_path FROM messages WHERE thumbnail_path IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to query thumbnails: %w", err)
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		referenced[filepath.Clean(path)] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return filepath.WalkDir(thumbnailDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || referenced[filepath.Clean(path)] {
+			return nil // A missing directory has nothing to release
+		}
+		if info, err := d.Info(); err != nil || info.ModTime().After(recent) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete thumbnail: %v\n", err)
+		}
+		return nil
+	})
+}
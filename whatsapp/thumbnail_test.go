@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageThumbnail(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name          string
+		width, height int
+		wantW, wantH  int
+	}{
+		{"landscape", 800, 400, 100, 50},
+		{"portrait", 300, 1200, 25, 100},
+		{"already small", 40, 30, 40, 30},
+	}
+	for _, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+		for y := 0; y < tt.height; y++ {
+			for x := 0; x < tt.width; x++ {
+				src.Set(x, y, color.RGBA{200, 100, 50, 255})
+			}
+		}
+		path := filepath.Join(dir, tt.name+".png")
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, src); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := imageThumbnail(path)
+		if err != nil {
+			t.Fatalf("%s: imageThumbnail: %v", tt.name, err)
+		}
+		thumb, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: thumbnail isn't a JPEG: %v", tt.name, err)
+		}
+		if b := thumb.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("%s: thumbnail is %dx%d, want %dx%d", tt.name, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+		}
+		// Averaging samples keeps a flat color, give or take JPEG's rounding
+		if r, g, b, _ := thumb.At(tt.wantW/2, tt.wantH/2).RGBA(); absDiff(r>>8, 200) > 8 || absDiff(g>>8, 100) > 8 || absDiff(b>>8, 50) > 8 {
+			t.Errorf("%s: thumbnail color = %d,%d,%d, want about 200,100,50", tt.name, r>>8, g>>8, b>>8)
+		}
+	}
+
+	// Formats Go can't decode get no thumbnail, and no error
+	path := filepath.Join(dir, "sticker.webp")
+	if err := os.WriteFile(path, []byte("RIFF\x00\x00\x00\x00WEBP"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := imageThumbnail(path); data != nil || err != nil {
+		t.Errorf("imageThumbnail(webp) = %d bytes, %v; want nil, nil", len(data), err)
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// revokeWindow is how long after sending WhatsApp accepts "delete for everyone".
+const revokeWindow = 48 * time.Hour
+
+// recordSent logs a message this CLI sent, for undo. Failures only warn: the
+// message is already out.
+func recordSent(command, chatJID string, resp whatsmeow.SendResponse) {
+	if messageDB == nil {
+		if err := initMessageDB(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record sent message: %v\n", err)
+			return
+		}
+	}
+	if _, err := messageDB.Exec(`
+		INSERT OR REPLACE INTO sent_messages (id, chat_jid, command, timestamp) VALUES (?, ?, ?, ?)
+	`, resp.ID, chatJID, command, resp.Timestamp.Unix()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record sent message: %v\n", err)
+	}
+}
+
+// cmdUndo revokes (deletes for everyone) the most recent message sent with
+// this CLI, if it's still within WhatsApp's deletion window.
+// Usage: undo [--dry-run]
+func cmdUndo(args []string) error {
+	dryRun := false
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			dryRun = true
+		} else {
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	var msgID, chatJID, command string
+	var sentAt int64
+	err := messageDB.QueryRow(`
+		SELECT id, chat_jid, command, timestamp FROM sent_messages
+		WHERE revoked_at IS NULL
+		ORDER BY timestamp DESC, rowid DESC LIMIT 1
+	`).Scan(&msgID, &chatJID, &command, &sentAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no sent message to undo")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query sent messages: %w", err)
+	}
+
+	age := time.Since(time.Unix(sentAt, 0))
+	if age > revokeWindow {
+		return fmt.Errorf("last sent message %s is %s old, past WhatsApp's %s deletion window",
+			msgID, age.Round(time.Minute), revokeWindow)
+	}
+
+	output := map[string]any{
+		"id":        msgID,
+		"chat_jid":  chatJID,
+		"chat_name": chatDisplayName(chatJID),
+		"command":   command,
+		"timestamp": sentAt,
+	}
+	if dryRun {
+		output["dry_run"] = true
+		return printJSON(output)
+	}
+
+	jid, err := parseJID(chatJID)
+	if err != nil {
+		return err
+	}
+	if err := checkProfileSend(jid); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if _, err := client.RevokeMessage(ctx, jid, msgID); err != nil {
+		return fmt.Errorf("failed to revoke message: %w", err)
+	}
+
+	now := time.Now().Unix()
+	if _, err := messageDB.Exec(`UPDATE sent_messages SET revoked_at = ? WHERE id = ? AND chat_jid = ?`, now, msgID, chatJID); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record revoke: %v\n", err)
+	}
+	// Show the local copy the way a received delete looks
+	if _, err := messageDB.Exec(`
+		UPDATE messages SET text = '[Message deleted]', search_text = '[message deleted]', media_type = 'deleted'
+		WHERE id = ? AND chat_jid = ?
+	`, msgID, canonicalJID(normalizeJID(chatJID))); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update local message: %v\n", err)
+	}
+
+	output["success"] = true
+	output["revoked_at"] = now
+	return printJSON(output)
+}
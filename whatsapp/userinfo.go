@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// cmdUserInfo shows a contact's about text, devices, verified business name
+// and profile picture ID. The first lookup asks WhatsApp and stores the result
+// in contacts; later ones are answered locally unless --refresh is passed.
+// Usage: user-info <phone-or-jid> [--refresh]
+func cmdUserInfo(args []string) error {
+	var target string
+	refresh := false
+	for _, arg := range args {
+		switch {
+		case arg == "--refresh":
+			refresh = true
+		case target == "":
+			target = arg
+		default:
+			return fmt.Errorf("unexpected argument: %s", arg)
+		}
+	}
+	if target == "" {
+		return fmt.Errorf("usage: user-info <phone> [--refresh]")
+	}
+	jid, err := parseJID(target)
+	if err != nil {
+		return err
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return fmt.Errorf("user-info takes a phone number or user JID, not %s", jid)
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+
+	if !refresh {
+		output, ok, err := cachedUserInfo(jid.String())
+		if err != nil {
+			return err
+		}
+		if ok {
+			return printJSON(output)
+		}
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	infos, err := client.GetUserInfo(ctx, []types.JID{jid})
+	if err != nil {
+		return fmt.Errorf("failed to get user info: %w", err)
+	}
+	info, ok := infos[jid]
+	if !ok {
+		return fmt.Errorf("%s is not on WhatsApp", jid)
+	}
+	if err := saveUserInfo(jid.String(), info); err != nil {
+		return fmt.Errorf("failed to save user info: %w", err)
+	}
+
+	output, _, err := cachedUserInfo(jid.String())
+	if err != nil {
+		return err
+	}
+	return printJSON(output)
+}
+
+// saveUserInfo stores what GetUserInfo returned for a contact, leaving its
+// name and push name alone.
+func saveUserInfo(jid string, info types.UserInfo) error {
+	devices := make([]string, len(info.Devices))
+	for i, d := range info.Devices {
+		devices[i] = d.String()
+	}
+	var verifiedName string
+	if info.VerifiedName != nil && info.VerifiedName.Details != nil {
+		verifiedName = info.VerifiedName.Details.GetVerifiedName()
+	}
+	now := time.Now().Unix()
+	_, err := messageDB.Exec(`
+		INSERT INTO contacts (jid, name, push_name, about, devices, verified_name, picture_id, lid, info_updated_at, updated_at)
+		VALUES (?, '', '', ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(jid) DO UPDATE SET
+			about = excluded.about,
+			devices = excluded.devices,
+			verified_name = excluded.verified_name,
+			picture_id = excluded.picture_id,
+			lid = excluded.lid,
+			info_updated_at = excluded.info_updated_at
+	`, normalizeJID(jid), info.Status, strings.Join(devices, ","), verifiedName, info.PictureID,
+		jidString(info.LID), now, now)
+	return err
+}
+
+// cachedUserInfo reads a contact's stored user info. ok is false if user-info
+// has never looked the contact up.
+func cachedUserInfo(jid string) (map[string]any, bool, error) {
+	var name, pushName, about, devices, verifiedName, pictureID, lid string
+	var lookedUp sql.NullInt64
+	err := messageDB.QueryRow(`
+		SELECT COALESCE(name, ''), COALESCE(push_name, ''), COALESCE(about, ''), COALESCE(devices, ''),
+			COALESCE(verified_name, ''), COALESCE(picture_id, ''), COALESCE(lid, ''), info_updated_at
+		FROM contacts WHERE jid = ?
+	`, normalizeJID(jid)).Scan(&name, &pushName, &about, &devices, &verifiedName, &pictureID, &lid, &lookedUp)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !lookedUp.Valid) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query contact: %w", err)
+	}
+
+	deviceList := []string{}
+	if devices != "" {
+		deviceList = strings.Split(devices, ",")
+	}
+	output := map[string]any{
+		"jid":          normalizeJID(jid),
+		"about":        about,
+		"devices":      deviceList,
+		"looked_up_at": lookedUp.Int64,
+	}
+	if name != "" {
+		output["name"] = name
+	}
+	if pushName != "" {
+		output["push_name"] = pushName
+	}
+	if verifiedName != "" {
+		output["verified_name"] = verifiedName
+	}
+	if pictureID != "" {
+		output["picture_id"] = pictureID
+	}
+	if lid != "" {
+		output["lid"] = lid
+	}
+	return output, true, nil
+}
+
+// cmdCheck reports which phone numbers are registered on WhatsApp and the JID
+// each one uses, so a bulk send can be checked before it goes out.
+// Usage: check <phone>...
+func cmdCheck(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: check <phone>...")
+	}
+	queries := make([]string, len(args))
+	for i, arg := range args {
+		jid, err := parseJID(arg)
+		if err != nil {
+			return err
+		}
+		if jid.Server != types.DefaultUserServer {
+			return fmt.Errorf("check takes phone numbers, not %s", arg)
+		}
+		queries[i] = "+" + jid.User
+	}
+
+	ctx := context.Background()
+	if err := connectClient(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	responses, err := client.IsOnWhatsApp(ctx, queries)
+	if err != nil {
+		return fmt.Errorf("failed to check numbers: %w", err)
+	}
+	byQuery := make(map[string]types.IsOnWhatsAppResponse, len(responses))
+	for _, r := range responses {
+		byQuery[r.Query] = r
+	}
+
+	results := make([]map[string]any, 0, len(args))
+	registered := 0
+	for i, arg := range args {
+		r := byQuery[queries[i]]
+		result := map[string]any{"phone": arg, "registered": r.IsIn}
+		if r.IsIn {
+			registered++
+			result["jid"] = r.JID.String()
+			if r.VerifiedName != nil && r.VerifiedName.Details != nil {
+				result["verified_name"] = r.VerifiedName.Details.GetVerifiedName()
+			}
+		}
+		results = append(results, result)
+	}
+	return printJSON(map[string]any{
+		"registered":     registered,
+		"not_registered": len(args) - registered,
+		"results":        results,
+	})
+}
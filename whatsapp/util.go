@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -96,6 +97,45 @@ func lookupContactByName(name string) (string, error) {
 	return phone, nil
 }
 
+// messageKey identifies a stored message. IDs are only unique within a chat.
+type messageKey struct {
+	ID      string `json:"id"`
+	ChatJID string `json:"chat_jid"`
+}
+
+// resolveMessageChat returns the chat holding messageID. If chatJID is given it
+// is used as-is (normalized, and merged as by contacts merge); otherwise the ID
+// must be unambiguous.
+func resolveMessageChat(messageID, chatJID string) (string, error) {
+	if chatJID != "" {
+		return canonicalJID(normalizeJID(chatJID)), nil
+	}
+	rows, err := messageDB.Query(`SELECT DISTINCT chat_jid FROM messages WHERE id = ?`, messageID)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up message: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var chats []string
+	for rows.Next() {
+		var jid string
+		if err := rows.Scan(&jid); err != nil {
+			return "", fmt.Errorf("failed to scan row: %w", err)
+		}
+		chats = append(chats, jid)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	switch len(chats) {
+	case 0:
+		return "", fmt.Errorf("message not found: %s", messageID)
+	case 1:
+		return chats[0], nil
+	default:
+		return "", fmt.Errorf("message ID %s exists in several chats (%s); pass --chat=JID", messageID, strings.Join(chats, ", "))
+	}
+}
+
 // getQuotedContext retrieves context info for replying to a specific message
 func getQuotedContext(messageID, chatJID string) (*waE2E.ContextInfo, error) {
 	// Look up the message in the database
@@ -191,6 +231,23 @@ func getChatName(ctx context.Context, chatJID string, isGroup bool) string {
 	return name
 }
 
+// chatDisplayName returns the best local name for a chat: the chat name, then
+// (for DMs) the contact's name or push name. Returns "" if none is known.
+func chatDisplayName(chatJID string) string {
+	var name string
+	_ = messageDB.QueryRow(`
+		SELECT
+			CASE
+				WHEN c.is_group = 1 THEN COALESCE(NULLIF(c.name, ''), '')
+				ELSE COALESCE(NULLIF(c.name, ''), ct.name, ct.push_name, '')
+			END
+		FROM (SELECT ? AS jid) j
+		LEFT JOIN chats c ON c.jid = j.jid
+		LEFT JOIN contacts ct ON ct.jid = j.jid
+	`, chatJID).Scan(&name)
+	return name
+}
+
 // getExtensionFromMime returns a file extension for a MIME type
 func getExtensionFromMime(mimeType string) string {
 	switch mimeType {
@@ -260,6 +317,31 @@ func openFile(path string) {
 	}
 }
 
+// normalizeJID returns the canonical stored form of a JID: device and agent
+// suffixes stripped ("1234:12@s.whatsapp.net" -> "1234@s.whatsapp.net") and the
+// server lowercased, so the same chat or person always matches in JOINs.
+func normalizeJID(jid string) string {
+	at := strings.LastIndex(jid, "@")
+	if at < 0 {
+		return jid
+	}
+	jid = jid[:at] + "@" + strings.ToLower(jid[at+1:])
+	parsed, err := types.ParseJID(jid)
+	if err != nil {
+		return jid
+	}
+	return parsed.ToNonAD().String()
+}
+
+// exitCodeError makes main exit with a specific code instead of 1.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
 func boolToInt(b bool) int {
 	if b {
 		return 1
@@ -268,6 +350,9 @@ func boolToInt(b bool) int {
 }
 
 func printJSON(v any) error {
+	if outputFile != "" {
+		return writeOutputFile(outputFile, v)
+	}
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	return enc.Encode(v)
@@ -345,6 +430,101 @@ func getLastMessageTime() int64 {
 	return 0
 }
 
+// timestampLayouts are the local-time formats parseTimestamp accepts besides
+// RFC 3339.
+var timestampLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseTimestamp parses a point in time given as Unix seconds, RFC 3339, or a
+// local date and time such as 2006-01-02T15:04.
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use Unix seconds, RFC 3339, or 2006-01-02T15:04)", s)
+}
+
+// parseTimeBound parses the bound of a time-range filter such as --since: a
+// point in time as parseTimestamp accepts, or an age (24h, 7d) before now.
+func parseTimeBound(s string) (time.Time, error) {
+	if t, err := parseTimestamp(s); err == nil {
+		return t, nil
+	}
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339, 2006-01-02T15:04, or an age like 24h or 7d)", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// parseAge parses an age such as "90d", "12w", "2y", or any Go duration ("36h").
+// Days, weeks, and years are fixed lengths (24h, 7d, 365d); exact calendar
+// arithmetic doesn't matter for retention windows and relative filters.
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	case 'y':
+		unit = 365 * 24 * time.Hour
+	}
+	if unit != 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q (use e.g. 24h, 7d, 2y)", s)
+	}
+	return d, nil
+}
+
+// parseSize parses a byte size such as "20MB", "512K", "1.5GB", or "1000".
+// Units are binary (1KB = 1024 bytes), matching how file managers show sizes.
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GB", 1 << 30}, {"G", 1 << 30},
+		{"MB", 1 << 20}, {"M", 1 << 20},
+		{"KB", 1 << 10}, {"K", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			multiplier = u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 20MB, 512KB)", size)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
 // currentUnixTime returns the current Unix timestamp.
 func currentUnixTime() int64 {
 	return time.Now().Unix()
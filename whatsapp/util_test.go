@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"1700000000", time.Unix(1700000000, 0), false},
+		{" 1700000000 ", time.Unix(1700000000, 0), false},
+		{"2024-03-01T12:30:00Z", time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), false},
+		{"2024-03-01T12:30:00+02:00", time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), false},
+		{"2024-03-01T12:30", time.Date(2024, 3, 1, 12, 30, 0, 0, time.Local), false},
+		{"2024-03-01 12:30:15", time.Date(2024, 3, 1, 12, 30, 15, 0, time.Local), false},
+		{"2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local), false},
+		{"yesterday", time.Time{}, true},
+		{"24h", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTimestamp(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTimestamp(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	got, err := parseTimeBound("2024-03-01")
+	if err != nil || !got.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("parseTimeBound(2024-03-01) = %v, %v", got, err)
+	}
+
+	// Ages count back from now
+	for in, age := range map[string]time.Duration{"24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "90m": 90 * time.Minute} {
+		before := time.Now()
+		got, err := parseTimeBound(in)
+		after := time.Now()
+		if err != nil {
+			t.Errorf("parseTimeBound(%q) error = %v", in, err)
+			continue
+		}
+		if got.Before(before.Add(-age)) || got.After(after.Add(-age)) {
+			t.Errorf("parseTimeBound(%q) = %v, want about %v", in, got, before.Add(-age))
+		}
+	}
+
+	for _, in := range []string{"", "last week", "-7d"} {
+		if _, err := parseTimeBound(in); err == nil {
+			t.Errorf("parseTimeBound(%q) accepted an invalid bound", in)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90d", 90 * day, false},
+		{"12w", 12 * 7 * day, false},
+		{"2y", 2 * 365 * day, false},
+		{"36h", 36 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{" 0d ", 0, false},
+		{"", 0, true},
+		{"d", 0, true},
+		{"-3d", 0, true},
+		{"-1h", 0, true},
+		{"1.5d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAge(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAge(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeJID(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"12025551234@s.whatsapp.net", "12025551234@s.whatsapp.net"},
+		{"12025551234:12@s.whatsapp.net", "12025551234@s.whatsapp.net"},
+		{"12025551234.0:3@S.WhatsApp.Net", "12025551234@s.whatsapp.net"},
+		{"120363277025153496@G.US", "120363277025153496@g.us"},
+		{"123456789:4@lid", "123456789@lid"},
+		{"status@broadcast", "status@broadcast"},
+		{"not a jid", "not a jid"},
+	}
+	for _, tt := range tests {
+		if got := normalizeJID(tt.in); got != tt.want {
+			t.Errorf("normalizeJID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolveMessageChat(t *testing.T) {
+	openTestDB(t)
+	alice, team := "12025551234@s.whatsapp.net", "120363277025153496@g.us"
+	// The same ID in two chats is two messages
+	insertTestMessage(t, "shared", alice, 100, "")
+	insertTestMessage(t, "shared", team, 200, "")
+	insertTestMessage(t, "only", alice, 300, "")
+
+	if got, err := resolveMessageChat("only", ""); err != nil || got != alice {
+		t.Errorf("resolveMessageChat(only) = %q, %v; want %q", got, err, alice)
+	}
+	if _, err := resolveMessageChat("shared", ""); err == nil || !strings.Contains(err.Error(), "--chat") {
+		t.Errorf("resolveMessageChat(shared) error = %v, want one asking for --chat", err)
+	}
+	if got, err := resolveMessageChat("shared", "120363277025153496@G.US"); err != nil || got != team {
+		t.Errorf("resolveMessageChat(shared, team) = %q, %v; want %q", got, err, team)
+	}
+	if _, err := resolveMessageChat("missing", ""); err == nil {
+		t.Error("resolveMessageChat(missing) succeeded")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1000", 1000, false},
+		{"512K", 512 << 10, false},
+		{"512kb", 512 << 10, false},
+		{"20MB", 20 << 20, false},
+		{"20 MB", 20 << 20, false},
+		{"1.5GB", 3 << 29, false},
+		{"100B", 100, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-5MB", 0, true},
+		{"lots", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
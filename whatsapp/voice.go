@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// voiceNoteMimeType is the only format WhatsApp plays as a voice note.
+	voiceNoteMimeType = "audio/ogg; codecs=opus"
+	// waveformSamples is how many bars WhatsApp draws for a voice note.
+	waveformSamples = 64
+	// waveformSampleRate is the rate audio is decoded at to draw the waveform;
+	// it only needs to be fine enough for 64 bars.
+	waveformSampleRate = 8000
+)
+
+// voiceNote is audio ready to send as a voice note.
+type voiceNote struct {
+	Data     []byte
+	Seconds  uint32
+	Waveform []byte // nil if it couldn't be computed
+}
+
+// prepareVoiceNote converts audio to ogg/opus with ffmpeg and computes its
+// duration and waveform. Without ffmpeg, ogg/opus files are sent as they are,
+// with the duration read from the container and no waveform.
+func prepareVoiceNote(filePath string, data []byte) (*voiceNote, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		seconds, err := oggDuration(data)
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg is needed to convert %s to a voice note (or pass an ogg/opus file)", filepath.Base(filePath))
+		}
+		fmt.Fprintf(os.Stderr, "Warning: ffmpeg not found; sending the voice note without a waveform\n")
+		return &voiceNote{Data: data, Seconds: seconds}, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-v", "error", "-i", filePath, "-vn", "-ac", "1", "-ar", "48000",
+		"-c:a", "libopus", "-b:a", "32k", "-application", "voip", "-f", "ogg", "pipe:1")
+	cmd.Stderr = &stderr
+	converted, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert audio: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	stderr.Reset()
+	cmd = exec.Command(ffmpeg, "-v", "error", "-i", filePath, "-vn", "-ac", "1", "-ar", fmt.Sprint(waveformSampleRate),
+		"-f", "s16le", "pipe:1")
+	cmd.Stderr = &stderr
+	pcm, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audio: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	samples := make([]int16, len(pcm)/2)
+	if err := binary.Read(bytes.NewReader(pcm[:len(samples)*2]), binary.LittleEndian, samples); err != nil {
+		return nil, fmt.Errorf("failed to decode audio: %w", err)
+	}
+	seconds := uint32((len(samples) + waveformSampleRate - 1) / waveformSampleRate)
+	return &voiceNote{Data: converted, Seconds: seconds, Waveform: waveform(samples)}, nil
+}
+
+// waveform reduces samples to the 64 bars WhatsApp shows, each the bucket's
+// mean loudness on a 0-100 scale relative to the loudest bucket.
+func waveform(samples []int16) []byte {
+	if len(samples) == 0 {
+		return nil
+	}
+	means := make([]float64, waveformSamples)
+	peak := 0.0
+	for i := range means {
+		start := i * len(samples) / waveformSamples
+		end := (i + 1) * len(samples) / waveformSamples
+		if end == start {
+			end = start + 1
+			if end > len(samples) {
+				break
+			}
+		}
+		sum := 0.0
+		for _, s := range samples[start:end] {
+			if s < 0 {
+				sum -= float64(s)
+			} else {
+				sum += float64(s)
+			}
+		}
+		means[i] = sum / float64(end-start)
+		if means[i] > peak {
+			peak = means[i]
+		}
+	}
+	bars := make([]byte, waveformSamples)
+	if peak == 0 {
+		return bars
+	}
+	for i, m := range means {
+		bars[i] = byte(m / peak * 100)
+	}
+	return bars
+}
+
+// oggDuration reads an ogg/opus file's length in seconds from the granule
+// position of its last page, which counts 48kHz samples.
+func oggDuration(data []byte) (uint32, error) {
+	if !bytes.HasPrefix(data, []byte("OggS")) || !bytes.Contains(data[:min(len(data), 64)], []byte("OpusHead")) {
+		return 0, fmt.Errorf("not an ogg/opus file")
+	}
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last+14 > len(data) {
+		return 0, fmt.Errorf("truncated ogg file")
+	}
+	granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+	return uint32((granule + 47999) / 48000), nil
+}
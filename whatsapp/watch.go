@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// cmdWatch stays connected and prints each incoming message to stdout as one
+// JSON object per line, as it arrives. Messages are saved like sync saves them.
+// Usage: watch [--chat <jid>] [--from <jid>]
+func cmdWatch(args []string) error {
+	var chatFilter, fromFilter string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("usage: watch [--chat <jid>] [--from <jid>]")
+			}
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "--chat", "--from":
+			jid, err := parseJID(value)
+			if err != nil {
+				return err
+			}
+			if name == "--chat" {
+				chatFilter = jid.String()
+			} else {
+				fromFilter = jid.String()
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+	}
+
+	ctx := context.Background()
+	if err := initClient(ctx); err != nil {
+		return err
+	}
+	if err := initMessageDB(); err != nil {
+		return err
+	}
+	if client.Store.ID == nil {
+		return fmt.Errorf("not authenticated. Run 'auth' first")
+	}
+	// Aliases resolve against the DB, so filters are canonicalized after it's open
+	if chatFilter != "" {
+		chatFilter = canonicalJID(normalizeJID(chatFilter))
+	}
+	if fromFilter != "" {
+		fromFilter = canonicalJID(normalizeJID(fromFilter))
+	}
+
+	var messageCount atomic.Int64
+	var mu sync.Mutex
+	enc := json.NewEncoder(os.Stdout)
+	client.AddEventHandler(syncEventHandler(ctx, &messageCount))
+	client.AddEventHandler(func(evt interface{}) {
+		v, ok := evt.(*events.Message)
+		if !ok {
+			return
+		}
+		n, ok := messageNotification(v)
+		if !ok || (chatFilter != "" && n.ChatJID != chatFilter) || (fromFilter != "" && n.SenderJID != fromFilter) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(n); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write message: %v\n", err)
+		}
+	})
+
+	ended := watchSessionEnd()
+
+	// Desktop notifications follow the daemon's rules, so those apply here too
+	if installDesktopNotifier() {
+		rules, err := loadRules()
+		if err != nil {
+			return err
+		}
+		client.AddEventHandler(notificationHandler(rules))
+	}
+
+	if err := connectSession(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Disconnect()
+	announcePresence(ctx)
+
+	fmt.Fprintln(os.Stderr, "Watching for messages. Press Ctrl+C to stop.")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sigChan:
+		return nil
+	case err := <-ended:
+		return err
+	}
+}
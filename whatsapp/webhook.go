@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Webhook events, for webhook_events.
+const (
+	webhookMessage  = "message"
+	webhookReceipt  = "receipt"
+	webhookReaction = "reaction"
+	webhookAlert    = "alert"
+)
+
+const (
+	webhookAttempts = 4                // First try plus retries
+	webhookBackoff  = time.Second      // Doubles after each failed attempt
+	webhookTimeout  = 10 * time.Second // Per request
+)
+
+var (
+	webhookClient  = &http.Client{Timeout: webhookTimeout}
+	webhookPending sync.WaitGroup
+)
+
+func webhookWants(event string) bool {
+	if len(cfg.WebhookEvents) == 0 {
+		return event == webhookMessage || event == webhookAlert
+	}
+	return slices.Contains(cfg.WebhookEvents, event)
+}
+
+// installWebhook registers the configured webhook, if any, and reports whether
+// it did. Messages reach it as a notifier, so the notification rules apply;
+// receipts and reactions, which the rules don't cover, come from their own
+// event handler.
+func installWebhook() bool {
+	if cfg.WebhookURL == "" {
+		return false
+	}
+	notifiers = append(notifiers, func(n Notification) {
+		switch {
+		case n.Event == eventMessage && webhookWants(webhookMessage):
+			postWebhook(webhookMessage, n)
+		case n.Event == eventAlert && webhookWants(webhookAlert):
+			postWebhook(webhookAlert, n)
+		}
+	})
+	client.AddEventHandler(webhookEventHandler)
+	return true
+}
+
+func webhookEventHandler(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Receipt:
+		if payload, ok := receiptPayload(v); ok && webhookWants(webhookReceipt) {
+			postWebhook(webhookReceipt, payload)
+		}
+	case *events.Message:
+		reaction := v.Message.GetReactionMessage()
+		chatJID := canonicalJID(normalizeJID(v.Info.Chat.String()))
+		if reaction == nil || !webhookWants(webhookReaction) || !chatSynced(chatJID) {
+			return
+		}
+		postWebhook(webhookReaction, map[string]any{
+			"event":      webhookReaction,
+			"chat_jid":   chatJID,
+			"sender_jid": canonicalJID(normalizeJID(v.Info.Sender.String())),
+			"is_from_me": v.Info.IsFromMe,
+			"message_id": reaction.GetKey().GetID(),
+			"emoji":      reaction.GetText(), // Empty when a reaction is removed
+			"timestamp":  v.Info.Timestamp.Unix(),
+		})
+	}
+}
+
+// receiptPayload describes a receipt for webhooks and hooks. It returns false
+// for receipt types we don't track and chats sync doesn't save.
+func receiptPayload(v *events.Receipt) (map[string]any, bool) {
+	receiptType := receiptTypeName(v.Type)
+	chatJID := canonicalJID(normalizeJID(v.Chat.String()))
+	if receiptType == "" || !chatSynced(chatJID) {
+		return nil, false
+	}
+	return map[string]any{
+		"event":           webhookReceipt,
+		"chat_jid":        chatJID,
+		"participant_jid": canonicalJID(normalizeJID(v.Sender.String())),
+		"message_ids":     v.MessageIDs,
+		"type":            receiptType,
+		"timestamp":       v.Timestamp.Unix(),
+	}, true
+}
+
+// postWebhook delivers payload in the background, retrying with backoff on
+// network errors and 5xx responses. With webhook_secret set, the body is signed
+// with HMAC-SHA256 in X-Signature-256 ("sha256=<hex>").
+func postWebhook(event string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to encode webhook payload: %v\n", err)
+		return
+	}
+	webhookPending.Add(1)
+	go func() {
+		defer webhookPending.Done()
+		backoff := webhookBackoff
+		for attempt := 1; ; attempt++ {
+			err := sendWebhook(event, body)
+			if err == nil {
+				return
+			}
+			if attempt == webhookAttempts {
+				fmt.Fprintf(os.Stderr, "Warning: webhook %s failed after %d attempts: %v\n", event, attempt, err)
+				return
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
+
+func sendWebhook(event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	if cfg.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	if resp.StatusCode >= 400 {
+		// Not retried: the request itself is wrong
+		fmt.Fprintf(os.Stderr, "Warning: webhook %s rejected: %s\n", event, resp.Status)
+	}
+	return nil
+}
+
+// flushWebhooks waits for deliveries still in flight, including retries.
+func flushWebhooks() {
+	webhookPending.Wait()
+}
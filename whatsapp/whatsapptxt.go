@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lrm is the left-to-right mark WhatsApp puts before placeholders like
+// "image omitted", which parsers of its exports use to tell them from text.
+const lrm = "‎"
+
+// Timestamp layouts of WhatsApp's chat exports: whatsapp-txt uses the iOS one,
+// with seconds; txt the [dd/mm/yyyy, hh:mm] one most export parsers expect.
+const (
+	whatsAppTxtTime = "02/01/2006, 15:04:05"
+	plainTxtTime    = "02/01/2006, 15:04"
+)
+
+// omittedLabels are WhatsApp's placeholders for media exported without files.
+var omittedLabels = map[string]string{
+	"image":    "image omitted",
+	"video":    "video omitted",
+	"audio":    "audio omitted",
+	"sticker":  "sticker omitted",
+	"gif":      "GIF omitted",
+	"document": "document omitted",
+	"contact":  "Contact card omitted",
+}
+
+// attachmentKinds name attached files the way WhatsApp does
+// (00000012-PHOTO-2024-01-15-14-03-22.jpg).
+var attachmentKinds = map[string]string{
+	"image":    "PHOTO",
+	"video":    "VIDEO",
+	"audio":    "AUDIO",
+	"sticker":  "STICKER",
+	"gif":      "GIF",
+	"document": "DOCUMENT",
+}
+
+// whatsAppTxtWriter formats exported messages like WhatsApp's own "Export
+// chat": one "[date, time] Name: message" line each, continuation lines as is.
+// With an archive, media files are added to it and referenced as attachments;
+// otherwise they become "<type> omitted" placeholders. layout formats the
+// timestamps.
+type whatsAppTxtWriter struct {
+	w                         io.Writer
+	chatName, ownName, layout string
+	archive                   *zipArchive
+	n                         int
+}
+
+// add writes the next message, oldest first.
+func (t *whatsAppTxtWriter) add(msg map[string]any) error {
+	t.n++
+	ts := time.Unix(msg["timestamp"].(int64), 0)
+	if t.n == 1 {
+		if _, err := fmt.Fprintf(t.w, "[%s] %s: %sMessages and calls are end-to-end encrypted. No one outside of this chat, not even WhatsApp, can read or listen to them.\n",
+			ts.Format(t.layout), t.chatName, lrm); err != nil {
+			return err
+		}
+	}
+
+	name, _ := msg["sender_name"].(string)
+	if msg["is_from_me"] == true && t.ownName != "" {
+		name = t.ownName
+	}
+	if name == "" {
+		name = strings.Split(msg["sender_jid"].(string), "@")[0]
+	}
+	text, _ := msg["text"].(string)
+	mediaType, _ := msg["media_type"].(string)
+	mediaType = strings.TrimPrefix(mediaType, "viewonce_")
+
+	body := text
+	switch mediaType {
+	case "":
+	case "deleted":
+		body = lrm + "This message was deleted."
+	case "poll", "location":
+		// Stored text is the poll question or place; WhatsApp writes those inline
+		body = mediaType + ": " + text
+	default:
+		placeholder := lrm + mediaType + " omitted"
+		if label, ok := omittedLabels[mediaType]; ok {
+			placeholder = lrm + label
+		}
+		if path, ok := msg["media_file_path"].(string); ok && t.archive != nil {
+			kind := attachmentKinds[mediaType]
+			if kind == "" {
+				kind = strings.ToUpper(mediaType)
+			}
+			file := fmt.Sprintf("%08d-%s-%s%s", t.n, kind, ts.Format("2006-01-02-15-04-05"), filepath.Ext(path))
+			found, err := t.archive.addFile(file, path)
+			if err != nil {
+				return err
+			}
+			if found {
+				placeholder = lrm + "<attached: " + file + ">"
+			}
+		}
+		body = placeholder
+		if text != "" {
+			body += "\n" + text
+		}
+	}
+	_, err := fmt.Fprintf(t.w, "[%s] %s: %s\n", ts.Format(t.layout), name, body)
+	return err
+}